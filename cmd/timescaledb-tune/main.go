@@ -4,8 +4,9 @@
 // various groups of settings to make sure they are reasonably set for the
 // machine's resources.
 //
-// The groups of settings deal with memory usage, parallelism, the WAL, and
-// other miscellaneous settings that have been found to be useful when tuning.
+// The groups of settings deal with memory usage, parallelism, the WAL,
+// autovacuum, TimescaleDB itself, streaming replication, and other
+// miscellaneous settings that have been found to be useful when tuning.
 package main
 
 import (
@@ -34,20 +35,49 @@ func init() {
 	flag.StringVar(&f.Memory, "memory", "", "Amount of memory to base recommendations on in the PostgreSQL format <int value><units>, e.g., 4GB. Default is to use all memory")
 	flag.UintVar(&f.NumCPUs, "cpus", 0, "Number of CPU cores to base recommendations on. Default is equal to number of cores")
 	flag.StringVar(&f.PGVersion, "pg-version", "", "Major version of PostgreSQL to base recommendations on. Default is determined via pg_config. Valid values: "+strings.Join(tstune.ValidPGVersions, ", "))
-	flag.StringVar(&f.WALDiskSize, "wal-disk-size", "", "Size of the disk where the WAL resides, in PostgreSQL format <int value><units>, e.g., 4GB. Using this flag helps tune WAL behavior.")
+	flag.StringVar(&f.CgroupRoot, "cgroup-root", tstune.DefaultCgroupRoot, "Path where the cgroup filesystem is mounted, used to detect container memory and CPU limits. Set to blank to disable detection")
+	flag.StringVar(&f.CPURounding, "cpu-rounding", "up", "How to round a fractional CPU limit from a cgroup to a whole number of CPUs. Valid values: "+strings.Join(tstune.ValidCPURoundings, ", "))
+	flag.StringVar(&f.WALDiskSize, "wal-disk-size", "", "Size of the disk where the WAL resides, in PostgreSQL format <int value><units>, e.g., 4GB. Default is the size of the filesystem the WAL directory is on, if it can be found, in which case max_wal_size is kept to at most 16GB. A given size is used as is.")
+	flag.StringVar(&f.Storage, "storage", "", "Kind of storage the data directory is on, used to tune random_page_cost and effective_io_concurrency. Default is to detect it. Valid values: "+strings.Join(pgtune.ValidStorageClasses, ", "))
 	flag.Uint64Var(&f.MaxConns, "max-conns", 0, "Max number of connections for the database. Default is equal to our best recommendation")
-	flag.IntVar(&f.MaxBGWorkers, "max-bg-workers", pgtune.MaxBackgroundWorkersDefault, "Max number of background workers")
+	flag.IntVar(&f.MaxBGWorkers, "max-bg-workers", 0, fmt.Sprintf("Max number of background workers. Default is %d, or enough to run all scheduled TimescaleDB jobs at once with --connect", pgtune.MaxBackgroundWorkersDefault))
 	flag.StringVar(&f.ConfPath, "conf-path", "", "Path to postgresql.conf. If blank, heuristics will be used to find it")
 	flag.StringVar(&f.DestPath, "out-path", "", "Path to write the new configuration file. If blank, will use the same file that is read from")
 	flag.StringVar(&f.PGConfig, "pg-config", "pg_config", "Path to the pg_config binary")
 	flag.BoolVar(&f.YesAlways, "yes", false, "Answer 'yes' to every prompt")
+	flag.BoolVar(&f.PerSetting, "per-setting", false, "Ask about each setting that needs tuning, to accept the recommendation, keep the current value, or enter a value of your own, instead of about each group of settings")
+	flag.StringVar(&f.Answers, "answers", "", "Path to a YAML, JSON, or TOML file answering the prompts: conf_file, shared_libs, and tune as yes or no, groups as a map of settings group to accept or skip, and settings as a map of setting to the value to use instead of the recommendation, and keep as a list of settings to never tune")
+	flag.StringVar(&f.Keep, "keep", "", "Comma-separated list of settings to never tune, e.g., work_mem,max_connections. Settings can also be kept by ending their line in the configuration file with a # tstune:pin comment, or listing them under keep in the profile or answers file")
+	flag.BoolVar(&f.StrictMemory, "strict-memory", false, "Exit with an error instead of a warning when the settings as they will be are expected not to fit in memory, unless the recommended settings would not fit either")
+	flag.BoolVar(&f.NonInteractive, "non-interactive", false, "Never read responses from stdin, and exit with an error on any prompt not answered by --answers or --yes")
 	flag.BoolVar(&f.Quiet, "quiet", false, "Show only the total recommendations at the end")
 	flag.BoolVar(&f.UseColor, "color", true, "Use color in output (works best on dark terminals)")
 	flag.BoolVar(&f.DryRun, "dry-run", false, "Whether to just show the changes without overwriting the configuration file")
+	flag.StringVar(&f.SQLPath, "sql-script", "", "Path to write the accepted changes to as ALTER SYSTEM statements instead of modifying the configuration file. Use - for stdout")
+	flag.StringVar(&f.Format, "format", "text", "Format of the output. With json or yaml, a single document describing the current and recommended settings is printed to stdout and everything else goes to stderr. Valid values: "+strings.Join(tstune.ValidFormats, ", "))
+	flag.BoolVar(&f.Check, "check", false, "Only check whether the configuration file is tuned, without prompting or writing. Exits with 0 if tuned, 1 if settings differ from recommendations, 2 if timescaledb is missing from shared_preload_libraries, and 3 on errors")
+	flag.BoolVar(&f.Diff, "diff", false, "Show the changes to the configuration files as a unified diff on stdout instead of writing them. Implies --dry-run")
+	flag.StringVar(&f.DiffPath, "diff-file", "", "Path to also write the diff to as a patch file, which can be applied with \"patch -p0\" from the directory of postgresql.conf. Refused if a file outside that directory would be changed. Implies --diff")
 	flag.BoolVar(&f.Restore, "restore", false, "Whether to restore a previously made conf file backup")
-	flag.StringVar(&f.Profile, "profile", "", "a specific \"mode\" for tailoring recommendations to a special workload type. If blank or unspecified, a default is used unless the TSTUNE_PROFILE environment variable is set. Valid values: \"promscale\"")
+	flag.StringVar(&f.BackupDir, "backup-dir", "", "Directory to keep backups of the configuration file in. Default is "+tstune.BackupDirName+" in the data directory")
+	flag.UintVar(&f.BackupKeep, "backup-keep", 0, "Number of backups of the configuration file to keep, removing older ones after each new backup. Default is to keep all of them")
+	flag.StringVar(&f.BackupMaxAge, "backup-max-age", "", "Remove backups of the configuration file older than this after each new backup, in PostgreSQL time format with days as the default unit, e.g., 30 or 12h. The newest backup is always kept")
+	flag.StringVar(&f.Connect, "connect", "", "Connection string (URL or key=value pairs) of the running server, used to read the effective value and limits of each setting from pg_settings")
+	flag.StringVar(&f.Apply, "apply", "", "Push the accepted changes to the server given by --connect and reload it, reporting which settings took effect and which need a restart. Valid values: "+strings.Join(tstune.ValidApplyMethods, ", ")+" (write the conf file or use ALTER SYSTEM)")
+	flag.StringVar(&f.Groups, "groups", "", "Comma-separated list of the settings groups to tune, where default stands for the groups tuned when blank. Valid values: "+strings.Join(tstune.ValidGroups, ", "))
+	flag.StringVar(&f.SkipGroups, "skip-groups", "", "Comma-separated list of the settings groups not to tune, taking the same values as --groups")
+	flag.StringVar(&f.Keys, "keys", "", "Comma-separated list of the settings to tune, e.g., wal_buffers,max_wal_size. Default is every setting in the groups being tuned, and groups with none of the settings listed are not tuned")
+	flag.StringVar(&f.SkipKeys, "skip-keys", "", "Comma-separated list of the settings not to tune")
+	flag.StringVar(&f.Role, "role", "", "Part the server plays in streaming replication, used to tune the replication settings. Default is to leave them alone. Valid values: "+strings.Join(pgtune.ValidRoles, ", "))
+	flag.UintVar(&f.Replicas, "replicas", 0, "Number of standbys streaming from the primary, used with --role=primary or --role=standby to size the replication settings")
+	flag.StringVar(&f.Profile, "profile", "", "a specific \"mode\" for tailoring recommendations to a special workload type. If blank or unspecified, a default is used unless the TSTUNE_PROFILE environment variable is set. Valid values: "+strings.Join(pgtune.ValidProfiles, ", "))
+	flag.StringVar(&f.ProfileFile, "profile-file", "", "Path to a YAML, JSON, or TOML file defining a custom profile, which overrides recommendations of a base profile with fixed values or formulas")
 
 	flag.BoolVar(&showVersion, "version", false, "Show the version of this tool")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\n%s\n\nFlags:\n", binName, tstune.CommandUsage)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	// the TSTUNE_PROFILE environment variable overrides the --profile flag if the --profile is blank or unset
@@ -60,6 +90,9 @@ func init() {
 func main() {
 	if showVersion {
 		fmt.Printf("%s %s (%s %s)\n", binName, version, runtime.GOOS, runtime.GOARCH)
+	} else if args := flag.Args(); len(args) > 0 {
+		tuner := tstune.Tuner{}
+		tuner.RunCommand(args, &f, os.Stdin, os.Stdout, os.Stderr)
 	} else {
 		tuner := tstune.Tuner{}
 		tuner.Run(&f, os.Stdin, os.Stdout, os.Stderr)
@@ -3,12 +3,15 @@ module github.com/timescale/timescaledb-tune
 go 1.23
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/fatih/color v1.17.0
+	github.com/lib/pq v1.10.9
 	github.com/pbnjay/memory v0.0.0-20210728143218-7b4eea64cf58
+	golang.org/x/sys v0.25.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	golang.org/x/sys v0.25.0 // indirect
 )
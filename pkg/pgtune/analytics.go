@@ -0,0 +1,154 @@
+package pgtune
+
+import "fmt"
+
+// The analytics profile is for a few heavy queries at a time, such as
+// dashboards aggregating over large time ranges. Those benefit from more
+// memory per sort or hash, using all CPUs for a single query, better
+// statistics, and JIT compilation. The memory for queries is spread across
+// fewer connections, so each gets more of it.
+const (
+	analyticsConnsDivisor             = 2
+	analyticsDefaultCheckpointTimeout = "900" // 15 minutes expressed in seconds
+	analyticsDefaultBgwriterDelay     = "100" // milliseconds
+	analyticsDefaultBgwriterMaxPages  = "200"
+	analyticsStatsTarget              = "500"
+	analyticsJit                      = "on"
+)
+
+// getAnalyticsMaxConns gives a default amount of connections for the
+// analytics profile, which is half the usual amount.
+func getAnalyticsMaxConns(totalMemory uint64) uint64 {
+	conns := getMaxConns(totalMemory) / analyticsConnsDivisor
+	if conns < minMaxConns {
+		return minMaxConns
+	}
+	return conns
+}
+
+// AnalyticsMemoryRecommender gives recommendations for MemoryKeys for the
+// analytics profile. With fewer connections by default, work_mem is larger.
+type AnalyticsMemoryRecommender struct {
+	*MemoryRecommender
+}
+
+// NewAnalyticsMemoryRecommender returns an AnalyticsMemoryRecommender that
+// recommends based on the given number of cpus and system memory
+func NewAnalyticsMemoryRecommender(totalMemory uint64, cpus int, maxConns uint64) *AnalyticsMemoryRecommender {
+	conns := maxConns
+	if conns == 0 {
+		conns = getAnalyticsMaxConns(totalMemory)
+	}
+	return &AnalyticsMemoryRecommender{
+		MemoryRecommender: NewMemoryRecommender(totalMemory, cpus, conns),
+	}
+}
+
+// IsAvailable returns whether this Recommender is usable given the system resources. Always true.
+func (r *AnalyticsMemoryRecommender) IsAvailable() bool {
+	return true
+}
+
+// AnalyticsParallelRecommender gives recommendations for ParallelKeys for the analytics profile
+type AnalyticsParallelRecommender struct {
+	*ParallelRecommender
+}
+
+// NewAnalyticsParallelRecommender returns an AnalyticsParallelRecommender that
+// recommends based on the given number of cpus.
+func NewAnalyticsParallelRecommender(cpus, maxBGWorkers int) *AnalyticsParallelRecommender {
+	return &AnalyticsParallelRecommender{NewParallelRecommender(cpus, maxBGWorkers)}
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *AnalyticsParallelRecommender) Recommend(key string) string {
+	val := r.ParallelRecommender.Recommend(key)
+	if key == MaxParallelWorkersGatherKey {
+		// a single query can use all of the parallel workers
+		val = fmt.Sprintf("%d", r.cpus)
+	}
+	return val
+}
+
+// AnalyticsWALRecommender gives recommendations for WALKeys for the analytics profile
+type AnalyticsWALRecommender struct {
+	WALRecommender
+}
+
+// NewAnalyticsWALRecommender returns an AnalyticsWALRecommender that
+// recommends based on the given totalMemory bytes.
+func NewAnalyticsWALRecommender(totalMemory, walDiskSize uint64) *AnalyticsWALRecommender {
+	return &AnalyticsWALRecommender{
+		WALRecommender: WALRecommender{
+			totalMemory: totalMemory,
+			walDiskSize: walDiskSize,
+		},
+	}
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *AnalyticsWALRecommender) Recommend(key string) string {
+	switch key {
+	case CheckpointTimeoutKey:
+		// spread out the bursts of writes from refreshing continuous aggregates
+		return analyticsDefaultCheckpointTimeout
+	default:
+		return r.WALRecommender.Recommend(key)
+	}
+}
+
+// AnalyticsBgwriterRecommender gives recommendations for BgwriterKeys for the
+// analytics profile. Writes come in bursts, so the background writer only
+// needs to be a little more active than usual.
+type AnalyticsBgwriterRecommender struct{}
+
+// IsAvailable returns whether this Recommender is usable given the system resources. Always true.
+func (r *AnalyticsBgwriterRecommender) IsAvailable() bool {
+	return true
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *AnalyticsBgwriterRecommender) Recommend(key string) string {
+	switch key {
+	case BgwriterDelayKey:
+		return analyticsDefaultBgwriterDelay
+	case BgwriterLRUMaxPagesKey:
+		return analyticsDefaultBgwriterMaxPages
+	default:
+		return NoRecommendation
+	}
+}
+
+// AnalyticsMiscRecommender gives recommendations for MiscKeys for the analytics profile
+type AnalyticsMiscRecommender struct {
+	*MiscRecommender
+}
+
+// NewAnalyticsMiscRecommender returns an AnalyticsMiscRecommender.
+func NewAnalyticsMiscRecommender(totalMemory, maxConns uint64, pgMajorVersion string) *AnalyticsMiscRecommender {
+	return &AnalyticsMiscRecommender{NewMiscRecommender(totalMemory, maxConns, pgMajorVersion)}
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *AnalyticsMiscRecommender) Recommend(key string) string {
+	val := r.MiscRecommender.Recommend(key)
+	switch key {
+	case MaxConnectionsKey:
+		if r.maxConns == 0 {
+			return fmt.Sprintf("%d", getAnalyticsMaxConns(r.totalMemory))
+		}
+	case StatsTargetKey:
+		return analyticsStatsTarget
+	case Jit:
+		// long running queries make up for the cost of compiling, but only
+		// recommend it where jit is recommended at all
+		if val != NoRecommendation {
+			return analyticsJit
+		}
+	}
+	return val
+}
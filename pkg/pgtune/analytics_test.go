@@ -0,0 +1,182 @@
+package pgtune
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+var (
+	// analyticsMemorySettingsMatrix stores the test cases for
+	// AnalyticsMemoryRecommender along with the expected values
+	analyticsMemorySettingsMatrix = newMemorySettingsMatrix(defaultMemoryToBaseVals, MaxConnectionsDefault/analyticsConnsDivisor, func(wm uint64) uint64 {
+		return wm
+	})
+	// analyticsParallelSettingsMatrix stores the test cases for
+	// AnalyticsParallelRecommender along with the expected values
+	analyticsParallelSettingsMatrix = newParallelSettingsMatrix(map[int]string{2: "2", 4: "4", 5: "5"})
+	// analyticsWALSettingsMatrix stores the test cases for
+	// AnalyticsWALRecommender along with the expected values
+	analyticsWALSettingsMatrix = newWALSettingsMatrix(memoryToWALBuffers, walDiskToMaxBytes, analyticsDefaultCheckpointTimeout, NoRecommendation)
+)
+
+func TestAnalyticsMemoryRecommenderRecommend(t *testing.T) {
+	for totalMemory, cpuMatrix := range analyticsMemorySettingsMatrix {
+		for cpus, connMatrix := range cpuMatrix {
+			for conns, cases := range connMatrix {
+				r := NewAnalyticsMemoryRecommender(totalMemory, cpus, conns)
+				if !r.IsAvailable() {
+					t.Errorf("unexpectedly not available")
+				}
+				testRecommender(t, r, MemoryKeys, cases)
+			}
+		}
+	}
+}
+
+func TestAnalyticsMemorySettingsGroup(t *testing.T) {
+	for totalMemory, cpuMatrix := range analyticsMemorySettingsMatrix {
+		for cpus, connMatrix := range cpuMatrix {
+			for conns, matrix := range connMatrix {
+				config := getDefaultTestSystemConfig(t)
+				config.CPUs = cpus
+				config.Memory = totalMemory
+				config.maxConns = conns
+
+				sg := mustGetSettingsGroup(t, MemoryLabel, config)
+				testSettingGroup(t, sg, AnalyticsProfile, matrix, MemoryLabel, MemoryKeys)
+			}
+		}
+	}
+}
+
+func TestAnalyticsParallelRecommenderRecommend(t *testing.T) {
+	for cpus, tempMatrix := range analyticsParallelSettingsMatrix {
+		for workers, matrix := range tempMatrix {
+			r := NewAnalyticsParallelRecommender(cpus, workers)
+			testRecommender(t, r, ParallelKeys, matrix)
+		}
+	}
+}
+
+func TestAnalyticsParallelSettingsGroup(t *testing.T) {
+	for cpus, tempMatrix := range analyticsParallelSettingsMatrix {
+		for workers, matrix := range tempMatrix {
+			config := getDefaultTestSystemConfig(t)
+			config.CPUs = cpus
+			config.PGMajorVersion = pgutils.MajorVersion11
+			config.MaxBGWorkers = workers
+			sg := mustGetSettingsGroup(t, ParallelLabel, config)
+			testSettingGroup(t, sg, AnalyticsProfile, matrix, ParallelLabel, ParallelKeys)
+		}
+	}
+}
+
+func TestAnalyticsWALRecommenderRecommend(t *testing.T) {
+	for totalMemory, outerMatrix := range analyticsWALSettingsMatrix {
+		for walSize, matrix := range outerMatrix {
+			r := NewAnalyticsWALRecommender(totalMemory, walSize)
+			testRecommender(t, r, WALKeys, matrix)
+		}
+	}
+}
+
+func TestAnalyticsWALSettingsGroup(t *testing.T) {
+	for totalMemory, outerMatrix := range analyticsWALSettingsMatrix {
+		for walSize, matrix := range outerMatrix {
+			config := getDefaultTestSystemConfig(t)
+			config.Memory = totalMemory
+			config.WALDiskSize = walSize
+			sg := mustGetSettingsGroup(t, WALLabel, config)
+			testSettingGroup(t, sg, AnalyticsProfile, matrix, WALLabel, WALKeys)
+		}
+	}
+}
+
+func TestAnalyticsBgwriterRecommender(t *testing.T) {
+	r := &AnalyticsBgwriterRecommender{}
+	if !r.IsAvailable() {
+		t.Error("AnalyticsBgwriterRecommender should always be available")
+	}
+	testRecommender(t, r, BgwriterKeys, map[string]string{
+		BgwriterFlushAfterKey:    NoRecommendation,
+		BgwriterDelayKey:         analyticsDefaultBgwriterDelay,
+		BgwriterLRUMaxPagesKey:   analyticsDefaultBgwriterMaxPages,
+		BgwriterLRUMultiplierKey: NoRecommendation,
+	})
+}
+
+func TestAnalyticsMiscRecommenderRecommend(t *testing.T) {
+	cases := []struct {
+		pgVersion string
+		wantJit   string
+	}{
+		{pgutils.MajorVersion10, NoRecommendation},
+		{pgutils.MajorVersion12, analyticsJit},
+		{pgutils.MajorVersion15, analyticsJit},
+	}
+
+	for _, c := range cases {
+		config, err := NewSystemConfig(8*parse.Gigabyte, 8, c.pgVersion, walDiskUnset, 0, MaxBackgroundWorkersDefault)
+		if err != nil {
+			t.Fatalf("unexpected error on system config creation: got %v", err)
+		}
+		r := mustGetSettingsGroup(t, MiscLabel, config).GetRecommender(AnalyticsProfile)
+		if got := r.Recommend(StatsTargetKey); got != analyticsStatsTarget {
+			t.Errorf("%s: incorrect %s: got %s want %s", c.pgVersion, StatsTargetKey, got, analyticsStatsTarget)
+		}
+		if got := r.Recommend(Jit); got != c.wantJit {
+			t.Errorf("%s: incorrect %s: got %s want %s", c.pgVersion, Jit, got, c.wantJit)
+		}
+
+		// everything else is the same as the default profile
+		base := mustGetSettingsGroup(t, MiscLabel, config).GetRecommender(DefaultProfile)
+		for _, k := range MiscKeys {
+			if k == StatsTargetKey || k == Jit || k == MaxConnectionsKey {
+				continue
+			}
+			if got, want := r.Recommend(k), base.Recommend(k); got != want {
+				t.Errorf("%s: incorrect %s: got %s want %s", c.pgVersion, k, got, want)
+			}
+		}
+	}
+}
+
+func TestAnalyticsMiscRecommenderMaxConns(t *testing.T) {
+	cases := []struct {
+		desc        string
+		totalMemory uint64
+		maxConns    uint64
+		want        string
+	}{
+		{
+			desc:        "half the default conns",
+			totalMemory: 8 * parse.Gigabyte,
+			want:        fmt.Sprintf("%d", MaxConnectionsDefault/2),
+		},
+		{
+			desc:        "half the default conns, not below the minimum",
+			totalMemory: 2 * parse.Gigabyte,
+			want:        fmt.Sprintf("%d", minMaxConns),
+		},
+		{
+			desc:        "given conns",
+			totalMemory: 8 * parse.Gigabyte,
+			maxConns:    200,
+			want:        "200",
+		},
+	}
+
+	for _, c := range cases {
+		config, err := NewSystemConfig(c.totalMemory, 8, pgutils.MajorVersion12, walDiskUnset, c.maxConns, MaxBackgroundWorkersDefault)
+		if err != nil {
+			t.Fatalf("unexpected error on system config creation: got %v", err)
+		}
+		r := mustGetSettingsGroup(t, MiscLabel, config).GetRecommender(AnalyticsProfile)
+		if got := r.Recommend(MaxConnectionsKey); got != c.want {
+			t.Errorf("%s: incorrect %s: got %s want %s", c.desc, MaxConnectionsKey, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package pgtune
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+// Keys in the conf file that are tuned related to autovacuum
+const (
+	AutovacuumMaxWorkersKey        = "autovacuum_max_workers"
+	AutovacuumNaptimeKey           = "autovacuum_naptime"
+	AutovacuumCostLimitKey         = "autovacuum_vacuum_cost_limit"
+	AutovacuumCostDelayKey         = "autovacuum_vacuum_cost_delay"
+	AutovacuumWorkMemKey           = "autovacuum_work_mem"
+	AutovacuumScaleFactorKey       = "autovacuum_vacuum_scale_factor"
+	AutovacuumAnalyzeScaleKey      = "autovacuum_analyze_scale_factor"
+	AutovacuumInsertScaleFactorKey = "autovacuum_vacuum_insert_scale_factor" // PG13+
+
+	// Hypertables are made of many chunks, each of which autovacuum has to
+	// get to separately, so there should be enough workers for the chunks
+	// being written to, up to one per CPU.
+	autovacuumMaxWorkersMin  = 3
+	autovacuumMaxWorkersMax  = 10
+	autovacuumNaptimeDefault = "10"
+	// The cost limit is shared by all running workers, so it grows with them
+	// to give each worker a share of I/O that suits the storage.
+	autovacuumCostLimitPerWorkerSSD     = 200
+	autovacuumCostLimitPerWorkerNetwork = 150
+	autovacuumCostLimitPerWorkerHDD     = 100
+	autovacuumCostLimitMax              = 10000 // largest value PostgreSQL accepts
+	autovacuumCostDelayDefault          = "2ms"
+	autovacuumCostDelayHDD              = "10ms"
+	// Autovacuum can use an eighth of memory, split between its workers.
+	// There are only as many workers beyond the minimum as can each get
+	// autovacuumWorkMemMin of that, but the minimum number of workers share
+	// it even when they get less.
+	autovacuumWorkMemDivisor = 8
+	autovacuumWorkMemMin     = 64 * parse.Megabyte
+	autovacuumWorkMemMax     = 1 * parse.Gigabyte // more is not used for dead tuples before PG17
+	// Chunks stop growing once they are no longer written to, so vacuuming and
+	// analyzing sooner than after a fifth of a chunk changes costs little and
+	// keeps statistics and visibility maps of recent chunks current.
+	autovacuumScaleFactorDefault       = "0.05"
+	autovacuumAnalyzeScaleDefault      = "0.02"
+	autovacuumInsertScaleFactorDefault = "0.05"
+
+	// autovacuumDisabled is the value that makes a setting fall back to the
+	// corresponding non-autovacuum setting, e.g., maintenance_work_mem.
+	autovacuumDisabled = "-1"
+)
+
+// AutovacuumLabel is the label used to refer to the autovacuum settings group
+const AutovacuumLabel = "autovacuum"
+
+// AutovacuumKeys is an array of keys that are tunable for autovacuum
+var AutovacuumKeys = []string{
+	AutovacuumMaxWorkersKey,
+	AutovacuumNaptimeKey,
+	AutovacuumCostLimitKey,
+	AutovacuumCostDelayKey,
+	AutovacuumWorkMemKey,
+	AutovacuumScaleFactorKey,
+	AutovacuumAnalyzeScaleKey,
+	AutovacuumInsertScaleFactorKey,
+}
+
+// AutovacuumRecommender gives recommendations for AutovacuumKeys based on
+// system resources.
+type AutovacuumRecommender struct {
+	totalMemory    uint64
+	cpus           int
+	pgMajorVersion string
+	storage        StorageClass
+}
+
+// NewAutovacuumRecommender returns an AutovacuumRecommender that recommends
+// based on the given system resources.
+func NewAutovacuumRecommender(totalMemory uint64, cpus int, pgMajorVersion string, storage StorageClass) *AutovacuumRecommender {
+	return &AutovacuumRecommender{totalMemory, cpus, pgMajorVersion, storage}
+}
+
+// IsAvailable returns whether this Recommender is usable given the system resources. Always true.
+func (r *AutovacuumRecommender) IsAvailable() bool {
+	return true
+}
+
+func (r *AutovacuumRecommender) maxWorkers() uint64 {
+	workers := uint64(r.cpus)
+	if byMemory := r.totalMemory / autovacuumWorkMemDivisor / autovacuumWorkMemMin; workers > byMemory {
+		workers = byMemory
+	}
+	switch {
+	case workers < autovacuumMaxWorkersMin:
+		return autovacuumMaxWorkersMin
+	case workers > autovacuumMaxWorkersMax:
+		return autovacuumMaxWorkersMax
+	default:
+		return workers
+	}
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *AutovacuumRecommender) Recommend(key string) string {
+	switch key {
+	case AutovacuumMaxWorkersKey:
+		return fmt.Sprintf("%d", r.maxWorkers())
+	case AutovacuumNaptimeKey:
+		return autovacuumNaptimeDefault
+	case AutovacuumCostLimitKey:
+		perWorker := uint64(autovacuumCostLimitPerWorkerSSD)
+		switch r.storage {
+		case StorageHDD:
+			perWorker = autovacuumCostLimitPerWorkerHDD
+		case StorageNetwork:
+			perWorker = autovacuumCostLimitPerWorkerNetwork
+		}
+		limit := perWorker * r.maxWorkers()
+		if limit > autovacuumCostLimitMax {
+			limit = autovacuumCostLimitMax
+		}
+		return fmt.Sprintf("%d", limit)
+	case AutovacuumCostDelayKey:
+		if r.storage == StorageHDD {
+			return autovacuumCostDelayHDD
+		}
+		return autovacuumCostDelayDefault
+	case AutovacuumWorkMemKey:
+		// never more than autovacuum's share of memory in all
+		temp := r.totalMemory / autovacuumWorkMemDivisor / r.maxWorkers()
+		if temp > autovacuumWorkMemMax {
+			temp = autovacuumWorkMemMax
+		}
+		return parse.BytesToPGFormat(temp)
+	case AutovacuumScaleFactorKey:
+		return autovacuumScaleFactorDefault
+	case AutovacuumAnalyzeScaleKey:
+		return autovacuumAnalyzeScaleDefault
+	case AutovacuumInsertScaleFactorKey:
+		return getValueForVersion(r.pgMajorVersion, []string{
+			pgutils.MajorVersion96, pgutils.MajorVersion10, pgutils.MajorVersion11, pgutils.MajorVersion12},
+			NoRecommendation, autovacuumInsertScaleFactorDefault,
+		)
+	}
+	return NoRecommendation
+}
+
+// AutovacuumSettingsGroup is the SettingsGroup to represent settings that
+// affect autovacuum.
+type AutovacuumSettingsGroup struct {
+	totalMemory    uint64
+	cpus           int
+	pgMajorVersion string
+	storage        StorageClass
+}
+
+// Label should always return the value AutovacuumLabel.
+func (sg *AutovacuumSettingsGroup) Label() string { return AutovacuumLabel }
+
+// Keys should always return the AutovacuumKeys slice.
+func (sg *AutovacuumSettingsGroup) Keys() []string { return AutovacuumKeys }
+
+// GetRecommender should return a new AutovacuumRecommender.
+func (sg *AutovacuumSettingsGroup) GetRecommender(profile Profile) Recommender {
+	return NewAutovacuumRecommender(sg.totalMemory, sg.cpus, sg.pgMajorVersion, sg.storage)
+}
+
+// AutovacuumFloatParser parses the values of AutovacuumKeys, which are a mix
+// of amounts of memory, times, and plain numbers. Several of them can be -1 to
+// use the value of the corresponding vacuum setting instead, which is parsed
+// as -1 regardless of units.
+type AutovacuumFloatParser struct{}
+
+func (v *AutovacuumFloatParser) ParseFloat(key string, s string) (float64, error) {
+	if strings.TrimSpace(s) == autovacuumDisabled {
+		return -1.0, nil
+	}
+	switch key {
+	case AutovacuumWorkMemKey:
+		bfp := &bytesFloatParser{}
+		return bfp.ParseFloat(key, s)
+	case AutovacuumNaptimeKey:
+		return parseTimeToUnits(s, parse.Seconds, parse.VarTypeInteger)
+	case AutovacuumCostDelayKey:
+		return parseTimeToUnits(s, parse.Milliseconds, parse.VarTypeReal)
+	default:
+		nfp := &numericFloatParser{}
+		return nfp.ParseFloat(key, s)
+	}
+}
+
+// parseTimeToUnits parses s as a time setting of type vt whose default units
+// are units, and returns it in those units.
+func parseTimeToUnits(s string, units parse.TimeUnit, vt parse.VarType) (float64, error) {
+	val, parsedUnits, err := parse.PGFormatToTime(s, units, vt)
+	if err != nil {
+		return val, err
+	}
+	conv, err := parse.TimeConversion(parsedUnits, units)
+	if err != nil {
+		return val, err
+	}
+	return val * conv, nil
+}
@@ -0,0 +1,199 @@
+package pgtune
+
+import (
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+func TestAutovacuumSettingsGroup(t *testing.T) {
+	cases := []struct {
+		desc      string
+		memory    uint64
+		cpus      int
+		pgVersion string
+		storage   StorageClass
+		want      map[string]string
+	}{
+		{
+			desc:      "small SSD host",
+			memory:    2 * parse.Gigabyte,
+			cpus:      1,
+			pgVersion: pgutils.MajorVersion16,
+			storage:   StorageSSD,
+			want: map[string]string{
+				AutovacuumMaxWorkersKey:        "3",
+				AutovacuumNaptimeKey:           autovacuumNaptimeDefault,
+				AutovacuumCostLimitKey:         "600",
+				AutovacuumCostDelayKey:         autovacuumCostDelayDefault,
+				AutovacuumWorkMemKey:           "87381kB",
+				AutovacuumScaleFactorKey:       autovacuumScaleFactorDefault,
+				AutovacuumAnalyzeScaleKey:      autovacuumAnalyzeScaleDefault,
+				AutovacuumInsertScaleFactorKey: autovacuumInsertScaleFactorDefault,
+			},
+		},
+		{
+			desc:      "medium host, unknown storage",
+			memory:    32 * parse.Gigabyte,
+			cpus:      8,
+			pgVersion: pgutils.MajorVersion13,
+			want: map[string]string{
+				AutovacuumMaxWorkersKey:        "8",
+				AutovacuumNaptimeKey:           autovacuumNaptimeDefault,
+				AutovacuumCostLimitKey:         "1600",
+				AutovacuumCostDelayKey:         autovacuumCostDelayDefault,
+				AutovacuumWorkMemKey:           "512MB",
+				AutovacuumScaleFactorKey:       autovacuumScaleFactorDefault,
+				AutovacuumAnalyzeScaleKey:      autovacuumAnalyzeScaleDefault,
+				AutovacuumInsertScaleFactorKey: autovacuumInsertScaleFactorDefault,
+			},
+		},
+		{
+			desc:      "large HDD host, old PG",
+			memory:    256 * parse.Gigabyte,
+			cpus:      64,
+			pgVersion: pgutils.MajorVersion12,
+			storage:   StorageHDD,
+			want: map[string]string{
+				AutovacuumMaxWorkersKey:        "10",
+				AutovacuumNaptimeKey:           autovacuumNaptimeDefault,
+				AutovacuumCostLimitKey:         "1000",
+				AutovacuumCostDelayKey:         autovacuumCostDelayHDD,
+				AutovacuumWorkMemKey:           "1GB",
+				AutovacuumScaleFactorKey:       autovacuumScaleFactorDefault,
+				AutovacuumAnalyzeScaleKey:      autovacuumAnalyzeScaleDefault,
+				AutovacuumInsertScaleFactorKey: NoRecommendation,
+			},
+		},
+		{
+			desc:      "network storage",
+			memory:    8 * parse.Gigabyte,
+			cpus:      4,
+			pgVersion: pgutils.MajorVersion15,
+			storage:   StorageNetwork,
+			want: map[string]string{
+				AutovacuumMaxWorkersKey:        "4",
+				AutovacuumNaptimeKey:           autovacuumNaptimeDefault,
+				AutovacuumCostLimitKey:         "600",
+				AutovacuumCostDelayKey:         autovacuumCostDelayDefault,
+				AutovacuumWorkMemKey:           "256MB",
+				AutovacuumScaleFactorKey:       autovacuumScaleFactorDefault,
+				AutovacuumAnalyzeScaleKey:      autovacuumAnalyzeScaleDefault,
+				AutovacuumInsertScaleFactorKey: autovacuumInsertScaleFactorDefault,
+			},
+		},
+		{
+			desc:      "many CPUs, little memory",
+			memory:    1 * parse.Gigabyte,
+			cpus:      32,
+			pgVersion: pgutils.MajorVersion15,
+			storage:   StorageSSD,
+			want: map[string]string{
+				AutovacuumMaxWorkersKey:        "3",
+				AutovacuumNaptimeKey:           autovacuumNaptimeDefault,
+				AutovacuumCostLimitKey:         "600",
+				AutovacuumCostDelayKey:         autovacuumCostDelayDefault,
+				AutovacuumWorkMemKey:           "43690kB",
+				AutovacuumScaleFactorKey:       autovacuumScaleFactorDefault,
+				AutovacuumAnalyzeScaleKey:      autovacuumAnalyzeScaleDefault,
+				AutovacuumInsertScaleFactorKey: autovacuumInsertScaleFactorDefault,
+			},
+		},
+		{
+			desc:      "many CPUs, some memory",
+			memory:    4 * parse.Gigabyte,
+			cpus:      32,
+			pgVersion: pgutils.MajorVersion15,
+			storage:   StorageSSD,
+			want: map[string]string{
+				AutovacuumMaxWorkersKey:        "8",
+				AutovacuumNaptimeKey:           autovacuumNaptimeDefault,
+				AutovacuumCostLimitKey:         "1600",
+				AutovacuumCostDelayKey:         autovacuumCostDelayDefault,
+				AutovacuumWorkMemKey:           "64MB",
+				AutovacuumScaleFactorKey:       autovacuumScaleFactorDefault,
+				AutovacuumAnalyzeScaleKey:      autovacuumAnalyzeScaleDefault,
+				AutovacuumInsertScaleFactorKey: autovacuumInsertScaleFactorDefault,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		config, err := NewSystemConfig(c.memory, c.cpus, c.pgVersion, 0, 0, MaxBackgroundWorkersDefault)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.desc, err)
+		}
+		config.Storage = c.storage
+		sg := mustGetSettingsGroup(t, AutovacuumLabel, config)
+		testSettingGroup(t, sg, DefaultProfile, c.want, AutovacuumLabel, AutovacuumKeys)
+
+		r := sg.GetRecommender(DefaultProfile)
+		if !r.IsAvailable() {
+			t.Errorf("%s: should always be available", c.desc)
+		}
+		if got := r.Recommend("foo"); got != NoRecommendation {
+			t.Errorf("%s: unexpected recommendation for unknown key: %s", c.desc, got)
+		}
+	}
+}
+
+func TestAutovacuumRecommenderWorkMemFits(t *testing.T) {
+	for _, memory := range []uint64{512 * parse.Megabyte, 1 * parse.Gigabyte, 3 * parse.Gigabyte, 16 * parse.Gigabyte, 128 * parse.Gigabyte} {
+		for _, cpus := range []int{1, 2, 4, 8, 32, 64} {
+			r := NewAutovacuumRecommender(memory, cpus, pgutils.MajorVersion15, StorageSSD)
+			workMem, err := parse.PGFormatToBytes(r.Recommend(AutovacuumWorkMemKey))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if total := r.maxWorkers() * workMem; total > memory/autovacuumWorkMemDivisor {
+				t.Errorf("%d bytes/%d CPUs: workers use too much memory: got %d want at most %d", memory, cpus, total, memory/autovacuumWorkMemDivisor)
+			}
+		}
+	}
+}
+
+func TestAutovacuumFloatParserParseFloat(t *testing.T) {
+	cases := []struct {
+		key       string
+		s         string
+		want      float64
+		shouldErr bool
+	}{
+		{AutovacuumMaxWorkersKey, "10", 10.0, false},
+		{AutovacuumNaptimeKey, "10", 10.0, false},
+		{AutovacuumNaptimeKey, "1min", 60.0, false},
+		{AutovacuumNaptimeKey, "500ms", 0.5, false},
+		{AutovacuumCostDelayKey, "2ms", 2.0, false},
+		{AutovacuumCostDelayKey, "2.5", 2.5, false},
+		{AutovacuumCostDelayKey, "1s", 1000.0, false},
+		{AutovacuumCostDelayKey, "-1", -1.0, false},
+		{AutovacuumCostLimitKey, "-1", -1.0, false},
+		{AutovacuumCostLimitKey, "2000", 2000.0, false},
+		{AutovacuumWorkMemKey, "-1", -1.0, false},
+		{AutovacuumWorkMemKey, "1GB", float64(parse.Gigabyte), false},
+		{AutovacuumScaleFactorKey, "0.05", 0.05, false},
+		{AutovacuumNaptimeKey, "soon", 0.0, true},
+		{AutovacuumWorkMemKey, "lots", 0.0, true},
+	}
+
+	v := &AutovacuumFloatParser{}
+	for _, c := range cases {
+		got, err := v.ParseFloat(c.key, c.s)
+		if c.shouldErr {
+			if err == nil {
+				t.Errorf("%s: unexpected lack of error for %s", c.key, c.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error for %s: %v", c.key, c.s, err)
+		} else if got != c.want {
+			t.Errorf("%s: incorrect result for %s: got %f want %f", c.key, c.s, got, c.want)
+		}
+	}
+
+	if _, ok := GetFloatParser(&AutovacuumRecommender{}).(*AutovacuumFloatParser); !ok {
+		t.Errorf("incorrect FloatParser for AutovacuumRecommender")
+	}
+}
@@ -1,7 +1,14 @@
 package pgtune
 
+import (
+	"github.com/timescale/timescaledb-tune/internal/parse"
+)
+
 const (
-	BgwriterFlushAfterKey = "bgwriter_flush_after"
+	BgwriterFlushAfterKey    = "bgwriter_flush_after"
+	BgwriterDelayKey         = "bgwriter_delay"
+	BgwriterLRUMaxPagesKey   = "bgwriter_lru_maxpages"
+	BgwriterLRUMultiplierKey = "bgwriter_lru_multiplier"
 
 	promscaleDefaultBgwriterFlushAfter = "0"
 )
@@ -11,6 +18,9 @@ const BgwriterLabel = "background writer"
 
 var BgwriterKeys = []string{
 	BgwriterFlushAfterKey,
+	BgwriterDelayKey,
+	BgwriterLRUMaxPagesKey,
+	BgwriterLRUMultiplierKey,
 }
 
 // PromscaleBgwriterRecommender gives recommendations for the background writer for the promscale profile
@@ -50,7 +60,38 @@ func (sg *BgwriterSettingsGroup) GetRecommender(profile Profile) Recommender {
 	switch profile {
 	case PromscaleProfile:
 		return &PromscaleBgwriterRecommender{}
+	case OLTPProfile:
+		return &OLTPBgwriterRecommender{}
+	case AnalyticsProfile:
+		return &AnalyticsBgwriterRecommender{}
+	case IngestProfile:
+		return &IngestBgwriterRecommender{}
 	default:
 		return &NullRecommender{}
 	}
 }
+
+// BgwriterFloatParser parses the values of BgwriterKeys, which are a mix of
+// amounts of memory, times, and plain numbers.
+type BgwriterFloatParser struct{}
+
+func (v *BgwriterFloatParser) ParseFloat(key string, s string) (float64, error) {
+	switch key {
+	case BgwriterFlushAfterKey:
+		bfp := &bytesFloatParser{}
+		return bfp.ParseFloat(key, s)
+	case BgwriterDelayKey:
+		val, units, err := parse.PGFormatToTime(s, parse.Milliseconds, parse.VarTypeInteger)
+		if err != nil {
+			return val, err
+		}
+		conv, err := parse.TimeConversion(units, parse.Milliseconds)
+		if err != nil {
+			return val, err
+		}
+		return val * conv, nil
+	default:
+		nfp := &numericFloatParser{}
+		return nfp.ParseFloat(key, s)
+	}
+}
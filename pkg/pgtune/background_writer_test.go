@@ -3,6 +3,8 @@ package pgtune
 import (
 	"fmt"
 	"testing"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
 )
 
 func TestBgwriterSettingsGroup_GetRecommender(t *testing.T) {
@@ -12,6 +14,9 @@ func TestBgwriterSettingsGroup_GetRecommender(t *testing.T) {
 	}{
 		{DefaultProfile, "*pgtune.NullRecommender"},
 		{PromscaleProfile, "*pgtune.PromscaleBgwriterRecommender"},
+		{OLTPProfile, "*pgtune.OLTPBgwriterRecommender"},
+		{AnalyticsProfile, "*pgtune.AnalyticsBgwriterRecommender"},
+		{IngestProfile, "*pgtune.IngestBgwriterRecommender"},
 	}
 
 	sg := BgwriterSettingsGroup{}
@@ -49,3 +54,34 @@ func TestPromscaleBgwriterRecommender(t *testing.T) {
 		t.Errorf("Expected %s for key %s but got %s", promscaleDefaultBgwriterFlushAfter, BgwriterFlushAfterKey, val)
 	}
 }
+
+func TestBgwriterFloatParserParseFloat(t *testing.T) {
+	seconds, _ := parse.TimeConversion(parse.Seconds, parse.Milliseconds)
+	cases := []struct {
+		key  string
+		s    string
+		want float64
+	}{
+		{BgwriterFlushAfterKey, "512" + parse.KB, float64(512 * parse.Kilobyte)},
+		{BgwriterFlushAfterKey, "0", 0.0},
+		{BgwriterDelayKey, "50", 50.0},
+		{BgwriterDelayKey, "2" + parse.Seconds.String(), 2.0 * seconds},
+		{BgwriterLRUMaxPagesKey, "400", 400.0},
+		{BgwriterLRUMultiplierKey, "2.5", 2.5},
+	}
+
+	v := &BgwriterFloatParser{}
+	for _, c := range cases {
+		got, err := v.ParseFloat(c.key, c.s)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.key, err)
+		}
+		if got != c.want {
+			t.Errorf("%s: incorrect result for %s: got %f want %f", c.key, c.s, got, c.want)
+		}
+	}
+
+	if _, err := v.ParseFloat(BgwriterDelayKey, "soon"); err == nil {
+		t.Errorf("unexpected lack of error")
+	}
+}
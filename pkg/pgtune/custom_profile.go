@@ -0,0 +1,420 @@
+package pgtune
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+const (
+	errCustomProfileNoName      = "profile has no name"
+	errCustomProfileNameFmt     = "invalid profile name %q: quotes, backslashes, and control characters are not allowed"
+	errCustomProfileBaseFmt     = "invalid base profile: %v"
+	errCustomProfileKeyFmt      = "unknown setting in profile: %s"
+	errCustomProfileEmptyFmt    = "no value, formula, min, or max given for %s"
+	errCustomProfileBothFmt     = "only one of value and formula can be given for %s"
+	errCustomProfileValueClamp  = "min and max cannot be used with a fixed value for %s"
+	errCustomProfileValueFmt    = "invalid value for %s: %v"
+	errCustomProfileFormulaFmt  = "invalid formula for %s: %v"
+	errCustomProfileBoundFmt    = "invalid %s for %s: %v"
+	errCustomProfileMinMaxFmt   = "min is larger than max for %s"
+	errCustomProfileEvalFmt     = "could not evaluate formula for %s: %v"
+	errCustomProfileNotBytesFmt = "formula for %s must give a positive number of bytes: got %v"
+	errCustomProfileKeepFmt     = "%s cannot be both kept and overridden"
+)
+
+// bytesKeys are the keys whose values are an amount of memory or disk. Formula
+// results and clamps for these are in bytes; for all other keys they are plain
+// numbers in the setting's default unit.
+var bytesKeys = map[string]bool{
+	SharedBuffersKey:      true,
+	EffectiveCacheKey:     true,
+	MaintenanceWorkMemKey: true,
+	WorkMemKey:            true,
+	WALBuffersKey:         true,
+	AutovacuumWorkMemKey:  true,
+	MinWALKey:             true,
+	MaxWALKey:             true,
+	WALKeepSizeKey:        true,
+	MaxSlotWALKeepSizeKey: true,
+}
+
+// realKeys are the numeric keys that take fractional values; formula results
+// for other numeric keys are rounded to whole numbers.
+var realKeys = map[string]bool{
+	CheckpointKey:                  true,
+	RandomPageCostKey:              true,
+	BgwriterLRUMultiplierKey:       true,
+	AutovacuumCostDelayKey:         true,
+	AutovacuumScaleFactorKey:       true,
+	AutovacuumAnalyzeScaleKey:      true,
+	AutovacuumInsertScaleFactorKey: true,
+}
+
+// groupKeys are the keys of each of the settings groups, by label.
+var groupKeys = map[string][]string{
+	MemoryLabel:      MemoryKeys,
+	ParallelLabel:    ParallelKeys,
+	WALLabel:         WALKeys,
+	BgwriterLabel:    BgwriterKeys,
+	MiscLabel:        MiscKeys,
+	AutovacuumLabel:  AutovacuumKeys,
+	LoggingLabel:     LoggingKeys,
+	TimescaleDBLabel: TimescaleDBKeys,
+	ReplicationLabel: ReplicationKeys,
+}
+
+// keyLabel returns the label of the settings group key belongs to, or false
+// if it belongs to none.
+func keyLabel(key string) (string, bool) {
+	for label, keys := range groupKeys {
+		for _, k := range keys {
+			if k == key {
+				return label, true
+			}
+		}
+	}
+	return "", false
+}
+
+// isTunableKey returns whether key belongs to one of the settings groups.
+func isTunableKey(key string) bool {
+	_, ok := keyLabel(key)
+	return ok
+}
+
+// valueRecommender returns the Recommender that profile uses for key, whose
+// FloatParser is what values given for key are parsed with. Only its type
+// matters, so the system it is for is arbitrary.
+func valueRecommender(key string, profile Profile) (Recommender, error) {
+	label, _ := keyLabel(key)
+	config, err := NewSystemConfig(parse.Gigabyte, 1, pgutils.MajorVersion19, 0, 0, MaxBackgroundWorkersDefault)
+	if err != nil {
+		return nil, err
+	}
+	sg, err := GetSettingsGroup(label, config)
+	if err != nil {
+		return nil, err
+	}
+	return sg.GetRecommender(profile), nil
+}
+
+// CustomProfile is a tuning profile defined outside of this package, e.g. in a
+// file. It builds on one of the built-in profiles and overrides the
+// recommendations for individual keys. The keys in Keep are never tuned, so
+// that values deliberately set apart from the recommendations stay as they are.
+type CustomProfile struct {
+	Name     string                      `json:"name" yaml:"name" toml:"name"`
+	Base     string                      `json:"base" yaml:"base" toml:"base"`
+	Settings map[string]*SettingOverride `json:"settings" yaml:"settings" toml:"settings"`
+	Keep     []string                    `json:"keep,omitempty" yaml:"keep,omitempty" toml:"keep,omitempty"`
+
+	base Profile
+}
+
+// SettingOverride replaces the recommendation for a single key, with either a
+// fixed Value or a Formula over the system resources. Min and Max clamp the
+// result of the Formula, or the built-in recommendation if neither Value nor
+// Formula is given.
+type SettingOverride struct {
+	Value   string `json:"value,omitempty" yaml:"value,omitempty" toml:"value,omitempty"`
+	Formula string `json:"formula,omitempty" yaml:"formula,omitempty" toml:"formula,omitempty"`
+	Min     string `json:"min,omitempty" yaml:"min,omitempty" toml:"min,omitempty"`
+	Max     string `json:"max,omitempty" yaml:"max,omitempty" toml:"max,omitempty"`
+
+	formula  *Formula
+	min, max *float64
+}
+
+// Validate checks that the profile is well-formed, i.e., it has a name that
+// can be written into the conf file, a known base profile, valid overrides for
+// known keys, and only known keys to keep that are not also overridden. It
+// must be called before the profile is used.
+func (p *CustomProfile) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf(errCustomProfileNoName)
+	}
+	// the name is written into the conf file as a quoted string
+	if strings.ContainsAny(p.Name, `'"\`) || strings.IndexFunc(p.Name, unicode.IsControl) >= 0 {
+		return fmt.Errorf(errCustomProfileNameFmt, p.Name)
+	}
+	base, err := ParseProfile(p.Base)
+	if err != nil {
+		return fmt.Errorf(errCustomProfileBaseFmt, err)
+	}
+	p.base = base
+
+	// sorted so that the first error is always the same one
+	keys := make([]string, 0, len(p.Settings))
+	for k := range p.Settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !isTunableKey(k) {
+			return fmt.Errorf(errCustomProfileKeyFmt, k)
+		}
+		if err := p.Settings[k].validate(k, p.base); err != nil {
+			return err
+		}
+	}
+	for _, k := range p.Keep {
+		if !isTunableKey(k) {
+			return fmt.Errorf(errCustomProfileKeyFmt, k)
+		}
+		if _, ok := p.Settings[k]; ok {
+			return fmt.Errorf(errCustomProfileKeepFmt, k)
+		}
+	}
+	return nil
+}
+
+// validate checks the override for key, parsing a fixed value the way the
+// recommendations of profile for key are parsed.
+func (o *SettingOverride) validate(key string, profile Profile) error {
+	if o == nil || (o.Value == "" && o.Formula == "" && o.Min == "" && o.Max == "") {
+		return fmt.Errorf(errCustomProfileEmptyFmt, key)
+	}
+	if o.Value != "" && o.Formula != "" {
+		return fmt.Errorf(errCustomProfileBothFmt, key)
+	}
+	if o.Value != "" && (o.Min != "" || o.Max != "") {
+		return fmt.Errorf(errCustomProfileValueClamp, key)
+	}
+	// log_line_prefix is free-form text
+	if o.Value != "" && key != LogLinePrefixKey {
+		r, err := valueRecommender(key, profile)
+		if err != nil {
+			return err
+		}
+		if err := ValidateValue(r, key, o.Value); err != nil {
+			return fmt.Errorf(errCustomProfileValueFmt, key, err)
+		}
+	}
+	if o.Formula != "" {
+		f, err := ParseFormula(o.Formula)
+		if err != nil {
+			return fmt.Errorf(errCustomProfileFormulaFmt, key, err)
+		}
+		o.formula = f
+	}
+	parseBound := func(name, s string) (*float64, error) {
+		if s == "" {
+			return nil, nil
+		}
+		v, err := parseOverrideNumber(key, s)
+		if err != nil {
+			return nil, fmt.Errorf(errCustomProfileBoundFmt, name, key, err)
+		}
+		return &v, nil
+	}
+	var err error
+	if o.min, err = parseBound("min", o.Min); err != nil {
+		return err
+	}
+	if o.max, err = parseBound("max", o.Max); err != nil {
+		return err
+	}
+	if o.min != nil && o.max != nil && *o.min > *o.max {
+		return fmt.Errorf(errCustomProfileMinMaxFmt, key)
+	}
+	return nil
+}
+
+// BaseProfile returns the built-in profile this one builds on. Only valid
+// after Validate.
+func (p *CustomProfile) BaseProfile() Profile { return p.base }
+
+// WrapSettingsGroup returns a SettingsGroup that gives the recommendations of
+// sg with the overrides of this profile applied. Formulas are evaluated with
+// the resources in config.
+func (p *CustomProfile) WrapSettingsGroup(sg SettingsGroup, config *SystemConfig) (SettingsGroup, error) {
+	vars, err := p.formulaVars(config)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := make(map[string]*resolvedOverride)
+	for _, k := range sg.Keys() {
+		o, ok := p.Settings[k]
+		if !ok {
+			continue
+		}
+		res := &resolvedOverride{value: o.Value, min: o.min, max: o.max}
+		if o.formula != nil {
+			res.value, err = o.eval(k, vars)
+			if err != nil {
+				return nil, err
+			}
+		}
+		overrides[k] = res
+	}
+	return &customProfileSettingsGroup{sg, overrides}, nil
+}
+
+// ApplyConnections sets the connections of config to the max_connections the
+// profile gives, if it overrides it, so that the built-in recommendations
+// sized by connections, such as work_mem, are consistent with it. It must be
+// called once the rest of config is known, since formulas may use any of it.
+func (p *CustomProfile) ApplyConnections(config *SystemConfig) error {
+	if _, ok := p.Settings[MaxConnectionsKey]; !ok {
+		return nil
+	}
+	vars, err := p.formulaVars(config)
+	if err != nil {
+		return err
+	}
+	if conns := vars[FormulaConnections]; conns >= 1 {
+		config.maxConns = uint64(conns)
+	}
+	return nil
+}
+
+// formulaVars returns the values of the formula variables for config. If the
+// profile overrides max_connections, that is what connections will be, so
+// that formulas are consistent with it.
+func (p *CustomProfile) formulaVars(config *SystemConfig) (map[string]float64, error) {
+	conns := config.maxConns
+	if conns == 0 {
+		conns = getMaxConnsForProfile(p.base, config.Memory)
+	}
+	vars := map[string]float64{
+		FormulaMemory:      float64(config.Memory),
+		FormulaCPUs:        float64(config.CPUs),
+		FormulaConnections: float64(conns),
+		FormulaWALDiskSize: float64(config.WALDiskSize),
+	}
+
+	o, ok := p.Settings[MaxConnectionsKey]
+	switch {
+	case !ok:
+	case o.Value != "":
+		if v, err := strconv.ParseFloat(o.Value, 64); err == nil {
+			vars[FormulaConnections] = v
+		}
+	case o.formula != nil:
+		val, err := o.eval(MaxConnectionsKey, vars)
+		if err != nil {
+			return nil, err
+		}
+		vars[FormulaConnections], _ = strconv.ParseFloat(val, 64)
+	default:
+		vars[FormulaConnections] = math.Round(clamp(vars[FormulaConnections], o.min, o.max))
+	}
+	return vars, nil
+}
+
+// eval evaluates the formula of the override for key, clamps it, and returns
+// it as a PostgreSQL formatted value.
+func (o *SettingOverride) eval(key string, vars map[string]float64) (string, error) {
+	v, err := o.formula.Eval(vars)
+	if err != nil {
+		return "", fmt.Errorf(errCustomProfileEvalFmt, key, err)
+	}
+	v = clamp(v, o.min, o.max)
+	if bytesKeys[key] && v < 1 {
+		return "", fmt.Errorf(errCustomProfileNotBytesFmt, key, v)
+	}
+	return formatOverrideNumber(key, v), nil
+}
+
+// resolvedOverride is a SettingOverride for a specific system: either a value
+// to use as-is, or clamps to apply to the built-in recommendation.
+type resolvedOverride struct {
+	value    string
+	min, max *float64
+}
+
+// parseOverrideNumber parses a formula result, clamp, or recommendation for key
+// into bytes (for bytesKeys) or a plain number.
+func parseOverrideNumber(key, s string) (float64, error) {
+	if bytesKeys[key] {
+		v, err := parse.PGFormatToBytes(s)
+		return float64(v), err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// formatOverrideNumber turns v back into a PostgreSQL formatted value for key.
+func formatOverrideNumber(key string, v float64) string {
+	switch {
+	case bytesKeys[key]:
+		return parse.BytesToPGFormat(uint64(v))
+	case realKeys[key]:
+		return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+	default:
+		return strconv.FormatFloat(math.Round(v), 'f', 0, 64)
+	}
+}
+
+func clamp(v float64, min, max *float64) float64 {
+	if min != nil && v < *min {
+		v = *min
+	}
+	if max != nil && v > *max {
+		v = *max
+	}
+	return v
+}
+
+// customProfileSettingsGroup is a SettingsGroup whose Recommender has the
+// overrides of a CustomProfile applied.
+type customProfileSettingsGroup struct {
+	SettingsGroup
+	overrides map[string]*resolvedOverride
+}
+
+// GetRecommender returns the Recommender of the wrapped SettingsGroup with the
+// overrides applied.
+func (sg *customProfileSettingsGroup) GetRecommender(profile Profile) Recommender {
+	return &CustomProfileRecommender{sg.SettingsGroup.GetRecommender(profile), sg.overrides}
+}
+
+// CustomProfileRecommender gives the recommendations of a built-in Recommender
+// with the overrides of a CustomProfile applied.
+type CustomProfileRecommender struct {
+	base      Recommender
+	overrides map[string]*resolvedOverride
+}
+
+// IsAvailable returns whether the underlying Recommender is available.
+func (r *CustomProfileRecommender) IsAvailable() bool {
+	return r.base.IsAvailable()
+}
+
+// Unwrap returns the built-in Recommender that the overrides are applied to.
+func (r *CustomProfileRecommender) Unwrap() Recommender {
+	return r.base
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *CustomProfileRecommender) Recommend(key string) string {
+	o, ok := r.overrides[key]
+	if !ok {
+		return r.base.Recommend(key)
+	}
+	if o.value != "" {
+		return o.value
+	}
+
+	// only clamps given, so apply them to the built-in recommendation
+	rec := r.base.Recommend(key)
+	if rec == NoRecommendation {
+		return rec
+	}
+	v, err := parseOverrideNumber(key, rec)
+	if err != nil {
+		return rec
+	}
+	if clamped := clamp(v, o.min, o.max); clamped != v {
+		return formatOverrideNumber(key, clamped)
+	}
+	return rec
+}
@@ -0,0 +1,400 @@
+package pgtune
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+)
+
+func TestCustomProfileValidate(t *testing.T) {
+	cases := []struct {
+		desc     string
+		profile  *CustomProfile
+		wantBase Profile
+		errMsg   string
+	}{
+		{
+			desc:     "no settings",
+			profile:  &CustomProfile{Name: "mine"},
+			wantBase: DefaultProfile,
+		},
+		{
+			desc: "valid settings",
+			profile: &CustomProfile{
+				Name: "mine",
+				Base: "promscale",
+				Settings: map[string]*SettingOverride{
+					WorkMemKey:        {Formula: "memory / connections / 4", Min: "4MB", Max: "64MB"},
+					MaxConnectionsKey: {Value: "200"},
+					RandomPageCostKey: {Min: "1.5"},
+				},
+			},
+			wantBase: PromscaleProfile,
+		},
+		{
+			desc: "keep",
+			profile: &CustomProfile{
+				Name:     "mine",
+				Settings: map[string]*SettingOverride{MaxConnectionsKey: {Value: "200"}},
+				Keep:     []string{WorkMemKey, SharedBuffersKey},
+			},
+			wantBase: DefaultProfile,
+		},
+		{
+			desc:    "unknown key to keep",
+			profile: &CustomProfile{Name: "mine", Keep: []string{"foo"}},
+			errMsg:  fmt.Sprintf(errCustomProfileKeyFmt, "foo"),
+		},
+		{
+			desc: "kept and overridden",
+			profile: &CustomProfile{
+				Name:     "mine",
+				Settings: map[string]*SettingOverride{WorkMemKey: {Value: "4MB"}},
+				Keep:     []string{WorkMemKey},
+			},
+			errMsg: fmt.Sprintf(errCustomProfileKeepFmt, WorkMemKey),
+		},
+		{
+			desc:    "no name",
+			profile: &CustomProfile{},
+			errMsg:  errCustomProfileNoName,
+		},
+		{
+			desc:    "name with quote",
+			profile: &CustomProfile{Name: "O'Brien"},
+			errMsg:  fmt.Sprintf(errCustomProfileNameFmt, "O'Brien"),
+		},
+		{
+			desc:    "name with backslash",
+			profile: &CustomProfile{Name: `mine\`},
+			errMsg:  fmt.Sprintf(errCustomProfileNameFmt, `mine\`),
+		},
+		{
+			desc:    "name with newline",
+			profile: &CustomProfile{Name: "two\nlines"},
+			errMsg:  fmt.Sprintf(errCustomProfileNameFmt, "two\nlines"),
+		},
+		{
+			desc:     "name with spaces",
+			profile:  &CustomProfile{Name: "my profile"},
+			wantBase: DefaultProfile,
+		},
+		{
+			desc:    "bad base",
+			profile: &CustomProfile{Name: "mine", Base: "nope"},
+			errMsg:  fmt.Sprintf(errCustomProfileBaseFmt, fmt.Errorf(errUnrecognizedProfile, "nope")),
+		},
+		{
+			desc: "unknown key",
+			profile: &CustomProfile{Name: "mine", Settings: map[string]*SettingOverride{
+				"foo": {Value: "1"},
+			}},
+			errMsg: fmt.Sprintf(errCustomProfileKeyFmt, "foo"),
+		},
+		{
+			desc: "empty override",
+			profile: &CustomProfile{Name: "mine", Settings: map[string]*SettingOverride{
+				WorkMemKey: {},
+			}},
+			errMsg: fmt.Sprintf(errCustomProfileEmptyFmt, WorkMemKey),
+		},
+		{
+			desc: "nil override",
+			profile: &CustomProfile{Name: "mine", Settings: map[string]*SettingOverride{
+				WorkMemKey: nil,
+			}},
+			errMsg: fmt.Sprintf(errCustomProfileEmptyFmt, WorkMemKey),
+		},
+		{
+			desc: "value and formula",
+			profile: &CustomProfile{Name: "mine", Settings: map[string]*SettingOverride{
+				WorkMemKey: {Value: "4MB", Formula: "memory"},
+			}},
+			errMsg: fmt.Sprintf(errCustomProfileBothFmt, WorkMemKey),
+		},
+		{
+			desc: "value and clamp",
+			profile: &CustomProfile{Name: "mine", Settings: map[string]*SettingOverride{
+				WorkMemKey: {Value: "4MB", Max: "8MB"},
+			}},
+			errMsg: fmt.Sprintf(errCustomProfileValueClamp, WorkMemKey),
+		},
+		{
+			desc: "valid fixed values",
+			profile: &CustomProfile{
+				Name: "mine",
+				Base: "analytics",
+				Settings: map[string]*SettingOverride{
+					WorkMemKey:       {Value: "256MB"},
+					Jit:              {Value: "off"},
+					WALLevelKey:      {Value: "logical"},
+					LogLinePrefixKey: {Value: "%m [%p] "},
+				},
+			},
+			wantBase: AnalyticsProfile,
+		},
+		{
+			desc: "bad bytes value",
+			profile: &CustomProfile{Name: "mine", Settings: map[string]*SettingOverride{
+				WorkMemKey: {Value: "lots"},
+			}},
+			errMsg: fmt.Sprintf(errCustomProfileValueFmt, WorkMemKey, "incorrect PostgreSQL bytes format: 'lots'"),
+		},
+		{
+			desc: "bad numeric value",
+			profile: &CustomProfile{Name: "mine", Settings: map[string]*SettingOverride{
+				MaxConnectionsKey: {Value: "many"},
+			}},
+			errMsg: fmt.Sprintf(errCustomProfileValueFmt, MaxConnectionsKey, `strconv.ParseFloat: parsing "many": invalid syntax`),
+		},
+		{
+			desc: "bad bool value",
+			profile: &CustomProfile{Name: "mine", Settings: map[string]*SettingOverride{
+				Jit: {Value: "maybe"},
+			}},
+			errMsg: fmt.Sprintf(errCustomProfileValueFmt, Jit, "unrecognized bool value: maybe"),
+		},
+		{
+			desc: "bad enum value",
+			profile: &CustomProfile{Name: "mine", Settings: map[string]*SettingOverride{
+				WALLevelKey: {Value: "full"},
+			}},
+			errMsg: fmt.Sprintf(errCustomProfileValueFmt, WALLevelKey, fmt.Errorf(errUnrecognizedEnumValue, "full", "minimal, replica, logical, archive, hot_standby")),
+		},
+		{
+			desc: "bad formula",
+			profile: &CustomProfile{Name: "mine", Settings: map[string]*SettingOverride{
+				WorkMemKey: {Formula: "memory +"},
+			}},
+			errMsg: fmt.Sprintf(errCustomProfileFormulaFmt, WorkMemKey, fmt.Errorf(errFormulaUnexpectedFmt, errFormulaEnd, 8)),
+		},
+		{
+			desc: "bad bytes min",
+			profile: &CustomProfile{Name: "mine", Settings: map[string]*SettingOverride{
+				WorkMemKey: {Min: "4 MB"},
+			}},
+			errMsg: fmt.Sprintf(errCustomProfileBoundFmt, "min", WorkMemKey, fmt.Errorf("incorrect PostgreSQL bytes format: '4 MB'")),
+		},
+		{
+			desc: "bad numeric max",
+			profile: &CustomProfile{Name: "mine", Settings: map[string]*SettingOverride{
+				MaxConnectionsKey: {Max: "lots"},
+			}},
+			errMsg: fmt.Sprintf(errCustomProfileBoundFmt, "max", MaxConnectionsKey, `strconv.ParseFloat: parsing "lots": invalid syntax`),
+		},
+		{
+			desc: "min larger than max",
+			profile: &CustomProfile{Name: "mine", Settings: map[string]*SettingOverride{
+				WorkMemKey: {Min: "1GB", Max: "1MB"},
+			}},
+			errMsg: fmt.Sprintf(errCustomProfileMinMaxFmt, WorkMemKey),
+		},
+	}
+
+	for _, c := range cases {
+		err := c.profile.Validate()
+		if c.errMsg == "" && err != nil {
+			t.Errorf("%s: unexpected error: got %v", c.desc, err)
+		} else if c.errMsg != "" {
+			if err == nil {
+				t.Errorf("%s: unexpected lack of error", c.desc)
+			} else if got := err.Error(); got != c.errMsg {
+				t.Errorf("%s: incorrect error: got\n%s\nwant\n%s", c.desc, got, c.errMsg)
+			}
+			continue
+		}
+		if got := c.profile.BaseProfile(); got != c.wantBase {
+			t.Errorf("%s: incorrect base: got %v want %v", c.desc, got, c.wantBase)
+		}
+	}
+}
+
+func TestCustomProfileWrapSettingsGroup(t *testing.T) {
+	mem := uint64(8 * parse.Gigabyte)
+	config, err := NewSystemConfig(mem, 4, "14", 0, 0, MaxBackgroundWorkersDefault)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	profile := &CustomProfile{
+		Name: "mine",
+		Settings: map[string]*SettingOverride{
+			SharedBuffersKey:      {Formula: "memory / 2"},
+			WorkMemKey:            {Formula: "memory / connections", Max: "64MB"},
+			MaintenanceWorkMemKey: {Max: "256MB"},
+			EffectiveCacheKey:     {Min: "1GB"},
+			MaxConnectionsKey:     {Formula: "cpus * 12.6"},
+			RandomPageCostKey:     {Formula: "4 / 3"},
+			StatsTargetKey:        {Value: "500"},
+			Jit:                   {Min: "1"}, // not numeric, left alone
+		},
+	}
+	if err := profile.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		label string
+		want  map[string]string
+	}{
+		{
+			label: MemoryLabel,
+			want: map[string]string{
+				SharedBuffersKey:      "4GB",
+				WorkMemKey:            "64MB",
+				MaintenanceWorkMemKey: "256MB",
+				EffectiveCacheKey:     "6GB",
+			},
+		},
+		{
+			label: MiscLabel,
+			want: map[string]string{
+				MaxConnectionsKey: "50",
+				RandomPageCostKey: "1.33",
+				StatsTargetKey:    "500",
+				CheckpointKey:     checkpointDefault,
+				Jit:               off,
+			},
+		},
+		{
+			label: BgwriterLabel,
+			want: map[string]string{
+				BgwriterFlushAfterKey: NoRecommendation,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		sg, err := profile.WrapSettingsGroup(mustGetSettingsGroup(t, c.label, config), config)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.label, err)
+			continue
+		}
+		if got := sg.Label(); got != c.label {
+			t.Errorf("incorrect label: got %s want %s", got, c.label)
+		}
+		r := sg.GetRecommender(DefaultProfile)
+		if !r.IsAvailable() {
+			t.Errorf("%s: recommender unexpectedly not available", c.label)
+		}
+		for k, want := range c.want {
+			if got := r.Recommend(k); got != want {
+				t.Errorf("%s: incorrect recommendation for %s: got %s want %s", c.label, k, got, want)
+			}
+		}
+		base := mustGetSettingsGroup(t, c.label, config).GetRecommender(DefaultProfile)
+		if got, want := fmt.Sprintf("%T", GetFloatParser(r)), fmt.Sprintf("%T", GetFloatParser(base)); got != want {
+			t.Errorf("%s: incorrect float parser: got %s want %s", c.label, got, want)
+		}
+	}
+
+	// connections follows an overridden max_connections
+	for _, o := range []*SettingOverride{{Value: "200"}, {Formula: "connections * 2"}} {
+		conns := &CustomProfile{Name: "conns", Settings: map[string]*SettingOverride{
+			MaxConnectionsKey: o,
+			WorkMemKey:        {Formula: "memory / connections"},
+		}}
+		if err := conns.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sg, err := conns.WrapSettingsGroup(mustGetSettingsGroup(t, MemoryLabel, config), config)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := parse.BytesToPGFormat(mem / 200)
+		if got := sg.GetRecommender(DefaultProfile).Recommend(WorkMemKey); got != want {
+			t.Errorf("incorrect work_mem with max_connections %v: got %s want %s", o, got, want)
+		}
+	}
+
+	// formulas that cannot be evaluated for this system
+	bad := &CustomProfile{Name: "bad", Settings: map[string]*SettingOverride{
+		SharedBuffersKey: {Formula: "memory / wal_disk_size"},
+	}}
+	if err := bad.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = bad.WrapSettingsGroup(mustGetSettingsGroup(t, MemoryLabel, config), config)
+	wantErr := fmt.Sprintf(errCustomProfileEvalFmt, SharedBuffersKey, errFormulaDivByZero)
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("incorrect error: got %v want %s", err, wantErr)
+	}
+
+	bad.Settings[SharedBuffersKey] = &SettingOverride{Formula: "memory - 16GB"}
+	if err := bad.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = bad.WrapSettingsGroup(mustGetSettingsGroup(t, MemoryLabel, config), config)
+	wantErr = fmt.Sprintf(errCustomProfileNotBytesFmt, SharedBuffersKey, -8.0*parse.Gigabyte)
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("incorrect error: got %v want %s", err, wantErr)
+	}
+}
+
+func TestCustomProfileApplyConnections(t *testing.T) {
+	mem := uint64(8 * parse.Gigabyte)
+	cases := []struct {
+		desc      string
+		override  *SettingOverride
+		wantConns uint64
+	}{
+		{
+			desc:      "no override",
+			wantConns: 0,
+		},
+		{
+			desc:      "value",
+			override:  &SettingOverride{Value: "200"},
+			wantConns: 200,
+		},
+		{
+			desc:      "formula",
+			override:  &SettingOverride{Formula: "cpus * 30"},
+			wantConns: 120,
+		},
+		{
+			desc:      "clamp",
+			override:  &SettingOverride{Max: "60"},
+			wantConns: 60,
+		},
+	}
+
+	for _, c := range cases {
+		config, err := NewSystemConfig(mem, 4, "14", 0, 0, MaxBackgroundWorkersDefault)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.desc, err)
+		}
+		profile := &CustomProfile{Name: "conns", Settings: map[string]*SettingOverride{}}
+		if c.override != nil {
+			profile.Settings[MaxConnectionsKey] = c.override
+		}
+		if err := profile.Validate(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.desc, err)
+		}
+		if err := profile.ApplyConnections(config); err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.desc, err)
+		}
+		if got := config.maxConns; got != c.wantConns {
+			t.Errorf("%s: incorrect connections: got %d want %d", c.desc, got, c.wantConns)
+		}
+		if c.wantConns == 0 {
+			continue
+		}
+
+		// the built-in recommendations are the same as for those connections
+		wantConfig, err := NewSystemConfig(mem, 4, "14", 0, c.wantConns, MaxBackgroundWorkersDefault)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.desc, err)
+		}
+		for label, key := range map[string]string{MemoryLabel: WorkMemKey, MiscLabel: MaxConnectionsKey} {
+			sg, err := profile.WrapSettingsGroup(mustGetSettingsGroup(t, label, config), config)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", c.desc, err)
+			}
+			got := sg.GetRecommender(DefaultProfile).Recommend(key)
+			if want := mustGetSettingsGroup(t, label, wantConfig).GetRecommender(DefaultProfile).Recommend(key); got != want {
+				t.Errorf("%s: incorrect %s: got %s want %s", c.desc, key, got, want)
+			}
+		}
+	}
+}
@@ -10,8 +10,28 @@ import (
 
 const (
 	errUnrecognizedBoolValue = "unrecognized bool value: %s"
+	errUnrecognizedEnumValue = "unrecognized value: %s (want one of %s)"
 )
 
+// EnumValues are the values accepted by the settings that take one of a fixed
+// set of names, besides a bool for those also in BoolKeys.
+var EnumValues = map[string][]string{
+	WALLevelKey:             {"minimal", walLevelReplica, "logical", "archive", "hot_standby"},
+	WALCompressionKey:       {"pglz", lz4Compression, "zstd"},
+	DefaultToastCompression: {"pglz", lz4Compression},
+}
+
+// BoolKeys are the settings that take a bool.
+var BoolKeys = []string{
+	Jit,
+	WALCompressionKey,
+	HotStandbyFeedbackKey,
+	WALLogHintsKey,
+	LogCheckpointsKey,
+	LogLockWaitsKey,
+	TrackIOTimingKey,
+}
+
 type FloatParser interface {
 	ParseFloat(string, string) (float64, error)
 }
@@ -57,19 +77,80 @@ func (v *boolFloatParser) ParseFloat(key string, s string) (float64, error) {
 	}
 }
 
+// enumFloatParser parses the value of a setting in EnumValues as its position
+// among the values it accepts.
+type enumFloatParser struct{}
+
+func (v *enumFloatParser) ParseFloat(key string, s string) (float64, error) {
+	norm := strings.ToLower(strings.Trim(strings.TrimSpace(s), `"'`))
+	for i, e := range EnumValues[key] {
+		if norm == e {
+			return float64(i), nil
+		}
+	}
+	return 0.0, fmt.Errorf(errUnrecognizedEnumValue, s, strings.Join(EnumValues[key], ", "))
+}
+
+// ValidateValue returns an error if s is not a value PostgreSQL accepts for
+// key. Settings in EnumValues or BoolKeys must have one of the values they
+// accept, while the rest must be parsable by the FloatParser for r.
+func ValidateValue(r Recommender, key string, s string) error {
+	values, isEnum := EnumValues[key]
+	isBool := false
+	for _, k := range BoolKeys {
+		isBool = isBool || k == key
+	}
+	if !isEnum && !isBool {
+		_, err := GetFloatParser(r).ParseFloat(key, s)
+		return err
+	}
+	if isBool {
+		bfp := &boolFloatParser{}
+		_, err := bfp.ParseFloat(key, s)
+		if err == nil || !isEnum {
+			return err
+		}
+		values = append([]string{"on", "off"}, values...)
+	}
+	efp := &enumFloatParser{}
+	if _, err := efp.ParseFloat(key, s); err != nil {
+		return fmt.Errorf(errUnrecognizedEnumValue, s, strings.Join(values, ", "))
+	}
+	return nil
+}
+
+// Unwrapper is implemented by Recommenders that adjust the recommendations of
+// another Recommender, such as CustomProfileRecommender.
+type Unwrapper interface {
+	Unwrap() Recommender
+}
+
 // GetFloatParser returns the correct FloatParser for a given Recommender.
 func GetFloatParser(r Recommender) FloatParser {
+	// adjusted recommendations are in the same format as what they adjust
+	if u, ok := r.(Unwrapper); ok {
+		return GetFloatParser(u.Unwrap())
+	}
 	switch r.(type) {
-	case *MemoryRecommender:
+	case *MemoryRecommender, *PromscaleMemoryRecommender, *OLTPMemoryRecommender,
+		*AnalyticsMemoryRecommender, *IngestMemoryRecommender:
 		return &bytesFloatParser{}
 	case *WALRecommender:
 		return &WALFloatParser{}
-	case *PromscaleWALRecommender:
+	case *PromscaleWALRecommender, *OLTPWALRecommender, *AnalyticsWALRecommender, *IngestWALRecommender:
 		return &WALFloatParser{}
-	case *PromscaleBgwriterRecommender:
-		return &numericFloatParser{}
+	case *PromscaleBgwriterRecommender, *OLTPBgwriterRecommender, *AnalyticsBgwriterRecommender, *IngestBgwriterRecommender:
+		return &BgwriterFloatParser{}
+	case *LoggingRecommender:
+		return &LoggingFloatParser{}
+	case *AutovacuumRecommender:
+		return &AutovacuumFloatParser{}
+	case *ReplicationRecommender:
+		return &ReplicationFloatParser{}
 	case *ParallelRecommender:
 		return &numericFloatParser{}
+	case *MiscRecommender, *OLTPMiscRecommender, *AnalyticsMiscRecommender, *IngestMiscRecommender:
+		return &MiscFloatParser{}
 	default:
 		return &numericFloatParser{}
 	}
@@ -171,15 +171,41 @@ func TestGetFloatParser(t *testing.T) {
 	}
 
 	switch x := (GetFloatParser(&PromscaleBgwriterRecommender{})).(type) {
-	case *numericFloatParser:
+	case *BgwriterFloatParser:
 	default:
 		t.Errorf("wrong validator type for PromscaleBgwriterRecommender: got %T", x)
 	}
 
-	switch x := (GetFloatParser(&MiscRecommender{})).(type) {
-	case *numericFloatParser:
-	default:
-		t.Errorf("wrong validator type for MiscRecommender: got %T", x)
+	for _, r := range []Recommender{&OLTPMemoryRecommender{}, &AnalyticsMemoryRecommender{}, &IngestMemoryRecommender{}} {
+		switch x := (GetFloatParser(r)).(type) {
+		case *bytesFloatParser:
+		default:
+			t.Errorf("wrong validator type for %T: got %T", r, x)
+		}
+	}
+
+	for _, r := range []Recommender{&OLTPWALRecommender{}, &AnalyticsWALRecommender{}, &IngestWALRecommender{}} {
+		switch x := (GetFloatParser(r)).(type) {
+		case *WALFloatParser:
+		default:
+			t.Errorf("wrong validator type for %T: got %T", r, x)
+		}
+	}
+
+	for _, r := range []Recommender{&OLTPBgwriterRecommender{}, &AnalyticsBgwriterRecommender{}, &IngestBgwriterRecommender{}} {
+		switch x := (GetFloatParser(r)).(type) {
+		case *BgwriterFloatParser:
+		default:
+			t.Errorf("wrong validator type for %T: got %T", r, x)
+		}
+	}
+
+	for _, r := range []Recommender{&MiscRecommender{}, &OLTPMiscRecommender{}, &AnalyticsMiscRecommender{}, &IngestMiscRecommender{}} {
+		switch x := (GetFloatParser(r)).(type) {
+		case *MiscFloatParser:
+		default:
+			t.Errorf("wrong validator type for %T: got %T", r, x)
+		}
 	}
 
 	switch x := (GetFloatParser(&NullRecommender{})).(type) {
@@ -188,3 +214,65 @@ func TestGetFloatParser(t *testing.T) {
 		t.Errorf("wrong validator type for NullRecommender: got %T", x)
 	}
 }
+
+func TestEnumFloatParserParseFloat(t *testing.T) {
+	cases := []struct {
+		desc    string
+		key     string
+		s       string
+		want    float64
+		wantErr string
+	}{
+		{desc: "first", key: DefaultToastCompression, s: "pglz", want: 0.0},
+		{desc: "quoted and upper case", key: DefaultToastCompression, s: "'LZ4'", want: 1.0},
+		{desc: "unknown", key: DefaultToastCompression, s: "zstd", wantErr: "unrecognized value: zstd (want one of pglz, lz4)"},
+		{desc: "not an enum", key: WorkMemKey, s: "on", wantErr: "unrecognized value: on (want one of )"},
+	}
+
+	v := &enumFloatParser{}
+	for _, c := range cases {
+		got, err := v.ParseFloat(c.key, c.s)
+		if c.wantErr != "" {
+			if err == nil || err.Error() != c.wantErr {
+				t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if got != c.want {
+			t.Errorf("%s: incorrect result: got %f want %f", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestValidateValue(t *testing.T) {
+	cases := []struct {
+		desc    string
+		r       Recommender
+		key     string
+		s       string
+		wantErr string
+	}{
+		{desc: "bool", r: &MiscRecommender{}, key: Jit, s: "on"},
+		{desc: "bad bool", r: &MiscRecommender{}, key: Jit, s: "maybe", wantErr: "unrecognized bool value: maybe"},
+		{desc: "enum", r: &MiscRecommender{}, key: DefaultToastCompression, s: "pglz"},
+		{desc: "bad enum", r: &MiscRecommender{}, key: DefaultToastCompression, s: "off", wantErr: "unrecognized value: off (want one of pglz, lz4)"},
+		{desc: "enum, unknown recommender", r: &NullRecommender{}, key: WALLevelKey, s: "logical"},
+		{desc: "bool, unknown recommender", r: &NullRecommender{}, key: HotStandbyFeedbackKey, s: "off"},
+		{desc: "bool or enum, bool", r: &WALRecommender{}, key: WALCompressionKey, s: "on"},
+		{desc: "bool or enum, enum", r: &WALRecommender{}, key: WALCompressionKey, s: "zstd"},
+		{desc: "bool or enum, neither", r: &WALRecommender{}, key: WALCompressionKey, s: "gzip", wantErr: "unrecognized value: gzip (want one of on, off, pglz, lz4, zstd)"},
+		{desc: "numeric", r: &MemoryRecommender{}, key: WorkMemKey, s: "64MB"},
+		{desc: "bad numeric", r: &MiscRecommender{}, key: RandomPageCostKey, s: "on", wantErr: `strconv.ParseFloat: parsing "on": invalid syntax`},
+	}
+
+	for _, c := range cases {
+		err := ValidateValue(c.r, c.key, c.s)
+		if c.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if c.wantErr != "" && (err == nil || err.Error() != c.wantErr) {
+			t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.wantErr)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package pgtune
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+)
+
+// Variables that can be used in a formula
+const (
+	FormulaMemory      = "memory"        // total memory in bytes
+	FormulaCPUs        = "cpus"          // number of CPUs
+	FormulaConnections = "connections"   // max_connections that will be used
+	FormulaWALDiskSize = "wal_disk_size" // size of the WAL disk in bytes (its free space if shared with the data), 0 if unknown
+)
+
+const (
+	errFormulaUnexpectedFmt = "unexpected %s at position %d"
+	errFormulaUnknownVarFmt = "unknown variable '%s' (valid variables: %s)"
+	errFormulaDivByZero     = "division by zero"
+	errFormulaEnd           = "end of formula"
+)
+
+// FormulaVariables are the names that can be used in a formula
+var FormulaVariables = []string{FormulaMemory, FormulaCPUs, FormulaConnections, FormulaWALDiskSize}
+
+// formulaUnits are the byte units numbers in a formula can have, e.g. 16MB
+var formulaUnits = map[string]float64{
+	parse.KB: parse.Kilobyte,
+	parse.MB: parse.Megabyte,
+	parse.GB: parse.Gigabyte,
+	parse.TB: parse.Terabyte,
+}
+
+// Formula is a parsed arithmetic expression over the system resources, e.g.
+// "memory / 4" or "(memory - 1GB) / connections".
+type Formula struct {
+	src  string
+	root formulaNode
+}
+
+// formulaNode is a node in the expression tree of a Formula
+type formulaNode interface {
+	eval(vars map[string]float64) (float64, error)
+}
+
+type numberNode float64
+
+func (n numberNode) eval(map[string]float64) (float64, error) { return float64(n), nil }
+
+type variableNode string
+
+func (n variableNode) eval(vars map[string]float64) (float64, error) { return vars[string(n)], nil }
+
+type negateNode struct{ operand formulaNode }
+
+func (n *negateNode) eval(vars map[string]float64) (float64, error) {
+	v, err := n.operand.eval(vars)
+	return -v, err
+}
+
+type binaryNode struct {
+	op          byte
+	left, right formulaNode
+}
+
+func (n *binaryNode) eval(vars map[string]float64) (float64, error) {
+	l, err := n.left.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	r, err := n.right.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case '+':
+		return l + r, nil
+	case '-':
+		return l - r, nil
+	case '*':
+		return l * r, nil
+	default: // '/'
+		if r == 0 {
+			return 0, fmt.Errorf(errFormulaDivByZero)
+		}
+		return l / r, nil
+	}
+}
+
+// ParseFormula parses src into a Formula. Formulas support +, -, *, /,
+// parentheses, numbers with optional byte units (kB, MB, GB, TB), and the
+// variables in FormulaVariables.
+func ParseFormula(src string) (*Formula, error) {
+	p := &formulaParser{src: src}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, p.unexpected()
+	}
+	return &Formula{src: src, root: root}, nil
+}
+
+// String returns the formula as it was written.
+func (f *Formula) String() string { return f.src }
+
+// Eval evaluates the formula with the given values for its variables.
+func (f *Formula) Eval(vars map[string]float64) (float64, error) {
+	return f.root.eval(vars)
+}
+
+// formulaParser is a recursive descent parser for the grammar:
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = factor { ("*" | "/") factor }
+//	factor = "-" factor | "(" expr ")" | number [unit] | variable
+type formulaParser struct {
+	src string
+	pos int
+}
+
+func (p *formulaParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *formulaParser) unexpected() error {
+	if p.pos >= len(p.src) {
+		return fmt.Errorf(errFormulaUnexpectedFmt, errFormulaEnd, p.pos)
+	}
+	return fmt.Errorf(errFormulaUnexpectedFmt, fmt.Sprintf("'%c'", p.src[p.pos]), p.pos)
+}
+
+func (p *formulaParser) parseExpr() (formulaNode, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) || (p.src[p.pos] != '+' && p.src[p.pos] != '-') {
+			return left, nil
+		}
+		op := p.src[p.pos]
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op, left, right}
+	}
+}
+
+func (p *formulaParser) parseTerm() (formulaNode, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) || (p.src[p.pos] != '*' && p.src[p.pos] != '/') {
+			return left, nil
+		}
+		op := p.src[p.pos]
+		p.pos++
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op, left, right}
+	}
+}
+
+func (p *formulaParser) parseFactor() (formulaNode, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, p.unexpected()
+	}
+	c := p.src[p.pos]
+	switch {
+	case c == '-':
+		p.pos++
+		operand, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return &negateNode{operand}, nil
+	case c == '(':
+		p.pos++
+		inner, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.src) || p.src[p.pos] != ')' {
+			return nil, p.unexpected()
+		}
+		p.pos++
+		return inner, nil
+	case c == '.' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case c == '_' || unicode.IsLetter(rune(c)):
+		start := p.pos
+		p.pos = p.scanWord()
+		name := p.src[start:p.pos]
+		for _, v := range FormulaVariables {
+			if name == v {
+				return variableNode(name), nil
+			}
+		}
+		return nil, fmt.Errorf(errFormulaUnknownVarFmt, name, strings.Join(FormulaVariables, ", "))
+	default:
+		return nil, p.unexpected()
+	}
+}
+
+func (p *formulaParser) parseNumber() (formulaNode, error) {
+	start := p.pos
+	for p.pos < len(p.src) && (p.src[p.pos] == '.' || (p.src[p.pos] >= '0' && p.src[p.pos] <= '9')) {
+		p.pos++
+	}
+	val, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.unexpected()
+	}
+	// a unit must directly follow the number, e.g. 16MB
+	end := p.scanWord()
+	if end > p.pos {
+		mult, ok := formulaUnits[p.src[p.pos:end]]
+		if !ok {
+			return nil, p.unexpected()
+		}
+		val *= mult
+		p.pos = end
+	}
+	return numberNode(val), nil
+}
+
+// scanWord returns the position after the identifier starting at p.pos.
+func (p *formulaParser) scanWord() int {
+	end := p.pos
+	for end < len(p.src) {
+		c := rune(p.src[end])
+		if c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			break
+		}
+		end++
+	}
+	return end
+}
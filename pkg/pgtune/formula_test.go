@@ -0,0 +1,138 @@
+package pgtune
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+)
+
+func TestParseFormula(t *testing.T) {
+	vars := map[string]float64{
+		FormulaMemory:      8 * parse.Gigabyte,
+		FormulaCPUs:        4,
+		FormulaConnections: 100,
+		FormulaWALDiskSize: 0,
+	}
+	cases := []struct {
+		desc    string
+		formula string
+		want    float64
+		errMsg  string
+	}{
+		{
+			desc:    "number",
+			formula: "42",
+			want:    42,
+		},
+		{
+			desc:    "fraction",
+			formula: "0.5",
+			want:    0.5,
+		},
+		{
+			desc:    "number with units",
+			formula: "16MB",
+			want:    16 * parse.Megabyte,
+		},
+		{
+			desc:    "variable",
+			formula: "memory",
+			want:    8 * parse.Gigabyte,
+		},
+		{
+			desc:    "precedence",
+			formula: "1 + 2 * 3 - 4 / 2",
+			want:    5,
+		},
+		{
+			desc:    "left associative",
+			formula: "100 / 10 / 2",
+			want:    5,
+		},
+		{
+			desc:    "parentheses",
+			formula: "(1 + 2) * 3",
+			want:    9,
+		},
+		{
+			desc:    "unary minus",
+			formula: "-(cpus - 6) * -2",
+			want:    -4,
+		},
+		{
+			desc:    "all variables",
+			formula: "(memory - 4GB) / connections + cpus * 1kB + wal_disk_size",
+			want:    4.0*parse.Gigabyte/100 + 4*parse.Kilobyte,
+		},
+		{
+			desc:    "no spaces",
+			formula: "memory/4",
+			want:    2 * parse.Gigabyte,
+		},
+		{
+			desc:    "empty",
+			formula: "",
+			errMsg:  fmt.Sprintf(errFormulaUnexpectedFmt, errFormulaEnd, 0),
+		},
+		{
+			desc:    "unknown variable",
+			formula: "memory / disks",
+			errMsg:  fmt.Sprintf(errFormulaUnknownVarFmt, "disks", strings.Join(FormulaVariables, ", ")),
+		},
+		{
+			desc:    "unknown units",
+			formula: "16mb",
+			errMsg:  fmt.Sprintf(errFormulaUnexpectedFmt, "'m'", 2),
+		},
+		{
+			desc:    "unbalanced parentheses",
+			formula: "(memory / 4",
+			errMsg:  fmt.Sprintf(errFormulaUnexpectedFmt, errFormulaEnd, 11),
+		},
+		{
+			desc:    "trailing junk",
+			formula: "memory / 4)",
+			errMsg:  fmt.Sprintf(errFormulaUnexpectedFmt, "')'", 10),
+		},
+		{
+			desc:    "missing operand",
+			formula: "memory * ",
+			errMsg:  fmt.Sprintf(errFormulaUnexpectedFmt, errFormulaEnd, 9),
+		},
+		{
+			desc:    "bad number",
+			formula: "1.2.3",
+			errMsg:  fmt.Sprintf(errFormulaUnexpectedFmt, "'1'", 0),
+		},
+		{
+			desc:    "division by zero",
+			formula: "memory / wal_disk_size",
+			errMsg:  errFormulaDivByZero,
+		},
+	}
+
+	for _, c := range cases {
+		f, err := ParseFormula(c.formula)
+		if err == nil {
+			if got := f.String(); got != c.formula {
+				t.Errorf("%s: incorrect string: got %s want %s", c.desc, got, c.formula)
+			}
+			var got float64
+			got, err = f.Eval(vars)
+			if err == nil && c.errMsg == "" && got != c.want {
+				t.Errorf("%s: incorrect result: got %v want %v", c.desc, got, c.want)
+			}
+		}
+		if c.errMsg == "" && err != nil {
+			t.Errorf("%s: unexpected error: got %v", c.desc, err)
+		} else if c.errMsg != "" {
+			if err == nil {
+				t.Errorf("%s: unexpected lack of error", c.desc)
+			} else if got := err.Error(); got != c.errMsg {
+				t.Errorf("%s: incorrect error: got\n%s\nwant\n%s", c.desc, got, c.errMsg)
+			}
+		}
+	}
+}
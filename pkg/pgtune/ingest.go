@@ -0,0 +1,175 @@
+package pgtune
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+)
+
+// The ingest profile is for sustained high-volume inserts, e.g. from IoT
+// devices. The most recent chunks and their indexes should stay in shared
+// buffers, checkpoints should be infrequent, and the background writer should
+// keep up with the stream of dirty buffers.
+const (
+	ingestSharedBuffersPct          = 40
+	ingestWorkMemDivisor            = 2 // inserts need little memory
+	ingestWALBuffersThreshold       = 8 * parse.Gigabyte
+	ingestWALBuffers                = 64 * parse.Megabyte
+	ingestDefaultMaxWALBytes        = 8 * parse.Gigabyte
+	ingestDefaultCheckpointTimeout  = "1800" // 30 minutes expressed in seconds
+	ingestDefaultWALCompression     = "on"
+	ingestDefaultBgwriterFlushAfter = "0"
+	ingestDefaultBgwriterDelay      = "10" // milliseconds
+	ingestDefaultBgwriterMaxPages   = "1000"
+	ingestDefaultBgwriterLRUMult    = "4"
+	ingestMaxLocksMultiplier        = 2 // inserts touch many chunks
+)
+
+// IngestMemoryRecommender gives recommendations for MemoryKeys for the ingest profile
+type IngestMemoryRecommender struct {
+	*MemoryRecommender
+}
+
+// NewIngestMemoryRecommender returns an IngestMemoryRecommender that
+// recommends based on the given number of cpus and system memory
+func NewIngestMemoryRecommender(totalMemory uint64, cpus int, maxConns uint64) *IngestMemoryRecommender {
+	return &IngestMemoryRecommender{
+		MemoryRecommender: NewMemoryRecommender(totalMemory, cpus, maxConns),
+	}
+}
+
+// IsAvailable returns whether this Recommender is usable given the system resources. Always true.
+func (r *IngestMemoryRecommender) IsAvailable() bool {
+	return true
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *IngestMemoryRecommender) Recommend(key string) string {
+	switch key {
+	case SharedBuffersKey:
+		return parse.BytesToPGFormat(r.totalMemory * ingestSharedBuffersPct / 100)
+	case WorkMemKey:
+		temp := r.workMem() / ingestWorkMemDivisor
+		if temp < workMemMin {
+			temp = workMemMin
+		}
+		return parse.BytesToPGFormat(temp)
+	default:
+		return r.MemoryRecommender.Recommend(key)
+	}
+}
+
+// IngestParallelRecommender gives recommendations for ParallelKeys for the ingest profile
+type IngestParallelRecommender struct {
+	*ParallelRecommender
+}
+
+// NewIngestParallelRecommender returns an IngestParallelRecommender that
+// recommends based on the given number of cpus.
+func NewIngestParallelRecommender(cpus, maxBGWorkers int) *IngestParallelRecommender {
+	return &IngestParallelRecommender{NewParallelRecommender(cpus, maxBGWorkers)}
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *IngestParallelRecommender) Recommend(key string) string {
+	val := r.ParallelRecommender.Recommend(key)
+	if key == MaxParallelWorkersGatherKey {
+		// leave most CPUs to the inserting connections
+		gather := int(math.Round(float64(r.cpus) / 4.0))
+		if gather < 1 {
+			gather = 1
+		}
+		val = fmt.Sprintf("%d", gather)
+	}
+	return val
+}
+
+// IngestWALRecommender gives recommendations for WALKeys for the ingest profile
+type IngestWALRecommender struct {
+	WALRecommender
+}
+
+// NewIngestWALRecommender returns an IngestWALRecommender that recommends
+// based on the given totalMemory bytes.
+func NewIngestWALRecommender(totalMemory, walDiskSize uint64) *IngestWALRecommender {
+	return &IngestWALRecommender{
+		WALRecommender: WALRecommender{
+			totalMemory: totalMemory,
+			walDiskSize: walDiskSize,
+		},
+	}
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *IngestWALRecommender) Recommend(key string) string {
+	switch key {
+	case WALBuffersKey:
+		if r.totalMemory >= ingestWALBuffersThreshold {
+			return parse.BytesToPGFormat(ingestWALBuffers)
+		}
+		return r.WALRecommender.Recommend(key)
+	case MinWALKey:
+		return parse.BytesToPGFormat(r.calcMaxWALBytesWithDefault(ingestDefaultMaxWALBytes) / 2)
+	case MaxWALKey:
+		return parse.BytesToPGFormat(r.calcMaxWALBytesWithDefault(ingestDefaultMaxWALBytes))
+	case CheckpointTimeoutKey:
+		return ingestDefaultCheckpointTimeout
+	case WALCompressionKey:
+		return ingestDefaultWALCompression
+	default:
+		return r.WALRecommender.Recommend(key)
+	}
+}
+
+// IngestBgwriterRecommender gives recommendations for BgwriterKeys for the ingest profile
+type IngestBgwriterRecommender struct{}
+
+// IsAvailable returns whether this Recommender is usable given the system resources. Always true.
+func (r *IngestBgwriterRecommender) IsAvailable() bool {
+	return true
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *IngestBgwriterRecommender) Recommend(key string) string {
+	switch key {
+	case BgwriterFlushAfterKey:
+		return ingestDefaultBgwriterFlushAfter
+	case BgwriterDelayKey:
+		return ingestDefaultBgwriterDelay
+	case BgwriterLRUMaxPagesKey:
+		return ingestDefaultBgwriterMaxPages
+	case BgwriterLRUMultiplierKey:
+		return ingestDefaultBgwriterLRUMult
+	default:
+		return NoRecommendation
+	}
+}
+
+// IngestMiscRecommender gives recommendations for MiscKeys for the ingest profile
+type IngestMiscRecommender struct {
+	*MiscRecommender
+}
+
+// NewIngestMiscRecommender returns an IngestMiscRecommender.
+func NewIngestMiscRecommender(totalMemory, maxConns uint64, pgMajorVersion string) *IngestMiscRecommender {
+	return &IngestMiscRecommender{NewMiscRecommender(totalMemory, maxConns, pgMajorVersion)}
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *IngestMiscRecommender) Recommend(key string) string {
+	val := r.MiscRecommender.Recommend(key)
+	if key == MaxLocksPerTxKey {
+		locks, err := strconv.Atoi(val)
+		if err == nil {
+			val = fmt.Sprintf("%d", locks*ingestMaxLocksMultiplier)
+		}
+	}
+	return val
+}
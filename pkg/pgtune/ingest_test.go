@@ -0,0 +1,187 @@
+package pgtune
+
+import (
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+// ingestMemoryToBaseVals provides a memory from test memory levels to expected
+// "base" memory settings for the ingest profile, see defaultMemoryToBaseVals.
+var ingestMemoryToBaseVals = map[uint64]map[string]uint64{
+	10 * parse.Gigabyte: {
+		SharedBuffersKey:      4 * parse.Gigabyte,
+		EffectiveCacheKey:     7680 * parse.Megabyte,
+		MaintenanceWorkMemKey: 1280 * parse.Megabyte,
+		WorkMemKey:            200 * parse.Megabyte,
+	},
+	12 * parse.Gigabyte: {
+		SharedBuffersKey:      12 * parse.Gigabyte * 2 / 5,
+		EffectiveCacheKey:     9 * parse.Gigabyte,
+		MaintenanceWorkMemKey: 1536 * parse.Megabyte,
+		WorkMemKey:            240 * parse.Megabyte,
+	},
+	32 * parse.Gigabyte: {
+		SharedBuffersKey:      32 * parse.Gigabyte * 2 / 5,
+		EffectiveCacheKey:     24 * parse.Gigabyte,
+		MaintenanceWorkMemKey: maintenanceWorkMemLimit,
+		WorkMemKey:            640 * parse.Megabyte,
+	},
+}
+
+// ingestMemoryToWALBuffers provides a mapping from test case memory levels to
+// the expected WAL buffers setting for the ingest profile.
+var ingestMemoryToWALBuffers = map[uint64]uint64{
+	1 * parse.Gigabyte:                    7864 * parse.Kilobyte,
+	uint64(1.5 * float64(parse.Gigabyte)): 11796 * parse.Kilobyte,
+	2 * parse.Gigabyte:                    walBuffersDefault,
+	10 * parse.Gigabyte:                   64 * parse.Megabyte,
+}
+
+var (
+	// ingestMemorySettingsMatrix stores the test cases for
+	// IngestMemoryRecommender along with the expected values
+	ingestMemorySettingsMatrix = newMemorySettingsMatrix(ingestMemoryToBaseVals, MaxConnectionsDefault, func(wm uint64) uint64 {
+		if wm/ingestWorkMemDivisor < workMemMin {
+			return workMemMin
+		}
+		return wm / ingestWorkMemDivisor
+	})
+	// ingestParallelSettingsMatrix stores the test cases for
+	// IngestParallelRecommender along with the expected values
+	ingestParallelSettingsMatrix = newParallelSettingsMatrix(map[int]string{2: "1", 4: "1", 5: "1"})
+	// ingestWALSettingsMatrix stores the test cases for IngestWALRecommender
+	// along with the expected values
+	ingestWALSettingsMatrix = newWALSettingsMatrix(ingestMemoryToWALBuffers, map[uint64]uint64{
+		walDiskUnset:          ingestDefaultMaxWALBytes,
+		walDiskDivideUnevenly: 4928 * parse.Megabyte, // nearest 16MB segment
+		walDiskDivideEvenly:   5280 * parse.Megabyte,
+	}, ingestDefaultCheckpointTimeout, ingestDefaultWALCompression)
+)
+
+func TestIngestMemoryRecommenderRecommend(t *testing.T) {
+	for totalMemory, cpuMatrix := range ingestMemorySettingsMatrix {
+		for cpus, connMatrix := range cpuMatrix {
+			for conns, cases := range connMatrix {
+				r := NewIngestMemoryRecommender(totalMemory, cpus, conns)
+				if !r.IsAvailable() {
+					t.Errorf("unexpectedly not available")
+				}
+				testRecommender(t, r, MemoryKeys, cases)
+			}
+		}
+	}
+}
+
+func TestIngestMemorySettingsGroup(t *testing.T) {
+	for totalMemory, cpuMatrix := range ingestMemorySettingsMatrix {
+		for cpus, connMatrix := range cpuMatrix {
+			for conns, matrix := range connMatrix {
+				config := getDefaultTestSystemConfig(t)
+				config.CPUs = cpus
+				config.Memory = totalMemory
+				config.maxConns = conns
+
+				sg := mustGetSettingsGroup(t, MemoryLabel, config)
+				testSettingGroup(t, sg, IngestProfile, matrix, MemoryLabel, MemoryKeys)
+			}
+		}
+	}
+}
+
+func TestIngestParallelRecommenderRecommend(t *testing.T) {
+	for cpus, tempMatrix := range ingestParallelSettingsMatrix {
+		for workers, matrix := range tempMatrix {
+			r := NewIngestParallelRecommender(cpus, workers)
+			testRecommender(t, r, ParallelKeys, matrix)
+		}
+	}
+
+	// larger machines still leave most CPUs to inserts
+	r := NewIngestParallelRecommender(16, MaxBackgroundWorkersDefault)
+	if got := r.Recommend(MaxParallelWorkersGatherKey); got != "4" {
+		t.Errorf("incorrect %s for 16 cpus: got %s want %s", MaxParallelWorkersGatherKey, got, "4")
+	}
+}
+
+func TestIngestParallelSettingsGroup(t *testing.T) {
+	for cpus, tempMatrix := range ingestParallelSettingsMatrix {
+		for workers, matrix := range tempMatrix {
+			config := getDefaultTestSystemConfig(t)
+			config.CPUs = cpus
+			config.PGMajorVersion = pgutils.MajorVersion11
+			config.MaxBGWorkers = workers
+			sg := mustGetSettingsGroup(t, ParallelLabel, config)
+			testSettingGroup(t, sg, IngestProfile, matrix, ParallelLabel, ParallelKeys)
+		}
+	}
+}
+
+func TestIngestWALRecommenderRecommend(t *testing.T) {
+	for totalMemory, outerMatrix := range ingestWALSettingsMatrix {
+		for walSize, matrix := range outerMatrix {
+			r := NewIngestWALRecommender(totalMemory, walSize)
+			testRecommender(t, r, WALKeys, matrix)
+		}
+	}
+}
+
+func TestIngestWALSettingsGroup(t *testing.T) {
+	for totalMemory, outerMatrix := range ingestWALSettingsMatrix {
+		for walSize, matrix := range outerMatrix {
+			config := getDefaultTestSystemConfig(t)
+			config.Memory = totalMemory
+			config.WALDiskSize = walSize
+			sg := mustGetSettingsGroup(t, WALLabel, config)
+			testSettingGroup(t, sg, IngestProfile, matrix, WALLabel, WALKeys)
+		}
+	}
+}
+
+func TestIngestBgwriterRecommender(t *testing.T) {
+	r := &IngestBgwriterRecommender{}
+	if !r.IsAvailable() {
+		t.Error("IngestBgwriterRecommender should always be available")
+	}
+	testRecommender(t, r, BgwriterKeys, map[string]string{
+		BgwriterFlushAfterKey:    ingestDefaultBgwriterFlushAfter,
+		BgwriterDelayKey:         ingestDefaultBgwriterDelay,
+		BgwriterLRUMaxPagesKey:   ingestDefaultBgwriterMaxPages,
+		BgwriterLRUMultiplierKey: ingestDefaultBgwriterLRUMult,
+	})
+}
+
+func TestIngestMiscRecommenderRecommend(t *testing.T) {
+	cases := []struct {
+		totalMemory uint64
+		want        string
+	}{
+		{7 * parse.Gigabyte, "256"},
+		{8 * parse.Gigabyte, "512"},
+		{16 * parse.Gigabyte, "1024"},
+		{32 * parse.Gigabyte, "2048"},
+	}
+
+	for _, c := range cases {
+		config, err := NewSystemConfig(c.totalMemory, 8, pgutils.MajorVersion12, walDiskUnset, 0, MaxBackgroundWorkersDefault)
+		if err != nil {
+			t.Fatalf("unexpected error on system config creation: got %v", err)
+		}
+		r := mustGetSettingsGroup(t, MiscLabel, config).GetRecommender(IngestProfile)
+		if got := r.Recommend(MaxLocksPerTxKey); got != c.want {
+			t.Errorf("%d: incorrect %s: got %s want %s", c.totalMemory, MaxLocksPerTxKey, got, c.want)
+		}
+
+		// everything else is the same as the default profile
+		base := mustGetSettingsGroup(t, MiscLabel, config).GetRecommender(DefaultProfile)
+		for _, k := range MiscKeys {
+			if k == MaxLocksPerTxKey {
+				continue
+			}
+			if got, want := r.Recommend(k), base.Recommend(k); got != want {
+				t.Errorf("%d: incorrect %s: got %s want %s", c.totalMemory, k, got, want)
+			}
+		}
+	}
+}
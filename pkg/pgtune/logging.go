@@ -0,0 +1,154 @@
+package pgtune
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+// Keys in the conf file that are tuned for logging and observability
+const (
+	LogMinDurationStatementKey  = "log_min_duration_statement"
+	LogCheckpointsKey           = "log_checkpoints"
+	LogAutovacuumMinDurationKey = "log_autovacuum_min_duration"
+	LogLockWaitsKey             = "log_lock_waits"
+	LogTempFilesKey             = "log_temp_files"
+	LogLinePrefixKey            = "log_line_prefix"
+	TrackIOTimingKey            = "track_io_timing"
+	PGStatStatementsMaxKey      = "pg_stat_statements.max"
+	TrackActivityQuerySizeKey   = "track_activity_query_size"
+
+	// PGStatStatementsLib is the library that needs to be in
+	// shared_preload_libraries for pg_stat_statements to work
+	PGStatStatementsLib = "pg_stat_statements"
+
+	logMinDurationStatementDefault  = "1s"
+	logAutovacuumMinDurationDefault = "10s"
+	logTempFilesDefault             = "0" // every temporary file, since each means work_mem ran out
+	logDisabled                     = "-1"
+	on                              = "on"
+	// The backend type (%b) is only available from PG13 on. It goes before %q
+	// so that it is also logged for background processes, e.g., autovacuum
+	// workers or TimescaleDB jobs.
+	logLinePrefixOldVersions = "'%m [%p] %q%u@%d/%a '"
+	logLinePrefixDefault     = "'%m [%p] %b %q%u@%d/%a '"
+	// TimescaleDB queries differ per chunk, so more distinct statements are
+	// kept than the default 5000, and long queries are not cut off at 1kB.
+	pgStatStatementsMaxDefault    = "10000"
+	trackActivityQuerySizeDefault = "4096"
+)
+
+// LoggingLabel is the label used to refer to the logging settings group
+const LoggingLabel = "logging"
+
+// LoggingKeys is an array of keys that are tunable for logging and observability
+var LoggingKeys = []string{
+	LogMinDurationStatementKey,
+	LogCheckpointsKey,
+	LogAutovacuumMinDurationKey,
+	LogLockWaitsKey,
+	LogTempFilesKey,
+	LogLinePrefixKey,
+	TrackIOTimingKey,
+	PGStatStatementsMaxKey,
+	TrackActivityQuerySizeKey,
+}
+
+// LoggingRecommender gives recommendations for LoggingKeys.
+type LoggingRecommender struct {
+	pgMajorVersion string
+}
+
+// NewLoggingRecommender returns a LoggingRecommender for the given major
+// version of PostgreSQL.
+func NewLoggingRecommender(pgMajorVersion string) *LoggingRecommender {
+	return &LoggingRecommender{pgMajorVersion}
+}
+
+// IsAvailable returns whether this Recommender is usable given the system resources. Always true.
+func (r *LoggingRecommender) IsAvailable() bool {
+	return true
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *LoggingRecommender) Recommend(key string) string {
+	switch key {
+	case LogMinDurationStatementKey:
+		return logMinDurationStatementDefault
+	case LogAutovacuumMinDurationKey:
+		return logAutovacuumMinDurationDefault
+	case LogCheckpointsKey, LogLockWaitsKey, TrackIOTimingKey:
+		return on
+	case LogTempFilesKey:
+		return logTempFilesDefault
+	case LogLinePrefixKey:
+		return getValueForVersion(r.pgMajorVersion, []string{
+			pgutils.MajorVersion96, pgutils.MajorVersion10, pgutils.MajorVersion11, pgutils.MajorVersion12},
+			logLinePrefixOldVersions, logLinePrefixDefault,
+		)
+	case PGStatStatementsMaxKey:
+		return pgStatStatementsMaxDefault
+	case TrackActivityQuerySizeKey:
+		return trackActivityQuerySizeDefault
+	}
+	return NoRecommendation
+}
+
+// LoggingSettingsGroup is the SettingsGroup to represent settings for logging
+// and collecting statistics. It is not tuned unless asked for.
+type LoggingSettingsGroup struct {
+	pgMajorVersion string
+}
+
+// Label should always return the value LoggingLabel.
+func (sg *LoggingSettingsGroup) Label() string { return LoggingLabel }
+
+// Keys should always return the LoggingKeys slice.
+func (sg *LoggingSettingsGroup) Keys() []string { return LoggingKeys }
+
+// GetRecommender should return a new LoggingRecommender.
+func (sg *LoggingSettingsGroup) GetRecommender(profile Profile) Recommender {
+	return NewLoggingRecommender(sg.pgMajorVersion)
+}
+
+// LoggingFloatParser parses the values of LoggingKeys, which are a mix of
+// times, amounts of memory, bools, and plain numbers. The durations and
+// log_temp_files can be -1 to turn off logging, which is parsed as -1
+// regardless of units. log_line_prefix is not a number, so cannot be parsed.
+type LoggingFloatParser struct{}
+
+func (v *LoggingFloatParser) ParseFloat(key string, s string) (float64, error) {
+	switch key {
+	case LogMinDurationStatementKey, LogAutovacuumMinDurationKey:
+		if strings.TrimSpace(s) == logDisabled {
+			return -1.0, nil
+		}
+		return parseTimeToUnits(s, parse.Milliseconds, parse.VarTypeInteger)
+	case LogTempFilesKey:
+		if strings.TrimSpace(s) == logDisabled {
+			return -1.0, nil
+		}
+		return parseBytesWithDefaultUnit(s, parse.Kilobyte)
+	case TrackActivityQuerySizeKey:
+		return parseBytesWithDefaultUnit(s, 1)
+	case LogCheckpointsKey, LogLockWaitsKey, TrackIOTimingKey:
+		bfp := &boolFloatParser{}
+		return bfp.ParseFloat(key, s)
+	default:
+		nfp := &numericFloatParser{}
+		return nfp.ParseFloat(key, s)
+	}
+}
+
+// parseBytesWithDefaultUnit parses s as an amount of memory in bytes, where a
+// number without units is in multiples of unit.
+func parseBytesWithDefaultUnit(s string, unit uint64) (float64, error) {
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return n * float64(unit), nil
+	}
+	bfp := &bytesFloatParser{}
+	return bfp.ParseFloat("", s)
+}
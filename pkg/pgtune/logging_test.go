@@ -0,0 +1,88 @@
+package pgtune
+
+import (
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+func TestLoggingSettingsGroup(t *testing.T) {
+	want := map[string]string{
+		LogMinDurationStatementKey:  logMinDurationStatementDefault,
+		LogCheckpointsKey:           on,
+		LogAutovacuumMinDurationKey: logAutovacuumMinDurationDefault,
+		LogLockWaitsKey:             on,
+		LogTempFilesKey:             logTempFilesDefault,
+		LogLinePrefixKey:            logLinePrefixDefault,
+		TrackIOTimingKey:            on,
+		PGStatStatementsMaxKey:      pgStatStatementsMaxDefault,
+		TrackActivityQuerySizeKey:   trackActivityQuerySizeDefault,
+	}
+	for _, pgVersion := range []string{pgutils.MajorVersion96, pgutils.MajorVersion12, pgutils.MajorVersion13, pgutils.MajorVersion17} {
+		config, err := NewSystemConfig(8*parse.Gigabyte, 4, pgVersion, 0, 0, MaxBackgroundWorkersDefault)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want[LogLinePrefixKey] = logLinePrefixDefault
+		if pgVersion == pgutils.MajorVersion96 || pgVersion == pgutils.MajorVersion12 {
+			want[LogLinePrefixKey] = logLinePrefixOldVersions
+		}
+		sg := mustGetSettingsGroup(t, LoggingLabel, config)
+		testSettingGroup(t, sg, DefaultProfile, want, LoggingLabel, LoggingKeys)
+
+		r := sg.GetRecommender(DefaultProfile)
+		if !r.IsAvailable() {
+			t.Errorf("%s: should always be available", pgVersion)
+		}
+		if got := r.Recommend("foo"); got != NoRecommendation {
+			t.Errorf("%s: unexpected recommendation for unknown key: %s", pgVersion, got)
+		}
+	}
+}
+
+func TestLoggingFloatParserParseFloat(t *testing.T) {
+	cases := []struct {
+		key       string
+		s         string
+		want      float64
+		shouldErr bool
+	}{
+		{LogMinDurationStatementKey, "1s", 1000.0, false},
+		{LogMinDurationStatementKey, "250", 250.0, false},
+		{LogMinDurationStatementKey, "-1", -1.0, false},
+		{LogAutovacuumMinDurationKey, "10min", 600000.0, false},
+		{LogAutovacuumMinDurationKey, "-1", -1.0, false},
+		{LogTempFilesKey, "0", 0.0, false},
+		{LogTempFilesKey, "10", float64(10 * parse.Kilobyte), false},
+		{LogTempFilesKey, "10MB", float64(10 * parse.Megabyte), false},
+		{LogTempFilesKey, "-1", -1.0, false},
+		{TrackActivityQuerySizeKey, "4096", 4096.0, false},
+		{TrackActivityQuerySizeKey, "4kB", 4096.0, false},
+		{LogCheckpointsKey, "on", 1.0, false},
+		{TrackIOTimingKey, "off", 0.0, false},
+		{PGStatStatementsMaxKey, "5000", 5000.0, false},
+		{LogLinePrefixKey, "%m [%p] ", 0.0, true},
+		{LogLockWaitsKey, "sometimes", 0.0, true},
+	}
+
+	v := &LoggingFloatParser{}
+	for _, c := range cases {
+		got, err := v.ParseFloat(c.key, c.s)
+		if c.shouldErr {
+			if err == nil {
+				t.Errorf("%s: unexpected lack of error for %s", c.key, c.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error for %s: %v", c.key, c.s, err)
+		} else if got != c.want {
+			t.Errorf("%s: incorrect result for %s: got %f want %f", c.key, c.s, got, c.want)
+		}
+	}
+
+	if _, ok := GetFloatParser(&LoggingRecommender{}).(*LoggingFloatParser); !ok {
+		t.Errorf("incorrect FloatParser for LoggingRecommender")
+	}
+}
@@ -68,19 +68,25 @@ func (r *MemoryRecommender) Recommend(key string) string {
 		}
 		val = parse.BytesToPGFormat(uint64(temp))
 	case WorkMemKey:
-		cpuFactor := math.Round(float64(r.cpus) / 2.0)
-		gigs := float64(r.totalMemory) / float64(parse.Gigabyte)
-		temp := uint64(gigs * (workMemPerGigPerConn * float64(parse.Megabyte) / float64(r.conns)) / cpuFactor)
-		if temp < workMemMin {
-			temp = workMemMin
-		}
-		val = parse.BytesToPGFormat(temp)
+		val = parse.BytesToPGFormat(r.workMem())
 	default:
 		val = NoRecommendation
 	}
 	return val
 }
 
+// workMem returns the recommended work_mem in bytes, which is never less than
+// workMemMin.
+func (r *MemoryRecommender) workMem() uint64 {
+	cpuFactor := math.Round(float64(r.cpus) / 2.0)
+	gigs := float64(r.totalMemory) / float64(parse.Gigabyte)
+	temp := uint64(gigs * (workMemPerGigPerConn * float64(parse.Megabyte) / float64(r.conns)) / cpuFactor)
+	if temp < workMemMin {
+		temp = workMemMin
+	}
+	return temp
+}
+
 // PromscaleMemoryRecommender gives recommendations for ParallelKeys based on system resources
 type PromscaleMemoryRecommender struct {
 	*MemoryRecommender
@@ -130,6 +136,12 @@ func (sg *MemorySettingsGroup) GetRecommender(profile Profile) Recommender {
 	switch profile {
 	case PromscaleProfile:
 		return NewPromscaleMemoryRecommender(sg.totalMemory, sg.cpus, sg.maxConns)
+	case OLTPProfile:
+		return NewOLTPMemoryRecommender(sg.totalMemory, sg.cpus, sg.maxConns)
+	case AnalyticsProfile:
+		return NewAnalyticsMemoryRecommender(sg.totalMemory, sg.cpus, sg.maxConns)
+	case IngestProfile:
+		return NewIngestMemoryRecommender(sg.totalMemory, sg.cpus, sg.maxConns)
 	default:
 		return NewMemoryRecommender(sg.totalMemory, sg.cpus, sg.maxConns)
 	}
@@ -0,0 +1,200 @@
+package pgtune
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+)
+
+const (
+	// Each query can run several sorts and hashes at once, each of which may
+	// use up to work_mem.
+	workMemNodesWorstCase = 2
+	// Most connections are idle at any one time, so only one in this many is
+	// expected to be running a query that uses work_mem.
+	activeConnsShare = 4
+	// Autovacuum workers only run while tables need vacuuming, so only one in
+	// this many is expected to be using its work memory.
+	activeAutovacuumShare = 2
+	// Every backend, including background workers, uses some memory of its
+	// own for catalog caches, query plans, and the like, besides work_mem.
+	backendOverhead = 5 * parse.Megabyte
+
+	// PostgreSQL defaults for the settings used when they are not set
+	sharedBuffersDefault        = "128MB"
+	maxConnectionsDefault       = "100"
+	workMemDefault              = "4MB"
+	maintenanceWorkMemDefault   = "64MB"
+	autovacuumMaxWorkersDefault = "3"
+	maxWorkerProcessesDefault   = "8"
+	walBuffersAuto              = "-1" // 1/32 of shared_buffers, between 64kB and 16MB
+	walBuffersAutoMin           = 64 * parse.Kilobyte
+	walBuffersAutoMax           = 16 * parse.Megabyte
+	// pages are the unit for shared_buffers and wal_buffers without units
+	pageSize = 8 * parse.Kilobyte
+
+	errMemoryBudgetParseFmt = "could not parse %s for the memory budget: %v"
+)
+
+// Names of the parts of a MemoryBudget
+const (
+	MemoryUseSharedBuffers = "shared buffers"
+	MemoryUseWALBuffers    = "WAL buffers"
+	MemoryUseQueries       = "queries (work_mem)"
+	MemoryUseMaintenance   = "maintenance and autovacuum"
+	MemoryUseBackends      = "backend overhead"
+)
+
+// MemoryBudgetKeys are the settings that the memory used by PostgreSQL is
+// estimated from.
+var MemoryBudgetKeys = []string{
+	SharedBuffersKey,
+	WALBuffersKey,
+	MaxConnectionsKey,
+	WorkMemKey,
+	MaintenanceWorkMemKey,
+	AutovacuumMaxWorkersKey,
+	AutovacuumWorkMemKey,
+	MaxWorkerProcessesKey,
+}
+
+// MemoryUse is the memory used by one part of PostgreSQL, as expected and in
+// the worst case, along with the settings that control it.
+type MemoryUse struct {
+	Name      string
+	Expected  uint64
+	WorstCase uint64
+	Keys      []string
+}
+
+// MemoryBudget is a breakdown of the memory used by PostgreSQL with a given
+// configuration.
+type MemoryBudget struct {
+	Uses []*MemoryUse
+}
+
+// Expected returns the memory expected to be used in total.
+func (b *MemoryBudget) Expected() uint64 {
+	var sum uint64
+	for _, u := range b.Uses {
+		sum += u.Expected
+	}
+	return sum
+}
+
+// WorstCase returns the most memory that can be used in total.
+func (b *MemoryBudget) WorstCase() uint64 {
+	var sum uint64
+	for _, u := range b.Uses {
+		sum += u.WorstCase
+	}
+	return sum
+}
+
+// Largest returns the part that uses the most memory, as expected or, if
+// worstCase, in the worst case.
+func (b *MemoryBudget) Largest(worstCase bool) *MemoryUse {
+	var largest *MemoryUse
+	for _, u := range b.Uses {
+		if largest == nil || u.amount(worstCase) > largest.amount(worstCase) {
+			largest = u
+		}
+	}
+	return largest
+}
+
+func (u *MemoryUse) amount(worstCase bool) uint64 {
+	if worstCase {
+		return u.WorstCase
+	}
+	return u.Expected
+}
+
+// NewMemoryBudget estimates the memory used by PostgreSQL when its settings
+// are those returned by value, in the conf file format. value returns blank
+// for settings that are not set, which then have their PostgreSQL defaults.
+//
+// Shared memory and the overhead of each connection are expected to be used in
+// full, while only some of the connections are expected to be running queries
+// that use work_mem, and only some of the autovacuum workers to be running. In
+// the worst case, every connection runs queries that use work_mem several
+// times at once, every autovacuum worker and background worker is running,
+// and a manual maintenance operation uses maintenance_work_mem.
+func NewMemoryBudget(value func(key string) string) (*MemoryBudget, error) {
+	get := func(key, def string) string {
+		if v := strings.TrimSpace(value(key)); v != "" {
+			return strings.Trim(v, "'")
+		}
+		return def
+	}
+	var err error
+	bytes := func(key, def string, unit uint64) uint64 {
+		if err != nil {
+			return 0
+		}
+		v, parseErr := parseBytesWithDefaultUnit(get(key, def), unit)
+		if parseErr == nil && v < 0 {
+			parseErr = fmt.Errorf("negative amount: %s", get(key, def))
+		}
+		if parseErr != nil {
+			err = fmt.Errorf(errMemoryBudgetParseFmt, key, parseErr)
+			return 0
+		}
+		return uint64(v)
+	}
+	count := func(key, def string) uint64 {
+		if err != nil {
+			return 0
+		}
+		v, parseErr := strconv.ParseUint(get(key, def), 10, 64)
+		if parseErr != nil {
+			err = fmt.Errorf(errMemoryBudgetParseFmt, key, parseErr)
+		}
+		return v
+	}
+
+	sharedBuffers := bytes(SharedBuffersKey, sharedBuffersDefault, pageSize)
+	var walBuffers uint64
+	if get(WALBuffersKey, walBuffersAuto) == walBuffersAuto {
+		walBuffers = sharedBuffers / 32
+		if walBuffers < walBuffersAutoMin {
+			walBuffers = walBuffersAutoMin
+		} else if walBuffers > walBuffersAutoMax {
+			walBuffers = walBuffersAutoMax
+		}
+	} else {
+		walBuffers = bytes(WALBuffersKey, walBuffersAuto, pageSize)
+	}
+	conns := count(MaxConnectionsKey, maxConnectionsDefault)
+	workMem := bytes(WorkMemKey, workMemDefault, parse.Kilobyte)
+	maintenanceWorkMem := bytes(MaintenanceWorkMemKey, maintenanceWorkMemDefault, parse.Kilobyte)
+	autovacuumWorkers := count(AutovacuumMaxWorkersKey, autovacuumMaxWorkersDefault)
+	autovacuumWorkMem := maintenanceWorkMem
+	if get(AutovacuumWorkMemKey, autovacuumDisabled) != autovacuumDisabled {
+		autovacuumWorkMem = bytes(AutovacuumWorkMemKey, autovacuumDisabled, parse.Kilobyte)
+	}
+	workers := count(MaxWorkerProcessesKey, maxWorkerProcessesDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	activeConns := (conns + activeConnsShare - 1) / activeConnsShare
+	activeAutovacuumWorkers := (autovacuumWorkers + activeAutovacuumShare - 1) / activeAutovacuumShare
+	autovacuum := autovacuumWorkers * autovacuumWorkMem
+	return &MemoryBudget{
+		Uses: []*MemoryUse{
+			{MemoryUseSharedBuffers, sharedBuffers, sharedBuffers, []string{SharedBuffersKey}},
+			{MemoryUseWALBuffers, walBuffers, walBuffers, []string{WALBuffersKey}},
+			{MemoryUseQueries, activeConns * workMem, conns * workMem * workMemNodesWorstCase, []string{WorkMemKey, MaxConnectionsKey}},
+			{
+				MemoryUseMaintenance,
+				activeAutovacuumWorkers * autovacuumWorkMem,
+				autovacuum + maintenanceWorkMem,
+				[]string{AutovacuumWorkMemKey, AutovacuumMaxWorkersKey, MaintenanceWorkMemKey},
+			},
+			{MemoryUseBackends, conns * backendOverhead, (conns + autovacuumWorkers + workers) * backendOverhead, []string{MaxConnectionsKey, MaxWorkerProcessesKey}},
+		},
+	}, nil
+}
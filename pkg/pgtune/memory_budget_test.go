@@ -0,0 +1,125 @@
+package pgtune
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+)
+
+func TestNewMemoryBudget(t *testing.T) {
+	mb := uint64(parse.Megabyte)
+	cases := []struct {
+		desc         string
+		settings     map[string]string
+		wantUses     map[string][2]uint64
+		wantExpected uint64
+		wantWorst    uint64
+		wantLargest  [2]string // expected and worst case
+		errMsg       string
+	}{
+		{
+			desc:     "defaults",
+			settings: map[string]string{},
+			wantUses: map[string][2]uint64{
+				MemoryUseSharedBuffers: {128 * mb, 128 * mb},
+				MemoryUseWALBuffers:    {4 * mb, 4 * mb},
+				MemoryUseQueries:       {100 * mb, 800 * mb},
+				MemoryUseMaintenance:   {128 * mb, 256 * mb},
+				MemoryUseBackends:      {500 * mb, 555 * mb},
+			},
+			wantExpected: 860 * mb,
+			wantWorst:    1743 * mb,
+			wantLargest:  [2]string{MemoryUseBackends, MemoryUseQueries},
+		},
+		{
+			desc: "tuned, some without units",
+			settings: map[string]string{
+				SharedBuffersKey:        "262144",
+				WALBuffersKey:           "16MB",
+				MaxConnectionsKey:       "25",
+				WorkMemKey:              "65536",
+				MaintenanceWorkMemKey:   "1GB",
+				AutovacuumMaxWorkersKey: "4",
+				AutovacuumWorkMemKey:    "256MB",
+				MaxWorkerProcessesKey:   "23",
+			},
+			wantUses: map[string][2]uint64{
+				MemoryUseSharedBuffers: {2048 * mb, 2048 * mb},
+				MemoryUseWALBuffers:    {16 * mb, 16 * mb},
+				MemoryUseQueries:       {448 * mb, 3200 * mb},
+				MemoryUseMaintenance:   {512 * mb, 2048 * mb},
+				MemoryUseBackends:      {125 * mb, 260 * mb},
+			},
+			wantExpected: 3149 * mb,
+			wantWorst:    7572 * mb,
+			wantLargest:  [2]string{MemoryUseSharedBuffers, MemoryUseQueries},
+		},
+		{
+			desc: "quoted, automatic WAL buffers are capped",
+			settings: map[string]string{
+				SharedBuffersKey:     "'1GB'",
+				WALBuffersKey:        "-1",
+				AutovacuumWorkMemKey: "-1",
+			},
+			wantUses: map[string][2]uint64{
+				MemoryUseSharedBuffers: {1024 * mb, 1024 * mb},
+				MemoryUseWALBuffers:    {16 * mb, 16 * mb},
+				MemoryUseMaintenance:   {128 * mb, 256 * mb},
+			},
+			wantExpected: 1768 * mb,
+			wantWorst:    2651 * mb,
+			wantLargest:  [2]string{MemoryUseSharedBuffers, MemoryUseSharedBuffers},
+		},
+		{
+			desc:     "bad memory",
+			settings: map[string]string{WorkMemKey: "lots"},
+			errMsg:   "could not parse work_mem for the memory budget",
+		},
+		{
+			desc:     "negative memory",
+			settings: map[string]string{SharedBuffersKey: "-1"},
+			errMsg:   "could not parse shared_buffers for the memory budget",
+		},
+		{
+			desc:     "bad count",
+			settings: map[string]string{MaxConnectionsKey: "-5"},
+			errMsg:   "could not parse max_connections for the memory budget",
+		},
+	}
+
+	for _, c := range cases {
+		b, err := NewMemoryBudget(func(key string) string { return c.settings[key] })
+		if c.errMsg != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), c.errMsg) {
+				t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+		for _, u := range b.Uses {
+			want, ok := c.wantUses[u.Name]
+			if !ok {
+				continue
+			}
+			if u.Expected != want[0] || u.WorstCase != want[1] {
+				t.Errorf("%s: incorrect use for %s: got %d/%d want %d/%d", c.desc, u.Name, u.Expected, u.WorstCase, want[0], want[1])
+			}
+		}
+		if got := b.Expected(); got != c.wantExpected {
+			t.Errorf("%s: incorrect expected total: got %d want %d", c.desc, got, c.wantExpected)
+		}
+		if got := b.WorstCase(); got != c.wantWorst {
+			t.Errorf("%s: incorrect worst case total: got %d want %d", c.desc, got, c.wantWorst)
+		}
+		if got := b.Largest(false).Name; got != c.wantLargest[0] {
+			t.Errorf("%s: incorrect largest expected use: got %s want %s", c.desc, got, c.wantLargest[0])
+		}
+		if got := b.Largest(true).Name; got != c.wantLargest[1] {
+			t.Errorf("%s: incorrect largest worst case use: got %s want %s", c.desc, got, c.wantLargest[1])
+		}
+	}
+}
@@ -224,7 +224,7 @@ func TestMemorySettingsGroup(t *testing.T) {
 				config.Memory = totalMemory
 				config.maxConns = conns
 
-				sg := GetSettingsGroup(MemoryLabel, config)
+				sg := mustGetSettingsGroup(t, MemoryLabel, config)
 				testSettingGroup(t, sg, DefaultProfile, matrix, MemoryLabel, MemoryKeys)
 			}
 		}
@@ -240,9 +240,43 @@ func TestPromscaleMemorySettingsGroup(t *testing.T) {
 				config.Memory = totalMemory
 				config.maxConns = conns
 
-				sg := GetSettingsGroup(MemoryLabel, config)
+				sg := mustGetSettingsGroup(t, MemoryLabel, config)
 				testSettingGroup(t, sg, PromscaleProfile, matrix, MemoryLabel, MemoryKeys)
 			}
 		}
 	}
 }
+
+// newMemorySettingsMatrix builds the test cases for a profile's memory
+// recommender from its "base" values, in the same way as the init function.
+// defaultConns is the number of connections used when none are given, and
+// adjustWorkMem adjusts the usual work_mem to what the profile recommends.
+func newMemorySettingsMatrix(baseVals map[uint64]map[string]uint64, defaultConns uint64, adjustWorkMem func(uint64) uint64) map[uint64]map[int]map[uint64]map[string]string {
+	matrix := make(map[uint64]map[int]map[uint64]map[string]string)
+	for mem, baseMatrix := range baseVals {
+		matrix[mem] = make(map[int]map[uint64]map[string]string)
+		for _, cpus := range cpuVals {
+			matrix[mem][cpus] = make(map[uint64]map[string]string)
+			for _, conns := range connVals {
+				matrix[mem][cpus][conns] = map[string]string{
+					SharedBuffersKey:      parse.BytesToPGFormat(baseMatrix[SharedBuffersKey]),
+					EffectiveCacheKey:     parse.BytesToPGFormat(baseMatrix[EffectiveCacheKey]),
+					MaintenanceWorkMemKey: parse.BytesToPGFormat(baseMatrix[MaintenanceWorkMemKey]),
+				}
+
+				cpuFactor := math.Round(float64(cpus) / 2.0)
+				connFactor := float64(defaultConns) / float64(baseConns)
+				if conns != 0 {
+					connFactor = float64(conns) / float64(baseConns)
+				}
+
+				wm := uint64(float64(baseMatrix[WorkMemKey]) / connFactor / cpuFactor)
+				if wm < workMemMin {
+					wm = workMemMin
+				}
+				matrix[mem][cpus][conns][WorkMemKey] = parse.BytesToPGFormat(adjustWorkMem(wm))
+			}
+		}
+	}
+	return matrix
+}
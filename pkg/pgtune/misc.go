@@ -11,24 +11,20 @@ import (
 
 // Keys in the conf file that are tunable but not in the other groupings
 const (
-	CheckpointKey           = "checkpoint_completion_target"
-	StatsTargetKey          = "default_statistics_target"
-	MaxConnectionsKey       = "max_connections"
-	RandomPageCostKey       = "random_page_cost"
-	MaxLocksPerTxKey        = "max_locks_per_transaction"
-	AutovacuumMaxWorkersKey = "autovacuum_max_workers"
-	AutovacuumNaptimeKey    = "autovacuum_naptime"
-	EffectiveIOKey          = "effective_io_concurrency" // linux only
+	CheckpointKey     = "checkpoint_completion_target"
+	StatsTargetKey    = "default_statistics_target"
+	MaxConnectionsKey = "max_connections"
+	RandomPageCostKey = "random_page_cost"
+	MaxLocksPerTxKey  = "max_locks_per_transaction"
+	EffectiveIOKey    = "effective_io_concurrency" // linux only
 
 	// nonnumeric
 	DefaultToastCompression = "default_toast_compression"
 	Jit                     = "jit"
 
-	checkpointDefault           = "0.9"
-	statsTargetDefault          = "100"
-	randomPageCostDefault       = "1.1"
-	autovacuumMaxWorkersDefault = "10"
-	autovacuumNaptimeDefault    = "10"
+	checkpointDefault     = "0.9"
+	statsTargetDefault    = "100"
+	randomPageCostDefault = "1.1"
 	// effective io concurrency has changed in v13: https://www.postgresql.org/docs/13/release-13.html
 	// However, our previous value of 200 is translated to 1176, which seems excessively high
 	// (the upper limit is 1000. For the SSDs we'll follow up the wise man's advice here:
@@ -37,6 +33,14 @@ const (
 	effectiveIODefault            = "256"
 	lz4Compression                = "lz4"
 	off                           = "off"
+	// Spinning disks pay for every seek and can only serve a couple of
+	// requests at once, so random reads cost as much as stock PostgreSQL
+	// assumes.
+	randomPageCostHDD = "4.0"
+	effectiveIOHDD    = "2"
+	// Network storage (NFS, EBS, ...) has no seek penalty, but each request
+	// has a round trip, so random reads are a bit costlier than on local SSDs.
+	randomPageCostNetwork = "1.5"
 
 	// If you want to lower this value, consider that Patroni will not accept anything less than 25 as
 	// a valid max_connections and will replace it with 100, per
@@ -65,6 +69,18 @@ func getMaxConns(totalMemory uint64) uint64 {
 	}
 }
 
+// getMaxConnsForProfile gives the default amount of connections for profile,
+// based on a memory step function.
+func getMaxConnsForProfile(profile Profile, totalMemory uint64) uint64 {
+	switch profile {
+	case OLTPProfile:
+		return getOLTPMaxConns(totalMemory)
+	case AnalyticsProfile:
+		return getAnalyticsMaxConns(totalMemory)
+	}
+	return getMaxConns(totalMemory)
+}
+
 func getValueForVersion(currentVersion string, oldVersions []string, oldVersionValue, newVersionValue string) string {
 	for _, ov := range oldVersions {
 		if ov == currentVersion {
@@ -100,8 +116,6 @@ var MiscKeys = []string{
 	CheckpointKey,
 	MaxConnectionsKey,
 	MaxLocksPerTxKey,
-	AutovacuumMaxWorkersKey,
-	AutovacuumNaptimeKey,
 	DefaultToastCompression,
 	Jit,
 
@@ -113,11 +127,12 @@ type MiscRecommender struct {
 	totalMemory    uint64
 	maxConns       uint64
 	pgMajorVersion string
+	storage        StorageClass
 }
 
 // NewMiscRecommender returns a MiscRecommender (unaffected by system resources).
 func NewMiscRecommender(totalMemory, maxConns uint64, pgMajorVersion string) *MiscRecommender {
-	return &MiscRecommender{totalMemory, maxConns, pgMajorVersion}
+	return &MiscRecommender{totalMemory, maxConns, pgMajorVersion, StorageUnknown}
 }
 
 // IsAvailable returns whether this Recommender is usable given the system resources. Always true.
@@ -133,13 +148,18 @@ func (r *MiscRecommender) Recommend(key string) string {
 		return checkpointDefault
 	case StatsTargetKey:
 		return statsTargetDefault
-	case AutovacuumMaxWorkersKey:
-		return autovacuumMaxWorkersDefault
-	case AutovacuumNaptimeKey:
-		return autovacuumNaptimeDefault
 	case RandomPageCostKey:
+		switch r.storage {
+		case StorageHDD:
+			return randomPageCostHDD
+		case StorageNetwork:
+			return randomPageCostNetwork
+		}
 		return randomPageCostDefault
 	case EffectiveIOKey:
+		if r.storage == StorageHDD {
+			return effectiveIOHDD
+		}
 		return getValueForVersion(r.pgMajorVersion, []string{
 			pgutils.MajorVersion96, pgutils.MajorVersion10, pgutils.MajorVersion11, pgutils.MajorVersion12},
 			effectiveIODefaultOldVersions, effectiveIODefault,
@@ -178,6 +198,7 @@ type MiscSettingsGroup struct {
 	totalMemory    uint64
 	maxConns       uint64
 	pgMajorVersion string
+	storage        StorageClass
 }
 
 // Label should always return the value MiscLabel.
@@ -193,5 +214,40 @@ func (sg *MiscSettingsGroup) Keys() []string {
 
 // GetRecommender should return a new MiscRecommender.
 func (sg *MiscSettingsGroup) GetRecommender(profile Profile) Recommender {
-	return NewMiscRecommender(sg.totalMemory, sg.maxConns, sg.pgMajorVersion)
+	switch profile {
+	case OLTPProfile:
+		r := NewOLTPMiscRecommender(sg.totalMemory, sg.maxConns, sg.pgMajorVersion)
+		r.storage = sg.storage
+		return r
+	case AnalyticsProfile:
+		r := NewAnalyticsMiscRecommender(sg.totalMemory, sg.maxConns, sg.pgMajorVersion)
+		r.storage = sg.storage
+		return r
+	case IngestProfile:
+		r := NewIngestMiscRecommender(sg.totalMemory, sg.maxConns, sg.pgMajorVersion)
+		r.storage = sg.storage
+		return r
+	default:
+		r := NewMiscRecommender(sg.totalMemory, sg.maxConns, sg.pgMajorVersion)
+		r.storage = sg.storage
+		return r
+	}
+}
+
+// MiscFloatParser parses the values of MiscKeys. jit is a bool, and
+// default_toast_compression is parsed by its position in EnumValues.
+type MiscFloatParser struct{}
+
+func (v *MiscFloatParser) ParseFloat(key string, s string) (float64, error) {
+	switch key {
+	case Jit:
+		bfp := &boolFloatParser{}
+		return bfp.ParseFloat(key, s)
+	case DefaultToastCompression:
+		efp := &enumFloatParser{}
+		return efp.ParseFloat(key, s)
+	default:
+		nfp := &numericFloatParser{}
+		return nfp.ParseFloat(key, s)
+	}
 }
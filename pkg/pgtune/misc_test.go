@@ -49,8 +49,6 @@ func init() {
 			miscSettingsMatrix[mem][conns][StatsTargetKey] = statsTargetDefault
 			miscSettingsMatrix[mem][conns][RandomPageCostKey] = randomPageCostDefault
 			miscSettingsMatrix[mem][conns][EffectiveIOKey] = effectiveIODefaultOldVersions
-			miscSettingsMatrix[mem][conns][AutovacuumMaxWorkersKey] = autovacuumMaxWorkersDefault
-			miscSettingsMatrix[mem][conns][AutovacuumNaptimeKey] = autovacuumNaptimeDefault
 		}
 	}
 }
@@ -235,12 +233,44 @@ func TestNewMiscRecommender(t *testing.T) {
 func TestMiscRecommenderRecommend(t *testing.T) {
 	for totalMemory, outerMatrix := range miscSettingsMatrix {
 		for maxConns, matrix := range outerMatrix {
-			r := &MiscRecommender{totalMemory, maxConns, pgutils.MajorVersion10}
+			r := &MiscRecommender{totalMemory, maxConns, pgutils.MajorVersion10, StorageUnknown}
 			testRecommender(t, r, MiscKeys, matrix)
 		}
 	}
 }
 
+func TestMiscRecommenderStorage(t *testing.T) {
+	cases := []struct {
+		storage     StorageClass
+		pgVersion   string
+		pageCost    string
+		concurrency string
+	}{
+		{StorageUnknown, pgutils.MajorVersion12, randomPageCostDefault, effectiveIODefaultOldVersions},
+		{StorageUnknown, pgutils.MajorVersion15, randomPageCostDefault, effectiveIODefault},
+		{StorageSSD, pgutils.MajorVersion12, randomPageCostDefault, effectiveIODefaultOldVersions},
+		{StorageSSD, pgutils.MajorVersion15, randomPageCostDefault, effectiveIODefault},
+		{StorageHDD, pgutils.MajorVersion12, randomPageCostHDD, effectiveIOHDD},
+		{StorageHDD, pgutils.MajorVersion15, randomPageCostHDD, effectiveIOHDD},
+		{StorageNetwork, pgutils.MajorVersion12, randomPageCostNetwork, effectiveIODefaultOldVersions},
+		{StorageNetwork, pgutils.MajorVersion15, randomPageCostNetwork, effectiveIODefault},
+	}
+	for _, c := range cases {
+		config, err := NewSystemConfig(8*parse.Gigabyte, 8, c.pgVersion, walDiskUnset, 0, MaxBackgroundWorkersDefault)
+		if err != nil {
+			t.Fatalf("unexpected error on system config creation: got %v", err)
+		}
+		config.Storage = c.storage
+		r := mustGetSettingsGroup(t, MiscLabel, config).GetRecommender(DefaultProfile)
+		if got := r.Recommend(RandomPageCostKey); got != c.pageCost {
+			t.Errorf("%s/%s: incorrect %s: got %s want %s", c.storage, c.pgVersion, RandomPageCostKey, got, c.pageCost)
+		}
+		if got := r.Recommend(EffectiveIOKey); got != c.concurrency {
+			t.Errorf("%s/%s: incorrect %s: got %s want %s", c.storage, c.pgVersion, EffectiveIOKey, got, c.concurrency)
+		}
+	}
+}
+
 func TestMiscRecommenderNoRecommendation(t *testing.T) {
 	r := &MiscRecommender{}
 	if r.Recommend("foo") != NoRecommendation {
@@ -255,9 +285,42 @@ func TestMiscSettingsGroup(t *testing.T) {
 			if err != nil {
 				t.Errorf("unexpected error on system config creation: got %v", err)
 			}
-			sg := GetSettingsGroup(MiscLabel, config)
+			sg := mustGetSettingsGroup(t, MiscLabel, config)
 
 			testSettingGroup(t, sg, DefaultProfile, matrix, MiscLabel, MiscKeys)
 		}
 	}
 }
+
+func TestMiscFloatParserParseFloat(t *testing.T) {
+	cases := []struct {
+		key     string
+		s       string
+		want    float64
+		wantErr bool
+	}{
+		{key: Jit, s: off, want: 0.0},
+		{key: Jit, s: "on", want: 1.0},
+		{key: Jit, s: "pglz", wantErr: true},
+		{key: DefaultToastCompression, s: "pglz", want: 0.0},
+		{key: DefaultToastCompression, s: lz4Compression, want: 1.0},
+		{key: DefaultToastCompression, s: "on", wantErr: true},
+		{key: RandomPageCostKey, s: randomPageCostDefault, want: 1.1},
+	}
+
+	v := &MiscFloatParser{}
+	for _, c := range cases {
+		got, err := v.ParseFloat(c.key, c.s)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s = %s: unexpected lack of error", c.key, c.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s = %s: unexpected error: %v", c.key, c.s, err)
+		} else if got != c.want {
+			t.Errorf("%s = %s: incorrect result: got %f want %f", c.key, c.s, got, c.want)
+		}
+	}
+}
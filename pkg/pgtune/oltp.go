@@ -0,0 +1,168 @@
+package pgtune
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+)
+
+// The OLTP profile is for many short transactions from many connections. Each
+// query needs little memory and parallelism mostly adds overhead, so memory is
+// spread across more connections and parallel query is kept small.
+const (
+	oltpWorkMemDivisor           = 2 // on top of having more connections
+	oltpMaxParallelWorkersGather = 2
+	oltpDefaultMaxWALBytes       = 2 * parse.Gigabyte
+	oltpDefaultCheckpointTimeout = "900" // 15 minutes expressed in seconds
+	oltpDefaultWALCompression    = "on"
+	oltpDefaultBgwriterDelay     = "50" // milliseconds
+	oltpDefaultBgwriterMaxPages  = "400"
+	oltpDefaultBgwriterLRUMult   = "4"
+)
+
+// getOLTPMaxConns gives a default amount of connections for the OLTP profile,
+// which is twice the usual amount.
+func getOLTPMaxConns(totalMemory uint64) uint64 {
+	return 2 * getMaxConns(totalMemory)
+}
+
+// OLTPMemoryRecommender gives recommendations for MemoryKeys for the OLTP profile
+type OLTPMemoryRecommender struct {
+	*MemoryRecommender
+}
+
+// NewOLTPMemoryRecommender returns an OLTPMemoryRecommender that recommends
+// based on the given number of cpus and system memory
+func NewOLTPMemoryRecommender(totalMemory uint64, cpus int, maxConns uint64) *OLTPMemoryRecommender {
+	conns := maxConns
+	if conns == 0 {
+		conns = getOLTPMaxConns(totalMemory)
+	}
+	return &OLTPMemoryRecommender{
+		MemoryRecommender: NewMemoryRecommender(totalMemory, cpus, conns),
+	}
+}
+
+// IsAvailable returns whether this Recommender is usable given the system resources. Always true.
+func (r *OLTPMemoryRecommender) IsAvailable() bool {
+	return true
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *OLTPMemoryRecommender) Recommend(key string) string {
+	switch key {
+	case WorkMemKey:
+		temp := r.workMem() / oltpWorkMemDivisor
+		if temp < workMemMin {
+			temp = workMemMin
+		}
+		return parse.BytesToPGFormat(temp)
+	default:
+		return r.MemoryRecommender.Recommend(key)
+	}
+}
+
+// OLTPParallelRecommender gives recommendations for ParallelKeys for the OLTP profile
+type OLTPParallelRecommender struct {
+	*ParallelRecommender
+}
+
+// NewOLTPParallelRecommender returns an OLTPParallelRecommender that
+// recommends based on the given number of cpus.
+func NewOLTPParallelRecommender(cpus, maxBGWorkers int) *OLTPParallelRecommender {
+	return &OLTPParallelRecommender{NewParallelRecommender(cpus, maxBGWorkers)}
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *OLTPParallelRecommender) Recommend(key string) string {
+	val := r.ParallelRecommender.Recommend(key)
+	if key == MaxParallelWorkersGatherKey {
+		gather := int(math.Round(float64(r.cpus) / 2.0))
+		if gather > oltpMaxParallelWorkersGather {
+			gather = oltpMaxParallelWorkersGather
+		}
+		val = fmt.Sprintf("%d", gather)
+	}
+	return val
+}
+
+// OLTPWALRecommender gives recommendations for WALKeys for the OLTP profile
+type OLTPWALRecommender struct {
+	WALRecommender
+}
+
+// NewOLTPWALRecommender returns an OLTPWALRecommender that recommends based on
+// the given totalMemory bytes.
+func NewOLTPWALRecommender(totalMemory, walDiskSize uint64) *OLTPWALRecommender {
+	return &OLTPWALRecommender{
+		WALRecommender: WALRecommender{
+			totalMemory: totalMemory,
+			walDiskSize: walDiskSize,
+		},
+	}
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *OLTPWALRecommender) Recommend(key string) string {
+	switch key {
+	case MinWALKey:
+		return parse.BytesToPGFormat(r.calcMaxWALBytesWithDefault(oltpDefaultMaxWALBytes) / 2)
+	case MaxWALKey:
+		return parse.BytesToPGFormat(r.calcMaxWALBytesWithDefault(oltpDefaultMaxWALBytes))
+	case CheckpointTimeoutKey:
+		return oltpDefaultCheckpointTimeout
+	case WALCompressionKey:
+		// lots of small updates mean lots of full page writes
+		return oltpDefaultWALCompression
+	default:
+		return r.WALRecommender.Recommend(key)
+	}
+}
+
+// OLTPBgwriterRecommender gives recommendations for BgwriterKeys for the OLTP
+// profile, where the background writer is made more active so that backends
+// rarely have to write out dirty buffers themselves.
+type OLTPBgwriterRecommender struct{}
+
+// IsAvailable returns whether this Recommender is usable given the system resources. Always true.
+func (r *OLTPBgwriterRecommender) IsAvailable() bool {
+	return true
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *OLTPBgwriterRecommender) Recommend(key string) string {
+	switch key {
+	case BgwriterDelayKey:
+		return oltpDefaultBgwriterDelay
+	case BgwriterLRUMaxPagesKey:
+		return oltpDefaultBgwriterMaxPages
+	case BgwriterLRUMultiplierKey:
+		return oltpDefaultBgwriterLRUMult
+	default:
+		return NoRecommendation
+	}
+}
+
+// OLTPMiscRecommender gives recommendations for MiscKeys for the OLTP profile
+type OLTPMiscRecommender struct {
+	*MiscRecommender
+}
+
+// NewOLTPMiscRecommender returns an OLTPMiscRecommender.
+func NewOLTPMiscRecommender(totalMemory, maxConns uint64, pgMajorVersion string) *OLTPMiscRecommender {
+	return &OLTPMiscRecommender{NewMiscRecommender(totalMemory, maxConns, pgMajorVersion)}
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *OLTPMiscRecommender) Recommend(key string) string {
+	if key == MaxConnectionsKey && r.maxConns == 0 {
+		return fmt.Sprintf("%d", getOLTPMaxConns(r.totalMemory))
+	}
+	return r.MiscRecommender.Recommend(key)
+}
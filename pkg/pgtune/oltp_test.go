@@ -0,0 +1,164 @@
+package pgtune
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+var (
+	// oltpMemorySettingsMatrix stores the test cases for OLTPMemoryRecommender
+	// along with the expected values
+	oltpMemorySettingsMatrix = newMemorySettingsMatrix(defaultMemoryToBaseVals, 2*MaxConnectionsDefault, func(wm uint64) uint64 {
+		if wm/oltpWorkMemDivisor < workMemMin {
+			return workMemMin
+		}
+		return wm / oltpWorkMemDivisor
+	})
+	// oltpParallelSettingsMatrix stores the test cases for OLTPParallelRecommender
+	// along with the expected values
+	oltpParallelSettingsMatrix = newParallelSettingsMatrix(map[int]string{2: "1", 4: "2", 5: "2"})
+	// oltpWALSettingsMatrix stores the test cases for OLTPWALRecommender along
+	// with the expected values
+	oltpWALSettingsMatrix = newWALSettingsMatrix(memoryToWALBuffers, map[uint64]uint64{
+		walDiskUnset:          oltpDefaultMaxWALBytes,
+		walDiskDivideUnevenly: 4928 * parse.Megabyte, // nearest 16MB segment
+		walDiskDivideEvenly:   5280 * parse.Megabyte,
+	}, oltpDefaultCheckpointTimeout, oltpDefaultWALCompression)
+)
+
+func TestOLTPMemoryRecommenderRecommend(t *testing.T) {
+	for totalMemory, cpuMatrix := range oltpMemorySettingsMatrix {
+		for cpus, connMatrix := range cpuMatrix {
+			for conns, cases := range connMatrix {
+				r := NewOLTPMemoryRecommender(totalMemory, cpus, conns)
+				if !r.IsAvailable() {
+					t.Errorf("unexpectedly not available")
+				}
+				testRecommender(t, r, MemoryKeys, cases)
+			}
+		}
+	}
+}
+
+func TestOLTPMemorySettingsGroup(t *testing.T) {
+	for totalMemory, cpuMatrix := range oltpMemorySettingsMatrix {
+		for cpus, connMatrix := range cpuMatrix {
+			for conns, matrix := range connMatrix {
+				config := getDefaultTestSystemConfig(t)
+				config.CPUs = cpus
+				config.Memory = totalMemory
+				config.maxConns = conns
+
+				sg := mustGetSettingsGroup(t, MemoryLabel, config)
+				testSettingGroup(t, sg, OLTPProfile, matrix, MemoryLabel, MemoryKeys)
+			}
+		}
+	}
+}
+
+func TestOLTPParallelRecommenderRecommend(t *testing.T) {
+	for cpus, tempMatrix := range oltpParallelSettingsMatrix {
+		for workers, matrix := range tempMatrix {
+			r := NewOLTPParallelRecommender(cpus, workers)
+			testRecommender(t, r, ParallelKeys, matrix)
+		}
+	}
+}
+
+func TestOLTPParallelSettingsGroup(t *testing.T) {
+	for cpus, tempMatrix := range oltpParallelSettingsMatrix {
+		for workers, matrix := range tempMatrix {
+			config := getDefaultTestSystemConfig(t)
+			config.CPUs = cpus
+			config.PGMajorVersion = pgutils.MajorVersion11
+			config.MaxBGWorkers = workers
+			sg := mustGetSettingsGroup(t, ParallelLabel, config)
+			testSettingGroup(t, sg, OLTPProfile, matrix, ParallelLabel, ParallelKeys)
+		}
+	}
+}
+
+func TestOLTPWALRecommenderRecommend(t *testing.T) {
+	for totalMemory, outerMatrix := range oltpWALSettingsMatrix {
+		for walSize, matrix := range outerMatrix {
+			r := NewOLTPWALRecommender(totalMemory, walSize)
+			testRecommender(t, r, WALKeys, matrix)
+		}
+	}
+}
+
+func TestOLTPWALSettingsGroup(t *testing.T) {
+	for totalMemory, outerMatrix := range oltpWALSettingsMatrix {
+		for walSize, matrix := range outerMatrix {
+			config := getDefaultTestSystemConfig(t)
+			config.Memory = totalMemory
+			config.WALDiskSize = walSize
+			sg := mustGetSettingsGroup(t, WALLabel, config)
+			testSettingGroup(t, sg, OLTPProfile, matrix, WALLabel, WALKeys)
+		}
+	}
+}
+
+func TestOLTPBgwriterRecommender(t *testing.T) {
+	r := &OLTPBgwriterRecommender{}
+	if !r.IsAvailable() {
+		t.Error("OLTPBgwriterRecommender should always be available")
+	}
+	testRecommender(t, r, BgwriterKeys, map[string]string{
+		BgwriterFlushAfterKey:    NoRecommendation,
+		BgwriterDelayKey:         oltpDefaultBgwriterDelay,
+		BgwriterLRUMaxPagesKey:   oltpDefaultBgwriterMaxPages,
+		BgwriterLRUMultiplierKey: oltpDefaultBgwriterLRUMult,
+	})
+}
+
+func TestOLTPMiscRecommenderRecommend(t *testing.T) {
+	cases := []struct {
+		desc        string
+		totalMemory uint64
+		maxConns    uint64
+		want        string
+	}{
+		{
+			desc:        "twice the default conns",
+			totalMemory: 8 * parse.Gigabyte,
+			want:        fmt.Sprintf("%d", 2*MaxConnectionsDefault),
+		},
+		{
+			desc:        "twice the default conns, low memory",
+			totalMemory: 2 * parse.Gigabyte,
+			want:        fmt.Sprintf("%d", 2*minMaxConns),
+		},
+		{
+			desc:        "given conns",
+			totalMemory: 8 * parse.Gigabyte,
+			maxConns:    50,
+			want:        "50",
+		},
+	}
+
+	for _, c := range cases {
+		config, err := NewSystemConfig(c.totalMemory, 8, pgutils.MajorVersion12, walDiskUnset, c.maxConns, MaxBackgroundWorkersDefault)
+		if err != nil {
+			t.Fatalf("unexpected error on system config creation: got %v", err)
+		}
+		r := mustGetSettingsGroup(t, MiscLabel, config).GetRecommender(OLTPProfile)
+		if got := r.Recommend(MaxConnectionsKey); got != c.want {
+			t.Errorf("%s: incorrect %s: got %s want %s", c.desc, MaxConnectionsKey, got, c.want)
+		}
+
+		// everything else is the same as the default profile
+		base := mustGetSettingsGroup(t, MiscLabel, config).GetRecommender(DefaultProfile)
+		for _, k := range MiscKeys {
+			if k == MaxConnectionsKey {
+				continue
+			}
+			if got, want := r.Recommend(k), base.Recommend(k); got != want {
+				t.Errorf("%s: incorrect %s: got %s want %s", c.desc, k, got, want)
+			}
+		}
+	}
+}
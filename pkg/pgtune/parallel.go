@@ -94,5 +94,14 @@ func (sg *ParallelSettingsGroup) Keys() []string {
 
 // GetRecommender should return a new ParallelRecommender.
 func (sg *ParallelSettingsGroup) GetRecommender(profile Profile) Recommender {
-	return NewParallelRecommender(sg.cpus, sg.maxBGWorkers)
+	switch profile {
+	case OLTPProfile:
+		return NewOLTPParallelRecommender(sg.cpus, sg.maxBGWorkers)
+	case AnalyticsProfile:
+		return NewAnalyticsParallelRecommender(sg.cpus, sg.maxBGWorkers)
+	case IngestProfile:
+		return NewIngestParallelRecommender(sg.cpus, sg.maxBGWorkers)
+	default:
+		return NewParallelRecommender(sg.cpus, sg.maxBGWorkers)
+	}
 }
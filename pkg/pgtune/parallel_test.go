@@ -138,7 +138,7 @@ func TestParallelSettingsGroup(t *testing.T) {
 			config.CPUs = cpus
 			config.PGMajorVersion = pgutils.MajorVersion96 // 9.6 lacks one key
 			config.MaxBGWorkers = workers
-			sg := GetSettingsGroup(ParallelLabel, config)
+			sg := mustGetSettingsGroup(t, ParallelLabel, config)
 			if got := len(sg.Keys()); got != keyCount-1 {
 				t.Errorf("incorrect number of keys for PG %s: got %d want %d", pgutils.MajorVersion96, got, keyCount-1)
 			}
@@ -146,14 +146,14 @@ func TestParallelSettingsGroup(t *testing.T) {
 
 			// PG10 adds a key
 			config.PGMajorVersion = pgutils.MajorVersion10
-			sg = GetSettingsGroup(ParallelLabel, config)
+			sg = mustGetSettingsGroup(t, ParallelLabel, config)
 			if got := len(sg.Keys()); got != keyCount {
 				t.Errorf("incorrect number of keys for PG %s: got %d want %d", pgutils.MajorVersion10, got, keyCount)
 			}
 			testSettingGroup(t, sg, DefaultProfile, matrix, ParallelLabel, ParallelKeys)
 
 			config.PGMajorVersion = pgutils.MajorVersion11
-			sg = GetSettingsGroup(ParallelLabel, config)
+			sg = mustGetSettingsGroup(t, ParallelLabel, config)
 			if got := len(sg.Keys()); got != keyCount {
 				t.Errorf("incorrect number of keys for PG %s: got %d want %d", pgutils.MajorVersion11, got, keyCount)
 			}
@@ -162,3 +162,21 @@ func TestParallelSettingsGroup(t *testing.T) {
 	}
 
 }
+
+// newParallelSettingsMatrix builds the test cases for a profile's parallel
+// recommender from parallelSettingsMatrix, replacing the number of workers per
+// gather with cpusToGather.
+func newParallelSettingsMatrix(cpusToGather map[int]string) map[int]map[int]map[string]string {
+	matrix := make(map[int]map[int]map[string]string)
+	for cpus, tempMatrix := range parallelSettingsMatrix {
+		matrix[cpus] = make(map[int]map[string]string)
+		for workers, wants := range tempMatrix {
+			matrix[cpus][workers] = make(map[string]string)
+			for k, v := range wants {
+				matrix[cpus][workers][k] = v
+			}
+			matrix[cpus][workers][MaxParallelWorkersGatherKey] = cpusToGather[cpus]
+		}
+	}
+	return matrix
+}
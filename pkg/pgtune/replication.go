@@ -0,0 +1,224 @@
+package pgtune
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+// Keys in the conf file that are tuned for streaming replication
+const (
+	WALLevelKey            = "wal_level"
+	MaxWALSendersKey       = "max_wal_senders"
+	MaxReplicationSlotsKey = "max_replication_slots"
+	WALKeepSizeKey         = "wal_keep_size"     // PG13+
+	WALKeepSegmentsKey     = "wal_keep_segments" // before PG13
+	MaxSlotWALKeepSizeKey  = "max_slot_wal_keep_size"
+	HotStandbyFeedbackKey  = "hot_standby_feedback"
+	WALLogHintsKey         = "wal_log_hints"
+
+	walLevelReplica = "replica"
+	// Besides one per replica, WAL senders (and slots) are needed for base
+	// backups and for tools like pg_receivewal; PostgreSQL's default of 10 is
+	// kept as the minimum.
+	walSendersSpare = 2
+	walSendersMin   = 10
+	// WAL kept for standbys that fall behind is a share of the WAL disk, on
+	// top of max_wal_size. Replication slots may hold on to more, but are
+	// capped so that an abandoned slot cannot fill the disk.
+	walKeepDiskPct     = 25
+	slotWALKeepDiskPct = 80
+	walKeepDefault     = 1 * parse.Gigabyte // when the WAL disk size is not known
+	walSegmentSize     = 16 * parse.Megabyte
+
+	errUnrecognizedRole = "unrecognized role: %s"
+)
+
+// ReplicationLabel is the label used to refer to the replication settings group
+const ReplicationLabel = "replication"
+
+// ReplicationKeys is an array of keys that are tunable for streaming replication
+var ReplicationKeys = []string{
+	WALLevelKey,
+	MaxWALSendersKey,
+	MaxReplicationSlotsKey,
+	WALKeepSizeKey,
+	WALKeepSegmentsKey,
+	MaxSlotWALKeepSizeKey,
+	HotStandbyFeedbackKey,
+	WALLogHintsKey,
+}
+
+// Role is the part a server plays in streaming replication.
+type Role int
+
+// Roles that recommendations can be tailored to. Replication settings are
+// not tuned for RoleUnknown.
+const (
+	RoleUnknown Role = iota
+	RoleStandalone
+	RolePrimary
+	RoleStandby
+)
+
+// ValidRoles are the names that ParseRole accepts.
+var ValidRoles = []string{"primary", "standby", "standalone"}
+
+// ParseRole converts s into a Role. A blank s is RoleUnknown.
+func ParseRole(s string) (Role, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return RoleUnknown, nil
+	case "standalone":
+		return RoleStandalone, nil
+	case "primary":
+		return RolePrimary, nil
+	case "standby":
+		return RoleStandby, nil
+	default:
+		return RoleUnknown, fmt.Errorf(errUnrecognizedRole, s)
+	}
+}
+
+func (r Role) String() string {
+	switch r {
+	case RoleStandalone:
+		return "standalone"
+	case RolePrimary:
+		return "primary"
+	case RoleStandby:
+		return "standby"
+	default:
+		return "unknown"
+	}
+}
+
+// ReplicationRecommender gives recommendations for ReplicationKeys based on
+// the role of the server, the number of replicas, and the WAL disk.
+type ReplicationRecommender struct {
+	role           Role
+	replicas       int
+	walDiskSize    uint64
+	pgMajorVersion string
+}
+
+// NewReplicationRecommender returns a ReplicationRecommender for a server with
+// the given role in a cluster with the given number of replicas.
+func NewReplicationRecommender(role Role, replicas int, walDiskSize uint64, pgMajorVersion string) *ReplicationRecommender {
+	return &ReplicationRecommender{role, replicas, walDiskSize, pgMajorVersion}
+}
+
+// IsAvailable returns whether this Recommender is usable given the system
+// resources. True only when the role of the server is known.
+func (r *ReplicationRecommender) IsAvailable() bool {
+	return r.role != RoleUnknown
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key. Primaries and standbys get the same settings, so that
+// either can take over from the other.
+func (r *ReplicationRecommender) Recommend(key string) string {
+	oldVersions := []string{pgutils.MajorVersion96, pgutils.MajorVersion10, pgutils.MajorVersion11, pgutils.MajorVersion12}
+	switch key {
+	case WALLevelKey:
+		// replica is also needed for base backups of a standalone server
+		return walLevelReplica
+	case MaxSlotWALKeepSizeKey:
+		if r.walDiskSize == 0 {
+			return NoRecommendation
+		}
+		return getValueForVersion(r.pgMajorVersion, oldVersions, NoRecommendation,
+			parse.BytesToPGFormat(r.walDiskShare(slotWALKeepDiskPct)))
+	}
+
+	if r.role == RoleStandalone {
+		return NoRecommendation
+	}
+	switch key {
+	case MaxWALSendersKey, MaxReplicationSlotsKey:
+		senders := r.replicas + walSendersSpare
+		if senders < walSendersMin {
+			senders = walSendersMin
+		}
+		return fmt.Sprintf("%d", senders)
+	case WALKeepSizeKey:
+		return getValueForVersion(r.pgMajorVersion, oldVersions, NoRecommendation, parse.BytesToPGFormat(r.walKeepBytes()))
+	case WALKeepSegmentsKey:
+		return getValueForVersion(r.pgMajorVersion, oldVersions, fmt.Sprintf("%d", r.walKeepBytes()/walSegmentSize), NoRecommendation)
+	case HotStandbyFeedbackKey, WALLogHintsKey:
+		// wal_log_hints lets pg_rewind turn a failed primary into a standby
+		return on
+	}
+	return NoRecommendation
+}
+
+// walKeepBytes returns how much WAL to keep for standbys that fall behind.
+func (r *ReplicationRecommender) walKeepBytes() uint64 {
+	if r.walDiskSize == 0 {
+		return walKeepDefault
+	}
+	return r.walDiskShare(walKeepDiskPct)
+}
+
+// walDiskShare returns pct percent of the WAL disk, rounded up to a whole WAL
+// segment.
+func (r *ReplicationRecommender) walDiskShare(pct uint64) uint64 {
+	share := r.walDiskSize * pct / 100
+	if share%walSegmentSize != 0 {
+		share = (share/walSegmentSize + 1) * walSegmentSize
+	}
+	return share
+}
+
+// ReplicationSettingsGroup is the SettingsGroup to represent settings for
+// streaming replication. It is only tuned when the role of the server is known.
+type ReplicationSettingsGroup struct {
+	role           Role
+	replicas       int
+	walDiskSize    uint64
+	pgMajorVersion string
+}
+
+// Label should always return the value ReplicationLabel.
+func (sg *ReplicationSettingsGroup) Label() string { return ReplicationLabel }
+
+// Keys should always return the ReplicationKeys slice.
+func (sg *ReplicationSettingsGroup) Keys() []string { return ReplicationKeys }
+
+// GetRecommender should return a new ReplicationRecommender.
+func (sg *ReplicationSettingsGroup) GetRecommender(profile Profile) Recommender {
+	return NewReplicationRecommender(sg.role, sg.replicas, sg.walDiskSize, sg.pgMajorVersion)
+}
+
+// ReplicationFloatParser parses the values of ReplicationKeys. wal_level is
+// parsed by how much it logs, where logical counts the same as replica since
+// it includes everything replica needs, so that it is not replaced.
+// max_slot_wal_keep_size can be -1 for no limit, which is parsed as -1.
+type ReplicationFloatParser struct{}
+
+func (v *ReplicationFloatParser) ParseFloat(key string, s string) (float64, error) {
+	switch key {
+	case WALLevelKey:
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "minimal":
+			return 0.0, nil
+		case walLevelReplica, "archive", "hot_standby", "logical":
+			return 1.0, nil
+		default:
+			return 0.0, fmt.Errorf("unknown %s: %s", WALLevelKey, s)
+		}
+	case WALKeepSizeKey, MaxSlotWALKeepSizeKey:
+		if strings.TrimSpace(s) == "-1" {
+			return -1.0, nil
+		}
+		return parseBytesWithDefaultUnit(s, parse.Megabyte)
+	case HotStandbyFeedbackKey, WALLogHintsKey:
+		bfp := &boolFloatParser{}
+		return bfp.ParseFloat(key, s)
+	default:
+		nfp := &numericFloatParser{}
+		return nfp.ParseFloat(key, s)
+	}
+}
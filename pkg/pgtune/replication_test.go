@@ -0,0 +1,180 @@
+package pgtune
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+func TestParseRole(t *testing.T) {
+	cases := []struct {
+		s      string
+		want   Role
+		errMsg string
+	}{
+		{s: "", want: RoleUnknown},
+		{s: "standalone", want: RoleStandalone},
+		{s: "Primary", want: RolePrimary},
+		{s: "standby", want: RoleStandby},
+		{s: "replica", want: RoleUnknown, errMsg: fmt.Sprintf(errUnrecognizedRole, "replica")},
+	}
+	for _, c := range cases {
+		got, err := ParseRole(c.s)
+		if c.errMsg == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.s, err)
+		} else if c.errMsg != "" && (err == nil || err.Error() != c.errMsg) {
+			t.Errorf("%s: incorrect error: got %v want %s", c.s, err, c.errMsg)
+		}
+		if got != c.want {
+			t.Errorf("%s: incorrect role: got %v want %v", c.s, got, c.want)
+		}
+	}
+
+	for _, s := range ValidRoles {
+		r, err := ParseRole(s)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", s, err)
+		} else if got := r.String(); got != s {
+			t.Errorf("%s: incorrect round trip: got %s", s, got)
+		}
+	}
+	if got := RoleUnknown.String(); got != "unknown" {
+		t.Errorf("incorrect string for unknown role: got %s", got)
+	}
+}
+
+func TestReplicationSettingsGroup(t *testing.T) {
+	cases := []struct {
+		desc        string
+		role        Role
+		replicas    int
+		walDiskSize uint64
+		pgVersion   string
+		want        map[string]string
+	}{
+		{
+			desc:        "primary with a few replicas",
+			role:        RolePrimary,
+			replicas:    3,
+			walDiskSize: 100 * parse.Gigabyte,
+			pgVersion:   pgutils.MajorVersion16,
+			want: map[string]string{
+				WALLevelKey:            walLevelReplica,
+				MaxWALSendersKey:       "10",
+				MaxReplicationSlotsKey: "10",
+				WALKeepSizeKey:         "25GB",
+				MaxSlotWALKeepSizeKey:  "80GB",
+				HotStandbyFeedbackKey:  on,
+				WALLogHintsKey:         on,
+			},
+		},
+		{
+			desc:      "standby with many replicas, old PG, unknown disk",
+			role:      RoleStandby,
+			replicas:  12,
+			pgVersion: pgutils.MajorVersion12,
+			want: map[string]string{
+				WALLevelKey:            walLevelReplica,
+				MaxWALSendersKey:       "14",
+				MaxReplicationSlotsKey: "14",
+				WALKeepSegmentsKey:     "64",
+				HotStandbyFeedbackKey:  on,
+				WALLogHintsKey:         on,
+			},
+		},
+		{
+			desc:        "standalone on a small disk",
+			role:        RoleStandalone,
+			walDiskSize: 10 * parse.Gigabyte,
+			pgVersion:   pgutils.MajorVersion13,
+			want: map[string]string{
+				WALLevelKey:           walLevelReplica,
+				MaxSlotWALKeepSizeKey: "8GB",
+			},
+		},
+		{
+			desc:        "primary on an odd sized disk",
+			role:        RolePrimary,
+			walDiskSize: 1000 * parse.Megabyte,
+			pgVersion:   pgutils.MajorVersion17,
+			want: map[string]string{
+				WALLevelKey:            walLevelReplica,
+				MaxWALSendersKey:       "10",
+				MaxReplicationSlotsKey: "10",
+				WALKeepSizeKey:         "256MB",
+				MaxSlotWALKeepSizeKey:  "800MB",
+				HotStandbyFeedbackKey:  on,
+				WALLogHintsKey:         on,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		config, err := NewSystemConfig(8*parse.Gigabyte, 4, c.pgVersion, c.walDiskSize, 0, MaxBackgroundWorkersDefault)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.desc, err)
+		}
+		config.Role = c.role
+		config.Replicas = c.replicas
+		sg := mustGetSettingsGroup(t, ReplicationLabel, config)
+		testSettingGroup(t, sg, DefaultProfile, c.want, ReplicationLabel, ReplicationKeys)
+
+		r := sg.GetRecommender(DefaultProfile)
+		if !r.IsAvailable() {
+			t.Errorf("%s: should be available", c.desc)
+		}
+		if got := r.Recommend("foo"); got != NoRecommendation {
+			t.Errorf("%s: unexpected recommendation for unknown key: %s", c.desc, got)
+		}
+	}
+
+	r := NewReplicationRecommender(RoleUnknown, 0, 0, pgutils.MajorVersion16)
+	if r.IsAvailable() {
+		t.Errorf("should not be available without a role")
+	}
+}
+
+func TestReplicationFloatParserParseFloat(t *testing.T) {
+	cases := []struct {
+		key       string
+		s         string
+		want      float64
+		shouldErr bool
+	}{
+		{WALLevelKey, "minimal", 0.0, false},
+		{WALLevelKey, "replica", 1.0, false},
+		{WALLevelKey, "hot_standby", 1.0, false},
+		{WALLevelKey, "logical", 1.0, false},
+		{WALLevelKey, "everything", 0.0, true},
+		{WALKeepSizeKey, "1GB", float64(parse.Gigabyte), false},
+		{WALKeepSizeKey, "512", float64(512 * parse.Megabyte), false},
+		{MaxSlotWALKeepSizeKey, "-1", -1.0, false},
+		{MaxSlotWALKeepSizeKey, "80GB", float64(80 * parse.Gigabyte), false},
+		{HotStandbyFeedbackKey, "on", 1.0, false},
+		{WALLogHintsKey, "off", 0.0, false},
+		{MaxWALSendersKey, "10", 10.0, false},
+		{WALKeepSegmentsKey, "64", 64.0, false},
+	}
+
+	v := &ReplicationFloatParser{}
+	for _, c := range cases {
+		got, err := v.ParseFloat(c.key, c.s)
+		if c.shouldErr {
+			if err == nil {
+				t.Errorf("%s: unexpected lack of error for %s", c.key, c.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error for %s: %v", c.key, c.s, err)
+		} else if got != c.want {
+			t.Errorf("%s: incorrect result for %s: got %f want %f", c.key, c.s, got, c.want)
+		}
+	}
+
+	if _, ok := GetFloatParser(&ReplicationRecommender{}).(*ReplicationFloatParser); !ok {
+		t.Errorf("incorrect FloatParser for ReplicationRecommender")
+	}
+}
@@ -0,0 +1,27 @@
+package pgtune
+
+// restartKeys are the settings we deal with that can only be changed at
+// server start (the "postmaster" context in pg_settings), so a reload is not
+// enough for new values to take effect.
+var restartKeys = map[string]bool{
+	"shared_preload_libraries": true,
+	SharedBuffersKey:           true,
+	MaxConnectionsKey:          true,
+	MaxLocksPerTxKey:           true,
+	MaxWorkerProcessesKey:      true,
+	MaxBackgroundWorkers:       true,
+	WALBuffersKey:              true,
+	AutovacuumMaxWorkersKey:    true,
+	PGStatStatementsMaxKey:     true,
+	TrackActivityQuerySizeKey:  true,
+	WALLevelKey:                true,
+	MaxWALSendersKey:           true,
+	MaxReplicationSlotsKey:     true,
+	WALLogHintsKey:             true,
+}
+
+// RequiresRestart returns whether a change to the setting key only takes effect
+// after PostgreSQL is restarted.
+func RequiresRestart(key string) bool {
+	return restartKeys[key]
+}
@@ -0,0 +1,23 @@
+package pgtune
+
+import "testing"
+
+func TestRequiresRestart(t *testing.T) {
+	cases := map[string]bool{
+		"shared_preload_libraries":  true,
+		SharedBuffersKey:            true,
+		MaxConnectionsKey:           true,
+		MaxWorkerProcessesKey:       true,
+		MaxBackgroundWorkers:        true,
+		WALBuffersKey:               true,
+		WorkMemKey:                  false,
+		MaxWALKey:                   false,
+		MaxParallelWorkersGatherKey: false,
+		"foo":                       false,
+	}
+	for key, want := range cases {
+		if got := RequiresRestart(key); got != want {
+			t.Errorf("incorrect result for %s: got %v want %v", key, got, want)
+		}
+	}
+}
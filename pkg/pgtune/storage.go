@@ -0,0 +1,54 @@
+package pgtune
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StorageClass is the kind of storage the data directory is on, which changes
+// how expensive random reads are and how many can be in flight at once.
+type StorageClass int
+
+// Storage classes that recommendations can be tailored to. StorageUnknown
+// gets the same recommendations as StorageSSD.
+const (
+	StorageUnknown StorageClass = iota
+	StorageSSD
+	StorageHDD
+	StorageNetwork
+)
+
+const errUnrecognizedStorage = "unrecognized storage class: %s"
+
+// ValidStorageClasses are the names that ParseStorageClass accepts.
+var ValidStorageClasses = []string{"ssd", "hdd", "network"}
+
+// ParseStorageClass converts s into a StorageClass. A blank s is
+// StorageUnknown.
+func ParseStorageClass(s string) (StorageClass, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return StorageUnknown, nil
+	case "ssd":
+		return StorageSSD, nil
+	case "hdd":
+		return StorageHDD, nil
+	case "network":
+		return StorageNetwork, nil
+	default:
+		return StorageUnknown, fmt.Errorf(errUnrecognizedStorage, s)
+	}
+}
+
+func (s StorageClass) String() string {
+	switch s {
+	case StorageSSD:
+		return "ssd"
+	case StorageHDD:
+		return "hdd"
+	case StorageNetwork:
+		return "network"
+	default:
+		return "unknown"
+	}
+}
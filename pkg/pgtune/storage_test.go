@@ -0,0 +1,43 @@
+package pgtune
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseStorageClass(t *testing.T) {
+	cases := []struct {
+		s      string
+		want   StorageClass
+		errMsg string
+	}{
+		{s: "", want: StorageUnknown},
+		{s: "ssd", want: StorageSSD},
+		{s: "HDD", want: StorageHDD},
+		{s: "network", want: StorageNetwork},
+		{s: "tape", want: StorageUnknown, errMsg: fmt.Sprintf(errUnrecognizedStorage, "tape")},
+	}
+	for _, c := range cases {
+		got, err := ParseStorageClass(c.s)
+		if c.errMsg == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.s, err)
+		} else if c.errMsg != "" && (err == nil || err.Error() != c.errMsg) {
+			t.Errorf("%s: incorrect error: got %v want %s", c.s, err, c.errMsg)
+		}
+		if got != c.want {
+			t.Errorf("%s: incorrect class: got %v want %v", c.s, got, c.want)
+		}
+	}
+
+	for _, s := range ValidStorageClasses {
+		c, err := ParseStorageClass(s)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", s, err)
+		} else if got := c.String(); got != s {
+			t.Errorf("%s: incorrect round trip: got %s", s, got)
+		}
+	}
+	if got := StorageUnknown.String(); got != "unknown" {
+		t.Errorf("incorrect unknown string: got %s", got)
+	}
+}
@@ -0,0 +1,164 @@
+package pgtune
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+)
+
+// Keys in the conf file that are tuned for the TimescaleDB extension itself
+const (
+	MaxCachedChunksKey       = "timescaledb.max_cached_chunks_per_hypertable"
+	MaxOpenChunksKey         = "timescaledb.max_open_chunks_per_insert"
+	MaxTuplesDecompressedKey = "timescaledb.max_tuples_decompressed_per_dml_transaction" // 2.11+
+
+	chunksCacheSmall          = "1024"
+	chunksCacheLarge          = "4096"
+	chunksCacheLargeMemory    = 16 * parse.Gigabyte
+	openChunksPerInsert       = "1024" // TimescaleDB's default
+	tuplesDecompressedDefault = 100000
+	tuplesDecompressedMax     = 1000000
+
+	// bgWorkersOverhead is the number of background workers TimescaleDB needs
+	// on top of one per job: the launcher, and a scheduler for each database
+	// with the extension, of which we allow for a couple
+	bgWorkersOverhead = 3
+)
+
+// TimescaleDBLabel is the label used to refer to the TimescaleDB settings group
+const TimescaleDBLabel = "TimescaleDB"
+
+// TimescaleDBKeys is an array of keys that are tunable for TimescaleDB. Which
+// of them are used depends on the version of the extension.
+var TimescaleDBKeys = []string{
+	MaxCachedChunksKey,
+	MaxOpenChunksKey,
+	MaxTuplesDecompressedKey,
+}
+
+// timescaleDBKeyVersions are the versions of TimescaleDB that first had a key,
+// for keys that are not in every version
+var timescaleDBKeyVersions = map[string][2]int{
+	MaxTuplesDecompressedKey: {2, 11},
+}
+
+var timescaleDBVersionRegex = regexp.MustCompile(`^([0-9]+)\.([0-9]+)`)
+
+// ParseTimescaleDBVersion returns the major and minor versions of a TimescaleDB
+// version string such as "2.14.2" or "2.15.0-dev". ok is false for versions
+// that cannot be parsed.
+func ParseTimescaleDBVersion(version string) (major, minor int, ok bool) {
+	res := timescaleDBVersionRegex.FindStringSubmatch(version)
+	if res == nil {
+		return 0, 0, false
+	}
+	major, errMajor := strconv.Atoi(res[1])
+	minor, errMinor := strconv.Atoi(res[2])
+	if errMajor != nil || errMinor != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+// hasTimescaleDBKey returns whether version of TimescaleDB has key. Unknown
+// versions are assumed to only have the keys every version has, since the
+// extension complains about, and ignores, keys it does not know.
+func hasTimescaleDBKey(version, key string) bool {
+	since, ok := timescaleDBKeyVersions[key]
+	if !ok {
+		return true
+	}
+	major, minor, ok := ParseTimescaleDBVersion(version)
+	if !ok {
+		return false
+	}
+	return major > since[0] || (major == since[0] && minor >= since[1])
+}
+
+// BackgroundWorkersForJobs returns the number of TimescaleDB background
+// workers needed for jobs scheduled jobs to run without waiting for one
+// another, which is never less than MaxBackgroundWorkersDefault.
+func BackgroundWorkersForJobs(jobs int) int {
+	if jobs+bgWorkersOverhead < MaxBackgroundWorkersDefault {
+		return MaxBackgroundWorkersDefault
+	}
+	return jobs + bgWorkersOverhead
+}
+
+// TimescaleDBRecommender gives recommendations for TimescaleDBKeys based on
+// system resources.
+type TimescaleDBRecommender struct {
+	totalMemory uint64
+}
+
+// NewTimescaleDBRecommender returns a TimescaleDBRecommender that recommends
+// based on the given totalMemory.
+func NewTimescaleDBRecommender(totalMemory uint64) *TimescaleDBRecommender {
+	return &TimescaleDBRecommender{totalMemory}
+}
+
+// IsAvailable returns whether this Recommender is usable given the system resources. Always true.
+func (r *TimescaleDBRecommender) IsAvailable() bool {
+	return true
+}
+
+// Recommend returns the recommended PostgreSQL formatted value for the conf
+// file for a given key.
+func (r *TimescaleDBRecommender) Recommend(key string) string {
+	switch key {
+	case MaxCachedChunksKey:
+		// Hypertables with many chunks, e.g., from short chunk intervals or
+		// long retention, are queried and inserted into without having to
+		// reopen chunks all the time, if there is memory to spare
+		if r.totalMemory >= chunksCacheLargeMemory {
+			return chunksCacheLarge
+		}
+		return chunksCacheSmall
+	case MaxOpenChunksKey:
+		// An insert only opens the chunks its rows fall into, which only
+		// backfills of long time ranges take past the default. Each open
+		// chunk holds insert state in the backend until the statement ends,
+		// in every connection inserting at once, so unlike the cache this is
+		// not raised with memory
+		return openChunksPerInsert
+	case MaxTuplesDecompressedKey:
+		// Updates and deletes on compressed chunks decompress the rows they
+		// touch, which larger hosts can afford to do for more rows at once
+		tuples := uint64(tuplesDecompressedDefault) * (r.totalMemory / (8 * parse.Gigabyte))
+		if tuples < tuplesDecompressedDefault {
+			tuples = tuplesDecompressedDefault
+		} else if tuples > tuplesDecompressedMax {
+			tuples = tuplesDecompressedMax
+		}
+		return fmt.Sprintf("%d", tuples)
+	}
+	return NoRecommendation
+}
+
+// TimescaleDBSettingsGroup is the SettingsGroup to represent settings of the
+// TimescaleDB extension.
+type TimescaleDBSettingsGroup struct {
+	totalMemory uint64
+	version     string // version of TimescaleDB, blank if unknown
+}
+
+// Label should always return the value TimescaleDBLabel.
+func (sg *TimescaleDBSettingsGroup) Label() string { return TimescaleDBLabel }
+
+// Keys returns the TimescaleDBKeys that the version of TimescaleDB has.
+func (sg *TimescaleDBSettingsGroup) Keys() []string {
+	keys := []string{}
+	for _, k := range TimescaleDBKeys {
+		if hasTimescaleDBKey(sg.version, k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// GetRecommender should return a new TimescaleDBRecommender.
+func (sg *TimescaleDBSettingsGroup) GetRecommender(profile Profile) Recommender {
+	return NewTimescaleDBRecommender(sg.totalMemory)
+}
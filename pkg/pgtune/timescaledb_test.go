@@ -0,0 +1,104 @@
+package pgtune
+
+import (
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+)
+
+func TestParseTimescaleDBVersion(t *testing.T) {
+	cases := []struct {
+		version   string
+		wantMajor int
+		wantMinor int
+		wantOK    bool
+	}{
+		{"2.14.2", 2, 14, true},
+		{"2.15.0-dev", 2, 15, true},
+		{"1.7", 1, 7, true},
+		{"", 0, 0, false},
+		{"devel", 0, 0, false},
+	}
+	for _, c := range cases {
+		major, minor, ok := ParseTimescaleDBVersion(c.version)
+		if major != c.wantMajor || minor != c.wantMinor || ok != c.wantOK {
+			t.Errorf("%q: incorrect result: got %d %d %v want %d %d %v", c.version, major, minor, ok, c.wantMajor, c.wantMinor, c.wantOK)
+		}
+	}
+}
+
+func TestBackgroundWorkersForJobs(t *testing.T) {
+	cases := map[int]int{
+		0:  MaxBackgroundWorkersDefault,
+		13: MaxBackgroundWorkersDefault,
+		14: 14 + bgWorkersOverhead,
+		50: 50 + bgWorkersOverhead,
+	}
+	for jobs, want := range cases {
+		if got := BackgroundWorkersForJobs(jobs); got != want {
+			t.Errorf("%d jobs: incorrect workers: got %d want %d", jobs, got, want)
+		}
+	}
+}
+
+func TestTimescaleDBSettingsGroup(t *testing.T) {
+	allKeys := TimescaleDBKeys
+	oldKeys := []string{MaxCachedChunksKey, MaxOpenChunksKey}
+	cases := []struct {
+		desc     string
+		memory   uint64
+		version  string
+		wantKeys []string
+		want     map[string]string
+	}{
+		{
+			desc:     "unknown version",
+			memory:   8 * parse.Gigabyte,
+			wantKeys: oldKeys,
+			want:     map[string]string{MaxCachedChunksKey: "1024", MaxOpenChunksKey: "1024"},
+		},
+		{
+			desc:     "unparseable version",
+			memory:   8 * parse.Gigabyte,
+			version:  "devel",
+			wantKeys: oldKeys,
+			want:     map[string]string{MaxCachedChunksKey: "1024", MaxOpenChunksKey: "1024"},
+		},
+		{
+			desc:     "before 2.11",
+			memory:   32 * parse.Gigabyte,
+			version:  "2.10.3",
+			wantKeys: oldKeys,
+			want:     map[string]string{MaxCachedChunksKey: "4096", MaxOpenChunksKey: "1024"},
+		},
+		{
+			desc:     "2.11",
+			memory:   4 * parse.Gigabyte,
+			version:  "2.11.0",
+			wantKeys: allKeys,
+			want:     map[string]string{MaxCachedChunksKey: "1024", MaxOpenChunksKey: "1024", MaxTuplesDecompressedKey: "100000"},
+		},
+		{
+			desc:     "newer than we know",
+			memory:   32 * parse.Gigabyte,
+			version:  "3.0.0",
+			wantKeys: allKeys,
+			want:     map[string]string{MaxCachedChunksKey: "4096", MaxOpenChunksKey: "1024", MaxTuplesDecompressedKey: "400000"},
+		},
+		{
+			desc:     "capped",
+			memory:   256 * parse.Gigabyte,
+			version:  "2.14.2",
+			wantKeys: allKeys,
+			want:     map[string]string{MaxCachedChunksKey: "4096", MaxOpenChunksKey: "1024", MaxTuplesDecompressedKey: "1000000"},
+		},
+	}
+	for _, c := range cases {
+		sg := &TimescaleDBSettingsGroup{c.memory, c.version}
+		if got := len(sg.Keys()); got != len(c.wantKeys) {
+			t.Errorf("%s: incorrect number of keys: got %d want %d", c.desc, got, len(c.wantKeys))
+			continue
+		}
+		testSettingGroup(t, sg, DefaultProfile, c.want, TimescaleDBLabel, c.wantKeys)
+	}
+}
@@ -12,6 +12,7 @@ const (
 	errMaxConnsTooLowFmt     = "maxConns must be 0 OR >= %d: got %d"
 	errMaxBGWorkersTooLowFmt = "maxBGWorkers must be >= %d: got %d"
 	errUnrecognizedProfile   = "unrecognized profile: %s"
+	errUnknownLabelFmt       = "unknown settings group: %s"
 )
 
 // Profile is a specific "mode" in which timescaledb-tune can be run to provide recommendations tailored to a
@@ -21,14 +22,31 @@ type Profile int64
 const (
 	DefaultProfile Profile = iota
 	PromscaleProfile
+	OLTPProfile      // many short transactions from many connections
+	AnalyticsProfile // few, heavy queries such as aggregates over large ranges
+	IngestProfile    // sustained high-volume inserts, e.g. IoT
 )
 
+// ValidProfiles are the names of the built-in non-default profiles
+var ValidProfiles = []string{
+	PromscaleProfile.String(),
+	OLTPProfile.String(),
+	AnalyticsProfile.String(),
+	IngestProfile.String(),
+}
+
 func ParseProfile(s string) (Profile, error) {
 	switch strings.ToLower(s) {
 	case "":
 		return DefaultProfile, nil
 	case "promscale":
 		return PromscaleProfile, nil
+	case "oltp":
+		return OLTPProfile, nil
+	case "analytics":
+		return AnalyticsProfile, nil
+	case "ingest":
+		return IngestProfile, nil
 	default:
 		return DefaultProfile, fmt.Errorf(errUnrecognizedProfile, s)
 	}
@@ -40,6 +58,12 @@ func (p Profile) String() string {
 		return ""
 	case PromscaleProfile:
 		return "promscale"
+	case OLTPProfile:
+		return "oltp"
+	case AnalyticsProfile:
+		return "analytics"
+	case IngestProfile:
+		return "ingest"
 	default:
 		return "unrecognized"
 	}
@@ -75,8 +99,17 @@ type SystemConfig struct {
 	CPUs           int
 	PGMajorVersion string
 	WALDiskSize    uint64
+	WALDiskShared  bool         // whether the WAL disk also holds the data directory, so WALDiskSize is its free space
+	Storage        StorageClass // kind of storage the data directory is on
 	maxConns       uint64
 	MaxBGWorkers   int
+
+	WALDiskDetected bool // whether WALDiskSize was detected rather than given by the user
+
+	TimescaleDBVersion string // version of the TimescaleDB extension, blank if unknown
+
+	Role     Role // part the server plays in streaming replication
+	Replicas int  // number of standbys streaming from the primary
 }
 
 // NewSystemConfig returns a new SystemConfig with the given parameters.
@@ -98,19 +131,28 @@ func NewSystemConfig(totalMemory uint64, cpus int, pgVersion string, walDiskSize
 }
 
 // GetSettingsGroup returns the corresponding SettingsGroup for a given label, initialized
-// according to the system resources of totalMemory and cpus. Panics if unknown label.
-func GetSettingsGroup(label string, config *SystemConfig) SettingsGroup {
+// according to the system resources of totalMemory and cpus. Returns an error if
+// the label is unknown.
+func GetSettingsGroup(label string, config *SystemConfig) (SettingsGroup, error) {
 	switch {
 	case label == MemoryLabel:
-		return &MemorySettingsGroup{config.Memory, config.CPUs, config.maxConns}
+		return &MemorySettingsGroup{config.Memory, config.CPUs, config.maxConns}, nil
 	case label == ParallelLabel:
-		return &ParallelSettingsGroup{config.PGMajorVersion, config.CPUs, config.MaxBGWorkers}
+		return &ParallelSettingsGroup{config.PGMajorVersion, config.CPUs, config.MaxBGWorkers}, nil
 	case label == WALLabel:
-		return &WALSettingsGroup{config.Memory, config.WALDiskSize}
+		return &WALSettingsGroup{config.Memory, config.WALDiskSize, config.WALDiskDetected}, nil
 	case label == BgwriterLabel:
-		return &BgwriterSettingsGroup{}
+		return &BgwriterSettingsGroup{}, nil
 	case label == MiscLabel:
-		return &MiscSettingsGroup{config.Memory, config.maxConns, config.PGMajorVersion}
+		return &MiscSettingsGroup{config.Memory, config.maxConns, config.PGMajorVersion, config.Storage}, nil
+	case label == AutovacuumLabel:
+		return &AutovacuumSettingsGroup{config.Memory, config.CPUs, config.PGMajorVersion, config.Storage}, nil
+	case label == LoggingLabel:
+		return &LoggingSettingsGroup{config.PGMajorVersion}, nil
+	case label == TimescaleDBLabel:
+		return &TimescaleDBSettingsGroup{config.Memory, config.TimescaleDBVersion}, nil
+	case label == ReplicationLabel:
+		return &ReplicationSettingsGroup{config.Role, config.Replicas, config.WALDiskSize, config.PGMajorVersion}, nil
 	}
-	panic("unknown label: " + label)
+	return nil, fmt.Errorf(errUnknownLabelFmt, label)
 }
@@ -81,10 +81,13 @@ func TestNewSystemConfig(t *testing.T) {
 }
 
 func TestGetSettingsGroup(t *testing.T) {
-	okLabels := []string{MemoryLabel, ParallelLabel, WALLabel, BgwriterLabel, MiscLabel}
+	okLabels := []string{MemoryLabel, ParallelLabel, WALLabel, BgwriterLabel, MiscLabel, AutovacuumLabel, LoggingLabel, TimescaleDBLabel, ReplicationLabel}
 	config := getDefaultTestSystemConfig(t)
 	for _, label := range okLabels {
-		sg := GetSettingsGroup(label, config)
+		sg, err := GetSettingsGroup(label, config)
+		if err != nil {
+			t.Errorf("unexpected error for label %s: %v", label, err)
+		}
 		if sg == nil {
 			t.Errorf("settings group unexpectedly nil for label %s", label)
 		}
@@ -120,20 +123,56 @@ func TestGetSettingsGroup(t *testing.T) {
 			if x.maxConns != config.maxConns {
 				t.Errorf("Misc group incorrect (max conns): got %d want %d", x.maxConns, config.maxConns)
 			}
+		case *AutovacuumSettingsGroup:
+			if x.totalMemory != config.Memory || x.cpus != config.CPUs {
+				t.Errorf("autovacuum group incorrect (resources): got %d %d want %d %d", x.totalMemory, x.cpus, config.Memory, config.CPUs)
+			}
+			if x.pgMajorVersion != config.PGMajorVersion {
+				t.Errorf("autovacuum group incorrect (PG version): got %s want %s", x.pgMajorVersion, config.PGMajorVersion)
+			}
+		case *LoggingSettingsGroup:
+			if x.pgMajorVersion != config.PGMajorVersion {
+				t.Errorf("logging group incorrect (PG version): got %s want %s", x.pgMajorVersion, config.PGMajorVersion)
+			}
+		case *TimescaleDBSettingsGroup:
+			if x.totalMemory != config.Memory {
+				t.Errorf("TimescaleDB group incorrect (memory): got %d want %d", x.totalMemory, config.Memory)
+			}
+			if x.version != config.TimescaleDBVersion {
+				t.Errorf("TimescaleDB group incorrect (version): got %s want %s", x.version, config.TimescaleDBVersion)
+			}
+		case *ReplicationSettingsGroup:
+			if x.role != config.Role || x.replicas != config.Replicas {
+				t.Errorf("replication group incorrect (role): got %v %d want %v %d", x.role, x.replicas, config.Role, config.Replicas)
+			}
+			if x.walDiskSize != config.WALDiskSize {
+				t.Errorf("replication group incorrect (WAL disk): got %d want %d", x.walDiskSize, config.WALDiskSize)
+			}
 		default:
 			t.Errorf("unexpected type for settings group %T", x)
 		}
 	}
 
-	// this should panic on unknown label
-	func() {
-		defer func() {
-			if re := recover(); re == nil {
-				t.Errorf("did not panic when should")
-			}
-		}()
-		GetSettingsGroup("foo", config)
-	}()
+	// this should error on unknown label
+	sg, err := GetSettingsGroup("foo", config)
+	if sg != nil {
+		t.Errorf("settings group unexpectedly not nil: got %T", sg)
+	}
+	wantErr := fmt.Sprintf(errUnknownLabelFmt, "foo")
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("incorrect error: got %v want %s", err, wantErr)
+	}
+}
+
+// mustGetSettingsGroup returns the SettingsGroup for label, failing the test
+// if the label is unknown.
+func mustGetSettingsGroup(t *testing.T, label string, config *SystemConfig) SettingsGroup {
+	t.Helper()
+	sg, err := GetSettingsGroup(label, config)
+	if err != nil {
+		t.Fatalf("unexpected error getting settings group %s: %v", label, err)
+	}
+	return sg
 }
 
 func testSettingGroup(t *testing.T, sg SettingsGroup, profile Profile, cases map[string]string, wantLabel string, wantKeys []string) {
@@ -185,6 +224,10 @@ func TestParseProfile(t *testing.T) {
 		{input: DefaultProfile.String(), expected: DefaultProfile},
 		{input: PromscaleProfile.String(), expected: PromscaleProfile},
 		{input: strings.ToUpper(PromscaleProfile.String()), expected: PromscaleProfile},
+		{input: OLTPProfile.String(), expected: OLTPProfile},
+		{input: "OLTP", expected: OLTPProfile},
+		{input: AnalyticsProfile.String(), expected: AnalyticsProfile},
+		{input: IngestProfile.String(), expected: IngestProfile},
 	}
 	for _, kase := range cases {
 		actual, err := ParseProfile(kase.input)
@@ -19,6 +19,11 @@ const (
 	promscaleDefaultMaxWALBytes       = 4 * parse.Gigabyte
 	promscaleDefaultCheckpointTimeout = "900" // 15 minutes expressed in seconds
 	promscaleDefaultWALCompression    = "1"
+
+	// max_wal_size is never more than this, however big a detected disk, since
+	// replaying that much WAL after a crash already takes a long time. A disk
+	// size given by the user is taken at its word.
+	walMaxBytesCap = 16 * parse.Gigabyte
 )
 
 // WALLabel is the label used to refer to the WAL settings group
@@ -35,8 +40,9 @@ var WALKeys = []string{
 
 // WALRecommender gives recommendations for WALKeys based on system resources
 type WALRecommender struct {
-	totalMemory uint64
-	walDiskSize uint64
+	totalMemory     uint64
+	walDiskSize     uint64
+	walDiskDetected bool
 }
 
 // NewWALRecommender returns a WALRecommender that recommends based on the given
@@ -77,11 +83,23 @@ func (r *WALRecommender) Recommend(key string) string {
 }
 
 func (r *WALRecommender) calcMaxWALBytes() uint64 {
+	return r.calcMaxWALBytesWithDefault(defaultMaxWALBytes)
+}
+
+// calcMaxWALBytesWithDefault returns the amount of the WAL disk that should be
+// used by the WAL, or def if the disk size is not known.
+func (r *WALRecommender) calcMaxWALBytesWithDefault(def uint64) uint64 {
 	// If disk size is not given, just use default
 	if r.walDiskSize == 0 {
-		return defaultMaxWALBytes
+		return def
 	}
 
+	return r.calcMaxWALBytesForDisk()
+}
+
+// calcMaxWALBytesForDisk returns the amount of the WAL disk that should be
+// used by the WAL.
+func (r *WALRecommender) calcMaxWALBytesForDisk() uint64 {
 	// With size given, we want to take up at most walMaxDiskPct, to give
 	// additional room for safety.
 	max := uint64(r.walDiskSize*walMaxDiskPct) / 100
@@ -91,13 +109,17 @@ func (r *WALRecommender) calcMaxWALBytes() uint64 {
 	if max%(16*parse.Megabyte) != 0 {
 		max = (max/(16*parse.Megabyte) + 1) * 16 * parse.Megabyte
 	}
+	if r.walDiskDetected && max > walMaxBytesCap {
+		max = walMaxBytesCap
+	}
 	return max
 }
 
 // WALSettingsGroup is the SettingsGroup to represent settings that affect WAL usage.
 type WALSettingsGroup struct {
-	totalMemory uint64
-	walDiskSize uint64
+	totalMemory     uint64
+	walDiskSize     uint64
+	walDiskDetected bool
 }
 
 // Label should always return the value WALLabel.
@@ -110,9 +132,25 @@ func (sg *WALSettingsGroup) Keys() []string { return WALKeys }
 func (sg *WALSettingsGroup) GetRecommender(profile Profile) Recommender {
 	switch profile {
 	case PromscaleProfile:
-		return NewPromscaleWALRecommender(sg.totalMemory, sg.walDiskSize)
+		r := NewPromscaleWALRecommender(sg.totalMemory, sg.walDiskSize)
+		r.walDiskDetected = sg.walDiskDetected
+		return r
+	case OLTPProfile:
+		r := NewOLTPWALRecommender(sg.totalMemory, sg.walDiskSize)
+		r.walDiskDetected = sg.walDiskDetected
+		return r
+	case AnalyticsProfile:
+		r := NewAnalyticsWALRecommender(sg.totalMemory, sg.walDiskSize)
+		r.walDiskDetected = sg.walDiskDetected
+		return r
+	case IngestProfile:
+		r := NewIngestWALRecommender(sg.totalMemory, sg.walDiskSize)
+		r.walDiskDetected = sg.walDiskDetected
+		return r
 	default:
-		return NewWALRecommender(sg.totalMemory, sg.walDiskSize)
+		r := NewWALRecommender(sg.totalMemory, sg.walDiskSize)
+		r.walDiskDetected = sg.walDiskDetected
+		return r
 	}
 }
 
@@ -157,21 +195,7 @@ func (r *PromscaleWALRecommender) Recommend(key string) string {
 }
 
 func (r *WALRecommender) promscaleCalcMaxWALBytes() uint64 {
-	// If disk size is not given, just use default
-	if r.walDiskSize == 0 {
-		return promscaleDefaultMaxWALBytes
-	}
-
-	// With size given, we want to take up at most walMaxDiskPct, to give
-	// additional room for safety.
-	max := uint64(r.walDiskSize*walMaxDiskPct) / 100
-
-	// WAL segments are 16MB, so it doesn't make sense not to round
-	// up to the nearest 16MB boundary.
-	if max%(16*parse.Megabyte) != 0 {
-		max = (max/(16*parse.Megabyte) + 1) * 16 * parse.Megabyte
-	}
-	return max
+	return r.calcMaxWALBytesWithDefault(promscaleDefaultMaxWALBytes)
 }
 
 type WALFloatParser struct{}
@@ -179,8 +203,16 @@ type WALFloatParser struct{}
 func (v *WALFloatParser) ParseFloat(key string, s string) (float64, error) {
 	switch key {
 	case WALCompressionKey:
+		// since PostgreSQL 15, a compression method turns it on as well
 		bfp := &boolFloatParser{}
-		return bfp.ParseFloat(key, s)
+		val, err := bfp.ParseFloat(key, s)
+		if err != nil {
+			efp := &enumFloatParser{}
+			if _, enumErr := efp.ParseFloat(key, s); enumErr == nil {
+				return 1.0, nil
+			}
+		}
+		return val, err
 	case CheckpointTimeoutKey:
 		val, units, err := parse.PGFormatToTime(s, parse.Milliseconds, parse.VarTypeInteger)
 		if err != nil {
@@ -77,6 +77,9 @@ func TestWALSettingsGroup_GetRecommender(t *testing.T) {
 	}{
 		{DefaultProfile, "*pgtune.WALRecommender"},
 		{PromscaleProfile, "*pgtune.PromscaleWALRecommender"},
+		{OLTPProfile, "*pgtune.OLTPWALRecommender"},
+		{AnalyticsProfile, "*pgtune.AnalyticsWALRecommender"},
+		{IngestProfile, "*pgtune.IngestWALRecommender"},
 	}
 
 	sg := WALSettingsGroup{totalMemory: 1, walDiskSize: 1}
@@ -151,7 +154,7 @@ func TestWALSettingsGroup(t *testing.T) {
 			config := getDefaultTestSystemConfig(t)
 			config.Memory = totalMemory
 			config.WALDiskSize = walSize
-			sg := GetSettingsGroup(WALLabel, config)
+			sg := mustGetSettingsGroup(t, WALLabel, config)
 			testSettingGroup(t, sg, DefaultProfile, matrix, WALLabel, WALKeys)
 		}
 	}
@@ -161,12 +164,54 @@ func TestWALSettingsGroup(t *testing.T) {
 			config := getDefaultTestSystemConfig(t)
 			config.Memory = totalMemory
 			config.WALDiskSize = walSize
-			sg := GetSettingsGroup(WALLabel, config)
+			sg := mustGetSettingsGroup(t, WALLabel, config)
 			testSettingGroup(t, sg, PromscaleProfile, matrix, WALLabel, WALKeys)
 		}
 	}
 }
 
+func TestWALSettingsGroupSharedDisk(t *testing.T) {
+	// a shared disk's size is already just its free space, so it is not
+	// reduced again: 60% of 8GB is 4915.2MB, rounded up to a 16MB segment
+	wantMax := uint64(4928 * parse.Megabyte)
+	for _, profile := range []Profile{DefaultProfile, PromscaleProfile, OLTPProfile, AnalyticsProfile, IngestProfile} {
+		config := getDefaultTestSystemConfig(t)
+		config.WALDiskSize = walDiskDivideUnevenly
+		config.WALDiskShared = true
+		r := mustGetSettingsGroup(t, WALLabel, config).GetRecommender(profile)
+		if got, want := r.Recommend(MaxWALKey), parse.BytesToPGFormat(wantMax); got != want {
+			t.Errorf("%s: incorrect %s: got %s want %s", profile, MaxWALKey, got, want)
+		}
+		if got, want := r.Recommend(MinWALKey), parse.BytesToPGFormat(wantMax/2); got != want {
+			t.Errorf("%s: incorrect %s: got %s want %s", profile, MinWALKey, got, want)
+		}
+	}
+}
+
+func TestWALRecommenderMaxWALCap(t *testing.T) {
+	cases := []struct {
+		detected bool
+		want     uint64
+	}{
+		{detected: true, want: walMaxBytesCap},
+		{detected: false, want: 600 * parse.Gigabyte}, // a given size is not capped
+	}
+	for _, c := range cases {
+		config := getDefaultTestSystemConfig(t)
+		config.WALDiskSize = 1000 * parse.Gigabyte
+		config.WALDiskDetected = c.detected
+		for _, profile := range []Profile{DefaultProfile, PromscaleProfile, OLTPProfile, AnalyticsProfile, IngestProfile} {
+			r := mustGetSettingsGroup(t, WALLabel, config).GetRecommender(profile)
+			if got, want := r.Recommend(MaxWALKey), parse.BytesToPGFormat(c.want); got != want {
+				t.Errorf("%s, detected %v: incorrect %s: got %s want %s", profile, c.detected, MaxWALKey, got, want)
+			}
+			if got, want := r.Recommend(MinWALKey), parse.BytesToPGFormat(c.want/2); got != want {
+				t.Errorf("%s, detected %v: incorrect %s: got %s want %s", profile, c.detected, MinWALKey, got, want)
+			}
+		}
+	}
+}
+
 func TestWALFloatParserParseFloat(t *testing.T) {
 	v := &WALFloatParser{}
 
@@ -200,4 +245,37 @@ func TestWALFloatParserParseFloat(t *testing.T) {
 	if got != want {
 		t.Errorf("incorrect result: got %f want %f", got, want)
 	}
+
+	for s, want := range map[string]float64{"off": 0.0, "on": 1.0, "lz4": 1.0, "'zstd'": 1.0} {
+		got, err = v.ParseFloat(WALCompressionKey, s)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", s, err)
+		}
+		if got != want {
+			t.Errorf("incorrect result for %s: got %f want %f", s, got, want)
+		}
+	}
+	if _, err = v.ParseFloat(WALCompressionKey, "gzip"); err == nil {
+		t.Errorf("unexpected lack of error for gzip")
+	}
+}
+
+// newWALSettingsMatrix builds the test cases for a profile's WAL recommender.
+// walDiskToMax gives the expected max_wal_size for each WAL disk size, and
+// memoryToBuffers the expected wal_buffers for each memory level.
+func newWALSettingsMatrix(memoryToBuffers, walDiskToMax map[uint64]uint64, checkpointTimeout, walCompression string) map[uint64]map[uint64]map[string]string {
+	matrix := make(map[uint64]map[uint64]map[string]string)
+	for memory, walBuffers := range memoryToBuffers {
+		matrix[memory] = make(map[uint64]map[string]string)
+		for walSize, maxBytes := range walDiskToMax {
+			matrix[memory][walSize] = map[string]string{
+				MinWALKey:            parse.BytesToPGFormat(maxBytes / 2),
+				MaxWALKey:            parse.BytesToPGFormat(maxBytes),
+				WALBuffersKey:        parse.BytesToPGFormat(walBuffers),
+				CheckpointTimeoutKey: checkpointTimeout,
+				WALCompressionKey:    walCompression,
+			}
+		}
+	}
+	return matrix
 }
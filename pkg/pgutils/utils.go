@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os/exec"
 	"regexp"
+	"strings"
 )
 
 // Major version strings for recent PostgreSQL versions
@@ -24,6 +25,7 @@ const (
 const (
 	defaultBinName = "pg_config"
 	versionFlag    = "--version"
+	sharedirFlag   = "--sharedir"
 
 	errCouldNotParseVersionFmt = "unable to parse PG version string: %s"
 	errUnknownMajorVersionFmt  = "unknown major PG version: %s"
@@ -73,3 +75,14 @@ func GetPGConfigVersionAtPath(path string) (string, error) {
 	}
 	return string(output), nil
 }
+
+// GetPGConfigSharedirAtPath executes the (pg_config) binary at path to get the
+// directory where PostgreSQL keeps architecture-independent files, such as the
+// control files of extensions.
+func GetPGConfigSharedirAtPath(path string) (string, error) {
+	output, err := execFn(path, sharedirFlag)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
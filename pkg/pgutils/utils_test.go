@@ -162,3 +162,31 @@ func TestGetPGConfigVersionAtPath(t *testing.T) {
 
 	execFn = oldExecFn
 }
+
+func TestGetPGConfigSharedirAtPath(t *testing.T) {
+	oldExecFn := execFn
+	defer func() { execFn = oldExecFn }()
+	var calledArgs []string
+	execFn = func(name string, args ...string) ([]byte, error) {
+		calledArgs = args
+		if name == "bad" {
+			return nil, fmt.Errorf("error")
+		}
+		return []byte("/usr/share/postgresql/16\n"), nil
+	}
+
+	out, err := GetPGConfigSharedirAtPath("foo")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if want := "/usr/share/postgresql/16"; out != want {
+		t.Errorf("unexpected result: got %q want %q", out, want)
+	}
+	if len(calledArgs) != 1 || calledArgs[0] != sharedirFlag {
+		t.Errorf("incorrect calledArgs: got %v want [%s]", calledArgs, sharedirFlag)
+	}
+
+	_, err = GetPGConfigSharedirAtPath("bad")
+	if err == nil || err.Error() != "error" {
+		t.Errorf("unexpected error: got %v want error", err)
+	}
+}
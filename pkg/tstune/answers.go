@@ -0,0 +1,318 @@
+package tstune
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+const (
+	answerAccept = "accept"
+	answerSkip   = "skip"
+
+	// names of the questions that the answers file can answer
+	questionConfFile   = "conf_file"
+	questionSharedLibs = "shared_libs"
+	questionTune       = "tune"
+	questionGroups     = "groups"
+	questionSettings   = "settings"
+
+	errAnswersFileFmt       = "could not load answers file %s: %v"
+	errAnswerGroupFmt       = "answer for settings group %s must be %s or %s, not %q"
+	errAnswerSettingFmt     = "unknown setting %q"
+	errAnswerSettingBlank   = "value for setting %s is blank"
+	errAnswerInvalidFmt     = "answers file: %q is not a valid answer for %s"
+	errAnswerPinFmt         = "answers file: %v"
+	errUnansweredFmt        = "no answer given for %q, and cannot ask when non-interactive"
+	statementAnsweredFmt    = "answered by %s in the answers file"
+	fmtAnswerPromptResponse = "%s\n"
+)
+
+// answersFile pre-answers the prompts of a run, so that the choices of an
+// operator can be reproduced without anyone at the prompt.
+type answersFile struct {
+	ConfFile   *bool             `json:"conf_file,omitempty" yaml:"conf_file,omitempty" toml:"conf_file,omitempty"`
+	SharedLibs *bool             `json:"shared_libs,omitempty" yaml:"shared_libs,omitempty" toml:"shared_libs,omitempty"`
+	Tune       *bool             `json:"tune,omitempty" yaml:"tune,omitempty" toml:"tune,omitempty"`
+	Groups     map[string]string `json:"groups,omitempty" yaml:"groups,omitempty" toml:"groups,omitempty"`       // label to accept or skip
+	Settings   map[string]string `json:"settings,omitempty" yaml:"settings,omitempty" toml:"settings,omitempty"` // key to value to use instead of the recommendation
+	Keep       []string          `json:"keep,omitempty" yaml:"keep,omitempty" toml:"keep,omitempty"`             // keys to never tune
+}
+
+// loadAnswersFile reads and validates an answers file from path, which is a
+// YAML, JSON, or TOML document depending on its extension. Group labels are
+// matched regardless of case, and are stored as the labels themselves, with
+// default standing for all the groups tuned without --groups.
+func loadAnswersFile(path string) (*answersFile, error) {
+	a := &answersFile{}
+	err := decodeFile(path, a)
+	if err == nil {
+		err = a.validate()
+	}
+	if err != nil {
+		return nil, fmt.Errorf(errAnswersFileFmt, path, err)
+	}
+	return a, nil
+}
+
+func (a *answersFile) validate() error {
+	// answers for default apply to all of its groups, unless given for a group
+	names := []string{}
+	for g := range a.Groups {
+		names = append(names, g)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return strings.EqualFold(names[i], groupsDefault) && !strings.EqualFold(names[j], groupsDefault)
+	})
+	groups := map[string]string{}
+	for _, g := range names {
+		labels, err := parseGroups(g)
+		if err != nil {
+			return err
+		}
+		answer := strings.ToLower(strings.TrimSpace(a.Groups[g]))
+		if answer != answerAccept && answer != answerSkip {
+			return fmt.Errorf(errAnswerGroupFmt, g, answerAccept, answerSkip, answer)
+		}
+		for _, label := range labels {
+			groups[label] = answer
+		}
+	}
+	a.Groups = groups
+
+	recommenders, err := answerRecommenders()
+	if err != nil {
+		return err
+	}
+	for key, value := range a.Settings {
+		if _, ok := regexes[key]; !ok {
+			return fmt.Errorf(errAnswerSettingFmt, key)
+		}
+		if strings.TrimSpace(value) == "" {
+			return fmt.Errorf(errAnswerSettingBlank, key)
+		}
+		// strings are kept as they are, since spaces can matter in them
+		if isIn(key, stringKeys) {
+			a.Settings[key] = quoteStringSetting(value)
+			continue
+		}
+		a.Settings[key] = strings.TrimSpace(value)
+		if r, ok := recommenders[key]; ok {
+			if err := pgtune.ValidateValue(r, key, a.Settings[key]); err != nil {
+				return fmt.Errorf(errSettingInvalidFmt, key, err)
+			}
+		}
+	}
+
+	for _, key := range a.Keep {
+		if _, ok := regexes[key]; !ok {
+			return fmt.Errorf(errAnswerSettingFmt, key)
+		}
+		if _, ok := a.Settings[key]; ok {
+			return fmt.Errorf(errAnswerKeepFmt, key)
+		}
+	}
+	return nil
+}
+
+// answerRecommenders returns the Recommender of the settings group of each
+// setting, to check the values given in an answers file with before anything
+// is changed. How values are parsed does not depend on the system, so those
+// for the newest PostgreSQL version, which has every setting, will do.
+func answerRecommenders() (map[string]pgtune.Recommender, error) {
+	config, err := pgtune.NewSystemConfig(parse.Gigabyte, 1, ValidPGVersions[0], 0, 0, pgtune.MaxBackgroundWorkersDefault)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]pgtune.Recommender)
+	for _, label := range ValidGroups[1:] {
+		sg, err := pgtune.GetSettingsGroup(label, config)
+		if err != nil {
+			return nil, err
+		}
+		r := sg.GetRecommender(pgtune.DefaultProfile)
+		for _, k := range sg.Keys() {
+			ret[k] = r
+		}
+	}
+	return ret, nil
+}
+
+// setting returns the value the answers file gives for key, if any.
+func (a *answersFile) setting(key string) (string, bool) {
+	if a == nil {
+		return "", false
+	}
+	v, ok := a.Settings[key]
+	return v, ok
+}
+
+// answer returns the response to q in the answers file, in the form the
+// checker of q expects, along with which answer it came from.
+func (a *answersFile) answer(q question) (string, string, bool) {
+	if a == nil {
+		return "", "", false
+	}
+	yesNo := func(b *bool) (string, string, bool) {
+		if b == nil {
+			return "", "", false
+		} else if *b {
+			return "yes", q.name, true
+		}
+		return "no", q.name, true
+	}
+
+	switch q.name {
+	case questionConfFile:
+		return yesNo(a.ConfFile)
+	case questionSharedLibs:
+		return yesNo(a.SharedLibs)
+	case questionTune:
+		return yesNo(a.Tune)
+	case questionGroups:
+		switch a.Groups[q.label] {
+		case answerAccept:
+			return "yes", q.String(), true
+		case answerSkip:
+			return answerSkip, q.String(), true
+		}
+	case questionSettings:
+		if _, ok := a.Settings[q.key]; ok {
+			return answerAccept, q.String(), true
+		}
+		from := question{name: questionGroups, label: q.label}.String()
+		switch a.Groups[q.label] {
+		case answerAccept:
+			return answerAccept, from, true
+		case answerSkip:
+			return "keep", from, true
+		}
+	}
+	return "", "", false
+}
+
+// question is a prompt that the answers file can answer.
+type question struct {
+	name  string // one of the question names
+	label string // settings group asked about, for groups and settings
+	key   string // setting asked about, for settings
+}
+
+func (q question) String() string {
+	switch q.name {
+	case questionGroups:
+		return q.name + "." + q.label
+	case questionSettings:
+		return q.name + "." + q.key
+	}
+	return q.name
+}
+
+// questionChecker is a promptChecker for a question that the answers file can
+// answer.
+type questionChecker struct {
+	promptChecker
+	q question
+}
+
+// ask makes checker answerable by the answers file as q.
+func ask(q question, checker promptChecker) *questionChecker {
+	return &questionChecker{checker, q}
+}
+
+// unwrapQuestion returns the question checker is for, if any, and the checker
+// of the responses.
+func unwrapQuestion(checker promptChecker) (question, promptChecker) {
+	if qc, ok := checker.(*questionChecker); ok {
+		return qc.q, qc.promptChecker
+	}
+	return question{}, checker
+}
+
+// useAnswer responds to prompt with answer from the answers file, telling the
+// user about it, and checks it like a typed response.
+func (t *Tuner) useAnswer(prompt string, checker promptChecker, answer, from string) error {
+	t.handler.p.Prompt(prompt)
+	fmt.Fprintf(t.handler.outErr, fmtAnswerPromptResponse, answer)
+	t.handler.p.Statement(statementAnsweredFmt, from)
+	if t.report != nil {
+		t.report.Answers = append(t.report.Answers, &answerReport{from, answer})
+	}
+
+	ok, err := checker.Check(answer)
+	if err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf(errAnswerInvalidFmt, answer, from)
+	}
+	return nil
+}
+
+// useAnswerSettings checks the values the answers file gives for the keys in
+// values, which are the values to write for a group of settings, and uses them
+// instead of the recommendations. The keys whose values are given are marked in
+// byHand.
+func (t *Tuner) useAnswerSettings(values map[string]string, byHand map[string]bool, recommender pgtune.Recommender) error {
+	keys := []string{}
+	for k := range values {
+		if _, ok := t.answers.setting(k); ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, err := t.validateSettingValue(k, values[k], recommender, values)
+		if err != nil {
+			return fmt.Errorf(errAnswerPinFmt, err)
+		}
+		values[k] = v
+		byHand[k] = true
+	}
+	return nil
+}
+
+// answersSettingsGroup is a SettingsGroup whose recommendations are the values
+// given in the answers file, where there are any.
+type answersSettingsGroup struct {
+	pgtune.SettingsGroup
+	answers *answersFile
+}
+
+func (sg *answersSettingsGroup) GetRecommender(profile pgtune.Profile) pgtune.Recommender {
+	return &answersRecommender{sg.SettingsGroup.GetRecommender(profile), sg.answers}
+}
+
+// answersRecommender gives the values given in the answers file, and the
+// recommendations of another Recommender for the other keys.
+type answersRecommender struct {
+	base    pgtune.Recommender
+	answers *answersFile
+}
+
+func (r *answersRecommender) IsAvailable() bool {
+	return r.base.IsAvailable()
+}
+
+// Unwrap returns the Recommender whose recommendations are used when not given.
+func (r *answersRecommender) Unwrap() pgtune.Recommender {
+	return r.base
+}
+
+func (r *answersRecommender) Recommend(key string) string {
+	if v, ok := r.answers.setting(key); ok {
+		return v
+	}
+	return r.base.Recommend(key)
+}
+
+// toolRecommendation returns what is recommended for key, regardless of any
+// value given in the answers file.
+func toolRecommendation(r pgtune.Recommender, key string) string {
+	if ar, ok := r.(*answersRecommender); ok {
+		return ar.base.Recommend(key)
+	}
+	return r.Recommend(key)
+}
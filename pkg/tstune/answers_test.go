@@ -0,0 +1,414 @@
+package tstune
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+const (
+	testAnswersYAML = `conf_file: yes
+shared_libs: no
+groups:
+  default: accept
+  wal: skip
+settings:
+  work_mem: 32MB
+  max_connections: 50
+  log_line_prefix: '%m [%p] '
+keep:
+  - jit
+`
+	testAnswersJSON = `{
+  "conf_file": true,
+  "shared_libs": false,
+  "groups": {"default": "accept", "WAL": "Skip"},
+  "settings": {"work_mem": "32MB", "max_connections": "50", "log_line_prefix": "'%m [%p] '"},
+  "keep": ["jit"]
+}`
+)
+
+func TestLoadAnswersFile(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		desc     string
+		file     string
+		contents string
+		errMsg   string
+	}{
+		{desc: "yaml", file: "answers.yaml", contents: testAnswersYAML},
+		{desc: "json", file: "answers.json", contents: testAnswersJSON},
+		{
+			desc:   "missing file",
+			file:   "missing.yaml",
+			errMsg: "no such file or directory",
+		},
+		{
+			desc:     "unknown field",
+			file:     "unknown.yaml",
+			contents: "conf_file: yes\nshared_lib: yes\n",
+			errMsg:   "field shared_lib not found",
+		},
+		{
+			desc:     "unknown group",
+			file:     "group.yaml",
+			contents: "groups:\n  memmory: accept\n",
+			errMsg:   fmt.Sprintf(errUnknownGroupFmt, "memmory", strings.Join(ValidGroups, ", ")),
+		},
+		{
+			desc:     "bad group answer",
+			file:     "answer.yaml",
+			contents: "groups:\n  memory: yes\n",
+			errMsg:   fmt.Sprintf(errAnswerGroupFmt, "memory", answerAccept, answerSkip, "yes"),
+		},
+		{
+			desc:     "unknown setting",
+			file:     "setting.yaml",
+			contents: "settings:\n  work_memory: 32MB\n",
+			errMsg:   fmt.Sprintf(errAnswerSettingFmt, "work_memory"),
+		},
+		{
+			desc:     "unknown setting to keep",
+			file:     "keep.yaml",
+			contents: "keep: [work_memory]\n",
+			errMsg:   fmt.Sprintf(errAnswerSettingFmt, "work_memory"),
+		},
+		{
+			desc:     "kept and given",
+			file:     "kept.yaml",
+			contents: "settings:\n  work_mem: 32MB\nkeep: [work_mem]\n",
+			errMsg:   fmt.Sprintf(errAnswerKeepFmt, "work_mem"),
+		},
+		{
+			desc:     "blank setting",
+			file:     "blank.yaml",
+			contents: "settings:\n  work_mem: ' '\n",
+			errMsg:   fmt.Sprintf(errAnswerSettingBlank, "work_mem"),
+		},
+		{
+			desc:     "invalid number",
+			file:     "number.yaml",
+			contents: "settings:\n  work_mem: lots\n",
+			errMsg:   "invalid value for work_mem",
+		},
+		{
+			desc:     "invalid bool",
+			file:     "bool.yaml",
+			contents: "settings:\n  jit: maybe\n",
+			errMsg:   "invalid value for jit: unrecognized bool value: maybe",
+		},
+		{
+			desc:     "invalid enum",
+			file:     "enum.yaml",
+			contents: "settings:\n  wal_level: full\n",
+			errMsg:   "invalid value for wal_level: unrecognized value: full",
+		},
+	}
+
+	for _, c := range cases {
+		path := filepath.Join(dir, c.file)
+		if c.contents != "" {
+			if err := os.WriteFile(path, []byte(c.contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		a, err := loadAnswersFile(path)
+		if c.errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), c.errMsg) {
+				t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.errMsg)
+			} else if !strings.HasPrefix(err.Error(), fmt.Sprintf(errAnswersFileFmt, path, "")) {
+				t.Errorf("%s: error missing path: %v", c.desc, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+
+		if a.ConfFile == nil || !*a.ConfFile {
+			t.Errorf("%s: incorrect conf file answer: got %v", c.desc, a.ConfFile)
+		}
+		if a.SharedLibs == nil || *a.SharedLibs {
+			t.Errorf("%s: incorrect shared libs answer: got %v", c.desc, a.SharedLibs)
+		}
+		if a.Tune != nil {
+			t.Errorf("%s: unexpected tune answer: got %v", c.desc, *a.Tune)
+		}
+		if got := len(a.Groups); got != len(tunableLabels) {
+			t.Errorf("%s: incorrect number of groups: got %d want %d", c.desc, got, len(tunableLabels))
+		}
+		if got := a.Groups[pgtune.WALLabel]; got != answerSkip {
+			t.Errorf("%s: incorrect answer for group given by itself: got %s", c.desc, got)
+		}
+		if got := a.Groups[pgtune.MemoryLabel]; got != answerAccept {
+			t.Errorf("%s: incorrect answer for group given by default: got %s", c.desc, got)
+		}
+		wantSettings := map[string]string{
+			pgtune.WorkMemKey:        "32MB",
+			pgtune.MaxConnectionsKey: "50",
+			pgtune.LogLinePrefixKey:  "'%m [%p] '",
+		}
+		for k, want := range wantSettings {
+			if got := a.Settings[k]; got != want {
+				t.Errorf("%s: incorrect value for %s: got %q want %q", c.desc, k, got, want)
+			}
+		}
+		if got := a.Keep; len(got) != 1 || got[0] != pgtune.Jit {
+			t.Errorf("%s: incorrect keys to keep: got %v", c.desc, got)
+		}
+	}
+
+	// values of string settings are quoted if they are not already
+	a := &answersFile{Settings: map[string]string{pgtune.LogLinePrefixKey: "%m it's "}}
+	if err := a.validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := a.Settings[pgtune.LogLinePrefixKey], "'%m it''s '"; got != want {
+		t.Errorf("incorrect quoting: got %s want %s", got, want)
+	}
+}
+
+func TestAnswersFileAnswer(t *testing.T) {
+	yes, no := true, false
+	a := &answersFile{
+		ConfFile:   &yes,
+		SharedLibs: &no,
+		Groups:     map[string]string{pgtune.MemoryLabel: answerAccept, pgtune.WALLabel: answerSkip},
+		Settings:   map[string]string{pgtune.WorkMemKey: "32MB"},
+	}
+	cases := []struct {
+		q        question
+		want     string
+		wantFrom string
+	}{
+		{q: question{name: questionConfFile}, want: "yes", wantFrom: "conf_file"},
+		{q: question{name: questionSharedLibs}, want: "no", wantFrom: "shared_libs"},
+		{q: question{name: questionTune}},
+		{q: question{name: questionGroups, label: pgtune.MemoryLabel}, want: "yes", wantFrom: "groups.memory"},
+		{q: question{name: questionGroups, label: pgtune.WALLabel}, want: answerSkip, wantFrom: "groups.WAL"},
+		{q: question{name: questionGroups, label: pgtune.ParallelLabel}},
+		{q: question{name: questionSettings, label: pgtune.WALLabel, key: pgtune.WorkMemKey}, want: answerAccept, wantFrom: "settings.work_mem"},
+		{q: question{name: questionSettings, label: pgtune.MemoryLabel, key: pgtune.SharedBuffersKey}, want: answerAccept, wantFrom: "groups.memory"},
+		{q: question{name: questionSettings, label: pgtune.WALLabel, key: pgtune.WALBuffersKey}, want: "keep", wantFrom: "groups.WAL"},
+		{q: question{name: questionSettings, label: pgtune.ParallelLabel, key: pgtune.MaxWorkerProcessesKey}},
+		{q: question{}},
+	}
+	for _, c := range cases {
+		got, from, ok := a.answer(c.q)
+		if ok != (c.want != "") {
+			t.Errorf("%s: incorrect answered: got %v", c.q, ok)
+		}
+		if got != c.want || from != c.wantFrom {
+			t.Errorf("%s: incorrect answer: got %s from %s want %s from %s", c.q, got, from, c.want, c.wantFrom)
+		}
+	}
+
+	var none *answersFile
+	if _, _, ok := none.answer(question{name: questionConfFile}); ok {
+		t.Errorf("unexpected answer without an answers file")
+	}
+	if _, ok := none.setting(pgtune.WorkMemKey); ok {
+		t.Errorf("unexpected setting without an answers file")
+	}
+}
+
+func TestTunerPromptAnswered(t *testing.T) {
+	yes, no := true, false
+	answers := &answersFile{
+		ConfFile: &yes,
+		Tune:     &no,
+		Groups:   map[string]string{pgtune.MemoryLabel: answerSkip},
+	}
+	cases := []struct {
+		desc           string
+		q              question
+		checker        promptChecker
+		yesAlways      bool
+		nonInteractive bool
+		wantPrompts    uint64
+		wantAnswer     string
+		errMsg         string
+	}{
+		{
+			desc:        "answered",
+			q:           question{name: questionConfFile},
+			checker:     newYesNoChecker(errConfFileCheckNo),
+			wantPrompts: 1,
+			wantAnswer:  "yes",
+		},
+		{
+			desc:        "answered no",
+			q:           question{name: questionTune},
+			checker:     newYesNoChecker("not tuning"),
+			wantPrompts: 1,
+			wantAnswer:  "no",
+			errMsg:      "not tuning",
+		},
+		{
+			desc:        "answered over --yes",
+			q:           question{name: questionGroups, label: pgtune.MemoryLabel},
+			checker:     newSkipChecker(errSettingsNeedTuningFmt, pgtune.MemoryLabel),
+			yesAlways:   true,
+			wantPrompts: 1,
+			wantAnswer:  answerSkip,
+			errMsg:      errSkip.Error(),
+		},
+		{
+			desc:      "unanswered with --yes",
+			q:         question{name: questionSharedLibs},
+			checker:   newYesNoChecker(errSharedLibNeeded),
+			yesAlways: true,
+		},
+		{
+			desc:        "unanswered reads stdin",
+			q:           question{name: questionSharedLibs},
+			checker:     newYesNoChecker(errSharedLibNeeded),
+			wantPrompts: 1,
+		},
+		{
+			desc:           "unanswered when non-interactive",
+			q:              question{name: questionSharedLibs},
+			checker:        newYesNoChecker(errSharedLibNeeded),
+			nonInteractive: true,
+			errMsg:         fmt.Sprintf(errUnansweredFmt, "Append to end? "+strings.TrimSpace(promptYesNo)),
+		},
+		{
+			desc:        "invalid answer",
+			q:           question{name: questionGroups, label: pgtune.MemoryLabel},
+			checker:     newYesNoChecker(errSharedLibNeeded),
+			wantPrompts: 1,
+			wantAnswer:  answerSkip,
+			errMsg:      fmt.Sprintf(errAnswerInvalidFmt, answerSkip, "groups.memory"),
+		},
+	}
+
+	for _, c := range cases {
+		tuner := newTunerWithDefaultFlagsForInputs(t, "y\n", []string{})
+		tuner.answers = answers
+		tuner.report = &report{}
+		tuner.flags.YesAlways = c.yesAlways
+		tuner.flags.NonInteractive = c.nonInteractive
+
+		err := tuner.promptUntilValidInput("Append to end? "+promptYesNo, ask(c.q, c.checker))
+		if c.errMsg != "" {
+			if err == nil || err.Error() != c.errMsg {
+				t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.errMsg)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		}
+
+		tp := tuner.handler.p.(*testPrinter)
+		if tp.promptCalls != c.wantPrompts {
+			t.Errorf("%s: incorrect number of prompts: got %d want %d", c.desc, tp.promptCalls, c.wantPrompts)
+		}
+		if c.wantAnswer == "" {
+			if got := len(tuner.report.Answers); got != 0 {
+				t.Errorf("%s: unexpected answers in report: got %d", c.desc, got)
+			}
+			continue
+		}
+		if got := len(tuner.report.Answers); got != 1 {
+			t.Errorf("%s: incorrect number of answers in report: got %d", c.desc, got)
+		} else if got := tuner.report.Answers[0]; got.Question != c.q.String() || got.Answer != c.wantAnswer {
+			t.Errorf("%s: incorrect answer in report: got %s = %s", c.desc, got.Question, got.Answer)
+		}
+		want := fmt.Sprintf(statementAnsweredFmt, c.q)
+		if got := tp.statements[len(tp.statements)-1]; got != want {
+			t.Errorf("%s: incorrect statement: got %s want %s", c.desc, got, want)
+		}
+	}
+}
+
+func TestTunerProcessSettingsGroupAnswers(t *testing.T) {
+	config := getDefaultSystemConfig(t)
+	answers := &answersFile{
+		Groups:   map[string]string{pgtune.MemoryLabel: answerAccept, pgtune.ParallelLabel: answerSkip},
+		Settings: map[string]string{pgtune.WorkMemKey: "32MB"},
+	}
+
+	for _, perSetting := range []bool{false, true} {
+		// max_connections is set so that the given work_mem fits in memory
+		tuner := newTunerWithDefaultFlagsForInputs(t, "", []string{"max_connections = 25"})
+		tuner.flags.PerSetting = perSetting
+		tuner.flags.NonInteractive = true
+		tuner.answers = answers
+		tuner.report = &report{}
+		tuner.config = config
+
+		for _, label := range []string{pgtune.MemoryLabel, pgtune.ParallelLabel} {
+			sg, err := tuner.getSettingsGroup(label, config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := tuner.processSettingsGroup(sg, pgtune.DefaultProfile); err != nil {
+				t.Fatalf("per setting %v: unexpected error: %v", perSetting, err)
+			}
+		}
+
+		wantLines := []string{"max_connections = 25", "shared_buffers = 2GB", "effective_cache_size = 6GB", "maintenance_work_mem = 1GB", "work_mem = 32MB"}
+		if got := len(tuner.cfs.lines); got != len(wantLines) {
+			t.Fatalf("per setting %v: incorrect number of lines: got %d want %d", perSetting, got, len(wantLines))
+		}
+		for i, want := range wantLines {
+			if got := tuner.cfs.lines[i].content; got != want {
+				t.Errorf("per setting %v: incorrect line at %d: got %s want %s", perSetting, i, got, want)
+			}
+		}
+		if got := tuner.byHand[pgtune.WorkMemKey]; got != "64MB" {
+			t.Errorf("per setting %v: incorrect recommendation for given setting: got %s", perSetting, got)
+		}
+		if got := len(tuner.byHand); got != 1 {
+			t.Errorf("per setting %v: incorrect number of settings set by hand: got %d", perSetting, got)
+		}
+		if s := tuner.report.Groups[0].Settings[3]; s.Key != pgtune.WorkMemKey || !s.ByHand || s.Value != "32MB" {
+			t.Errorf("per setting %v: incorrect report for given setting: got %s %v %s", perSetting, s.Key, s.ByHand, s.Value)
+		}
+		for _, s := range tuner.report.Groups[1].Settings {
+			if s.Action != actionSkip && s.Action != actionNone {
+				t.Errorf("per setting %v: incorrect action for skipped group: got %s for %s", perSetting, s.Action, s.Key)
+			}
+		}
+	}
+
+	// given values must be valid
+	tuner := newTunerWithDefaultFlagsForInputs(t, "", []string{})
+	tuner.flags.NonInteractive = true
+	tuner.answers = &answersFile{Settings: map[string]string{pgtune.WorkMemKey: "lots"}}
+	sg, _ := tuner.getSettingsGroup(pgtune.MemoryLabel, config)
+	err := tuner.processSettingsGroup(sg, pgtune.DefaultProfile)
+	if err == nil || !strings.HasPrefix(err.Error(), "answers file: invalid value for work_mem") {
+		t.Errorf("incorrect error for invalid given value: got %v", err)
+	}
+
+	// settings that are not numbers take the values PostgreSQL accepts for them
+	config, err = pgtune.NewSystemConfig(testMem, testCPUs, pgutils.MajorVersion14, testWALDisk, testMaxConns, testWorkers)
+	if err != nil {
+		t.Fatalf("unexpected error in config creation: got %v", err)
+	}
+	tuner = newTunerWithDefaultFlagsForInputs(t, "", []string{})
+	tuner.flags.NonInteractive = true
+	tuner.answers = &answersFile{
+		Groups:   map[string]string{pgtune.MiscLabel: answerAccept},
+		Settings: map[string]string{pgtune.Jit: "on", pgtune.DefaultToastCompression: "pglz"},
+	}
+	sg, _ = tuner.getSettingsGroup(pgtune.MiscLabel, config)
+	if err := tuner.processSettingsGroup(sg, pgtune.DefaultProfile); err != nil {
+		t.Fatalf("unexpected error for given enum and bool values: %v", err)
+	}
+	for _, want := range []string{"default_toast_compression = pglz", "jit = on"} {
+		found := false
+		for _, l := range tuner.cfs.lines {
+			found = found || l.content == want
+		}
+		if !found {
+			t.Errorf("missing line for given value: want %s", want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package tstune
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	applyFile        = "file"
+	applyAlterSystem = "alter-system"
+
+	errApplyUnknownFmt   = "unknown apply method: %s (valid values: %s)"
+	errApplyNoConnect    = "--apply needs a connection to the server; use it with --connect"
+	errApplyConflictFmt  = "--apply cannot be used with %s"
+	errApplyStatementFmt = "could not run %s: %v"
+
+	sqlReloadConfQuery = "SELECT pg_reload_conf()"
+
+	statementApplyingFmt      = "Applying %d change(s) to the running server with %s"
+	statementApplyReload      = "Reloading the configuration of the running server"
+	statementApplyRestart     = "Restart PostgreSQL for these settings to take effect"
+	statementApplyNoRestart   = "No restart is needed"
+	successApplyNothing       = "no changes to apply to the running server"
+	successAppliedFmt         = "in effect: %s"
+	applyRestartLabel         = "restart needed"
+	warningApplyNotAppliedFmt = "%s: the server is running with %s (set by %s) instead of %s"
+	warningApplyUnknownKeyFmt = "%s: the server does not know this setting, so it was not checked"
+)
+
+// ValidApplyMethods are the ways changes can be pushed to a running server
+// with --apply
+var ValidApplyMethods = []string{applyFile, applyAlterSystem}
+
+// allows us to substitute mock versions in tests
+var (
+	applyPollAttempts = 10
+	applyPollInterval = 200 * time.Millisecond
+)
+
+// validateApplyFlags returns an error if --apply is given an unknown method,
+// has no server to apply changes to, or is combined with flags that keep
+// changes from being made.
+func validateApplyFlags(flags *TunerFlags) error {
+	if flags.Apply == "" {
+		return nil
+	}
+	if flags.Apply != applyFile && flags.Apply != applyAlterSystem {
+		return fmt.Errorf(errApplyUnknownFmt, flags.Apply, strings.Join(ValidApplyMethods, ", "))
+	}
+	switch {
+	case flags.Connect == "":
+		return fmt.Errorf(errApplyNoConnect)
+	case flags.Restore:
+		return fmt.Errorf(errApplyConflictFmt, "--restore")
+	case flags.Check:
+		return fmt.Errorf(errApplyConflictFmt, "--check")
+	case flags.SQLPath != "":
+		return fmt.Errorf(errApplyConflictFmt, "--sql-script")
+	case flags.Diff:
+		return fmt.Errorf(errApplyConflictFmt, "--diff")
+	case flags.DryRun:
+		return fmt.Errorf(errApplyConflictFmt, "--dry-run")
+	}
+	return nil
+}
+
+// applyOutcome is what became of the changes pushed to the running server.
+type applyOutcome struct {
+	Method         string   `json:"method" yaml:"method"`
+	Applied        []string `json:"applied" yaml:"applied"`
+	PendingRestart []string `json:"pending_restart" yaml:"pending_restart"`
+	NotApplied     []string `json:"not_applied" yaml:"not_applied"`
+}
+
+// classifyChanges sorts changes by whether the settings of the running server
+// show them in effect, waiting for a restart, or overridden by something else.
+func classifyChanges(changes []*settingChange, settings map[string]*pgSetting) *applyOutcome {
+	o := &applyOutcome{Applied: []string{}, PendingRestart: []string{}, NotApplied: []string{}}
+	for _, c := range changes {
+		s, ok := settings[c.key]
+		switch {
+		case !ok:
+			o.NotApplied = append(o.NotApplied, c.key)
+		case !s.differsFrom(c.value):
+			o.Applied = append(o.Applied, c.key)
+		case s.pendingRestart:
+			o.PendingRestart = append(o.PendingRestart, c.key)
+		default:
+			o.NotApplied = append(o.NotApplied, c.key)
+		}
+	}
+	return o
+}
+
+// waiting returns whether any of the changes not applied are to settings the
+// server knows, and so may still be picked up.
+func (o *applyOutcome) waiting(settings map[string]*pgSetting) bool {
+	for _, key := range o.NotApplied {
+		if _, ok := settings[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applyChanges pushes the accepted changes to the running server, either with
+// ALTER SYSTEM or by having it reload the conf file that was just written, and
+// then reads pg_settings again to tell which of them took effect and which
+// still need a restart.
+func (t *Tuner) applyChanges() error {
+	if len(t.changes) == 0 {
+		t.handler.p.Success(successApplyNothing)
+		return nil
+	}
+	conn, err := connectFn(t.flags.Connect)
+	if err != nil {
+		return fmt.Errorf(errConnectFmt, err)
+	}
+	defer conn.Close()
+
+	if t.flags.Apply == applyAlterSystem {
+		t.handler.p.Statement(statementApplyingFmt, len(t.changes), "ALTER SYSTEM")
+		for _, c := range t.changes {
+			stmt := alterSystemStatement(c.key, c.value)
+			if err := conn.Exec(stmt); err != nil {
+				return fmt.Errorf(errApplyStatementFmt, stmt, err)
+			}
+		}
+	}
+	t.handler.p.Statement(statementApplyReload)
+	if err := conn.Exec(sqlReloadConfQuery); err != nil {
+		return fmt.Errorf(errApplyStatementFmt, sqlReloadConfQuery, err)
+	}
+
+	names := []string{}
+	for _, c := range t.changes {
+		names = append(names, c.key)
+	}
+	// backends only pick up the new configuration once the server has
+	// signaled them, so give it a moment if nothing seems to have changed yet
+	var settings map[string]*pgSetting
+	var outcome *applyOutcome
+	for i := 0; i < applyPollAttempts; i++ {
+		if i > 0 {
+			time.Sleep(applyPollInterval)
+		}
+		settings, err = conn.Settings(names)
+		if err != nil {
+			return fmt.Errorf(errReadSettingsFmt, err)
+		}
+		outcome = classifyChanges(t.changes, settings)
+		if !outcome.waiting(settings) {
+			break
+		}
+	}
+	outcome.Method = t.flags.Apply
+	t.printApplyOutcome(outcome, settings)
+	if t.report != nil {
+		t.report.Apply = outcome
+	}
+	return nil
+}
+
+// printApplyOutcome tells the user exactly which settings are in effect and
+// which are not yet, and why.
+func (t *Tuner) printApplyOutcome(o *applyOutcome, settings map[string]*pgSetting) {
+	if len(o.Applied) > 0 {
+		t.handler.p.Success(successAppliedFmt, strings.Join(o.Applied, ", "))
+	}
+	for _, key := range o.NotApplied {
+		s, ok := settings[key]
+		if !ok {
+			t.handler.p.Error("warning", warningApplyUnknownKeyFmt, key)
+			continue
+		}
+		want := ""
+		for _, c := range t.changes {
+			if c.key == key {
+				want = c.value
+			}
+		}
+		t.handler.p.Error("warning", warningApplyNotAppliedFmt, key, s.value(), s.source, want)
+	}
+	if len(o.PendingRestart) > 0 {
+		t.handler.p.Error(applyRestartLabel, strings.Join(o.PendingRestart, ", "))
+		t.handler.p.Statement(statementApplyRestart)
+	} else {
+		t.handler.p.Statement(statementApplyNoRestart)
+	}
+}
@@ -0,0 +1,201 @@
+package tstune
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+func TestValidateApplyFlags(t *testing.T) {
+	connect := "postgres://localhost"
+	cases := []struct {
+		desc   string
+		flags  *TunerFlags
+		errMsg string
+	}{
+		{desc: "not applying", flags: &TunerFlags{DryRun: true}},
+		{desc: "file", flags: &TunerFlags{Apply: applyFile, Connect: connect}},
+		{desc: "alter system", flags: &TunerFlags{Apply: applyAlterSystem, Connect: connect}},
+		{
+			desc:   "unknown method",
+			flags:  &TunerFlags{Apply: "foo", Connect: connect},
+			errMsg: fmt.Sprintf(errApplyUnknownFmt, "foo", "file, alter-system"),
+		},
+		{desc: "no connection", flags: &TunerFlags{Apply: applyFile}, errMsg: errApplyNoConnect},
+		{
+			desc:   "check",
+			flags:  &TunerFlags{Apply: applyFile, Connect: connect, Check: true},
+			errMsg: fmt.Sprintf(errApplyConflictFmt, "--check"),
+		},
+		{
+			desc:   "sql script",
+			flags:  &TunerFlags{Apply: applyAlterSystem, Connect: connect, SQLPath: "-"},
+			errMsg: fmt.Sprintf(errApplyConflictFmt, "--sql-script"),
+		},
+		{
+			desc:   "diff",
+			flags:  &TunerFlags{Apply: applyFile, Connect: connect, Diff: true, DryRun: true},
+			errMsg: fmt.Sprintf(errApplyConflictFmt, "--diff"),
+		},
+		{
+			desc:   "dry run",
+			flags:  &TunerFlags{Apply: applyFile, Connect: connect, DryRun: true},
+			errMsg: fmt.Sprintf(errApplyConflictFmt, "--dry-run"),
+		},
+	}
+	for _, c := range cases {
+		err := validateApplyFlags(c.flags)
+		if c.errMsg == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if c.errMsg != "" && (err == nil || err.Error() != c.errMsg) {
+			t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.errMsg)
+		}
+	}
+}
+
+func TestClassifyChanges(t *testing.T) {
+	sharedBuffers := *testSharedBuffers
+	sharedBuffers.pendingRestart = true
+	workMem := *testWorkMem
+	workMem.setting = "65536"
+	checkpointTimeout := *testCheckpointTimeout
+	checkpointTimeout.source = "command line"
+	settings := map[string]*pgSetting{
+		pgtune.SharedBuffersKey: &sharedBuffers,
+		pgtune.WorkMemKey:       &workMem,
+		"checkpoint_timeout":    &checkpointTimeout,
+	}
+	changes := []*settingChange{
+		{pgtune.SharedBuffersKey, "2GB"},
+		{pgtune.WorkMemKey, "64MB"},
+		{"checkpoint_timeout", "15min"},
+		{"timescaledb.max_background_workers", "8"},
+	}
+	got := classifyChanges(changes, settings)
+	want := &applyOutcome{
+		Applied:        []string{pgtune.WorkMemKey},
+		PendingRestart: []string{pgtune.SharedBuffersKey},
+		NotApplied:     []string{"checkpoint_timeout", "timescaledb.max_background_workers"},
+	}
+	if fmt.Sprintf("%v", got) != fmt.Sprintf("%v", want) {
+		t.Errorf("incorrect outcome: got %+v want %+v", got, want)
+	}
+	if !got.waiting(settings) {
+		t.Errorf("not waiting on a known setting")
+	}
+	got.NotApplied = []string{"timescaledb.max_background_workers"}
+	if got.waiting(settings) {
+		t.Errorf("waiting on an unknown setting")
+	}
+}
+
+func TestTunerApplyChanges(t *testing.T) {
+	oldConnectFn := connectFn
+	oldAttempts, oldInterval := applyPollAttempts, applyPollInterval
+	defer func() {
+		connectFn = oldConnectFn
+		applyPollAttempts, applyPollInterval = oldAttempts, oldInterval
+	}()
+	applyPollInterval = 0
+
+	sharedBuffers := *testSharedBuffers
+	workMem := *testWorkMem
+	checkpointTimeout := *testCheckpointTimeout
+	checkpointTimeout.source = "command line"
+	conn := &testPGConn{settings: map[string]*pgSetting{
+		pgtune.SharedBuffersKey: &sharedBuffers,
+		pgtune.WorkMemKey:       &workMem,
+		"checkpoint_timeout":    &checkpointTimeout,
+	}}
+	reloads := 0
+	conn.onExec = func(query string) error {
+		if query == sqlReloadConfQuery {
+			reloads++
+			sharedBuffers.pendingRestart = true
+			workMem.setting = "65536"
+		}
+		return nil
+	}
+	connectFn = func(string) (pgConn, error) { return conn, nil }
+
+	tuner := newTunerWithDefaultFlags(setupDefaultTestIO(""), nil)
+	tuner.flags.Connect = "postgres://localhost"
+	tuner.flags.Apply = applyAlterSystem
+	tuner.report = &report{}
+
+	// nothing to do
+	if err := tuner.applyChanges(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(conn.execs) != 0 {
+		t.Errorf("statements run without changes: %v", conn.execs)
+	}
+
+	tuner.changes = []*settingChange{
+		{pgtune.SharedBuffersKey, "2GB"},
+		{pgtune.WorkMemKey, "64MB"},
+		{"checkpoint_timeout", "15min"},
+	}
+	applyPollAttempts = 3
+	if err := tuner.applyChanges(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantExecs := []string{
+		"ALTER SYSTEM SET shared_buffers = '2GB';",
+		"ALTER SYSTEM SET work_mem = '64MB';",
+		"ALTER SYSTEM SET checkpoint_timeout = '15min';",
+		sqlReloadConfQuery,
+	}
+	if got := strings.Join(conn.execs, "\n"); got != strings.Join(wantExecs, "\n") {
+		t.Errorf("incorrect statements: got\n%s\nwant\n%s", got, strings.Join(wantExecs, "\n"))
+	}
+	if reloads != 1 || !conn.closed {
+		t.Errorf("incorrect reloads or connection left open: %d %v", reloads, conn.closed)
+	}
+
+	p := tuner.handler.p.(*testPrinter)
+	wantErrors := []string{
+		"warning: " + fmt.Sprintf(warningApplyNotAppliedFmt, "checkpoint_timeout", "300s", "command line", "15min"),
+		applyRestartLabel + ": " + pgtune.SharedBuffersKey,
+	}
+	if got := strings.Join(p.errors, "\n"); got != strings.Join(wantErrors, "\n") {
+		t.Errorf("incorrect errors: got\n%s\nwant\n%s", got, strings.Join(wantErrors, "\n"))
+	}
+	if got := p.successes[len(p.successes)-1]; got != fmt.Sprintf(successAppliedFmt, pgtune.WorkMemKey) {
+		t.Errorf("incorrect success: got %s", got)
+	}
+	if got := p.statements[len(p.statements)-1]; got != statementApplyRestart {
+		t.Errorf("incorrect last statement: got %s want %s", got, statementApplyRestart)
+	}
+	if tuner.report.Apply == nil || tuner.report.Apply.Method != applyAlterSystem {
+		t.Errorf("outcome not reported: %+v", tuner.report.Apply)
+	}
+
+	// the conf file was already written, so only reload
+	conn.execs = nil
+	tuner.flags.Apply = applyFile
+	tuner.changes = tuner.changes[1:2]
+	if err := tuner.applyChanges(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(conn.execs, "\n"); got != sqlReloadConfQuery {
+		t.Errorf("incorrect statements for file: got %s", got)
+	}
+	if got := p.statements[len(p.statements)-1]; got != statementApplyNoRestart {
+		t.Errorf("incorrect last statement: got %s want %s", got, statementApplyNoRestart)
+	}
+
+	// errors
+	conn.onExec = func(string) error { return fmt.Errorf("permission denied") }
+	err := tuner.applyChanges()
+	if want := fmt.Sprintf(errApplyStatementFmt, sqlReloadConfQuery, "permission denied"); err == nil || err.Error() != want {
+		t.Errorf("incorrect error: got %v want %s", err, want)
+	}
+	connectFn = func(string) (pgConn, error) { return nil, fmt.Errorf("refused") }
+	err = tuner.applyChanges()
+	if want := fmt.Sprintf(errConnectFmt, "refused"); err == nil || err.Error() != want {
+		t.Errorf("incorrect error: got %v want %s", err, want)
+	}
+}
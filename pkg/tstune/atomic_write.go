@@ -0,0 +1,151 @@
+package tstune
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// newFileMode is the mode given to conf files that did not exist before,
+	// since there is no original to copy it from.
+	newFileMode = 0644
+
+	errFileChanged   = "file was changed on disk after it was read; run timescaledb-tune again to tune its current contents"
+	errNotSyncedFmt  = "could not sync directory %s after writing: %v"
+	warningNotSynced = "%s was written, but its directory could not be synced, so it may have its old contents after a crash: %v"
+)
+
+// allows us to substitute mock versions in tests
+var (
+	writeFileAtomicFn = writeFileAtomic
+	syncDirFn         = syncDir
+)
+
+// notSyncedError is returned by writeFileAtomic when the file was replaced,
+// but syncing its directory afterwards failed, so the rename may not yet be
+// durable.
+type notSyncedError struct {
+	dir string
+	err error
+}
+
+func (e *notSyncedError) Error() string {
+	return fmt.Sprintf(errNotSyncedFmt, e.dir, e.err)
+}
+
+func (e *notSyncedError) Unwrap() error {
+	return e.err
+}
+
+// checkWriteErr returns err from writing the file at path, unless the file was
+// written and only syncing its directory failed. Since the file has its new
+// contents either way, that is only a warning.
+func (t *Tuner) checkWriteErr(path string, err error) error {
+	var notSynced *notSyncedError
+	if errors.As(err, &notSynced) {
+		t.handler.p.Error("warning", warningNotSynced, path, notSynced.err)
+		return nil
+	}
+	return err
+}
+
+// fileSnapshot records what a file looked like when it was read, so we can
+// tell whether something else changed it before we write it back.
+type fileSnapshot struct {
+	modTime time.Time
+	sum     [sha256.Size]byte
+}
+
+// checkUnchanged returns an error if the file at path no longer matches the
+// snapshot. The content hash catches edits made within the same mtime tick.
+func (s *fileSnapshot) checkUnchanged(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.ModTime().Equal(s.modTime) {
+		return fmt.Errorf(errFileChanged)
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if sha256.Sum256(contents) != s.sum {
+		return fmt.Errorf(errFileChanged)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with the output of wt. The output
+// goes to a temporary file in the same directory which is synced and given the
+// mode, owner, and SELinux label of the file it replaces before being renamed
+// over it, so a crash leaves either the old file or the new one, never a
+// truncated mix. If snap is not nil and the file no longer matches it, nothing
+// is written. If only syncing the directory after the rename fails, the error
+// is a *notSyncedError.
+func writeFileAtomic(path string, snap *fileSnapshot, wt io.WriterTo) (err error) {
+	// replace the file a symlink points to rather than the symlink itself
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if snap != nil {
+		if err := snap.checkUnchanged(path); err != nil {
+			return err
+		}
+	}
+
+	var orig os.FileInfo
+	if fi, err := os.Stat(path); err == nil {
+		orig = fi
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".tstune-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = wt.WriteTo(tmp); err != nil {
+		return err
+	}
+	mode := os.FileMode(newFileMode)
+	if orig != nil {
+		mode = orig.Mode().Perm()
+		// the owner and label are kept where we have permission to set them,
+		// and otherwise left as whoever is running us
+		_ = copyOwner(orig, tmp)
+		_ = copySELinuxLabel(path, tmp)
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	if err := syncDirFn(dir); err != nil {
+		return &notSyncedError{dir: dir, err: err}
+	}
+	return nil
+}
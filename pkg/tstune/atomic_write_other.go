@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || freebsd)
+
+package tstune
+
+import "os"
+
+// copyOwner is not supported on this OS, so the file keeps the owner of
+// whoever is running us.
+func copyOwner(fi os.FileInfo, f *os.File) error {
+	return nil
+}
+
+// syncDir is not supported on this OS; the rename is as durable as the
+// filesystem makes it.
+func syncDir(dir string) error {
+	return nil
+}
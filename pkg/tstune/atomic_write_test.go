@@ -0,0 +1,218 @@
+package tstune
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testWriterTo struct {
+	contents  string
+	shouldErr bool
+}
+
+func (w *testWriterTo) WriteTo(out io.Writer) (int64, error) {
+	n, err := io.WriteString(out, w.contents)
+	if err == nil && w.shouldErr {
+		err = fmt.Errorf(errTestWriter)
+	}
+	return int64(n), err
+}
+
+func checkFileContents(t *testing.T, desc, path, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s: could not read %s: %v", desc, path, err)
+	}
+	if string(got) != want {
+		t.Errorf("%s: incorrect contents: got %q want %q", desc, got, want)
+	}
+}
+
+func checkNoTempFiles(t *testing.T, desc, dir string) {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, ".*.tstune-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) > 0 {
+		t.Errorf("%s: temp files left behind: %v", desc, matches)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "postgresql.conf")
+
+	// new file
+	if err := writeFileAtomic(confPath, nil, &testWriterTo{contents: "foo = 1\n"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkFileContents(t, "new file", confPath, "foo = 1\n")
+	fi, err := os.Stat(confPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fi.Mode().Perm(); got != newFileMode {
+		t.Errorf("incorrect mode for new file: got %v want %v", got, os.FileMode(newFileMode))
+	}
+
+	// existing file keeps its mode
+	if err := os.Chmod(confPath, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(confPath, nil, &testWriterTo{contents: "bar = 2\n"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkFileContents(t, "existing file", confPath, "bar = 2\n")
+	fi, err = os.Stat(confPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fi.Mode().Perm(); got != 0600 {
+		t.Errorf("incorrect mode for existing file: got %v want %v", got, os.FileMode(0600))
+	}
+
+	// failed write leaves the original alone
+	err = writeFileAtomic(confPath, nil, &testWriterTo{contents: "baz = 3\n", shouldErr: true})
+	if err == nil || err.Error() != errTestWriter {
+		t.Errorf("incorrect error: got %v want %s", err, errTestWriter)
+	}
+	checkFileContents(t, "failed write", confPath, "bar = 2\n")
+
+	// symlinks are followed rather than replaced
+	linkPath := filepath.Join(dir, "link.conf")
+	if err := os.Symlink(confPath, linkPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(linkPath, nil, &testWriterTo{contents: "quaz = 4\n"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkFileContents(t, "symlink", confPath, "quaz = 4\n")
+	if fi, err := os.Lstat(linkPath); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symlink was replaced: %v", err)
+	}
+
+	checkNoTempFiles(t, "all", dir)
+}
+
+func TestWriteFileAtomicNotSynced(t *testing.T) {
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "postgresql.conf")
+	oldSyncDirFn := syncDirFn
+	defer func() { syncDirFn = oldSyncDirFn }()
+	syncDirFn = func(string) error { return fmt.Errorf(errTestWriter) }
+
+	err := writeFileAtomic(confPath, nil, &testWriterTo{contents: "foo = 1\n"})
+	var notSynced *notSyncedError
+	if !errors.As(err, &notSynced) {
+		t.Fatalf("incorrect error: got %v want a *notSyncedError", err)
+	}
+	if want := fmt.Sprintf(errNotSyncedFmt, dir+string(filepath.Separator), errTestWriter); err.Error() != want {
+		t.Errorf("incorrect error: got %v want %s", err, want)
+	}
+	// the file was still written
+	checkFileContents(t, "not synced", confPath, "foo = 1\n")
+	checkNoTempFiles(t, "not synced", dir)
+
+	tuner := newTunerWithDefaultFlags(setupDefaultTestIO(""), nil)
+	if err := tuner.checkWriteErr(confPath, err); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	tp := tuner.handler.p.(*testPrinter)
+	if want := "warning: " + fmt.Sprintf(warningNotSynced, confPath, errTestWriter); tp.errorCalls != 1 || tp.errors[0] != want {
+		t.Errorf("incorrect warnings: got %v want %s", tp.errors, want)
+	}
+
+	// any other error is returned as is
+	other := fmt.Errorf(errTestWriter)
+	if err := tuner.checkWriteErr(confPath, other); err != other {
+		t.Errorf("incorrect error: got %v want %v", err, other)
+	}
+	if err := tuner.checkWriteErr(confPath, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWriteFileAtomicSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "postgresql.conf")
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	reset := func(contents string) {
+		t.Helper()
+		if err := os.WriteFile(confPath, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(confPath, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reset("foo = 1\n")
+	cfs, err := readConfigFileState(confPath, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfs.snapshot == nil {
+		t.Fatalf("no snapshot for file read from disk")
+	}
+
+	cases := []struct {
+		desc     string
+		contents string
+		touch    bool
+		errMsg   string
+	}{
+		{
+			desc:     "unchanged",
+			contents: "foo = 1\n",
+		},
+		{
+			desc:     "touched",
+			contents: "foo = 1\n",
+			touch:    true,
+			errMsg:   errFileChanged,
+		},
+		{
+			desc:     "same mtime, different contents",
+			contents: "foo = 2\n",
+			errMsg:   errFileChanged,
+		},
+	}
+
+	for _, c := range cases {
+		reset(c.contents)
+		if c.touch {
+			if err := os.Chtimes(confPath, time.Now(), time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := writeFileAtomic(confPath, cfs.snapshot, &testWriterTo{contents: "bar = 2\n"})
+		if c.errMsg == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", c.desc, err)
+			}
+			checkFileContents(t, c.desc, confPath, "bar = 2\n")
+		} else {
+			if err == nil || err.Error() != c.errMsg {
+				t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.errMsg)
+			}
+			checkFileContents(t, c.desc, confPath, c.contents)
+		}
+	}
+	checkNoTempFiles(t, "all", dir)
+
+	// only files read from disk get a snapshot
+	cfs, err = getConfigFileState(stringSliceToBytesReader([]string{"foo = 1"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfs.snapshot != nil {
+		t.Errorf("unexpected snapshot for file not read from disk")
+	}
+}
@@ -0,0 +1,27 @@
+//go:build linux || darwin || freebsd
+
+package tstune
+
+import (
+	"os"
+	"syscall"
+)
+
+// copyOwner gives f the same owner and group as the file described by fi.
+func copyOwner(fi os.FileInfo, f *os.File) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return f.Chown(int(st.Uid), int(st.Gid))
+}
+
+// syncDir flushes the directory entry of a file renamed into dir to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
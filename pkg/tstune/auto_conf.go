@@ -0,0 +1,142 @@
+package tstune
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	autoConfFileName  = "postgresql.auto.conf"
+	pgVersionFileName = "PG_VERSION"
+
+	fmtAutoConfParam = "%s = '%s'"
+
+	statementAutoConfFound   = "Found settings made with ALTER SYSTEM at:"
+	warningAutoConfShadowFmt = "%s set in %s with ALTER SYSTEM, which overrides postgresql.conf"
+	promptAutoConf           = "Write recommendations to " + autoConfFileName + " or remove the entries from it? "
+	promptAutoConfOptions    = "[(w)rite/(r)emove/(q)uit]: "
+	errAutoConfShadowFmt     = "%s settings are still overridden by " + autoConfFileName
+)
+
+// getDataDirectory returns the best guess at the PostgreSQL data directory for
+// the conf file at confPath, in order of preference: the data_directory setting,
+// the directory holding confPath if it looks like a data directory, and PGDATA.
+// Returns an empty string if none of these work out.
+func getDataDirectory(cfs *configFileState, confPath string) string {
+	if cfs != nil && cfs.dataDirectory != "" {
+		dir := cfs.dataDirectory
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(confPath), dir)
+		}
+		return dir
+	}
+	confDir := filepath.Dir(confPath)
+	if fileExists(filepath.Join(confDir, pgVersionFileName)) {
+		return confDir
+	}
+	return os.Getenv("PGDATA")
+}
+
+// getAutoConfPath returns the path of postgresql.auto.conf for the conf file at
+// confPath, or an empty string if it cannot be found.
+func getAutoConfPath(cfs *configFileState, confPath string) string {
+	candidates := []string{}
+	if dir := getDataDirectory(cfs, confPath); dir != "" {
+		candidates = append(candidates, dir)
+	}
+	candidates = append(candidates, filepath.Dir(confPath))
+	if pgdata := os.Getenv("PGDATA"); pgdata != "" {
+		candidates = append(candidates, pgdata)
+	}
+	for _, dir := range candidates {
+		autoPath := filepath.Join(dir, autoConfFileName)
+		if fileExists(autoPath) {
+			return autoPath
+		}
+	}
+	return ""
+}
+
+// isAutoConf returns whether filePath is the postgresql.auto.conf for cfs.
+func (cfs *configFileState) isAutoConf(filePath string) bool {
+	return cfs.autoConf != nil && cfs.autoConf.path == filePath
+}
+
+// mergeAutoConf applies the state of postgresql.auto.conf on top of cfs. As
+// PostgreSQL reads it last, any setting in it overrides the same setting in
+// postgresql.conf or its included files. The results that get overridden are
+// remembered so that the override can later be removed in favor of them.
+func (cfs *configFileState) mergeAutoConf(auto *configFileState) {
+	cfs.autoConf = auto
+	auto.shadowed = make(map[string]*tunableParseResult)
+
+	if res := auto.sharedLibResult; res != nil && !res.commented {
+		cfs.sharedLibResult = res
+	}
+	for k, tpr := range auto.tuneParseResults {
+		if tpr.commented {
+			continue
+		}
+		if prev, ok := cfs.tuneParseResults[k]; ok {
+			auto.shadowed[k] = prev
+		}
+		cfs.tuneParseResults[k] = tpr
+	}
+}
+
+// loadAutoConf finds, parses, and merges postgresql.auto.conf for the conf
+// file at confPath, if there is one.
+func (t *Tuner) loadAutoConf(confPath string) error {
+	autoPath := getAutoConfPath(t.cfs, confPath)
+	if autoPath == "" {
+		return nil
+	}
+	auto, err := readConfigFileState(autoPath, 0)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %v", autoPath, err)
+	}
+	t.cfs.mergeAutoConf(auto)
+	if !t.flags.Quiet {
+		t.handler.p.Statement(statementAutoConfFound)
+		fmt.Fprintf(t.handler.outErr, autoPath+"\n\n")
+	}
+	return nil
+}
+
+// processAutoConfShadowing tells the user which of the settings in a group of
+// accepted recommendations are overridden by postgresql.auto.conf and asks
+// whether the recommendations should be written there or whether the overriding
+// entries should be removed. In quiet mode it defaults to writing them there.
+func (t *Tuner) processAutoConfShadowing(label string, shadowed []*tunableParseResult) (autoConfAction, error) {
+	checker := newAutoConfChecker(errAutoConfShadowFmt, label)
+	if t.flags.Quiet {
+		return checker.response, nil
+	}
+	keys := []string{}
+	for _, r := range shadowed {
+		keys = append(keys, r.key)
+	}
+	t.handler.p.Error("warning", warningAutoConfShadowFmt, strings.Join(keys, ", "), t.cfs.autoConf.path)
+	err := t.promptUntilValidInput(promptAutoConf+promptAutoConfOptions, checker)
+	return checker.response, err
+}
+
+// applyAutoConfAction updates the conf files for a recommendation rec of a
+// setting r that is overridden by postgresql.auto.conf, either by replacing
+// the entry there or by removing it and updating postgresql.conf instead.
+func (t *Tuner) applyAutoConfAction(action autoConfAction, r *tunableParseResult, rec string) {
+	if action == autoConfWrite {
+		t.cfs.setLine(r.file, r.idx, fmt.Sprintf(fmtAutoConfParam, r.key, rec))
+		return
+	}
+
+	t.cfs.removeLine(r.file, r.idx)
+	prev, ok := t.cfs.autoConf.shadowed[r.key]
+	if ok && prev.idx >= 0 {
+		t.cfs.setLine(prev.file, prev.idx, fmt.Sprintf(fmtTunableParam, r.key, rec, prev.extra))
+	} else {
+		t.cfs.lines = append(t.cfs.lines, &configLine{content: fmt.Sprintf(fmtTunableParam, r.key, rec, "")})
+	}
+}
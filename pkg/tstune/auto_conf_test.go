@@ -0,0 +1,290 @@
+package tstune
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+func TestGetDataDirectory(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestConfFile(t, filepath.Join(dataDir, pgVersionFileName), "16")
+	etcDir := t.TempDir()
+
+	cases := []struct {
+		desc     string
+		lines    []string
+		confPath string
+		pgdata   string
+		want     string
+	}{
+		{
+			desc:     "data_directory setting",
+			lines:    []string{"data_directory = '/var/lib/postgresql/16/main'"},
+			confPath: filepath.Join(etcDir, "postgresql.conf"),
+			want:     "/var/lib/postgresql/16/main",
+		},
+		{
+			desc:     "relative data_directory setting",
+			lines:    []string{"data_directory = 'data'"},
+			confPath: filepath.Join(etcDir, "postgresql.conf"),
+			want:     filepath.Join(etcDir, "data"),
+		},
+		{
+			desc:     "commented data_directory setting is ignored",
+			lines:    []string{"#data_directory = '/foo'"},
+			confPath: filepath.Join(dataDir, "postgresql.conf"),
+			want:     dataDir,
+		},
+		{
+			desc:     "conf file in data directory",
+			confPath: filepath.Join(dataDir, "postgresql.conf"),
+			pgdata:   "/should/not/use",
+			want:     dataDir,
+		},
+		{
+			desc:     "fallback to PGDATA",
+			confPath: filepath.Join(etcDir, "postgresql.conf"),
+			pgdata:   dataDir,
+			want:     dataDir,
+		},
+		{
+			desc:     "nothing found",
+			confPath: filepath.Join(etcDir, "postgresql.conf"),
+			want:     "",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			t.Setenv("PGDATA", c.pgdata)
+			cfs := newConfigFileStateFromSlice(t, c.lines)
+			if got := getDataDirectory(cfs, c.confPath); got != c.want {
+				t.Errorf("incorrect data directory: got %s want %s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestGetAutoConfPath(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestConfFile(t, filepath.Join(dataDir, autoConfFileName), "shared_buffers = '1GB'")
+	etcDir := t.TempDir()
+
+	t.Setenv("PGDATA", "")
+	if got := getAutoConfPath(newConfigFileStateFromSlice(t, nil), filepath.Join(etcDir, "postgresql.conf")); got != "" {
+		t.Errorf("unexpected auto conf path: got %s", got)
+	}
+	if got := getAutoConfPath(newConfigFileStateFromSlice(t, nil), filepath.Join(dataDir, "postgresql.conf")); got != filepath.Join(dataDir, autoConfFileName) {
+		t.Errorf("incorrect auto conf path next to conf: got %s", got)
+	}
+	cfs := newConfigFileStateFromSlice(t, []string{fmt.Sprintf("data_directory = '%s'", dataDir)})
+	if got := getAutoConfPath(cfs, filepath.Join(etcDir, "postgresql.conf")); got != filepath.Join(dataDir, autoConfFileName) {
+		t.Errorf("incorrect auto conf path from data_directory: got %s", got)
+	}
+	t.Setenv("PGDATA", dataDir)
+	if got := getAutoConfPath(newConfigFileStateFromSlice(t, nil), filepath.Join(etcDir, "postgresql.conf")); got != filepath.Join(dataDir, autoConfFileName) {
+		t.Errorf("incorrect auto conf path from PGDATA: got %s", got)
+	}
+}
+
+func newTestAutoConf(t *testing.T, lines ...string) *configFileState {
+	t.Helper()
+	auto, err := getConfigFileStateWithIncludes(stringSliceToBytesReader(lines), "/data/"+autoConfFileName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return auto
+}
+
+func TestConfigFileStateMergeAutoConf(t *testing.T) {
+	cfs := newConfigFileStateFromSlice(t, []string{
+		"shared_preload_libraries = 'timescaledb'",
+		"shared_buffers = 128MB",
+		"work_mem = 4MB",
+	})
+	auto := newTestAutoConf(t,
+		"# Do not edit this file manually!",
+		"shared_preload_libraries = 'pg_stat_statements'",
+		"shared_buffers = '1GB'",
+		"effective_cache_size = '3GB'",
+	)
+	cfs.mergeAutoConf(auto)
+
+	if !cfs.isAutoConf(auto.path) {
+		t.Errorf("auto conf path not recognized")
+	}
+	if cfs.fileFor(auto.path) != auto {
+		t.Errorf("fileFor did not return auto conf state")
+	}
+	if got := cfs.sharedLibResult.libs; got != "pg_stat_statements" {
+		t.Errorf("incorrect shared lib result: got %s", got)
+	}
+	if got := cfs.tuneParseResults[pgtune.SharedBuffersKey]; got.file != auto.path || got.value != "'1GB'" {
+		t.Errorf("shared_buffers not overridden: got %s at %s", got.value, got.location())
+	}
+	if got := cfs.tuneParseResults[pgtune.WorkMemKey]; got.file != "" {
+		t.Errorf("work_mem incorrectly overridden: got %s", got.location())
+	}
+	if got, ok := auto.shadowed[pgtune.SharedBuffersKey]; !ok || got.value != "128MB" {
+		t.Errorf("shared_buffers shadowed result missing or incorrect: %v", got)
+	}
+	if _, ok := auto.shadowed[pgtune.EffectiveCacheKey]; ok {
+		t.Errorf("effective_cache_size should not be shadowing anything")
+	}
+}
+
+func TestTunerProcessSettingsGroupAutoConf(t *testing.T) {
+	config := getDefaultSystemConfig(t)
+	sg := mustGetSettingsGroup(t, pgtune.MemoryLabel, config)
+	rec := sg.GetRecommender(pgtune.DefaultProfile).Recommend(pgtune.SharedBuffersKey)
+	lines := []string{
+		"shared_buffers = 128MB",
+		"effective_cache_size = 6GB",
+		"maintenance_work_mem = 1GB",
+		"work_mem = 64MB",
+	}
+
+	cases := []struct {
+		desc         string
+		input        string
+		quiet        bool
+		wantAutoLine string
+		wantRemoved  bool
+		wantMainLine string
+		shouldErr    bool
+	}{
+		{
+			desc:         "write to auto conf",
+			input:        "y\nw\n",
+			wantAutoLine: fmt.Sprintf(fmtAutoConfParam, pgtune.SharedBuffersKey, rec),
+			wantMainLine: lines[0],
+		},
+		{
+			desc:         "write to auto conf in quiet mode",
+			quiet:        true,
+			wantAutoLine: fmt.Sprintf(fmtAutoConfParam, pgtune.SharedBuffersKey, rec),
+			wantMainLine: lines[0],
+		},
+		{
+			desc:         "remove from auto conf",
+			input:        "y\nx\nr\n",
+			wantAutoLine: "shared_buffers = '1MB'",
+			wantRemoved:  true,
+			wantMainLine: fmt.Sprintf(fmtTunableParam, pgtune.SharedBuffersKey, rec, ""),
+		},
+		{
+			desc:      "quit",
+			input:     "y\nq\n",
+			shouldErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			tuner := newTunerWithDefaultFlagsForInputs(t, c.input, lines)
+			tuner.flags.Quiet = c.quiet
+			tuner.cfs.mergeAutoConf(newTestAutoConf(t, "shared_buffers = '1MB'"))
+
+			err := tuner.processSettingsGroup(sg, pgtune.DefaultProfile)
+			if c.shouldErr {
+				if err == nil {
+					t.Errorf("unexpected lack of error")
+				} else if want := fmt.Sprintf(errAutoConfShadowFmt, pgtune.MemoryLabel); err.Error() != want {
+					t.Errorf("incorrect error: got %v want %s", err, want)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			autoLine := tuner.cfs.autoConf.lines[0]
+			if autoLine.content != c.wantAutoLine {
+				t.Errorf("incorrect auto conf line: got %s want %s", autoLine.content, c.wantAutoLine)
+			}
+			if autoLine.remove != c.wantRemoved {
+				t.Errorf("incorrect auto conf line removal: got %v want %v", autoLine.remove, c.wantRemoved)
+			}
+			if got := tuner.cfs.lines[0].content; got != c.wantMainLine {
+				t.Errorf("incorrect main conf line: got %s want %s", got, c.wantMainLine)
+			}
+			if got := tuner.cfs.modifiedIncludes(); len(got) != 1 || got[0] != tuner.cfs.autoConf {
+				t.Errorf("auto conf not marked as modified")
+			}
+
+			tp := tuner.handler.p.(*testPrinter)
+			if !c.quiet {
+				found := false
+				for _, e := range tp.errors {
+					if strings.Contains(e, autoConfFileName) {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("no warning about auto conf shadowing: %v", tp.errors)
+				}
+			}
+		})
+	}
+}
+
+func TestTunerLoadAutoConf(t *testing.T) {
+	dataDir := t.TempDir()
+	confPath := filepath.Join(dataDir, "postgresql.conf")
+	writeTestConfFile(t, filepath.Join(dataDir, pgVersionFileName), "16")
+
+	tuner := newTunerWithDefaultFlagsForInputs(t, "", []string{"shared_buffers = 128MB"})
+	if err := tuner.loadAutoConf(confPath); err != nil {
+		t.Errorf("unexpected error without auto conf: %v", err)
+	}
+	if tuner.cfs.autoConf != nil {
+		t.Errorf("unexpected auto conf state")
+	}
+
+	writeTestConfFile(t, filepath.Join(dataDir, autoConfFileName), "shared_buffers = '1GB'")
+	if err := tuner.loadAutoConf(confPath); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if tuner.cfs.autoConf == nil {
+		t.Fatalf("auto conf state not loaded")
+	}
+	if got := tuner.cfs.tuneParseResults[pgtune.SharedBuffersKey].value; got != "'1GB'" {
+		t.Errorf("incorrect effective value: got %s", got)
+	}
+
+	if err := os.Chmod(filepath.Join(dataDir, autoConfFileName), 0); err == nil && os.Getuid() != 0 {
+		if err := tuner.loadAutoConf(confPath); err == nil {
+			t.Errorf("unexpected lack of error for unreadable auto conf")
+		}
+	}
+}
+
+func TestAutoConfBackupAndOutPath(t *testing.T) {
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "postgresql.conf")
+	outPath := filepath.Join(dir, "out.conf")
+	tuner := newTunerWithDefaultFlagsForInputs(t, "", []string{"shared_buffers = 128MB"})
+	auto := newTestAutoConf(t, "shared_buffers = '1MB'")
+	tuner.cfs.mergeAutoConf(auto)
+
+	incs := backupIncludes(tuner.cfs)
+	if len(incs) != 1 || incs[0].path != auto.path || incs[0].wt != auto {
+		t.Errorf("auto conf not backed up: got %v", incs)
+	}
+
+	tuner.flags.DestPath = outPath
+	r := tuner.cfs.tuneParseResults[pgtune.SharedBuffersKey]
+	tuner.cfs.setLine(r.file, r.idx, "shared_buffers = '2GB'")
+	err := tuner.writeConfFile(confPath)
+	want := fmt.Sprintf(errOutPathIncludeFmt, outPath, auto.path)
+	if err == nil || err.Error() != want {
+		t.Errorf("incorrect error: got %v want %s", err, want)
+	}
+	if fileExists(outPath) {
+		t.Errorf("out path unexpectedly written")
+	}
+}
@@ -1,90 +1,351 @@
 package tstune
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
-	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
 )
 
+// BackupDirName is the name of the directory in the data directory where
+// backups are kept by default.
+const BackupDirName = "timescaledb_tune_backups"
+
 const (
 	backupFilePrefix = "timescaledb_tune.backup"
-	backupDateFmt    = "200601021504"
+	backupDateFmt    = "20060102150405"
+	backupMetaSuffix = ".json"
+	backupIncSuffix  = ".include-" // followed by a number, for included files backed up along with the conf file
+	backupHashLen    = 8           // hex digits of the conf path hash kept in backup names
 
 	errBackupNotCreatedFmt = "could not create backup at %s: %v"
+	errBackupMaxAgeFmt     = "invalid backup max age %q: %v"
+	errBackupNotFileFmt    = "not a regular file: %s"
+
+	statementBackupsPrunedFmt = "Removed %d old backup(s) from %s"
 )
 
 // allows us to substitute mock versions in tests
 var filepathGlobFn = filepath.Glob
+var timeNowFn = time.Now
 var osCreateFn = func(path string) (io.WriteCloser, error) {
-	return os.Create(path)
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := chownLike(path, filepath.Dir(path)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// backupMeta is the sidecar file written next to each backup describing where
+// it came from.
+type backupMeta struct {
+	SourcePath  string    `json:"source_path" yaml:"source_path"`
+	ToolVersion string    `json:"tool_version" yaml:"tool_version"`
+	Profile     string    `json:"profile" yaml:"profile"`
+	SHA256      string    `json:"sha256" yaml:"sha256"`
+	Created     time.Time `json:"created" yaml:"created"`
+
+	Includes []*backupInclude `json:"includes,omitempty" yaml:"includes,omitempty"`
+}
+
+// backupInclude describes an included file backed up along with the conf file,
+// into a file named after the conf file's backup.
+type backupInclude struct {
+	SourcePath string `json:"source_path" yaml:"source_path"`
+	Name       string `json:"name" yaml:"name"`
+	SHA256     string `json:"sha256" yaml:"sha256"`
+}
+
+// includedFile is an included file to back up, at path, with contents wt.
+type includedFile struct {
+	path string
+	wt   io.WriterTo
+}
+
+// backupIncludes returns the included files of cfs that tuning may change,
+// including postgresql.auto.conf, to back up along with it.
+func backupIncludes(cfs *configFileState) []includedFile {
+	ret := []includedFile{}
+	for _, inc := range cfs.includes {
+		ret = append(ret, includedFile{inc.path, inc})
+	}
+	if cfs.autoConf != nil {
+		ret = append(ret, includedFile{cfs.autoConf.path, cfs.autoConf})
+	}
+	return ret
+}
+
+// confPathHash returns a short hash of the absolute path of the conf file, so
+// that backups of different clusters sharing a backup directory can be told
+// apart.
+func confPathHash(confPath string) string {
+	sum := sha256.Sum256([]byte(absPath(confPath)))
+	return hex.EncodeToString(sum[:])[:backupHashLen]
+}
+
+// backupName returns the file name of a backup of the conf file with the
+// given path hash made at time when.
+func backupName(hash string, when time.Time) string {
+	return backupFilePrefix + "-" + hash + "-" + when.Format(backupDateFmt)
+}
+
+// parseBackupName returns the conf path hash and time of the backup with the
+// given file name, or false if it is not a backup name.
+func parseBackupName(name string, loc *time.Location) (string, time.Time, bool) {
+	hash, when, _, ok := splitBackupName(name, loc)
+	return hash, when, ok
+}
+
+// splitBackupName returns the conf path hash, time, and sequence number of
+// the backup with the given file name, or false if it is not a backup name.
+// Backups made in the same second as an earlier one have a sequence number
+// after the time, so that they sort after it.
+func splitBackupName(name string, loc *time.Location) (string, time.Time, int, bool) {
+	parts := strings.Split(strings.TrimPrefix(name, backupFilePrefix+"-"), "-")
+	if !strings.HasPrefix(name, backupFilePrefix+"-") || len(parts) < 2 || len(parts) > 3 || len(parts[0]) != backupHashLen {
+		return "", time.Time{}, 0, false
+	}
+	when, err := time.ParseInLocation(backupDateFmt, parts[1], loc)
+	if err != nil {
+		return "", time.Time{}, 0, false
+	}
+	seq := 0
+	if len(parts) == 3 {
+		if seq, err = strconv.Atoi(parts[2]); err != nil || seq < 1 {
+			return "", time.Time{}, 0, false
+		}
+	}
+	return parts[0], when, seq, true
+}
+
+// getBackupDir returns the directory backups of the conf file at confPath are
+// kept in: dir if given, otherwise a directory in the data directory, falling
+// back to the system's temporary directory if the data directory is unknown.
+// The directory and the backups in it are owned by whoever owns the directory
+// it is made in, so that a backup directory in the data directory belongs to
+// the database's user even when tuning as root.
+func getBackupDir(dir string, cfs *configFileState, confPath string) string {
+	if dir != "" {
+		return dir
+	}
+	if dataDir := getDataDirectory(cfs, confPath); dataDir != "" {
+		return filepath.Join(dataDir, BackupDirName)
+	}
+	return filepath.Join(os.TempDir(), BackupDirName)
+}
+
+// parseBackupMaxAge parses the --backup-max-age flag, which uses the same
+// format as PostgreSQL time settings with days as the default unit, e.g.,
+// "30" or "12h". A blank value means backups never get too old.
+func parseBackupMaxAge(val string) (time.Duration, error) {
+	if val == "" {
+		return 0, nil
+	}
+	v, units, err := parse.PGFormatToTime(val, parse.Days, parse.VarTypeReal)
+	if err != nil {
+		return 0, fmt.Errorf(errBackupMaxAgeFmt, val, err)
+	}
+	return time.Duration(v * float64(parse.UnitsToDuration(units))), nil
+}
+
+// writeBackupFile writes the contents given by wt to a new file at path,
+// returning their checksum.
+func writeBackupFile(wt io.WriterTo, path string) (string, error) {
+	f, err := osCreateFn(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = wt.WriteTo(io.MultiWriter(f, h)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
-// backup writes the conf file state to the system's temporary directory
-// with a well known name format so it can potentially be restored.
-func backup(cfs *configFileState) (string, error) {
-	backupName := backupFilePrefix + time.Now().Format(backupDateFmt)
-	backupPath := path.Join(os.TempDir(), backupName)
-	bf, err := osCreateFn(backupPath)
+// absPath returns the absolute form of path, or path itself if there is none.
+func absPath(path string) string {
+	if abs, err := filepathAbsFn(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// backup writes the contents of the conf file at confPath, as given by wt,
+// into dir with a name made from the conf file's path and the current time so
+// it can potentially be restored, along with those of the included files in
+// includes. A sidecar file records where the backup came from and the
+// checksums.
+func backup(wt io.WriterTo, dir, confPath, profile string, includes ...includedFile) (string, error) {
+	backupPath := filepath.Join(dir, backupName(confPathHash(confPath), timeNowFn()))
+	if err := makeBackupDir(dir); err != nil {
+		return backupPath, fmt.Errorf(errBackupNotCreatedFmt, backupPath, err)
+	}
+	// never overwrite a backup made earlier in the same second
+	for seq, base := 1, backupPath; fileExists(backupPath); seq++ {
+		backupPath = fmt.Sprintf("%s-%d", base, seq)
+	}
+
+	sum, err := writeBackupFile(wt, backupPath)
 	if err != nil {
 		return backupPath, fmt.Errorf(errBackupNotCreatedFmt, backupPath, err)
 	}
-	_, err = cfs.WriteTo(bf)
-	return backupPath, err
+
+	meta := &backupMeta{
+		SourcePath:  absPath(confPath),
+		ToolVersion: Version,
+		Profile:     profile,
+		SHA256:      sum,
+		Created:     time.Now(),
+	}
+	for i, inc := range includes {
+		incPath := fmt.Sprintf("%s%s%d", backupPath, backupIncSuffix, i+1)
+		incSum, err := writeBackupFile(inc.wt, incPath)
+		if err != nil {
+			return backupPath, fmt.Errorf(errBackupNotCreatedFmt, incPath, err)
+		}
+		meta.Includes = append(meta.Includes, &backupInclude{absPath(inc.path), filepath.Base(incPath), incSum})
+	}
+	mf, err := osCreateFn(backupPath + backupMetaSuffix)
+	if err != nil {
+		return backupPath, fmt.Errorf(errBackupNotCreatedFmt, backupPath, err)
+	}
+	defer mf.Close()
+	enc := json.NewEncoder(mf)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(meta); err != nil {
+		return backupPath, fmt.Errorf(errBackupNotCreatedFmt, backupPath, err)
+	}
+	return backupPath, nil
+}
+
+// makeBackupDir creates the backup directory dir, if it does not exist yet,
+// owned by the owner of the directory it is in.
+func makeBackupDir(dir string) error {
+	if fileExists(dir) {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return chownLike(dir, filepath.Dir(dir))
 }
 
-// getBackups returns a list of files that match timescaledb-tune's backup
-// filename format.
-func getBackups() ([]string, error) {
-	backupPattern := path.Join(os.TempDir(), backupFilePrefix+"*")
+// getBackups returns a list of files in dir that match timescaledb-tune's
+// backup filename format for the conf file at confPath, oldest first.
+func getBackups(dir, confPath string) ([]string, error) {
+	hash := confPathHash(confPath)
+	backupPattern := filepath.Join(dir, backupFilePrefix+"-"+hash+"-*")
 	files, err := filepathGlobFn(backupPattern)
 	if err != nil {
 		return nil, err
 	}
-	ret := []string{}
-	stripPrefix := path.Join(os.TempDir(), backupFilePrefix)
+	type backupFile struct {
+		path string
+		when time.Time
+		seq  int
+	}
+	backups := []backupFile{}
 	for _, f := range files {
-		datePart := strings.Replace(f, stripPrefix, "", -1)
-		_, err := time.Parse(backupDateFmt, datePart)
-		if err != nil {
+		h, when, seq, ok := splitBackupName(filepath.Base(f), time.Local)
+		if !ok || h != hash {
 			continue
 		}
-		ret = append(ret, f)
+		backups = append(backups, backupFile{f, when, seq})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].when.Equal(backups[j].when) {
+			return backups[i].when.Before(backups[j].when)
+		}
+		return backups[i].seq < backups[j].seq
+	})
+	ret := []string{}
+	for _, b := range backups {
+		ret = append(ret, b.path)
 	}
 	return ret, nil
 }
 
+// pruneBackups removes the backups of the conf file at confPath from dir that
+// are beyond the newest keep, or older than maxAge, along with their sidecar
+// files. A keep or maxAge of 0 means no limit. The newest backup is never
+// removed, and neither is anything that is not a regular file. It returns the
+// paths of the removed backups.
+func pruneBackups(dir, confPath string, keep uint, maxAge time.Duration, now time.Time) ([]string, error) {
+	if keep == 0 && maxAge == 0 {
+		return nil, nil
+	}
+	files, err := getBackups(dir, confPath)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	// go from newest to oldest, always keeping the newest
+	for age := 1; age < len(files); age++ {
+		f := files[len(files)-1-age]
+		_, when, _ := parseBackupName(filepath.Base(f), now.Location())
+		tooMany := keep > 0 && uint(age) >= keep
+		tooOld := maxAge > 0 && now.Sub(when) > maxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+
+		fi, err := os.Lstat(f)
+		if err != nil {
+			return removed, err
+		}
+		if !fi.Mode().IsRegular() {
+			return removed, fmt.Errorf(errBackupNotFileFmt, f)
+		}
+		if err := os.Remove(f); err != nil {
+			return removed, err
+		}
+		// the sidecar file lists the included files backed up along with it
+		extras := []string{}
+		if meta, err := readBackupMeta(f); err == nil && meta != nil {
+			for _, inc := range meta.Includes {
+				extras = append(extras, filepath.Join(dir, filepath.Base(inc.Name)))
+			}
+		}
+		for _, extra := range append(extras, f+backupMetaSuffix) {
+			if fi, err := os.Lstat(extra); err == nil && fi.Mode().IsRegular() {
+				if err := os.Remove(extra); err != nil {
+					return removed, err
+				}
+			}
+		}
+		removed = append(removed, f)
+	}
+	return removed, nil
+}
+
 type restorer interface {
 	Restore(string, string) error
 }
 
 type fsRestorer struct{}
 
+// Restore writes the backup at backupPath over confPath as it is, without
+// parsing it, since any include directives in it are relative to confPath.
 func (r *fsRestorer) Restore(backupPath, confPath string) error {
-	backupFile, err := os.Open(backupPath)
+	contents, err := os.ReadFile(backupPath)
 	if err != nil {
 		return err
 	}
-	defer backupFile.Close()
-
-	backupCFS, err := getConfigFileState(backupFile)
-	if err != nil {
-		return err
-	}
-
-	confFile, err := os.OpenFile(confPath, os.O_WRONLY, 0644)
-	if err != nil {
-		return err
-	}
-	defer confFile.Close()
-
-	_, err = backupCFS.WriteTo(confFile)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return writeFileAtomicFn(confPath, nil, bytes.NewReader(contents))
 }
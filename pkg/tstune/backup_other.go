@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd)
+
+package tstune
+
+// chownLike is not supported on this OS, so files keep the owner they are
+// made with.
+func chownLike(path, ref string) error {
+	return nil
+}
@@ -1,15 +1,20 @@
 package tstune
 
 import (
-	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
-	"path"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
 )
 
 type testBufferCloser struct {
@@ -26,69 +31,308 @@ func (b *testBufferCloser) Write(p []byte) (int, error) {
 
 func (b *testBufferCloser) Close() error { return nil }
 
+func TestConfPathHash(t *testing.T) {
+	a := confPathHash("/etc/postgresql/16/main/postgresql.conf")
+	if len(a) != backupHashLen {
+		t.Errorf("incorrect hash length: got %d want %d", len(a), backupHashLen)
+	}
+	if b := confPathHash("/etc/postgresql/16/main/postgresql.conf"); a != b {
+		t.Errorf("hash not stable: got %s and %s", a, b)
+	}
+	if b := confPathHash("/etc/postgresql/16/other/postgresql.conf"); a == b {
+		t.Errorf("same hash for different paths: %s", a)
+	}
+}
+
+func TestParseBackupName(t *testing.T) {
+	when := time.Date(2019, 1, 18, 11, 22, 33, 0, time.UTC)
+	cases := []struct {
+		name     string
+		wantHash string
+		wantOK   bool
+	}{
+		{name: backupName("0123abcd", when), wantHash: "0123abcd", wantOK: true},
+		{name: backupName("0123abcd", when) + "-2", wantHash: "0123abcd", wantOK: true},
+		{name: backupName("0123abcd", when) + backupMetaSuffix},
+		{name: backupName("0123abcd", when) + "-0"},
+		{name: backupName("0123abcd", when) + "-x"},
+		{name: backupName("0123abcd", when) + "-1-1"},
+		{name: backupName("0123abc", when)},
+		{name: backupFilePrefix + "201901181122"},
+		{name: backupFilePrefix + "-0123abcd-2019011811"},
+		{name: "foo-0123abcd-20190118112233"},
+	}
+	for _, c := range cases {
+		hash, got, ok := parseBackupName(c.name, time.UTC)
+		if ok != c.wantOK {
+			t.Errorf("%s: incorrect ok: got %v want %v", c.name, ok, c.wantOK)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if hash != c.wantHash {
+			t.Errorf("%s: incorrect hash: got %s want %s", c.name, hash, c.wantHash)
+		}
+		if !got.Equal(when) {
+			t.Errorf("%s: incorrect time: got %v want %v", c.name, got, when)
+		}
+	}
+}
+
+func TestGetBackupDir(t *testing.T) {
+	dataDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dataDir, pgVersionFileName), []byte("16\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	confPath := filepath.Join(dataDir, "postgresql.conf")
+	otherConfPath := filepath.Join(t.TempDir(), "postgresql.conf")
+	t.Setenv("PGDATA", "")
+
+	cases := []struct {
+		desc     string
+		dir      string
+		cfs      *configFileState
+		confPath string
+		want     string
+	}{
+		{
+			desc:     "given",
+			dir:      "/backups",
+			confPath: confPath,
+			want:     "/backups",
+		},
+		{
+			desc:     "data directory",
+			confPath: confPath,
+			want:     filepath.Join(dataDir, BackupDirName),
+		},
+		{
+			desc:     "data_directory setting",
+			cfs:      &configFileState{dataDirectory: "/var/lib/postgresql/16/main"},
+			confPath: otherConfPath,
+			want:     filepath.Join("/var/lib/postgresql/16/main", BackupDirName),
+		},
+		{
+			desc:     "unknown data directory",
+			confPath: otherConfPath,
+			want:     filepath.Join(os.TempDir(), BackupDirName),
+		},
+	}
+	for _, c := range cases {
+		if got := getBackupDir(c.dir, c.cfs, c.confPath); got != c.want {
+			t.Errorf("%s: incorrect dir: got %s want %s", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestParseBackupMaxAge(t *testing.T) {
+	cases := []struct {
+		val    string
+		want   time.Duration
+		errMsg string
+	}{
+		{val: "", want: 0},
+		{val: "30", want: 30 * 24 * time.Hour},
+		{val: "7d", want: 7 * 24 * time.Hour},
+		{val: "12h", want: 12 * time.Hour},
+		{val: "1.5d", want: 36 * time.Hour},
+		{val: "90min", want: 90 * time.Minute},
+		{val: "-1", errMsg: fmt.Sprintf(errBackupMaxAgeFmt, "-1", "incorrect PostgreSQL time format: '-1'")},
+		{val: "foo", errMsg: fmt.Sprintf(errBackupMaxAgeFmt, "foo", "incorrect PostgreSQL time format: 'foo'")},
+	}
+	for _, c := range cases {
+		got, err := parseBackupMaxAge(c.val)
+		if c.errMsg == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.val, err)
+		} else if c.errMsg != "" {
+			if err == nil {
+				t.Errorf("%s: unexpected lack of error", c.val)
+			} else if err.Error() != c.errMsg {
+				t.Errorf("%s: incorrect error: got %s want %s", c.val, err.Error(), c.errMsg)
+			}
+		} else if got != c.want {
+			t.Errorf("%s: incorrect duration: got %v want %v", c.val, got, c.want)
+		}
+	}
+}
+
 func TestBackup(t *testing.T) {
 	oldOSCreateFn := osCreateFn
-	now := time.Now()
+	defer func() { osCreateFn = oldOSCreateFn }()
+	dir := filepath.Join(t.TempDir(), BackupDirName)
+	confPath := "/etc/postgresql/16/main/postgresql.conf"
 	lines := []string{"foo", "bar", "baz", "quaz"}
-	r := stringSliceToBytesReader(lines)
-	cfs, err := getConfigFileState(r)
+	cfs, err := getConfigFileState(stringSliceToBytesReader(lines))
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
-	wantFileName := backupFilePrefix + now.Format(backupDateFmt)
-	wantPath := path.Join(os.TempDir(), wantFileName)
 
 	osCreateFn = func(_ string) (io.WriteCloser, error) {
 		return nil, fmt.Errorf("erroring")
 	}
-
-	path, err := backup(cfs)
-	if path != wantPath {
-		t.Errorf("incorrect path in error case: got\n%s\nwant\n%s", path, wantPath)
-	}
+	backupPath, err := backup(cfs, dir, confPath, "")
 	if err == nil {
-		t.Errorf("unexpected lack of error for bad create")
+		t.Fatalf("unexpected lack of error for bad create")
 	}
-	want := fmt.Sprintf(errBackupNotCreatedFmt, wantPath, "erroring")
+	want := fmt.Sprintf(errBackupNotCreatedFmt, backupPath, "erroring")
 	if got := err.Error(); got != want {
 		t.Errorf("incorrect error: got\n%s\nwant\n%s", got, want)
 	}
 
-	var buf testBufferCloser
-	osCreateFn = func(p string) (io.WriteCloser, error) {
-		if p != wantPath {
-			t.Errorf("incorrect backup path: got %s want %s", p, wantPath)
-		}
-		return &buf, nil
+	osCreateFn = oldOSCreateFn
+	backupPath, err = backup(cfs, dir, confPath, pgtune.OLTPProfile.String())
+	if err != nil {
+		t.Fatalf("unexpected error for backup: %v", err)
+	}
+	if got := filepath.Dir(backupPath); got != dir {
+		t.Errorf("incorrect backup dir: got %s want %s", got, dir)
 	}
-	path, err = backup(cfs)
-	if path != wantPath {
-		t.Errorf("incorrect path in correct case: got\n%s\nwant\n%s", path, wantPath)
+	hash, _, ok := parseBackupName(filepath.Base(backupPath), time.Local)
+	if !ok || hash != confPathHash(confPath) {
+		t.Errorf("incorrect backup name: got %s", filepath.Base(backupPath))
 	}
+	contents, err := os.ReadFile(backupPath)
 	if err != nil {
-		t.Errorf("unexpected error for backup: %v", err)
+		t.Fatalf("could not read backup: %v", err)
+	}
+	wantContents := strings.Join(lines, "\n") + "\n"
+	if string(contents) != wantContents {
+		t.Errorf("incorrect backup contents: got\n%s\nwant\n%s", contents, wantContents)
+	}
+
+	metaContents, err := os.ReadFile(backupPath + backupMetaSuffix)
+	if err != nil {
+		t.Fatalf("could not read backup metadata: %v", err)
+	}
+	meta := &backupMeta{}
+	if err := json.Unmarshal(metaContents, meta); err != nil {
+		t.Fatalf("could not parse backup metadata: %v", err)
+	}
+	sum := sha256.Sum256([]byte(wantContents))
+	if got := meta.SHA256; got != hex.EncodeToString(sum[:]) {
+		t.Errorf("incorrect checksum: got %s", got)
+	}
+	if got := meta.SourcePath; got != confPath {
+		t.Errorf("incorrect source path: got %s want %s", got, confPath)
+	}
+	if got := meta.ToolVersion; got != Version {
+		t.Errorf("incorrect tool version: got %s want %s", got, Version)
+	}
+	if got := meta.Profile; got != pgtune.OLTPProfile.String() {
+		t.Errorf("incorrect profile: got %s want %s", got, pgtune.OLTPProfile.String())
 	}
 
-	scanner := bufio.NewScanner(bytes.NewReader(buf.b.Bytes()))
-	i := 0
-	for scanner.Scan() {
-		if scanner.Err() != nil {
-			t.Errorf("unexpected error while scanning: %v", scanner.Err())
+	// backups in the same second must not overwrite the first, but are made
+	// next to it
+	oldTimeNowFn := timeNowFn
+	defer func() { timeNowFn = oldTimeNowFn }()
+	now := time.Now().Add(time.Hour)
+	timeNowFn = func() time.Time { return now }
+	backupPath, err = backup(cfs, dir, confPath, "")
+	if err != nil {
+		t.Fatalf("unexpected error for backup: %v", err)
+	}
+	for _, want := range []string{backupPath + "-1", backupPath + "-2"} {
+		path, err := backup(cfs, dir, confPath, "")
+		if err != nil {
+			t.Fatalf("unexpected error for backup in the same second: %v", err)
+		}
+		if path != want {
+			t.Errorf("incorrect path for backup in the same second: got %s want %s", path, want)
 		}
-		got := scanner.Text()
-		if want := lines[i]; got != want {
-			t.Errorf("incorrect line at %d: got\n%s\nwant\n%s", i, got, want)
+		if !fileExists(path + backupMetaSuffix) {
+			t.Errorf("missing metadata for backup in the same second: %s", path)
 		}
-		i++
 	}
+	if files, err := getBackups(dir, confPath); err != nil || len(files) != 4 || files[3] != backupPath+"-2" {
+		t.Errorf("incorrect backups after several in the same second: got %v (%v)", files, err)
+	}
+}
 
-	osCreateFn = oldOSCreateFn
+func TestMakeBackupDir(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, BackupDirName)
+	if err := makeBackupDir(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("backup dir not made: %v", err)
+	}
+	if got := fi.Mode().Perm(); got != 0700 {
+		t.Errorf("incorrect permissions: got %o want %o", got, 0700)
+	}
+	// already made is fine
+	if err := makeBackupDir(dir); err != nil {
+		t.Errorf("unexpected error for existing dir: %v", err)
+	}
+}
+
+func TestBackupIncludes(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, BackupDirName)
+	confPath := filepath.Join(dir, "postgresql.conf")
+	incPath := filepath.Join(dir, "conf.d", "10-mem.conf")
+	writeTestConfFile(t, incPath, "work_mem = 16MB")
+	lines := []string{"include_dir 'conf.d'", "shared_buffers = 128MB"}
+	cfs, err := getConfigFileStateWithIncludes(stringSliceToBytesReader(lines), confPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	backupPath, err := backup(cfs, backupDir, confPath, "", backupIncludes(cfs)...)
+	if err != nil {
+		t.Fatalf("unexpected error for backup: %v", err)
+	}
+	meta, err := readBackupMeta(backupPath)
+	if err != nil {
+		t.Fatalf("could not read backup metadata: %v", err)
+	}
+	if len(meta.Includes) != 1 {
+		t.Fatalf("incorrect number of included files: got %d want 1", len(meta.Includes))
+	}
+	inc := meta.Includes[0]
+	if inc.SourcePath != incPath {
+		t.Errorf("incorrect included source path: got %s want %s", inc.SourcePath, incPath)
+	}
+	incBackup := filepath.Join(backupDir, inc.Name)
+	if incBackup != backupPath+backupIncSuffix+"1" {
+		t.Errorf("incorrect included backup name: got %s", inc.Name)
+	}
+	checkFileContents(t, "included backup", incBackup, "work_mem = 16MB\n")
+	sum := sha256.Sum256([]byte("work_mem = 16MB\n"))
+	if got := inc.SHA256; got != hex.EncodeToString(sum[:]) {
+		t.Errorf("incorrect included checksum: got %s", got)
+	}
+
+	// included backups are not listed as backups of their own, and go along
+	// with the backup they belong to when it is pruned
+	files, err := getBackups(backupDir, confPath)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("incorrect backups: got %v (%v)", files, err)
+	}
+	if _, err := backup(cfs, backupDir, confPath, ""); err != nil {
+		t.Fatalf("unexpected error for second backup: %v", err)
+	}
+	removed, err := pruneBackups(backupDir, confPath, 1, 0, time.Now())
+	if err != nil || len(removed) != 1 {
+		t.Fatalf("incorrect prune: got %v (%v)", removed, err)
+	}
+	if fileExists(incBackup) {
+		t.Errorf("included backup not pruned: %s", incBackup)
+	}
 }
 
 func TestGetBackups(t *testing.T) {
 	errGlob := "glob error"
-	correctFile1 := path.Join(os.TempDir(), "timescaledb_tune.backup201901181122")
-	correctFile2 := path.Join(os.TempDir(), "timescaledb_tune.backup201901191200")
+	confPath := "/etc/postgresql/16/main/postgresql.conf"
+	hash := confPathHash(confPath)
+	when1 := time.Date(2019, 1, 18, 11, 22, 0, 0, time.Local)
+	when2 := time.Date(2019, 1, 19, 12, 0, 0, 0, time.Local)
+	correctFile1 := filepath.Join(os.TempDir(), backupName(hash, when1))
+	correctFile2 := filepath.Join(os.TempDir(), backupName(hash, when2))
+	otherCluster := filepath.Join(os.TempDir(), backupName(confPathHash("/other/postgresql.conf"), when1))
 	cases := []struct {
 		desc        string
 		onDiskFiles []string
@@ -109,7 +353,7 @@ func TestGetBackups(t *testing.T) {
 		},
 		{
 			desc:        "invalid file",
-			onDiskFiles: []string{"foo"},
+			onDiskFiles: []string{"foo", correctFile1 + backupMetaSuffix},
 			want:        []string{},
 		},
 		{
@@ -122,9 +366,19 @@ func TestGetBackups(t *testing.T) {
 			onDiskFiles: []string{correctFile1, correctFile2},
 			want:        []string{correctFile1, correctFile2},
 		},
+		{
+			desc:        "two correct files out of order",
+			onDiskFiles: []string{correctFile2, correctFile1},
+			want:        []string{correctFile1, correctFile2},
+		},
+		{
+			desc:        "several in the same second",
+			onDiskFiles: []string{correctFile1 + "-10", correctFile2, correctFile1 + "-2", correctFile1},
+			want:        []string{correctFile1, correctFile1 + "-2", correctFile1 + "-10", correctFile2},
+		},
 		{
 			desc:        "two correct files with wrong files",
-			onDiskFiles: []string{"foo", correctFile1, "bar", correctFile2, "baz"},
+			onDiskFiles: []string{"foo", correctFile1, "bar", otherCluster, correctFile2, "baz"},
 			want:        []string{correctFile1, correctFile2},
 		},
 	}
@@ -137,7 +391,7 @@ func TestGetBackups(t *testing.T) {
 			return c.onDiskFiles, nil
 		}
 
-		files, err := getBackups()
+		files, err := getBackups(os.TempDir(), confPath)
 		if c.errMsg == "" && err != nil {
 			t.Errorf("%s: unexpected error: got %v", c.desc, err)
 		} else if c.errMsg != "" {
@@ -161,6 +415,118 @@ func TestGetBackups(t *testing.T) {
 	filepathGlobFn = oldFilepathGlobFn
 }
 
+func TestPruneBackups(t *testing.T) {
+	confPath := "/etc/postgresql/16/main/postgresql.conf"
+	hash := confPathHash(confPath)
+	now := time.Date(2019, 1, 20, 12, 0, 0, 0, time.Local)
+	// newest last
+	ages := []time.Duration{72 * time.Hour, 48 * time.Hour, 24 * time.Hour, time.Hour}
+
+	cases := []struct {
+		desc        string
+		keep        uint
+		maxAge      time.Duration
+		wantRemoved []int // indexes into ages
+	}{
+		{
+			desc:        "no limits",
+			wantRemoved: []int{},
+		},
+		{
+			desc:        "keep 2",
+			keep:        2,
+			wantRemoved: []int{1, 0},
+		},
+		{
+			desc:        "keep more than there are",
+			keep:        10,
+			wantRemoved: []int{},
+		},
+		{
+			desc:        "max age",
+			maxAge:      36 * time.Hour,
+			wantRemoved: []int{1, 0},
+		},
+		{
+			desc:        "max age never removes newest",
+			maxAge:      time.Minute,
+			wantRemoved: []int{2, 1, 0},
+		},
+		{
+			desc:        "keep and max age",
+			keep:        3,
+			maxAge:      60 * time.Hour,
+			wantRemoved: []int{0},
+		},
+	}
+
+	for _, c := range cases {
+		dir := t.TempDir()
+		files := []string{}
+		for _, age := range ages {
+			f := filepath.Join(dir, backupName(hash, now.Add(-age)))
+			for _, p := range []string{f, f + backupMetaSuffix} {
+				if err := os.WriteFile(p, []byte("foo\n"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			files = append(files, f)
+		}
+		other := filepath.Join(dir, backupName(confPathHash("/other/postgresql.conf"), now.Add(-ages[0])))
+		if err := os.WriteFile(other, []byte("foo\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		removed, err := pruneBackups(dir, confPath, c.keep, c.maxAge, now)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+		if len(removed) != len(c.wantRemoved) {
+			t.Errorf("%s: incorrect number removed: got %d want %d", c.desc, len(removed), len(c.wantRemoved))
+			continue
+		}
+		gone := map[string]bool{}
+		for i, idx := range c.wantRemoved {
+			if removed[i] != files[idx] {
+				t.Errorf("%s: incorrect removed file at %d: got %s want %s", c.desc, i, removed[i], files[idx])
+			}
+			gone[files[idx]] = true
+		}
+		for _, f := range files {
+			for _, p := range []string{f, f + backupMetaSuffix} {
+				if got := fileExists(p); got == gone[f] {
+					t.Errorf("%s: incorrect existence of %s: got %v want %v", c.desc, p, got, !gone[f])
+				}
+			}
+		}
+		if !fileExists(other) {
+			t.Errorf("%s: backup of other cluster removed", c.desc)
+		}
+	}
+
+	// anything that is not a regular file is left alone
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	if err := os.WriteFile(target, []byte("foo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, backupName(hash, now.Add(-ages[0])))
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, backupName(hash, now)), []byte("foo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := pruneBackups(dir, confPath, 1, 0, now)
+	if want := fmt.Sprintf(errBackupNotFileFmt, link); err == nil || err.Error() != want {
+		t.Errorf("incorrect error for symlink: got %v want %s", err, want)
+	}
+	if !fileExists(target) || !fileExists(link) {
+		t.Errorf("symlink or its target removed")
+	}
+}
+
 func TestFSRestorer(t *testing.T) {
 	fileContents := []byte("oneline\ntwoline\nthreeline\n")
 	tmpfile, err := ioutil.TempFile("", "timescaledb-tune-test")
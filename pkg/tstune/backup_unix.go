@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd
+
+package tstune
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// chownLike gives path the owner and group of ref. Only root can give files
+// away, and only root makes files that others should own, so nothing is done
+// for anyone else.
+func chownLike(path, ref string) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(ref, &st); err != nil {
+		return err
+	}
+	return os.Lchown(path, int(st.Uid), int(st.Gid))
+}
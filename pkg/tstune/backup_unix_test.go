@@ -0,0 +1,41 @@
+//go:build linux || darwin || freebsd
+
+package tstune
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestBackupOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("only root can give files away")
+	}
+	const uid, gid = 1234, 5678
+	dataDir := t.TempDir()
+	if err := os.Chown(dataDir, uid, gid); err != nil {
+		t.Fatalf("could not chown data dir: %v", err)
+	}
+	cfs, err := getConfigFileState(stringSliceToBytesReader([]string{"foo"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dir := filepath.Join(dataDir, BackupDirName)
+	backupPath, err := backup(cfs, dir, filepath.Join(dataDir, "postgresql.conf"), "")
+	if err != nil {
+		t.Fatalf("unexpected error for backup: %v", err)
+	}
+
+	for _, path := range []string{dir, backupPath, backupPath + backupMetaSuffix} {
+		var st unix.Stat_t
+		if err := unix.Stat(path, &st); err != nil {
+			t.Fatalf("could not stat %s: %v", path, err)
+		}
+		if st.Uid != uid || st.Gid != gid {
+			t.Errorf("incorrect owner of %s: got %d:%d want %d:%d", path, st.Uid, st.Gid, uid, gid)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package tstune
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultCgroupRoot is where the cgroup filesystem is usually mounted
+	DefaultCgroupRoot = "/sys/fs/cgroup"
+
+	cgroupV2Controllers = "cgroup.controllers"
+	cgroupV2MemoryMax   = "memory.max"
+	cgroupV2CPUMax      = "cpu.max"
+	cgroupV2Unlimited   = "max"
+
+	cgroupV1MemoryDir   = "memory"
+	cgroupV1MemoryLimit = "memory.limit_in_bytes"
+	cgroupV1CPUQuota    = "cpu.cfs_quota_us"
+	cgroupV1CPUPeriod   = "cpu.cfs_period_us"
+
+	errCgroupParseFmt     = "could not parse cgroup file %s: %v"
+	errUnknownCPURounding = "unknown CPU rounding policy: %s (valid values: %s)"
+
+	cpuRoundingUp      = "up"
+	cpuRoundingDown    = "down"
+	cpuRoundingNearest = "nearest"
+)
+
+// cgroup v1 mounts the cpu controller under different names depending on the
+// distribution, so all of these are tried in order
+var cgroupV1CPUDirs = []string{"cpu", "cpu,cpuacct", "cpuacct,cpu"}
+
+// ValidCPURoundings are the policies for turning a fractional CPU limit into a
+// whole number of CPUs
+var ValidCPURoundings = []string{cpuRoundingUp, cpuRoundingDown, cpuRoundingNearest}
+
+// valueSource is where a value in the system config came from
+type valueSource int
+
+const (
+	sourceHost valueSource = iota
+	sourceFlag
+	sourceCgroup
+)
+
+func (s valueSource) String() string {
+	switch s {
+	case sourceFlag:
+		return "flag"
+	case sourceCgroup:
+		return "cgroup"
+	default:
+		return "host"
+	}
+}
+
+// cgroupLimits are the resource limits imposed on us by a cgroup. A value of 0
+// means there is no limit.
+type cgroupLimits struct {
+	version int
+	memory  uint64
+	cpus    float64
+}
+
+// detectCgroupLimits reads the memory and CPU limits of the cgroup mounted at
+// root, for either cgroup v1 or v2. Missing files are treated as no limit, since
+// not every controller needs to be enabled or mounted.
+func detectCgroupLimits(root string) (*cgroupLimits, error) {
+	if fileExists(filepath.Join(root, cgroupV2Controllers)) {
+		return detectCgroupV2Limits(root)
+	}
+	return detectCgroupV1Limits(root)
+}
+
+func detectCgroupV2Limits(root string) (*cgroupLimits, error) {
+	limits := &cgroupLimits{version: 2}
+
+	memPath := filepath.Join(root, cgroupV2MemoryMax)
+	content, ok, err := readSysFile(memPath)
+	if err != nil {
+		return nil, err
+	}
+	if ok && content != cgroupV2Unlimited {
+		limits.memory, err = strconv.ParseUint(content, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf(errCgroupParseFmt, memPath, err)
+		}
+	}
+
+	// cpu.max is of the form "$MAX $PERIOD", where $MAX may be "max"
+	cpuPath := filepath.Join(root, cgroupV2CPUMax)
+	content, ok, err = readSysFile(cpuPath)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		fields := strings.Fields(content)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf(errCgroupParseFmt, cpuPath, "expected quota and period")
+		}
+		if fields[0] != cgroupV2Unlimited {
+			limits.cpus, err = cpuQuotaToCPUs(fields[0], fields[1])
+			if err != nil {
+				return nil, fmt.Errorf(errCgroupParseFmt, cpuPath, err)
+			}
+		}
+	}
+
+	return limits, nil
+}
+
+func detectCgroupV1Limits(root string) (*cgroupLimits, error) {
+	limits := &cgroupLimits{version: 1}
+
+	// there is no "max" in v1, an unlimited cgroup instead has a very large
+	// value that is larger than any real amount of memory
+	memPath := filepath.Join(root, cgroupV1MemoryDir, cgroupV1MemoryLimit)
+	content, ok, err := readSysFile(memPath)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		limits.memory, err = strconv.ParseUint(content, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf(errCgroupParseFmt, memPath, err)
+		}
+	}
+
+	for _, dir := range cgroupV1CPUDirs {
+		quotaPath := filepath.Join(root, dir, cgroupV1CPUQuota)
+		quota, ok, err := readSysFile(quotaPath)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		periodPath := filepath.Join(root, dir, cgroupV1CPUPeriod)
+		period, ok, err := readSysFile(periodPath)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		// a quota of -1 means no limit
+		if quota != "-1" {
+			limits.cpus, err = cpuQuotaToCPUs(quota, period)
+			if err != nil {
+				return nil, fmt.Errorf(errCgroupParseFmt, quotaPath, err)
+			}
+		}
+		break
+	}
+
+	return limits, nil
+}
+
+// readSysFile returns the trimmed contents of the cgroup or sysfs file at path,
+// and whether the file exists.
+func readSysFile(path string) (string, bool, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return strings.TrimSpace(string(b)), true, nil
+}
+
+// cpuQuotaToCPUs converts a CFS quota and period, both in microseconds, into
+// the (possibly fractional) number of CPUs they allow.
+func cpuQuotaToCPUs(quota, period string) (float64, error) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil {
+		return 0, err
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil {
+		return 0, err
+	}
+	if q <= 0 || p <= 0 {
+		return 0, fmt.Errorf("quota and period must be positive")
+	}
+	return q / p, nil
+}
+
+// validateCPURounding returns an error if policy is not one of
+// ValidCPURoundings. A blank policy is the same as up.
+func validateCPURounding(policy string) error {
+	if policy == "" {
+		return nil
+	}
+	for _, p := range ValidCPURoundings {
+		if policy == p {
+			return nil
+		}
+	}
+	return fmt.Errorf(errUnknownCPURounding, policy, strings.Join(ValidCPURoundings, ", "))
+}
+
+// roundCPUs turns a fractional CPU limit into a whole number of CPUs according
+// to policy, which is one of ValidCPURoundings (blank is the same as up). The
+// result is never less than 1.
+func roundCPUs(cpus float64, policy string) (int, error) {
+	if err := validateCPURounding(policy); err != nil {
+		return 0, err
+	}
+	var rounded float64
+	switch policy {
+	case cpuRoundingDown:
+		rounded = math.Floor(cpus)
+	case cpuRoundingNearest:
+		rounded = math.Round(cpus)
+	default:
+		rounded = math.Ceil(cpus)
+	}
+	if rounded < 1 {
+		return 1, nil
+	}
+	return int(rounded), nil
+}
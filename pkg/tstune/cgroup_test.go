@@ -0,0 +1,278 @@
+package tstune
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/pbnjay/memory"
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+// writeCgroupFixture creates a fake cgroup filesystem in a temp dir, where
+// files maps a path relative to the root to its contents.
+func writeCgroupFixture(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("could not create fixture dir: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content+"\n"), 0644); err != nil {
+			t.Fatalf("could not write fixture file: %v", err)
+		}
+	}
+	return root
+}
+
+func TestDetectCgroupLimits(t *testing.T) {
+	cases := []struct {
+		desc    string
+		files   map[string]string
+		want    cgroupLimits
+		badFile string
+		errMsg  string
+	}{
+		{
+			desc: "v2 limited",
+			files: map[string]string{
+				cgroupV2Controllers: "cpu memory",
+				cgroupV2MemoryMax:   "8589934592",
+				cgroupV2CPUMax:      "150000 100000",
+			},
+			want: cgroupLimits{version: 2, memory: 8 * parse.Gigabyte, cpus: 1.5},
+		},
+		{
+			desc: "v2 unlimited",
+			files: map[string]string{
+				cgroupV2Controllers: "cpu memory",
+				cgroupV2MemoryMax:   "max",
+				cgroupV2CPUMax:      "max 100000",
+			},
+			want: cgroupLimits{version: 2},
+		},
+		{
+			desc: "v2 no controllers",
+			files: map[string]string{
+				cgroupV2Controllers: "",
+			},
+			want: cgroupLimits{version: 2},
+		},
+		{
+			desc: "v2 bad memory",
+			files: map[string]string{
+				cgroupV2Controllers: "memory",
+				cgroupV2MemoryMax:   "lots",
+			},
+			badFile: cgroupV2MemoryMax,
+			errMsg:  "could not parse cgroup file %s: strconv.ParseUint: parsing \"lots\": invalid syntax",
+		},
+		{
+			desc: "v2 bad cpu",
+			files: map[string]string{
+				cgroupV2Controllers: "cpu",
+				cgroupV2CPUMax:      "150000",
+			},
+			badFile: cgroupV2CPUMax,
+			errMsg:  "could not parse cgroup file %s: expected quota and period",
+		},
+		{
+			desc: "v1 limited",
+			files: map[string]string{
+				"memory/" + cgroupV1MemoryLimit: "4294967296",
+				"cpu/" + cgroupV1CPUQuota:       "200000",
+				"cpu/" + cgroupV1CPUPeriod:      "100000",
+			},
+			want: cgroupLimits{version: 1, memory: 4 * parse.Gigabyte, cpus: 2},
+		},
+		{
+			desc: "v1 combined cpu dir",
+			files: map[string]string{
+				"cpu,cpuacct/" + cgroupV1CPUQuota:  "50000",
+				"cpu,cpuacct/" + cgroupV1CPUPeriod: "100000",
+			},
+			want: cgroupLimits{version: 1, cpus: 0.5},
+		},
+		{
+			desc: "v1 unlimited",
+			files: map[string]string{
+				"memory/" + cgroupV1MemoryLimit: "9223372036854771712",
+				"cpu/" + cgroupV1CPUQuota:       "-1",
+				"cpu/" + cgroupV1CPUPeriod:      "100000",
+			},
+			want: cgroupLimits{version: 1, memory: 9223372036854771712},
+		},
+		{
+			desc: "v1 bad quota",
+			files: map[string]string{
+				"cpu/" + cgroupV1CPUQuota:  "0",
+				"cpu/" + cgroupV1CPUPeriod: "100000",
+			},
+			badFile: "cpu/" + cgroupV1CPUQuota,
+			errMsg:  "could not parse cgroup file %s: quota and period must be positive",
+		},
+		{
+			desc:  "nothing mounted",
+			files: map[string]string{},
+			want:  cgroupLimits{version: 1},
+		},
+	}
+
+	for _, c := range cases {
+		root := writeCgroupFixture(t, c.files)
+		got, err := detectCgroupLimits(root)
+		if c.errMsg == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", c.desc, err)
+			} else if *got != c.want {
+				t.Errorf("%s: incorrect limits: got %+v want %+v", c.desc, *got, c.want)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: unexpected lack of error", c.desc)
+			continue
+		}
+		if want := fmt.Sprintf(c.errMsg, filepath.Join(root, c.badFile)); err.Error() != want {
+			t.Errorf("%s: incorrect error: got\n%s\nwant\n%s", c.desc, err.Error(), want)
+		}
+	}
+}
+
+func TestRoundCPUs(t *testing.T) {
+	cases := []struct {
+		cpus   float64
+		policy string
+		want   int
+	}{
+		{cpus: 1.5, policy: "", want: 2},
+		{cpus: 1.5, policy: cpuRoundingUp, want: 2},
+		{cpus: 1.5, policy: cpuRoundingDown, want: 1},
+		{cpus: 1.5, policy: cpuRoundingNearest, want: 2},
+		{cpus: 1.4, policy: cpuRoundingNearest, want: 1},
+		{cpus: 0.5, policy: cpuRoundingDown, want: 1},
+		{cpus: 0.2, policy: cpuRoundingNearest, want: 1},
+		{cpus: 4, policy: cpuRoundingUp, want: 4},
+	}
+
+	for _, c := range cases {
+		got, err := roundCPUs(c.cpus, c.policy)
+		if err != nil {
+			t.Errorf("%v/%s: unexpected error: %v", c.cpus, c.policy, err)
+		} else if got != c.want {
+			t.Errorf("%v/%s: incorrect CPUs: got %d want %d", c.cpus, c.policy, got, c.want)
+		}
+	}
+
+	_, err := roundCPUs(1.5, "sideways")
+	want := fmt.Sprintf(errUnknownCPURounding, "sideways", strings.Join(ValidCPURoundings, ", "))
+	if err == nil || err.Error() != want {
+		t.Errorf("incorrect error: got %v want %s", err, want)
+	}
+}
+
+func TestTunerInitializeSystemConfigCgroup(t *testing.T) {
+	totalMemory := memory.TotalMemory()
+	hostCPUs := runtime.NumCPU()
+	// a limit of half a CPU rounds up to 1, which is only a limit if the host
+	// has more than that
+	limitedCPUSrc := sourceHost
+	if hostCPUs > 1 {
+		limitedCPUSrc = sourceCgroup
+	}
+	limited := writeCgroupFixture(t, map[string]string{
+		cgroupV2Controllers: "cpu memory",
+		cgroupV2MemoryMax:   fmt.Sprintf("%d", totalMemory/2),
+		cgroupV2CPUMax:      "50000 100000",
+	})
+	generous := writeCgroupFixture(t, map[string]string{
+		cgroupV2Controllers: "cpu memory",
+		cgroupV2MemoryMax:   fmt.Sprintf("%d", totalMemory*2),
+		cgroupV2CPUMax:      fmt.Sprintf("%d 100000", (hostCPUs+1)*100000),
+	})
+
+	cases := []struct {
+		desc       string
+		flags      TunerFlags
+		wantMemory uint64
+		wantMemSrc valueSource
+		wantCPUs   int
+		wantCPUSrc valueSource
+		wantCgroup uint64
+		errMsg     string
+	}{
+		{
+			desc:       "detection disabled",
+			flags:      TunerFlags{},
+			wantMemory: totalMemory,
+			wantMemSrc: sourceHost,
+			wantCPUs:   hostCPUs,
+			wantCPUSrc: sourceHost,
+		},
+		{
+			desc:       "limited by cgroup",
+			flags:      TunerFlags{CgroupRoot: limited},
+			wantMemory: totalMemory / 2,
+			wantMemSrc: sourceCgroup,
+			wantCPUs:   1,
+			wantCPUSrc: limitedCPUSrc,
+			wantCgroup: totalMemory / 2,
+		},
+		{
+			desc:       "cgroup larger than host",
+			flags:      TunerFlags{CgroupRoot: generous},
+			wantMemory: totalMemory,
+			wantMemSrc: sourceHost,
+			wantCPUs:   hostCPUs,
+			wantCPUSrc: sourceHost,
+		},
+		{
+			desc:       "flags beat cgroup",
+			flags:      TunerFlags{CgroupRoot: limited, Memory: "1GB", NumCPUs: 3},
+			wantMemory: parse.Gigabyte,
+			wantMemSrc: sourceFlag,
+			wantCPUs:   3,
+			wantCPUSrc: sourceFlag,
+			wantCgroup: totalMemory / 2,
+		},
+		{
+			desc:   "bad rounding",
+			flags:  TunerFlags{CgroupRoot: limited, CPURounding: "sideways"},
+			errMsg: fmt.Sprintf(errUnknownCPURounding, "sideways", strings.Join(ValidCPURoundings, ", ")),
+		},
+	}
+
+	for _, c := range cases {
+		flags := c.flags
+		flags.PGVersion = pgutils.MajorVersion12
+		tuner := &Tuner{flags: &flags}
+		config, err := tuner.initializeSystemConfig()
+		if c.errMsg != "" {
+			if err == nil || err.Error() != c.errMsg {
+				t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.errMsg)
+			}
+			continue
+		} else if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.desc, err)
+		}
+		if got := config.Memory; got != c.wantMemory {
+			t.Errorf("%s: incorrect memory: got %d want %d", c.desc, got, c.wantMemory)
+		}
+		if got := tuner.memorySource; got != c.wantMemSrc {
+			t.Errorf("%s: incorrect memory source: got %v want %v", c.desc, got, c.wantMemSrc)
+		}
+		if got := config.CPUs; got != c.wantCPUs {
+			t.Errorf("%s: incorrect CPUs: got %d want %d", c.desc, got, c.wantCPUs)
+		}
+		if got := tuner.cpuSource; got != c.wantCPUSrc {
+			t.Errorf("%s: incorrect CPU source: got %v want %v", c.desc, got, c.wantCPUSrc)
+		}
+		if got := tuner.cgroupMemory; got != c.wantCgroup {
+			t.Errorf("%s: incorrect cgroup memory limit: got %d want %d", c.desc, got, c.wantCgroup)
+		}
+	}
+}
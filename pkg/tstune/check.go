@@ -0,0 +1,122 @@
+package tstune
+
+import (
+	"fmt"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+// Exit codes for --check, so that it can be used in CI or a health check.
+const (
+	exitCheckTuned     = 0 // everything is within the fudge factor of our recommendations
+	exitCheckDrift     = 1 // at least one setting differs from our recommendations
+	exitCheckSharedLib = 2 // timescaledb, or another library needed, is not in shared_preload_libraries
+	exitCheckError     = 3 // the check could not be done
+)
+
+const (
+	errCheckConflictFmt = "--check cannot be used with %s"
+
+	checkSharedLibLabel         = "shared_preload_libraries"
+	checkDriftLabel             = "drift"
+	errCheckSharedLib           = "timescaledb is missing from shared_preload_libraries"
+	errCheckSharedLibMissingFmt = "%s is missing from shared_preload_libraries"
+	errCheckDriftFmt            = "%d setting(s) differ from recommendations"
+	successCheck                = "all settings tuned, no drift"
+
+	fmtCheckDrift  = "%s: %s, recommended %s"
+	checkMissing   = "missing"
+	checkCommented = "commented out"
+)
+
+// validateCheckFlags returns an error if --check is combined with flags that
+// would change something.
+func validateCheckFlags(flags *TunerFlags) error {
+	if !flags.Check {
+		return nil
+	}
+	switch {
+	case flags.Restore:
+		return fmt.Errorf(errCheckConflictFmt, "--restore")
+	case flags.SQLPath != "":
+		return fmt.Errorf(errCheckConflictFmt, "--sql-script")
+	}
+	return nil
+}
+
+// checkCurrentValue describes the current state of a setting for the drift
+// summary.
+func checkCurrentValue(r *tunableParseResult) string {
+	switch {
+	case r == nil || r.missing:
+		return checkMissing
+	case r.commented:
+		return checkCommented
+	default:
+		return r.value
+	}
+}
+
+// processCheck compares the conf file against our recommendations without
+// prompting or changing anything. It prints a summary of every setting that
+// has drifted and returns the exit code to use.
+func (t *Tuner) processCheck(config *pgtune.SystemConfig, profile pgtune.Profile) (int, error) {
+	t.printTunableIntro(config)
+	code := exitCheckTuned
+
+	res := t.cfs.sharedLibResult
+	if res == nil || res.commented || !res.hasTimescale {
+		t.handler.p.Error(checkSharedLibLabel, errCheckSharedLib)
+		code = exitCheckSharedLib
+	}
+	for _, lib := range t.extraSharedLibs() {
+		if res == nil || res.commented || !res.hasLib(lib) {
+			t.handler.p.Error(checkSharedLibLabel, errCheckSharedLibMissingFmt, lib)
+			code = exitCheckSharedLib
+		}
+	}
+
+	drifted := 0
+	for _, label := range t.tunedLabels() {
+		sg, err := t.getSettingsGroup(label, config)
+		if err != nil {
+			return exitCheckError, err
+		}
+		recommender := sg.GetRecommender(profile)
+		if !recommender.IsAvailable() {
+			continue
+		}
+
+		keys := sg.Keys()
+		show, err := checkIfShouldShowSetting(keys, t.cfs.tuneParseResults, recommender, t.pins)
+		if err != nil {
+			return exitCheckError, err
+		}
+		if t.report != nil {
+			groupRep := newGroupReport(label, keys, t.cfs.tuneParseResults, recommender, show)
+			addLiveSettings(groupRep, t.live)
+			groupRep.pin(t.pins)
+			t.report.Groups = append(t.report.Groups, groupRep)
+		}
+		t.printPinned(keys, recommender)
+
+		for _, k := range keys {
+			rec := recommender.Recommend(k)
+			if !show[k] || rec == pgtune.NoRecommendation {
+				continue
+			}
+			fmt.Fprintf(t.handler.out, fmtCheckDrift+"\n", k, checkCurrentValue(t.cfs.tuneParseResults[k]), rec)
+			drifted++
+		}
+	}
+
+	if drifted > 0 {
+		t.handler.p.Error(checkDriftLabel, errCheckDriftFmt, drifted)
+		if code == exitCheckTuned {
+			code = exitCheckDrift
+		}
+	} else if code == exitCheckTuned {
+		t.handler.p.Success(successCheck)
+	}
+	return code, nil
+}
@@ -0,0 +1,214 @@
+package tstune
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+func TestValidateCheckFlags(t *testing.T) {
+	cases := []struct {
+		desc   string
+		flags  *TunerFlags
+		errMsg string
+	}{
+		{
+			desc:  "not checking",
+			flags: &TunerFlags{Restore: true, SQLPath: "-"},
+		},
+		{
+			desc:  "checking",
+			flags: &TunerFlags{Check: true, DryRun: true, Quiet: true},
+		},
+		{
+			desc:   "checking with restore",
+			flags:  &TunerFlags{Check: true, Restore: true},
+			errMsg: fmt.Sprintf(errCheckConflictFmt, "--restore"),
+		},
+		{
+			desc:   "checking with sql script",
+			flags:  &TunerFlags{Check: true, SQLPath: "out.sql"},
+			errMsg: fmt.Sprintf(errCheckConflictFmt, "--sql-script"),
+		},
+	}
+
+	for _, c := range cases {
+		err := validateCheckFlags(c.flags)
+		if c.errMsg == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if c.errMsg != "" {
+			if err == nil {
+				t.Errorf("%s: unexpected lack of error", c.desc)
+			} else if got := err.Error(); got != c.errMsg {
+				t.Errorf("%s: incorrect error: got %s want %s", c.desc, got, c.errMsg)
+			}
+		}
+	}
+}
+
+func TestTunerProcessCheck(t *testing.T) {
+	replaceLines := func(replacements map[int]string) []string {
+		lines := make([]string, len(wantedQuietLines))
+		copy(lines, wantedQuietLines)
+		for idx, line := range replacements {
+			lines[idx] = line
+		}
+		return lines
+	}
+
+	cases := []struct {
+		desc        string
+		lines       []string
+		wantCode    int
+		wantPrints  []string
+		wantErrors  []string
+		wantSuccess bool
+	}{
+		{
+			desc:        "all correct",
+			lines:       wantedQuietLines,
+			wantCode:    exitCheckTuned,
+			wantPrints:  []string{},
+			wantSuccess: true,
+		},
+		{
+			desc:     "missing tunables",
+			lines:    append([]string{wantedQuietCorrectShared}, wantedQuietLines[6:]...),
+			wantCode: exitCheckDrift,
+			wantPrints: []string{
+				fmt.Sprintf(fmtCheckDrift, pgtune.SharedBuffersKey, checkMissing, "2GB"),
+				fmt.Sprintf(fmtCheckDrift, pgtune.EffectiveCacheKey, checkMissing, "6GB"),
+				fmt.Sprintf(fmtCheckDrift, pgtune.MaintenanceWorkMemKey, checkMissing, "1GB"),
+				fmt.Sprintf(fmtCheckDrift, pgtune.WorkMemKey, checkMissing, "64MB"),
+				fmt.Sprintf(fmtCheckDrift, pgtune.MaxBackgroundWorkers, checkMissing, "16"),
+			},
+			wantErrors: []string{checkDriftLabel + ": " + fmt.Sprintf(errCheckDriftFmt, 5)},
+		},
+		{
+			desc:       "commented tunable",
+			lines:      replaceLines(map[int]string{4: "#work_mem = 64MB"}),
+			wantCode:   exitCheckDrift,
+			wantPrints: []string{fmt.Sprintf(fmtCheckDrift, pgtune.WorkMemKey, checkCommented, "64MB")},
+			wantErrors: []string{checkDriftLabel + ": " + fmt.Sprintf(errCheckDriftFmt, 1)},
+		},
+		{
+			desc:       "tunable too far off",
+			lines:      replaceLines(map[int]string{4: "work_mem = 4MB"}),
+			wantCode:   exitCheckDrift,
+			wantPrints: []string{fmt.Sprintf(fmtCheckDrift, pgtune.WorkMemKey, "4MB", "64MB")},
+			wantErrors: []string{checkDriftLabel + ": " + fmt.Sprintf(errCheckDriftFmt, 1)},
+		},
+		{
+			desc:        "tunable close enough",
+			lines:       replaceLines(map[int]string{4: "work_mem = 63MB"}),
+			wantCode:    exitCheckTuned,
+			wantPrints:  []string{},
+			wantSuccess: true,
+		},
+		{
+			desc:       "missing shared",
+			lines:      wantedQuietLines[1:],
+			wantCode:   exitCheckSharedLib,
+			wantPrints: []string{},
+			wantErrors: []string{checkSharedLibLabel + ": " + errCheckSharedLib},
+		},
+		{
+			desc:       "commented shared",
+			lines:      replaceLines(map[int]string{0: wantedQuietCommentedShared}),
+			wantCode:   exitCheckSharedLib,
+			wantPrints: []string{},
+			wantErrors: []string{checkSharedLibLabel + ": " + errCheckSharedLib},
+		},
+		{
+			desc:       "wrong shared and drift",
+			lines:      replaceLines(map[int]string{0: wantedQuietMissingShared, 4: "work_mem = 4MB"}),
+			wantCode:   exitCheckSharedLib,
+			wantPrints: []string{fmt.Sprintf(fmtCheckDrift, pgtune.WorkMemKey, "4MB", "64MB")},
+			wantErrors: []string{
+				checkSharedLibLabel + ": " + errCheckSharedLib,
+				checkDriftLabel + ": " + fmt.Sprintf(errCheckDriftFmt, 1),
+			},
+		},
+	}
+
+	for _, c := range cases {
+		config := getDefaultSystemConfig(t)
+		tuner := newTunerWithDefaultFlagsForInputs(t, "", c.lines)
+		tuner.flags.Check = true
+
+		code, err := tuner.processCheck(config, pgtune.DefaultProfile)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+		if code != c.wantCode {
+			t.Errorf("%s: incorrect exit code: got %d want %d", c.desc, code, c.wantCode)
+		}
+
+		out := tuner.handler.out.(*testWriter)
+		if got := len(out.lines); got != len(c.wantPrints) {
+			t.Errorf("%s: incorrect prints len: got %d want %d", c.desc, got, len(c.wantPrints))
+		} else {
+			for i, want := range c.wantPrints {
+				if got := out.lines[i]; got != want+"\n" {
+					t.Errorf("%s: incorrect print at idx %d: got\n%s\nwant\n%s", c.desc, i, got, want+"\n")
+				}
+			}
+		}
+
+		tp := tuner.handler.p.(*testPrinter)
+		if got := tp.promptCalls; got != 0 {
+			t.Errorf("%s: unexpected prompts: got %d", c.desc, got)
+		}
+		if got := len(tp.errors); got != len(c.wantErrors) {
+			t.Errorf("%s: incorrect number of errors: got %d want %d", c.desc, got, len(c.wantErrors))
+		} else {
+			for i, want := range c.wantErrors {
+				if got := tp.errors[i]; got != want {
+					t.Errorf("%s: incorrect error at idx %d: got\n%s\nwant\n%s", c.desc, i, got, want)
+				}
+			}
+		}
+		if c.wantSuccess {
+			if len(tp.successes) != 1 || tp.successes[0] != successCheck {
+				t.Errorf("%s: incorrect successes: got %v want %s", c.desc, tp.successes, successCheck)
+			}
+		} else if got := tp.successCalls; got != 0 {
+			t.Errorf("%s: unexpected successes: got %v", c.desc, tp.successes)
+		}
+
+		// nothing is changed
+		if len(tuner.changes) != 0 {
+			t.Errorf("%s: unexpected changes: got %d", c.desc, len(tuner.changes))
+		}
+	}
+}
+
+func TestTunerProcessCheckReport(t *testing.T) {
+	config := getDefaultSystemConfig(t)
+	tuner := newTunerWithDefaultFlagsForInputs(t, "", wantedQuietLines[6:])
+	tuner.flags.Check = true
+	tuner.report = newReport(config, "")
+
+	code, err := tuner.processCheck(config, pgtune.DefaultProfile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if code != exitCheckSharedLib {
+		t.Errorf("incorrect exit code: got %d want %d", code, exitCheckSharedLib)
+	}
+
+	if len(tuner.report.Groups) == 0 {
+		t.Fatalf("no groups in report")
+	}
+	mem := tuner.report.Groups[0]
+	if mem.Label != pgtune.MemoryLabel {
+		t.Errorf("incorrect first group: got %s want %s", mem.Label, pgtune.MemoryLabel)
+	}
+	for _, s := range mem.Settings {
+		if !s.Missing || s.Action != actionAdd {
+			t.Errorf("incorrect report for %s: got missing %v action %s", s.Key, s.Missing, s.Action)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package tstune
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 var (
@@ -89,3 +90,104 @@ func (c *numberedListChecker) Check(r string) (bool, error) {
 	c.response = int(num)
 	return true, nil
 }
+
+// autoConfAction is what to do with a postgresql.auto.conf entry that shadows
+// a recommendation.
+type autoConfAction int
+
+const (
+	autoConfWrite  autoConfAction = iota // write the recommendation to postgresql.auto.conf
+	autoConfRemove                       // remove the entry from postgresql.auto.conf
+)
+
+func isWrite(s string) bool {
+	return s == "w" || s == "write"
+}
+
+func isRemove(s string) bool {
+	return s == "r" || s == "remove"
+}
+
+type autoConfChecker struct {
+	err      error
+	response autoConfAction
+}
+
+func newAutoConfChecker(errMsg string, args ...interface{}) *autoConfChecker {
+	return &autoConfChecker{fmt.Errorf(errMsg, args...), autoConfWrite}
+}
+
+func (c *autoConfChecker) Check(r string) (bool, error) {
+	if isQuit(r) {
+		return false, c.err
+	} else if isWrite(r) {
+		c.response = autoConfWrite
+		return true, nil
+	} else if isRemove(r) {
+		c.response = autoConfRemove
+		return true, nil
+	}
+	return false, nil
+}
+
+// caseSensitiveChecker is a promptChecker that needs responses as they were
+// typed, e.g., because they can include units like MB.
+type caseSensitiveChecker interface {
+	promptChecker
+	caseSensitive()
+}
+
+// settingChoice is what to do with a recommendation for a single setting.
+type settingChoice int
+
+const (
+	settingAccept settingChoice = iota // use the recommendation
+	settingKeep                        // leave the current value
+	settingCustom                      // use a value given by the user
+)
+
+func isAccept(s string) bool {
+	return s == "a" || s == "accept"
+}
+
+func isKeep(s string) bool {
+	return s == "k" || s == "keep"
+}
+
+type settingChecker struct {
+	err       error
+	validate  func(string) (string, error) // returns the value to use for a response
+	onInvalid func(error)
+	response  settingChoice
+	value     string
+}
+
+func newSettingChecker(validate func(string) (string, error), onInvalid func(error), errMsg string, args ...interface{}) *settingChecker {
+	return &settingChecker{fmt.Errorf(errMsg, args...), validate, onInvalid, settingAccept, ""}
+}
+
+func (c *settingChecker) caseSensitive() {}
+
+func (c *settingChecker) Check(r string) (bool, error) {
+	lower := strings.ToLower(r)
+	switch {
+	case r == "":
+		return false, nil
+	case isQuit(lower):
+		return false, c.err
+	case isAccept(lower) || isYes(lower):
+		c.response = settingAccept
+		return true, nil
+	case isKeep(lower):
+		c.response = settingKeep
+		return true, nil
+	}
+	v, err := c.validate(r)
+	if err != nil {
+		c.onInvalid(err)
+		return false, nil
+	}
+	c.response = settingCustom
+	c.value = v
+	return true, nil
+}
@@ -222,3 +222,113 @@ func TestNewNumberedListCheckerCheck(t *testing.T) {
 		}
 	}
 }
+
+func TestAutoConfCheckerCheck(t *testing.T) {
+	defaultErrMsg := "default error"
+	cases := []struct {
+		s            string
+		want         bool
+		wantResponse autoConfAction
+		errMsg       string
+	}{
+		{
+			s:      "q",
+			want:   false,
+			errMsg: defaultErrMsg,
+		},
+		{
+			s:            "",
+			want:         false,
+			wantResponse: autoConfWrite,
+		},
+		{
+			s:            "w",
+			want:         true,
+			wantResponse: autoConfWrite,
+		},
+		{
+			s:            "write",
+			want:         true,
+			wantResponse: autoConfWrite,
+		},
+		{
+			s:            "r",
+			want:         true,
+			wantResponse: autoConfRemove,
+		},
+		{
+			s:            "remove",
+			want:         true,
+			wantResponse: autoConfRemove,
+		},
+	}
+
+	for _, c := range cases {
+		checker := newAutoConfChecker(defaultErrMsg)
+		got, err := checker.Check(c.s)
+		if c.errMsg == "" && err != nil {
+			t.Errorf("%s: unexpected err: got %v", c.s, err)
+		} else if c.errMsg != "" {
+			if err == nil {
+				t.Errorf("%s: unexpected lack of error", c.s)
+			} else if got := err.Error(); got != c.errMsg {
+				t.Errorf("%s: incorrect error: got %s want %s", c.s, got, c.errMsg)
+			}
+		} else if got != c.want {
+			t.Errorf("%s: incorrect value: got %v want %v", c.s, got, c.want)
+		} else if checker.response != c.wantResponse {
+			t.Errorf("%s: incorrect response: got %v want %v", c.s, checker.response, c.wantResponse)
+		}
+	}
+}
+
+func TestSettingCheckerCheck(t *testing.T) {
+	defaultErrMsg := "default error"
+	cases := []struct {
+		s            string
+		want         bool
+		wantResponse settingChoice
+		wantValue    string
+		wantInvalid  int
+		errMsg       string
+	}{
+		{s: "q", errMsg: defaultErrMsg},
+		{s: "", wantResponse: settingAccept},
+		{s: "a", want: true, wantResponse: settingAccept},
+		{s: "Yes", want: true, wantResponse: settingAccept},
+		{s: "keep", want: true, wantResponse: settingKeep},
+		{s: "64MB", want: true, wantResponse: settingCustom, wantValue: "64MB"},
+		{s: "64 megs", wantResponse: settingAccept, wantInvalid: 1},
+	}
+
+	validate := func(s string) (string, error) {
+		if s == "64 megs" {
+			return "", fmt.Errorf("bad value")
+		}
+		return s, nil
+	}
+	for _, c := range cases {
+		invalid := 0
+		checker := newSettingChecker(validate, func(error) { invalid++ }, defaultErrMsg)
+		if _, ok := interface{}(checker).(caseSensitiveChecker); !ok {
+			t.Fatalf("setting checker should be case sensitive")
+		}
+		got, err := checker.Check(c.s)
+		if c.errMsg == "" && err != nil {
+			t.Errorf("%s: unexpected err: got %v", c.s, err)
+		} else if c.errMsg != "" {
+			if err == nil {
+				t.Errorf("%s: unexpected lack of error", c.s)
+			} else if got := err.Error(); got != c.errMsg {
+				t.Errorf("%s: incorrect error: got %s want %s", c.s, got, c.errMsg)
+			}
+		} else if got != c.want {
+			t.Errorf("%s: incorrect value: got %v want %v", c.s, got, c.want)
+		} else if checker.response != c.wantResponse || checker.value != c.wantValue {
+			t.Errorf("%s: incorrect response: got %v %q want %v %q", c.s, checker.response, checker.value, c.wantResponse, c.wantValue)
+		}
+		if invalid != c.wantInvalid {
+			t.Errorf("%s: incorrect number of invalid calls: got %d want %d", c.s, invalid, c.wantInvalid)
+		}
+	}
+}
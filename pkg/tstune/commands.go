@@ -0,0 +1,434 @@
+package tstune
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+)
+
+const (
+	commandBackups = "backups"
+	commandRestore = "restore"
+
+	backupsList  = "list"
+	backupsShow  = "show"
+	backupsDiff  = "diff"
+	backupsPrune = "prune"
+
+	errUnknownCommandFmt    = "unknown command %q (valid commands: %s)"
+	errUnknownBackupsFmt    = "unknown backups command %q (valid commands: %s)"
+	errCommandArgsFmt       = "%s takes %d argument(s), got %d"
+	errBackupNotFoundFmt    = "no backup named %s in %s"
+	errPruneNoLimits        = "nothing to prune without --backup-keep or --backup-max-age"
+	errRestoreLatestAndName = "--latest and --name cannot be used together"
+	errBackupChecksumFmt    = "SHA-256 of the backup is %s, but was %s when it was made"
+
+	backupChecksumLabel      = "checksum"
+	statementBackupsListFmt  = "Backups in %s (most recent first):"
+	statementNoBackupsFmt    = "No backups found in %s"
+	statementBackupSourceFmt = "Backup of %s made %s ago"
+	statementBackupMadeByFmt = "Made by timescaledb-tune %s with profile: %s"
+	statementBackupNoMeta    = "No metadata found for this backup"
+	successBackupChecksum    = "checksum matches"
+	successNoBackupDiff      = "no differences between the backup and the conf file"
+	successNoBackupsPruned   = "no backups to prune"
+	usageCommandFmt          = "Usage: timescaledb-tune %s [flags]%s\n"
+)
+
+// CommandUsage describes the commands that can be given instead of tuning,
+// for use in the help text.
+const CommandUsage = `Commands:
+  backups list [--format=text|json|yaml]
+        List the backups of the conf file, most recent first
+  backups show <name>
+        Print a backup, after checking it against its metadata
+  backups diff <name>
+        Show how the conf file has changed since a backup, as a unified diff
+  backups prune [--backup-keep=N] [--backup-max-age=AGE]
+        Remove old backups of the conf file, always keeping the newest
+  restore [--latest | --name=<name>]
+        Restore a backup, after backing up the conf file it replaces. Without
+        --latest or --name, asks which backup to restore
+Run a command with -h to see its flags.`
+
+var backupsActions = []string{backupsList, backupsShow, backupsDiff, backupsPrune}
+
+// command is a parsed command line for one of the commands that manage
+// backups.
+type command struct {
+	name   string   // commandBackups or commandRestore
+	action string   // for commandBackups, what to do with them
+	args   []string // positional arguments
+	latest bool     // restore the most recent backup
+	backup string   // name of the backup to restore
+}
+
+// backupEntry describes a backup for `backups list`.
+type backupEntry struct {
+	Name string      `json:"name" yaml:"name"`
+	Path string      `json:"path" yaml:"path"`
+	Time time.Time   `json:"time" yaml:"time"`
+	Size int64       `json:"size" yaml:"size"`
+	Meta *backupMeta `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+}
+
+// backupList is the document printed by `backups list` in a structured format.
+type backupList struct {
+	ConfPath  string         `json:"conf_path" yaml:"conf_path"`
+	BackupDir string         `json:"backup_dir" yaml:"backup_dir"`
+	Backups   []*backupEntry `json:"backups" yaml:"backups"`
+}
+
+// commandFlagSet returns the flags for a command, starting with those needed
+// to find the conf file and its backups. Their defaults are the values already
+// in flags, so they can be given before the command as well as after it.
+func commandFlagSet(name string, flags *TunerFlags, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&flags.ConfPath, "conf-path", flags.ConfPath, "Path to postgresql.conf. If blank, heuristics will be used to find it")
+	fs.StringVar(&flags.BackupDir, "backup-dir", flags.BackupDir, "Directory backups are kept in. Default is "+BackupDirName+" in the data directory")
+	fs.StringVar(&flags.PGConfig, "pg-config", flags.PGConfig, "Path to the pg_config binary, used to find postgresql.conf")
+	fs.StringVar(&flags.PGVersion, "pg-version", flags.PGVersion, "Major version of PostgreSQL, used to find postgresql.conf. Default is determined via pg_config")
+	fs.BoolVar(&flags.UseColor, "color", flags.UseColor, "Use color in output (works best on dark terminals)")
+	return fs
+}
+
+// parseInterspersed parses args with fs, allowing flags to come after
+// positional arguments, and returns the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// parseCommand parses the command line args of a command, storing flags that
+// are shared with tuning in flags. Usage and flag errors are written to output.
+func parseCommand(args []string, flags *TunerFlags, output io.Writer) (*command, error) {
+	cmd := &command{name: args[0]}
+	rest := args[1:]
+	var fs *flag.FlagSet
+	wantArgs := 0
+	switch cmd.name {
+	case commandBackups:
+		if len(rest) > 0 {
+			cmd.action = rest[0]
+			rest = rest[1:]
+		}
+		fs = commandFlagSet(commandBackups+" "+cmd.action, flags, output)
+		switch cmd.action {
+		case backupsList:
+			fs.StringVar(&flags.Format, "format", flags.Format, "Format of the list. Valid values: "+strings.Join(ValidFormats, ", "))
+		case backupsShow, backupsDiff:
+			wantArgs = 1
+		case backupsPrune:
+			fs.UintVar(&flags.BackupKeep, "backup-keep", flags.BackupKeep, "Number of backups to keep")
+			fs.StringVar(&flags.BackupMaxAge, "backup-max-age", flags.BackupMaxAge, "Remove backups older than this, in PostgreSQL time format with days as the default unit, e.g., 30 or 12h")
+		default:
+			return nil, fmt.Errorf(errUnknownBackupsFmt, cmd.action, strings.Join(backupsActions, ", "))
+		}
+	case commandRestore:
+		fs = commandFlagSet(commandRestore, flags, output)
+		fs.BoolVar(&cmd.latest, "latest", false, "Restore the most recent backup without asking")
+		fs.StringVar(&cmd.backup, "name", "", "Name of the backup to restore without asking")
+	default:
+		return nil, fmt.Errorf(errUnknownCommandFmt, cmd.name, strings.Join([]string{commandBackups, commandRestore}, ", "))
+	}
+
+	fs.Usage = func() {
+		argsUsage := ""
+		if wantArgs > 0 {
+			argsUsage = " <name>"
+		}
+		fmt.Fprintf(output, usageCommandFmt, fs.Name(), argsUsage)
+		fs.PrintDefaults()
+	}
+
+	var err error
+	cmd.args, err = parseInterspersed(fs, rest)
+	if err != nil {
+		return nil, err
+	}
+	if len(cmd.args) != wantArgs {
+		return nil, fmt.Errorf(errCommandArgsFmt, strings.TrimSpace(cmd.name+" "+cmd.action), wantArgs, len(cmd.args))
+	}
+	if cmd.latest && cmd.backup != "" {
+		return nil, fmt.Errorf(errRestoreLatestAndName)
+	}
+	return cmd, nil
+}
+
+// RunCommand runs one of the commands for managing backups given by args,
+// e.g., "backups list" or "restore --latest", instead of tuning.
+func (t *Tuner) RunCommand(args []string, flags *TunerFlags, in io.Reader, out io.Writer, outErr io.Writer) {
+	if flags == nil {
+		flags = &TunerFlags{}
+	}
+	cmd, err := parseCommand(args, flags, outErr)
+	t.flags, _ = verifyTunerFlags(flags)
+	t.initializeIOHandler(in, out, outErr)
+	if err == flag.ErrHelp {
+		return // usage was already printed
+	}
+	if err == nil {
+		err = t.runCommand(cmd)
+	}
+	if err != nil {
+		t.handler.errorExit(err)
+	}
+}
+
+// runCommand finds the conf file and its backups, then does what cmd says.
+func (t *Tuner) runCommand(cmd *command) error {
+	if err := validateFormat(t.flags.Format); err != nil {
+		return err
+	}
+	maxAge, err := parseBackupMaxAge(t.flags.BackupMaxAge)
+	if err != nil {
+		return err
+	}
+
+	confPath := t.flags.ConfPath
+	if len(confPath) == 0 {
+		pgVersion, err := t.pgMajorVersion()
+		if err != nil {
+			return err
+		}
+		confPath, err = getConfigFilePath(runtime.GOOS, pgVersion)
+		if err != nil {
+			return err
+		}
+	}
+	// commands are meant to be scripted, so there is no prompt for whether
+	// this is the right file
+	t.handler.p.Statement(statementConfFileCheck)
+	fmt.Fprintf(t.handler.outErr, confPath+"\n\n")
+
+	// the conf file may not parse, which could be why a backup is needed, in
+	// which case the backup directory is found without it
+	cfs, _ := readConfigFileState(confPath, 0)
+	dir := getBackupDir(t.flags.BackupDir, cfs, confPath)
+
+	if cmd.name == commandRestore {
+		return t.restoreCommand(cmd, dir, confPath)
+	}
+	switch cmd.action {
+	case backupsList:
+		return t.listBackups(dir, confPath)
+	case backupsShow:
+		return t.showBackup(dir, confPath, cmd.args[0])
+	case backupsDiff:
+		return t.diffBackup(dir, confPath, cmd.args[0])
+	default:
+		return t.pruneBackups(dir, confPath, maxAge)
+	}
+}
+
+// findBackup returns the path of the backup of the conf file at confPath in
+// dir with the given name. A path may be given instead of a name.
+func findBackup(dir, confPath, name string) (string, error) {
+	files, err := getBackups(dir, confPath)
+	if err != nil {
+		return "", fmt.Errorf(errCouldNotGetBackupsFmt, err)
+	}
+	for _, f := range files {
+		if filepath.Base(f) == filepath.Base(name) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf(errBackupNotFoundFmt, filepath.Base(name), dir)
+}
+
+// readBackupMeta returns the contents of the sidecar file of the backup at
+// backupPath, or nil if it has none.
+func readBackupMeta(backupPath string) (*backupMeta, error) {
+	contents, err := os.ReadFile(backupPath + backupMetaSuffix)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	meta := &backupMeta{}
+	if err := json.Unmarshal(contents, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// readLines returns the lines of the file at filePath.
+func readLines(filePath string) ([]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// listBackups prints the backups of the conf file at confPath, most recent
+// first, in the format given by flag.
+func (t *Tuner) listBackups(dir, confPath string) error {
+	files, err := getBackups(dir, confPath)
+	if err != nil {
+		return fmt.Errorf(errCouldNotGetBackupsFmt, err)
+	}
+	now := time.Now()
+	entries := []*backupEntry{}
+	for i := len(files) - 1; i >= 0; i-- {
+		name := filepath.Base(files[i])
+		_, when, _ := parseBackupName(name, now.Location())
+		entry := &backupEntry{Name: name, Path: files[i], Time: when}
+		if fi, err := os.Stat(files[i]); err == nil {
+			entry.Size = fi.Size()
+		}
+		entry.Meta, err = readBackupMeta(files[i])
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+
+	if t.flags.Format != "" && t.flags.Format != formatText {
+		return writeReport(t.handler.out, &backupList{ConfPath: confPath, BackupDir: dir, Backups: entries}, t.flags.Format)
+	}
+	if len(entries) == 0 {
+		t.handler.p.Statement(statementNoBackupsFmt, dir)
+		return nil
+	}
+	t.handler.p.Statement(statementBackupsListFmt, dir)
+	for i, e := range entries {
+		fmt.Fprintf(t.handler.out, backupListFmt, i+1, e.Name, parse.PrettyDuration(now.Sub(e.Time)))
+	}
+	return nil
+}
+
+// showBackup prints the backup with the given name, after checking it against
+// the checksum in its metadata.
+func (t *Tuner) showBackup(dir, confPath, name string) error {
+	backupPath, err := findBackup(dir, confPath, name)
+	if err != nil {
+		return err
+	}
+	contents, err := os.ReadFile(backupPath)
+	if err != nil {
+		return err
+	}
+	meta, err := readBackupMeta(backupPath)
+	if err != nil {
+		return err
+	}
+
+	if meta == nil {
+		t.handler.p.Statement(statementBackupNoMeta)
+	} else {
+		t.handler.p.Statement(statementBackupSourceFmt, meta.SourcePath, parse.PrettyDuration(time.Since(meta.Created)))
+		profile := meta.Profile
+		if profile == "" {
+			profile = defaultProfileName
+		}
+		t.handler.p.Statement(statementBackupMadeByFmt, meta.ToolVersion, profile)
+		sum := sha256.Sum256(contents)
+		if got := hex.EncodeToString(sum[:]); got != meta.SHA256 {
+			t.handler.p.Error(backupChecksumLabel, errBackupChecksumFmt, got, meta.SHA256)
+		} else {
+			t.handler.p.Success(successBackupChecksum)
+		}
+	}
+	fmt.Fprintf(t.handler.outErr, "\n")
+	_, err = t.handler.out.Write(contents)
+	return err
+}
+
+// diffBackup prints how the conf file at confPath has changed since the
+// backup with the given name was made, as a unified diff.
+func (t *Tuner) diffBackup(dir, confPath, name string) error {
+	backupPath, err := findBackup(dir, confPath, name)
+	if err != nil {
+		return err
+	}
+	backupLines, err := readLines(backupPath)
+	if err != nil {
+		return err
+	}
+	confLines, err := readLines(confPath)
+	if err != nil {
+		return err
+	}
+	d := unifiedDiff(backupPath, confPath, backupLines, confLines)
+	if d == "" {
+		t.handler.p.Success(successNoBackupDiff)
+		return nil
+	}
+	_, err = io.WriteString(t.handler.out, d)
+	return err
+}
+
+// pruneBackups removes old backups of the conf file at confPath according to
+// --backup-keep and --backup-max-age, printing the names of those removed.
+func (t *Tuner) pruneBackups(dir, confPath string, maxAge time.Duration) error {
+	if t.flags.BackupKeep == 0 && maxAge == 0 {
+		return fmt.Errorf(errPruneNoLimits)
+	}
+	removed, err := pruneBackups(dir, confPath, t.flags.BackupKeep, maxAge, time.Now())
+	for _, f := range removed {
+		fmt.Fprintln(t.handler.out, filepath.Base(f))
+	}
+	if err != nil {
+		return err
+	}
+	if len(removed) == 0 {
+		t.handler.p.Success(successNoBackupsPruned)
+	} else {
+		t.handler.p.Statement(statementBackupsPrunedFmt, len(removed), dir)
+	}
+	return nil
+}
+
+// restoreCommand restores the backup picked by cmd, or asks which one to
+// restore if none was.
+func (t *Tuner) restoreCommand(cmd *command, dir, confPath string) error {
+	r := &fsRestorer{}
+	switch {
+	case cmd.latest:
+		files, err := getBackups(dir, confPath)
+		if err != nil {
+			return fmt.Errorf(errCouldNotGetBackupsFmt, err)
+		}
+		if len(files) == 0 {
+			return fmt.Errorf(errNoBackupsFound)
+		}
+		return t.restoreBackup(r, dir, files[len(files)-1], confPath)
+	case cmd.backup != "":
+		backupPath, err := findBackup(dir, confPath, cmd.backup)
+		if err != nil {
+			return err
+		}
+		return t.restoreBackup(r, dir, backupPath, confPath)
+	default:
+		return t.restore(r, dir, confPath)
+	}
+}
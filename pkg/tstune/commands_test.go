@@ -0,0 +1,288 @@
+package tstune
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCommand(t *testing.T) {
+	cases := []struct {
+		desc      string
+		args      []string
+		want      *command
+		wantFlags *TunerFlags
+		errMsg    string
+	}{
+		{
+			desc:      "backups list",
+			args:      []string{"backups", "list", "--format=json"},
+			want:      &command{name: commandBackups, action: backupsList, args: []string{}},
+			wantFlags: &TunerFlags{Format: formatJSON},
+		},
+		{
+			desc:      "backups show with flag after name",
+			args:      []string{"backups", "show", "foo", "--conf-path=/etc/postgresql.conf"},
+			want:      &command{name: commandBackups, action: backupsShow, args: []string{"foo"}},
+			wantFlags: &TunerFlags{ConfPath: "/etc/postgresql.conf"},
+		},
+		{
+			desc:      "backups prune",
+			args:      []string{"backups", "prune", "--backup-keep=3", "--backup-max-age=7d"},
+			want:      &command{name: commandBackups, action: backupsPrune, args: []string{}},
+			wantFlags: &TunerFlags{BackupKeep: 3, BackupMaxAge: "7d"},
+		},
+		{
+			desc:      "restore latest",
+			args:      []string{"restore", "--latest", "--backup-dir=/backups"},
+			want:      &command{name: commandRestore, args: []string{}, latest: true},
+			wantFlags: &TunerFlags{BackupDir: "/backups"},
+		},
+		{
+			desc:      "restore by name",
+			args:      []string{"restore", "--name", "foo"},
+			want:      &command{name: commandRestore, args: []string{}, backup: "foo"},
+			wantFlags: &TunerFlags{},
+		},
+		{
+			desc:   "unknown command",
+			args:   []string{"foo"},
+			errMsg: fmt.Sprintf(errUnknownCommandFmt, "foo", "backups, restore"),
+		},
+		{
+			desc:   "missing backups command",
+			args:   []string{"backups"},
+			errMsg: fmt.Sprintf(errUnknownBackupsFmt, "", strings.Join(backupsActions, ", ")),
+		},
+		{
+			desc:   "missing backup name",
+			args:   []string{"backups", "diff"},
+			errMsg: fmt.Sprintf(errCommandArgsFmt, "backups diff", 1, 0),
+		},
+		{
+			desc:   "extra argument",
+			args:   []string{"backups", "list", "foo"},
+			errMsg: fmt.Sprintf(errCommandArgsFmt, "backups list", 0, 1),
+		},
+		{
+			desc:   "flag of another command",
+			args:   []string{"backups", "list", "--latest"},
+			errMsg: "flag provided but not defined: -latest",
+		},
+		{
+			desc:   "latest and name",
+			args:   []string{"restore", "--latest", "--name=foo"},
+			errMsg: errRestoreLatestAndName,
+		},
+	}
+
+	for _, c := range cases {
+		flags := &TunerFlags{}
+		cmd, err := parseCommand(c.args, flags, io.Discard)
+		if c.errMsg != "" {
+			if err == nil {
+				t.Errorf("%s: unexpected lack of error", c.desc)
+			} else if got := err.Error(); got != c.errMsg {
+				t.Errorf("%s: incorrect error: got %s want %s", c.desc, got, c.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+		if fmt.Sprintf("%+v", cmd) != fmt.Sprintf("%+v", c.want) {
+			t.Errorf("%s: incorrect command: got %+v want %+v", c.desc, cmd, c.want)
+		}
+		if *flags != *c.wantFlags {
+			t.Errorf("%s: incorrect flags: got %+v want %+v", c.desc, flags, c.wantFlags)
+		}
+	}
+
+	_, err := parseCommand([]string{"restore", "-h"}, &TunerFlags{}, io.Discard)
+	if err != flag.ErrHelp {
+		t.Errorf("incorrect error for help: got %v want %v", err, flag.ErrHelp)
+	}
+}
+
+// setupCommandTest makes a conf file and backup directory with backups of the
+// conf file made an hour and a day ago, and returns the paths of the conf file
+// and the backups, oldest first.
+func setupCommandTest(t *testing.T) (string, string, []string) {
+	t.Helper()
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "postgresql.conf")
+	backupDir := filepath.Join(dir, "backups")
+	if err := os.WriteFile(confPath, []byte("shared_buffers = 2GB\nwork_mem = 64MB\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	backups := []string{}
+	for _, contents := range []string{"shared_buffers = 128MB\n", "shared_buffers = 1GB\nwork_mem = 4MB\n"} {
+		cfs, err := getConfigFileState(strings.NewReader(contents))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := backup(cfs, backupDir, confPath, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// backups are named by time, so move them into the past
+		age := 24 * time.Hour
+		if len(backups) > 0 {
+			age = time.Hour
+		}
+		newPath := filepath.Join(backupDir, backupName(confPathHash(confPath), time.Now().Add(-age)))
+		for _, suffix := range []string{"", backupMetaSuffix} {
+			if err := os.Rename(p+suffix, newPath+suffix); err != nil {
+				t.Fatal(err)
+			}
+		}
+		backups = append(backups, newPath)
+	}
+	return confPath, backupDir, backups
+}
+
+func runTestCommand(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+	oldExitFn := exitFn
+	defer func() { exitFn = oldExitFn }()
+	code := 0
+	exitFn = func(c int) { code = c }
+
+	out := &bytes.Buffer{}
+	outErr := &bytes.Buffer{}
+	tuner := &Tuner{}
+	tuner.RunCommand(args, &TunerFlags{}, strings.NewReader(""), out, outErr)
+	return out.String(), outErr.String(), code
+}
+
+func TestRunCommandBackups(t *testing.T) {
+	confPath, backupDir, backups := setupCommandTest(t)
+	common := []string{"--conf-path=" + confPath, "--backup-dir=" + backupDir, "--color=false"}
+	newest := filepath.Base(backups[1])
+
+	// list
+	out, _, code := runTestCommand(t, append([]string{"backups", "list"}, common...)...)
+	if code != 0 {
+		t.Fatalf("list: unexpected exit code %d", code)
+	}
+	want := fmt.Sprintf(backupListFmt, 1, newest, "1 hour") + fmt.Sprintf(backupListFmt, 2, filepath.Base(backups[0]), "24 hours")
+	if out != want {
+		t.Errorf("list: incorrect output: got\n%s\nwant\n%s", out, want)
+	}
+
+	out, _, code = runTestCommand(t, append([]string{"backups", "list", "--format=json"}, common...)...)
+	if code != 0 {
+		t.Fatalf("list json: unexpected exit code %d", code)
+	}
+	list := &backupList{}
+	if err := json.Unmarshal([]byte(out), list); err != nil {
+		t.Fatalf("list json: could not parse output: %v\n%s", err, out)
+	}
+	if len(list.Backups) != 2 || list.Backups[0].Name != newest || list.Backups[0].Meta == nil {
+		t.Errorf("list json: incorrect backups: got %s", out)
+	}
+
+	// show
+	out, outErr, code := runTestCommand(t, append([]string{"backups", "show", newest}, common...)...)
+	if code != 0 {
+		t.Fatalf("show: unexpected exit code %d", code)
+	}
+	if want := "shared_buffers = 1GB\nwork_mem = 4MB\n"; out != want {
+		t.Errorf("show: incorrect output: got\n%s\nwant\n%s", out, want)
+	}
+	if !strings.Contains(outErr, successBackupChecksum) {
+		t.Errorf("show: checksum not verified: got\n%s", outErr)
+	}
+	if err := os.WriteFile(backups[1], []byte("tampered\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, outErr, _ = runTestCommand(t, append([]string{"backups", "show", newest}, common...)...)
+	if !strings.Contains(outErr, "SHA-256 of the backup is") {
+		t.Errorf("show: checksum mismatch not reported: got\n%s", outErr)
+	}
+
+	// diff
+	out, _, code = runTestCommand(t, append([]string{"backups", "diff", filepath.Base(backups[0])}, common...)...)
+	if code != 0 {
+		t.Fatalf("diff: unexpected exit code %d", code)
+	}
+	want = fmt.Sprintf(diffHeaderFmt, backups[0], confPath) + "@@ -1 +1,2 @@\n-shared_buffers = 128MB\n+shared_buffers = 2GB\n+work_mem = 64MB\n"
+	if out != want {
+		t.Errorf("diff: incorrect output: got\n%s\nwant\n%s", out, want)
+	}
+
+	// unknown backup
+	_, outErr, code = runTestCommand(t, append([]string{"backups", "diff", "foo"}, common...)...)
+	if code != 1 || !strings.Contains(outErr, fmt.Sprintf(errBackupNotFoundFmt, "foo", backupDir)) {
+		t.Errorf("diff unknown: incorrect exit: got code %d output\n%s", code, outErr)
+	}
+
+	// prune
+	_, outErr, code = runTestCommand(t, append([]string{"backups", "prune"}, common...)...)
+	if code != 1 || !strings.Contains(outErr, errPruneNoLimits) {
+		t.Errorf("prune without limits: incorrect exit: got code %d output\n%s", code, outErr)
+	}
+	out, _, code = runTestCommand(t, append([]string{"backups", "prune", "--backup-max-age=12h"}, common...)...)
+	if code != 0 {
+		t.Fatalf("prune: unexpected exit code %d", code)
+	}
+	if want := filepath.Base(backups[0]) + "\n"; out != want {
+		t.Errorf("prune: incorrect output: got %s want %s", out, want)
+	}
+	if fileExists(backups[0]) || fileExists(backups[0]+backupMetaSuffix) || !fileExists(backups[1]) {
+		t.Errorf("prune: incorrect backups removed")
+	}
+}
+
+func TestRunCommandRestore(t *testing.T) {
+	confPath, backupDir, backups := setupCommandTest(t)
+	common := []string{"--conf-path=" + confPath, "--backup-dir=" + backupDir, "--color=false"}
+	original, err := os.ReadFile(confPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, outErr, code := runTestCommand(t, append([]string{"restore", "--name", filepath.Base(backups[0])}, common...)...)
+	if code != 0 {
+		t.Fatalf("restore name: unexpected exit code %d:\n%s", code, outErr)
+	}
+	checkFileContents(t, "restore name", confPath, "shared_buffers = 128MB\n")
+	fi, err := os.Stat(confPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fi.Mode().Perm(); got != 0600 {
+		t.Errorf("restore name: mode not kept: got %v", got)
+	}
+
+	// the file that was replaced is now the latest backup, so restoring the
+	// latest undoes the restore
+	files, err := getBackups(backupDir, confPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("restore name: incorrect number of backups: got %d want 3", len(files))
+	}
+	checkFileContents(t, "undo backup", files[2], string(original))
+
+	_, outErr, code = runTestCommand(t, append([]string{"restore", "--latest"}, common...)...)
+	if code != 0 {
+		t.Fatalf("restore latest: unexpected exit code %d:\n%s", code, outErr)
+	}
+	checkFileContents(t, "restore latest", confPath, string(original))
+
+	_, outErr, code = runTestCommand(t, append([]string{"restore", "--name", "foo"}, common...)...)
+	if code != 1 || !strings.Contains(outErr, fmt.Sprintf(errBackupNotFoundFmt, "foo", backupDir)) {
+		t.Errorf("restore unknown: incorrect exit: got code %d output\n%s", code, outErr)
+	}
+	checkFileContents(t, "restore unknown", confPath, string(original))
+}
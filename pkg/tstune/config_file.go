@@ -2,11 +2,15 @@ package tstune
 
 import (
 	"bufio"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
 const (
@@ -23,8 +27,28 @@ const (
 	fileNameAlpine    = "/var/lib/postgresql/data/postgresql.conf"
 
 	errConfigNotFoundFmt = "could not find postgresql.conf at any of these locations:\n%v"
+
+	includeDirective         = "include"
+	includeIfExistsDirective = "include_if_exists"
+	includeDirDirective      = "include_dir"
+
+	// maxIncludeDepth mirrors the nesting limit PostgreSQL itself enforces
+	// when processing include directives.
+	maxIncludeDepth = 10
+
+	errIncludeDepthFmt = "could not open configuration file %s: maximum nesting depth exceeded"
+	errIncludeFmt      = "could not process %s at %s:%d: %v"
+
+	dataDirectoryKey = "data_directory"
 )
 
+// dataDirectoryRegex matches a line setting the data_directory parameter
+var dataDirectoryRegex = keyToRegexQuoted(dataDirectoryKey)
+
+// includeRegex matches the include, include_if_exists, and include_dir
+// directives, with the file or directory name either quoted or bare.
+var includeRegex = regexp.MustCompile(`^\s*(include_dir|include_if_exists|include)(?:\s*=\s*|\s+)(?:'((?:[^']|'')*)'|([^\s'#]+))\s*(?:#.*)?$`)
+
 type truncateWriter interface {
 	io.Writer
 	Seek(int64, int) (int64, error)
@@ -97,6 +121,21 @@ type tunableParseResult struct {
 	key       string
 	value     string
 	extra     string
+	file      string // path of the file the line was parsed from
+	pinned    bool   // whether the trailing comment has pinMarker
+}
+
+// location returns a human readable file:line description of where r was parsed.
+func (r *tunableParseResult) location() string {
+	return fmt.Sprintf("%s:%d", r.file, r.idx+1)
+}
+
+// shouldReplace decides whether a newly parsed result next should take precedence
+// over the previously parsed result prev for the same key. As in PostgreSQL, the
+// last definition wins, but a commented out line is not a definition and so does
+// not override an actual setting.
+func shouldReplace(prev, next *tunableParseResult) bool {
+	return prev == nil || prev.commented || !next.commented
 }
 
 // configLine represents a line in the conf file with some associated metadata
@@ -148,22 +187,66 @@ func getRemoveDuplicatesProcessors(keys []string) []configLineProcessor {
 
 // configFileState represents the postgresql.conf file, including all of its
 // lines, the parsed result of the shared_preload_libraries line, and parse results
-// for parameters we care about tuning
+// for parameters we care about tuning. Files pulled in via include directives
+// are parsed into their own configFileStates and tracked in includes, while the
+// parse results always reflect the effective value across all of the files.
 type configFileState struct {
+	path             string                         // path of the file, empty if not read from disk
 	lines            []*configLine                  // all the lines, to be updated for output
 	sharedLibResult  *sharedLibResult               // parsing result for shared lib line
 	tuneParseResults map[string]*tunableParseResult // mapping of each tunable param to its parsed line result
+	includes         []*configFileState             // included files, in the order they were processed
+	autoConf         *configFileState               // postgresql.auto.conf, applied after everything else
+	dataDirectory    string                         // value of the data_directory setting, if set
+	shadowed         map[string]*tunableParseResult // for postgresql.auto.conf, the results its settings override
+	modified         bool                           // whether any lines were changed since parsing
+	original         []string                       // the lines as they were read, to show what changed
+	snapshot         *fileSnapshot                  // mtime and hash of the file when read, nil if not read from disk
 }
 
 // getConfigFileState returns the current state of the configuration file by
 // reading it line by line and parsing those lines we particularly care about.
 func getConfigFileState(r io.Reader) (*configFileState, error) {
+	return parseConfigFileState(r, "", 0)
+}
+
+// getConfigFileStateWithIncludes is like getConfigFileState, but also records
+// filePath as the origin of r so that relative include directives are resolved
+// against its directory, the same way PostgreSQL resolves them.
+func getConfigFileStateWithIncludes(r io.Reader, filePath string) (*configFileState, error) {
+	return parseConfigFileState(r, filePath, 0)
+}
+
+// readConfigFileState opens and parses the file at filePath, which was included
+// at the given nesting depth.
+func readConfigFileState(filePath string, depth int) (*configFileState, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf(errIncludeDepthFmt, filePath)
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseConfigFileState(f, filePath, depth)
+}
+
+func parseConfigFileState(r io.Reader, filePath string, depth int) (*configFileState, error) {
 	cfs := &configFileState{
+		path:             filePath,
 		lines:            []*configLine{},
 		tuneParseResults: make(map[string]*tunableParseResult),
 	}
+	// stat before reading so that a change made while we read is also caught
+	var modTime time.Time
+	if filePath != "" {
+		if fi, err := os.Stat(filePath); err == nil {
+			modTime = fi.ModTime()
+		}
+	}
+	h := sha256.New()
 	i := 0
-	scanner := bufio.NewScanner(r)
+	scanner := bufio.NewScanner(io.TeeReader(r, h))
 	for scanner.Scan() {
 		if scanner.Err() != nil {
 			return nil, fmt.Errorf("could not read postgresql.conf: %v", scanner.Err())
@@ -172,22 +255,168 @@ func getConfigFileState(r io.Reader) (*configFileState, error) {
 		temp := parseLineForSharedLibResult(line)
 		if temp != nil {
 			temp.idx = i
-			cfs.sharedLibResult = temp
+			temp.file = filePath
+			if cfs.sharedLibResult == nil || cfs.sharedLibResult.commented || !temp.commented {
+				cfs.sharedLibResult = temp
+			}
+		} else if dd := parseWithRegex(line, dataDirectoryRegex); dd != nil {
+			if !dd.commented {
+				cfs.dataDirectory = dd.value
+			}
+		} else if directive, target := parseLineForInclude(line); directive != "" {
+			included, err := resolveInclude(directive, target, filePath, depth)
+			if err != nil {
+				return nil, fmt.Errorf(errIncludeFmt, directive, filePath, i+1, err)
+			}
+			for _, inc := range included {
+				cfs.mergeInclude(inc)
+			}
 		} else {
 			for k, regex := range regexes {
 				tpr := parseWithRegex(line, regex)
 				if tpr != nil {
 					tpr.idx = i
-					cfs.tuneParseResults[k] = tpr
+					tpr.file = filePath
+					if shouldReplace(cfs.tuneParseResults[k], tpr) {
+						cfs.tuneParseResults[k] = tpr
+					}
 				}
 			}
 		}
 		cfs.lines = append(cfs.lines, &configLine{content: line})
+		cfs.original = append(cfs.original, line)
 		i++
 	}
+	if !modTime.IsZero() {
+		cfs.snapshot = &fileSnapshot{modTime: modTime}
+		copy(cfs.snapshot.sum[:], h.Sum(nil))
+	}
 	return cfs, nil
 }
 
+// parseLineForInclude returns the directive and its target if line is an
+// include, include_if_exists, or include_dir directive; otherwise it returns
+// empty strings.
+func parseLineForInclude(line string) (string, string) {
+	res := includeRegex.FindStringSubmatch(line)
+	if len(res) == 0 {
+		return "", ""
+	}
+	target := res[3]
+	if res[2] != "" {
+		target = strings.ReplaceAll(res[2], "''", "'")
+	}
+	return res[1], target
+}
+
+// resolveInclude parses the file(s) referred to by an include directive found
+// in the file at fromPath. Relative targets are relative to the directory
+// containing fromPath. For include_dir, every file ending in .conf that does not
+// start with a '.' is included, in file name order.
+func resolveInclude(directive, target, fromPath string, depth int) ([]*configFileState, error) {
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(fromPath), target)
+	}
+
+	paths := []string{target}
+	switch directive {
+	case includeIfExistsDirective:
+		if !fileExists(target) {
+			return nil, nil
+		}
+	case includeDirDirective:
+		entries, err := os.ReadDir(target)
+		if err != nil {
+			return nil, err
+		}
+		paths = paths[:0]
+		for _, e := range entries {
+			name := e.Name()
+			if e.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".conf") {
+				continue
+			}
+			paths = append(paths, filepath.Join(target, name))
+		}
+		sort.Strings(paths)
+	}
+
+	ret := []*configFileState{}
+	for _, p := range paths {
+		inc, err := readConfigFileState(p, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, inc)
+	}
+	return ret, nil
+}
+
+// mergeInclude folds the state of an included file (and anything it included
+// in turn) into cfs, at the point in cfs where the directive was found.
+func (cfs *configFileState) mergeInclude(inc *configFileState) {
+	cfs.includes = append(cfs.includes, inc)
+	cfs.includes = append(cfs.includes, inc.includes...)
+	inc.includes = nil
+	if inc.dataDirectory != "" {
+		cfs.dataDirectory = inc.dataDirectory
+	}
+
+	if res := inc.sharedLibResult; res != nil {
+		if cfs.sharedLibResult == nil || cfs.sharedLibResult.commented || !res.commented {
+			cfs.sharedLibResult = res
+		}
+	}
+	for k, tpr := range inc.tuneParseResults {
+		if shouldReplace(cfs.tuneParseResults[k], tpr) {
+			cfs.tuneParseResults[k] = tpr
+		}
+	}
+}
+
+// fileFor returns the state of the file at filePath, which is either cfs itself,
+// one of the files it includes, or its postgresql.auto.conf. Unknown paths
+// resolve to cfs.
+func (cfs *configFileState) fileFor(filePath string) *configFileState {
+	if cfs.isAutoConf(filePath) {
+		return cfs.autoConf
+	}
+	for _, inc := range cfs.includes {
+		if inc.path == filePath && filePath != cfs.path {
+			return inc
+		}
+	}
+	return cfs
+}
+
+// setLine replaces the content of the line at idx in the file at filePath.
+func (cfs *configFileState) setLine(filePath string, idx int, content string) {
+	f := cfs.fileFor(filePath)
+	f.lines[idx] = &configLine{content: content}
+	f.modified = true
+}
+
+// removeLine marks the line at idx in the file at filePath to be removed on output.
+func (cfs *configFileState) removeLine(filePath string, idx int) {
+	f := cfs.fileFor(filePath)
+	f.lines[idx].remove = true
+	f.modified = true
+}
+
+// modifiedIncludes returns the included files, including postgresql.auto.conf,
+// that have had lines changed and therefore need to be written back out.
+func (cfs *configFileState) modifiedIncludes() []*configFileState {
+	ret := []*configFileState{}
+	for _, inc := range cfs.includes {
+		if inc.modified {
+			ret = append(ret, inc)
+		}
+	}
+	if cfs.autoConf != nil && cfs.autoConf.modified {
+		ret = append(ret, cfs.autoConf)
+	}
+	return ret
+}
+
 func (cfs *configFileState) ProcessLines(processors ...configLineProcessor) error {
 	var err error
 	for _, line := range cfs.lines {
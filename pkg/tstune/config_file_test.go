@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -293,6 +294,25 @@ func TestGetConfigFileState(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc:  "commented line does not override setting",
+			lines: []string{"shared_buffers = 1GB", memoryLine},
+			want: &configFileState{
+				lines: []*configLine{
+					{content: "shared_buffers = 1GB"},
+					{content: memoryLine},
+				},
+				tuneParseResults: map[string]*tunableParseResult{
+					pgtune.SharedBuffersKey: {
+						idx:       0,
+						commented: false,
+						key:       pgtune.SharedBuffersKey,
+						value:     "1GB",
+						extra:     "",
+					},
+				},
+			},
+		},
 	}
 
 	for _, c := range cases {
@@ -542,3 +562,195 @@ func TestConfigFileStateWriteTo(t *testing.T) {
 		}
 	}
 }
+
+func TestParseLineForInclude(t *testing.T) {
+	cases := []struct {
+		desc          string
+		line          string
+		wantDirective string
+		wantTarget    string
+	}{
+		{
+			desc: "not an include",
+			line: "shared_buffers = 128MB",
+		},
+		{
+			desc: "commented include",
+			line: "#include 'foo.conf'",
+		},
+		{
+			desc:          "include quoted",
+			line:          "include 'foo.conf'",
+			wantDirective: includeDirective,
+			wantTarget:    "foo.conf",
+		},
+		{
+			desc:          "include with equals and comment",
+			line:          "  include = 'foo.conf' # extra",
+			wantDirective: includeDirective,
+			wantTarget:    "foo.conf",
+		},
+		{
+			desc:          "include_if_exists bare",
+			line:          "include_if_exists foo.conf",
+			wantDirective: includeIfExistsDirective,
+			wantTarget:    "foo.conf",
+		},
+		{
+			desc:          "include_dir with escaped quote",
+			line:          "include_dir = 'conf''d'",
+			wantDirective: includeDirDirective,
+			wantTarget:    "conf'd",
+		},
+		{
+			desc: "similar but different key",
+			line: "include_dirs = 'conf.d'",
+		},
+	}
+
+	for _, c := range cases {
+		directive, target := parseLineForInclude(c.line)
+		if directive != c.wantDirective {
+			t.Errorf("%s: incorrect directive: got %q want %q", c.desc, directive, c.wantDirective)
+		}
+		if target != c.wantTarget {
+			t.Errorf("%s: incorrect target: got %q want %q", c.desc, target, c.wantTarget)
+		}
+	}
+}
+
+func writeTestConfFile(t *testing.T, filePath string, lines ...string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(filePath), 0755)
+	if err != nil {
+		t.Fatalf("could not create dir: %v", err)
+	}
+	err = os.WriteFile(filePath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatalf("could not write file: %v", err)
+	}
+}
+
+func TestGetConfigFileStateWithIncludes(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := filepath.Join(dir, "postgresql.conf")
+	writeTestConfFile(t, filepath.Join(dir, "conf.d", "01-memory.conf"),
+		"shared_buffers = 1GB",
+		"work_mem = 8MB",
+	)
+	writeTestConfFile(t, filepath.Join(dir, "conf.d", "02-memory.conf"),
+		"work_mem = 16MB",
+		"#shared_buffers = 4GB",
+	)
+	writeTestConfFile(t, filepath.Join(dir, "conf.d", ".hidden.conf"), "work_mem = 1MB")
+	writeTestConfFile(t, filepath.Join(dir, "conf.d", "ignored.txt"), "work_mem = 2MB")
+	writeTestConfFile(t, filepath.Join(dir, "libs.conf"), "shared_preload_libraries = 'timescaledb'")
+	lines := []string{
+		"#shared_preload_libraries = ''",
+		"shared_buffers = 128MB",
+		"min_wal_size = 80MB",
+		"include 'libs.conf'",
+		"include_if_exists 'missing.conf'",
+		"include_dir 'conf.d'",
+		"min_wal_size = 1GB",
+	}
+	writeTestConfFile(t, mainPath, lines...)
+
+	f, err := os.Open(mainPath)
+	if err != nil {
+		t.Fatalf("could not open: %v", err)
+	}
+	defer f.Close()
+	cfs, err := getConfigFileStateWithIncludes(f, mainPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := len(cfs.lines); got != len(lines) {
+		t.Errorf("incorrect number of lines: got %d want %d", got, len(lines))
+	}
+	if got := len(cfs.includes); got != 3 {
+		t.Fatalf("incorrect number of includes: got %d want %d", got, 3)
+	}
+	wantIncludes := []string{"libs.conf", "conf.d/01-memory.conf", "conf.d/02-memory.conf"}
+	for i, want := range wantIncludes {
+		if got := cfs.includes[i].path; got != filepath.Join(dir, want) {
+			t.Errorf("incorrect include at %d: got %s want %s", i, got, filepath.Join(dir, want))
+		}
+	}
+
+	wants := map[string]struct {
+		value string
+		file  string
+		idx   int
+	}{
+		pgtune.SharedBuffersKey: {"1GB", "conf.d/01-memory.conf", 0},
+		pgtune.WorkMemKey:       {"16MB", "conf.d/02-memory.conf", 0},
+		pgtune.MinWALKey:        {"1GB", "postgresql.conf", 6},
+	}
+	for k, want := range wants {
+		got, ok := cfs.tuneParseResults[k]
+		if !ok {
+			t.Errorf("missing parse result for %s", k)
+			continue
+		}
+		if got.value != want.value || got.file != filepath.Join(dir, want.file) || got.idx != want.idx {
+			t.Errorf("incorrect parse result for %s: got %s (%s) want %s (%s:%d)", k, got.value, got.location(), want.value, want.file, want.idx+1)
+		}
+	}
+
+	if cfs.sharedLibResult == nil {
+		t.Fatalf("missing shared lib result")
+	}
+	if got := cfs.sharedLibResult.file; got != filepath.Join(dir, "libs.conf") {
+		t.Errorf("incorrect shared lib file: got %s", got)
+	}
+	if !cfs.sharedLibResult.hasTimescale {
+		t.Errorf("shared lib result does not have timescaledb")
+	}
+
+	// Changing a setting in an included file should mark only that file modified
+	r := cfs.tuneParseResults[pgtune.WorkMemKey]
+	cfs.setLine(r.file, r.idx, "work_mem = 64MB")
+	if cfs.modified {
+		t.Errorf("main file incorrectly marked modified")
+	}
+	modified := cfs.modifiedIncludes()
+	if len(modified) != 1 || modified[0].path != r.file {
+		t.Errorf("incorrect modified includes: %v", modified)
+	} else if got := modified[0].lines[0].content; got != "work_mem = 64MB" {
+		t.Errorf("incorrect modified line: got %s", got)
+	}
+}
+
+func TestGetConfigFileStateWithIncludesErr(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := filepath.Join(dir, "postgresql.conf")
+	loopPath := filepath.Join(dir, "loop.conf")
+	writeTestConfFile(t, loopPath, "include 'loop.conf'")
+
+	cases := []struct {
+		desc  string
+		lines []string
+	}{
+		{
+			desc:  "missing include",
+			lines: []string{"include 'missing.conf'"},
+		},
+		{
+			desc:  "missing include_dir",
+			lines: []string{"include_dir 'missing.d'"},
+		},
+		{
+			desc:  "include loop",
+			lines: []string{"include 'loop.conf'"},
+		},
+	}
+
+	for _, c := range cases {
+		_, err := getConfigFileStateWithIncludes(stringSliceToBytesReader(c.lines), mainPath)
+		if err == nil {
+			t.Errorf("%s: unexpected lack of error", c.desc)
+		}
+	}
+}
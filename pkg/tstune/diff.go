@@ -0,0 +1,278 @@
+package tstune
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	diffContextLines = 3
+
+	errDiffConflictFmt = "--diff cannot be used with %s"
+	errDiffStdout      = "cannot write both the report and the diff to stdout"
+	errDiffFileOutside = "--diff-file cannot be used when %s would be changed, since it is outside %s and patch -p0 only applies changes inside the directory it is run from"
+	statementDiffFile  = "Writing patch to: "
+	successDiffEmpty   = "no changes to the configuration files"
+	diffHeaderFmt      = "--- %s\n+++ %s\n"
+	diffHunkHeaderFmt  = "@@ -%s +%s @@\n"
+)
+
+// validateDiffFlags returns an error if --diff is combined with flags that do
+// something other than editing the conf file.
+func validateDiffFlags(flags *TunerFlags) error {
+	if !flags.Diff {
+		return nil
+	}
+	switch {
+	case flags.Restore:
+		return fmt.Errorf(errDiffConflictFmt, "--restore")
+	case flags.Check:
+		return fmt.Errorf(errDiffConflictFmt, "--check")
+	case flags.SQLPath != "":
+		return fmt.Errorf(errDiffConflictFmt, "--sql-script")
+	case flags.Format != "" && flags.Format != formatText:
+		return fmt.Errorf(errDiffStdout)
+	}
+	return nil
+}
+
+// diffOp is a single line of an edit script turning one list of lines into
+// another: kept (' '), removed ('-'), or added ('+').
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines returns the shortest edit script that turns a into b, found using
+// the longest common subsequence of their lines.
+func diffLines(a, b []string) []diffOp {
+	// lines that are the same at the start and end need no work, and conf
+	// files mostly stay the same
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+
+	// lcs[i][j] is the length of the longest common subsequence of midA[i:]
+	// and midB[j:]
+	lcs := make([][]int, len(midA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	i, j := 0, 0
+	for i < len(midA) || j < len(midB) {
+		switch {
+		case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+			ops = append(ops, diffOp{' ', midA[i]})
+			i++
+			j++
+		case j == len(midB) || (i < len(midA) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', midA[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', midB[j]})
+			j++
+		}
+	}
+	for _, l := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	return ops
+}
+
+// diffRange formats the start line and length of one side of a hunk the same
+// way diff -u does.
+func diffRange(start, count int) string {
+	switch count {
+	case 0:
+		// an empty range refers to the line before it
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprintf("%d", start)
+	default:
+		return fmt.Sprintf("%d,%d", start, count)
+	}
+}
+
+// unifiedDiff returns the unified diff between lines a of the file oldName and
+// lines b of newName, or "" if they are the same.
+func unifiedDiff(oldName, newName string, a, b []string) string {
+	ops := diffLines(a, b)
+	changed := []int{}
+	for idx, op := range ops {
+		if op.kind != ' ' {
+			changed = append(changed, idx)
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, diffHeaderFmt, oldName, newName)
+
+	// line numbers (1-based) in a and b where each op is found
+	aLine := make([]int, len(ops)+1)
+	bLine := make([]int, len(ops)+1)
+	aLine[0], bLine[0] = 1, 1
+	for idx, op := range ops {
+		aLine[idx+1], bLine[idx+1] = aLine[idx], bLine[idx]
+		if op.kind != '+' {
+			aLine[idx+1]++
+		}
+		if op.kind != '-' {
+			bLine[idx+1]++
+		}
+	}
+
+	// group changes that are close enough to share context into hunks
+	for k := 0; k < len(changed); {
+		start := changed[k] - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		end := changed[k]
+		for k < len(changed) && changed[k]-end-1 <= 2*diffContextLines {
+			end = changed[k]
+			k++
+		}
+		end += diffContextLines + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		aCount, bCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(sb, diffHunkHeaderFmt, diffRange(aLine[start], aCount), diffRange(bLine[start], bCount))
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// outputLines returns the lines of cfs as they would be written out.
+func (cfs *configFileState) outputLines() []string {
+	ret := []string{}
+	for _, l := range cfs.lines {
+		if !l.remove {
+			ret = append(ret, l.content)
+		}
+	}
+	return ret
+}
+
+// diffName returns the name to use for the file at filePath in a diff. patch
+// refuses to apply changes to absolute paths or paths going through "..", so
+// names are made relative to baseDir when possible; the diff is then applied
+// from that directory with `patch -p0`. Files outside baseDir keep their
+// absolute path, and false is returned for them, since patch cannot apply
+// changes to them.
+func diffName(baseDir, filePath string) (string, bool) {
+	abs, err := filepathAbsFn(filePath)
+	if err != nil {
+		return filePath, false
+	}
+	rel, err := filepath.Rel(baseDir, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return abs, false
+	}
+	return rel, true
+}
+
+// diffBaseDir returns the absolute path of the directory of the main conf
+// file, which file names in diffs are relative to.
+func (cfs *configFileState) diffBaseDir() string {
+	if abs, err := filepathAbsFn(cfs.path); err == nil {
+		return filepath.Dir(abs)
+	}
+	return filepath.Dir(cfs.path)
+}
+
+// diff returns the unified diff of every file that writing out cfs would
+// change, starting with the main conf file, along with the paths of those
+// outside the directory of the main conf file. File names are relative to
+// that directory.
+func (cfs *configFileState) diff() (string, []string) {
+	baseDir := cfs.diffBaseDir()
+	sb := &strings.Builder{}
+	outside := []string{}
+	files := append([]*configFileState{cfs}, cfs.modifiedIncludes()...)
+	for _, f := range files {
+		name, ok := diffName(baseDir, f.path)
+		d := unifiedDiff(name, name, f.original, f.outputLines())
+		if d != "" && !ok {
+			outside = append(outside, name)
+		}
+		sb.WriteString(d)
+	}
+	return sb.String(), outside
+}
+
+// writeDiff writes the changes that would be made to the conf files as a
+// unified diff to stdout, and also to the patch file at outPath if given. The
+// patch file is refused if it would change files that `patch -p0` cannot
+// apply it to.
+func (t *Tuner) writeDiff(outPath string, stdout io.Writer) error {
+	d, outside := t.cfs.diff()
+	if d == "" {
+		t.handler.p.Success(successDiffEmpty)
+		return nil
+	}
+	if outPath != "" && len(outside) > 0 {
+		return fmt.Errorf(errDiffFileOutside, outside[0], t.cfs.diffBaseDir())
+	}
+	_, err := io.WriteString(stdout, d)
+	if err != nil {
+		return err
+	}
+	if outPath == "" {
+		return nil
+	}
+
+	t.handler.p.Statement(statementDiffFile + outPath)
+	f, err := osCreateFn(outPath)
+	if err != nil {
+		return fmt.Errorf(errCouldNotWriteFmt, outPath, err)
+	}
+	defer f.Close()
+
+	_, err = io.WriteString(f, d)
+	if err != nil {
+		return fmt.Errorf(errCouldNotWriteFmt, outPath, err)
+	}
+	return nil
+}
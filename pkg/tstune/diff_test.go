@@ -0,0 +1,375 @@
+package tstune
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateDiffFlags(t *testing.T) {
+	cases := []struct {
+		desc   string
+		flags  *TunerFlags
+		errMsg string
+	}{
+		{
+			desc:  "not diffing",
+			flags: &TunerFlags{Restore: true, Check: true, SQLPath: "-", Format: formatJSON},
+		},
+		{
+			desc:  "diffing",
+			flags: &TunerFlags{Diff: true, Quiet: true, Format: formatText},
+		},
+		{
+			desc:   "diffing with restore",
+			flags:  &TunerFlags{Diff: true, Restore: true},
+			errMsg: fmt.Sprintf(errDiffConflictFmt, "--restore"),
+		},
+		{
+			desc:   "diffing with check",
+			flags:  &TunerFlags{Diff: true, Check: true},
+			errMsg: fmt.Sprintf(errDiffConflictFmt, "--check"),
+		},
+		{
+			desc:   "diffing with sql script",
+			flags:  &TunerFlags{Diff: true, SQLPath: "out.sql"},
+			errMsg: fmt.Sprintf(errDiffConflictFmt, "--sql-script"),
+		},
+		{
+			desc:   "diffing with report",
+			flags:  &TunerFlags{Diff: true, Format: formatYAML},
+			errMsg: errDiffStdout,
+		},
+	}
+
+	for _, c := range cases {
+		err := validateDiffFlags(c.flags)
+		if c.errMsg == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if c.errMsg != "" {
+			if err == nil {
+				t.Errorf("%s: unexpected lack of error", c.desc)
+			} else if got := err.Error(); got != c.errMsg {
+				t.Errorf("%s: incorrect error: got %s want %s", c.desc, got, c.errMsg)
+			}
+		}
+	}
+}
+
+func TestVerifyTunerFlagsDiff(t *testing.T) {
+	flags, _ := verifyTunerFlags(&TunerFlags{DiffPath: "tune.patch"})
+	if !flags.Diff || !flags.DryRun {
+		t.Errorf("--diff-file did not imply --diff and --dry-run: got diff %v dry-run %v", flags.Diff, flags.DryRun)
+	}
+	flags, _ = verifyTunerFlags(&TunerFlags{Diff: true})
+	if !flags.DryRun {
+		t.Errorf("--diff did not imply --dry-run")
+	}
+	flags, _ = verifyTunerFlags(&TunerFlags{})
+	if flags.Diff || flags.DryRun {
+		t.Errorf("unexpected diff or dry-run: got diff %v dry-run %v", flags.Diff, flags.DryRun)
+	}
+}
+
+func TestDiffRange(t *testing.T) {
+	cases := []struct {
+		start int
+		count int
+		want  string
+	}{
+		{start: 1, count: 0, want: "0,0"},
+		{start: 5, count: 0, want: "4,0"},
+		{start: 5, count: 1, want: "5"},
+		{start: 5, count: 7, want: "5,7"},
+	}
+	for _, c := range cases {
+		if got := diffRange(c.start, c.count); got != c.want {
+			t.Errorf("incorrect range for %d,%d: got %s want %s", c.start, c.count, got, c.want)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	numbered := func(n int) []string {
+		ret := []string{}
+		for i := 1; i <= n; i++ {
+			ret = append(ret, fmt.Sprintf("line%d", i))
+		}
+		return ret
+	}
+	replace := func(lines []string, idx int, line string) []string {
+		ret := append([]string{}, lines...)
+		ret[idx] = line
+		return ret
+	}
+	header := fmt.Sprintf(diffHeaderFmt, "a.conf", "a.conf")
+
+	cases := []struct {
+		desc string
+		a    []string
+		b    []string
+		want string
+	}{
+		{
+			desc: "no changes",
+			a:    numbered(3),
+			b:    numbered(3),
+			want: "",
+		},
+		{
+			desc: "both empty",
+			a:    []string{},
+			b:    []string{},
+			want: "",
+		},
+		{
+			desc: "empty file",
+			a:    []string{},
+			b:    []string{"foo = 1"},
+			want: header + "@@ -0,0 +1 @@\n+foo = 1\n",
+		},
+		{
+			desc: "changed line with context",
+			a:    numbered(10),
+			b:    replace(numbered(10), 4, "changed"),
+			want: header + "@@ -2,7 +2,7 @@\n line2\n line3\n line4\n-line5\n+changed\n line6\n line7\n line8\n",
+		},
+		{
+			desc: "appended lines",
+			a:    numbered(5),
+			b:    append(numbered(5), "foo = 1", "bar = 2"),
+			want: header + "@@ -3,3 +3,5 @@\n line3\n line4\n line5\n+foo = 1\n+bar = 2\n",
+		},
+		{
+			desc: "removed line",
+			a:    numbered(3),
+			b:    []string{"line1", "line3"},
+			want: header + "@@ -1,3 +1,2 @@\n line1\n-line2\n line3\n",
+		},
+		{
+			desc: "close changes share a hunk",
+			a:    numbered(12),
+			b:    replace(replace(numbered(12), 1, "x"), 8, "y"),
+			want: header + "@@ -1,12 +1,12 @@\n line1\n-line2\n+x\n line3\n line4\n line5\n line6\n line7\n line8\n-line9\n+y\n line10\n line11\n line12\n",
+		},
+		{
+			desc: "far apart changes get their own hunks",
+			a:    numbered(12),
+			b:    replace(replace(numbered(12), 0, "x"), 11, "y"),
+			want: header + "@@ -1,4 +1,4 @@\n-line1\n+x\n line2\n line3\n line4\n" +
+				"@@ -9,4 +9,4 @@\n line9\n line10\n line11\n-line12\n+y\n",
+		},
+	}
+
+	for _, c := range cases {
+		if got := unifiedDiff("a.conf", "a.conf", c.a, c.b); got != c.want {
+			t.Errorf("%s: incorrect diff: got\n%s\nwant\n%s", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestDiffName(t *testing.T) {
+	oldFilepathAbsFn := filepathAbsFn
+	defer func() { filepathAbsFn = oldFilepathAbsFn }()
+	filepathAbsFn = func(p string) (string, error) {
+		if filepath.IsAbs(p) {
+			return p, nil
+		}
+		return filepath.Join("/etc/postgresql", p), nil
+	}
+
+	cases := []struct {
+		filePath string
+		want     string
+		wantOK   bool
+	}{
+		{"/etc/postgresql/postgresql.conf", "postgresql.conf", true},
+		{"postgresql.conf", "postgresql.conf", true},
+		{"/etc/postgresql/conf.d/memory.conf", filepath.Join("conf.d", "memory.conf"), true},
+		{"/var/lib/postgresql/postgresql.auto.conf", "/var/lib/postgresql/postgresql.auto.conf", false},
+		{"/etc/postgresql-common/common.conf", "/etc/postgresql-common/common.conf", false},
+	}
+	for _, c := range cases {
+		got, ok := diffName("/etc/postgresql", c.filePath)
+		if got != c.want || ok != c.wantOK {
+			t.Errorf("incorrect name for %s: got %s %v want %s %v", c.filePath, got, ok, c.want, c.wantOK)
+		}
+	}
+}
+
+func TestConfigFileStateDiff(t *testing.T) {
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "postgresql.conf")
+	incPath := filepath.Join(dir, "conf.d", "memory.conf")
+	if err := os.MkdirAll(filepath.Dir(incPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(incPath, []byte("work_mem = 4MB # small\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lines := []string{"shared_buffers = 128MB", "include_dir = 'conf.d'", lastTunedParam + " = 'old'", lastTunedParam + " = 'old'"}
+	if err := os.WriteFile(confPath, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(confPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfs, err := getConfigFileStateWithIncludes(f, confPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := cfs.diff(); got != "" {
+		t.Errorf("unexpected diff before changes:\n%s", got)
+	}
+
+	cfs.setLine(confPath, 0, "shared_buffers = 2GB")
+	cfs.lines = append(cfs.lines, &configLine{content: "max_wal_size = 1GB"})
+	cfs.ProcessLines(getRemoveDuplicatesProcessors([]string{lastTunedParam})...)
+	cfs.setLine(incPath, 0, "work_mem = 64MB # small")
+
+	want := fmt.Sprintf(diffHeaderFmt, "postgresql.conf", "postgresql.conf") +
+		"@@ -1,4 +1,4 @@\n" +
+		"-shared_buffers = 128MB\n" +
+		"+shared_buffers = 2GB\n" +
+		" include_dir = 'conf.d'\n" +
+		" " + lastTunedParam + " = 'old'\n" +
+		"-" + lastTunedParam + " = 'old'\n" +
+		"+max_wal_size = 1GB\n" +
+		fmt.Sprintf(diffHeaderFmt, filepath.Join("conf.d", "memory.conf"), filepath.Join("conf.d", "memory.conf")) +
+		"@@ -1 +1 @@\n" +
+		"-work_mem = 4MB # small\n" +
+		"+work_mem = 64MB # small\n"
+	got, outside := cfs.diff()
+	if got != want {
+		t.Errorf("incorrect diff: got\n%s\nwant\n%s", got, want)
+	}
+	if len(outside) != 0 {
+		t.Errorf("unexpected files outside the conf directory: %v", outside)
+	}
+}
+
+func TestTunerWriteDiff(t *testing.T) {
+	wantPath := "tune.patch"
+	errCreate := "could not create"
+	oldOSCreateFn := osCreateFn
+	defer func() { osCreateFn = oldOSCreateFn }()
+
+	// nothing changed
+	tuner := newTunerWithDefaultFlagsForInputs(t, "", []string{"foo = 1"})
+	stdout := &testWriter{}
+	if err := tuner.writeDiff(wantPath, stdout); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stdout.lines) != 0 {
+		t.Errorf("unexpected output: %v", stdout.lines)
+	}
+	tp := tuner.handler.p.(*testPrinter)
+	if len(tp.successes) != 1 || tp.successes[0] != successDiffEmpty {
+		t.Errorf("incorrect successes: got %v want %s", tp.successes, successDiffEmpty)
+	}
+
+	// stdout only
+	tuner.cfs.lines = append(tuner.cfs.lines, &configLine{content: "bar = 2"})
+	if err := tuner.writeDiff("", stdout); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want, _ := tuner.cfs.diff()
+	if got := strings.Join(stdout.lines, ""); got != want {
+		t.Errorf("incorrect stdout: got\n%s\nwant\n%s", got, want)
+	}
+
+	// file
+	var buf testBufferCloser
+	osCreateFn = func(p string) (io.WriteCloser, error) {
+		if p != wantPath {
+			return nil, fmt.Errorf(errCreate)
+		}
+		return &buf, nil
+	}
+	if err := tuner.writeDiff(wantPath, &testWriter{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := buf.b.String(); got != want {
+		t.Errorf("incorrect patch file: got\n%s\nwant\n%s", got, want)
+	}
+
+	// create error
+	err := tuner.writeDiff("other.patch", &testWriter{})
+	wantErr := fmt.Sprintf(errCouldNotWriteFmt, "other.patch", errCreate)
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("incorrect error: got %v want %s", err, wantErr)
+	}
+
+	// write error
+	buf.shouldErr = true
+	err = tuner.writeDiff(wantPath, &testWriter{})
+	wantErr = fmt.Sprintf(errCouldNotWriteFmt, wantPath, errTestWriter)
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("incorrect error: got %v want %s", err, wantErr)
+	}
+}
+
+func TestTunerWriteDiffIncludeOutside(t *testing.T) {
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "main")
+	confPath := filepath.Join(confDir, "postgresql.conf")
+	incPath := filepath.Join(dir, "common", "memory.conf")
+	for _, d := range []string{confDir, filepath.Dir(incPath)} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(incPath, []byte("work_mem = 4MB\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(confPath, []byte("include = '"+incPath+"'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(confPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfs, err := getConfigFileStateWithIncludes(f, confPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfs.setLine(incPath, 0, "work_mem = 64MB")
+
+	oldOSCreateFn := osCreateFn
+	defer func() { osCreateFn = oldOSCreateFn }()
+	osCreateFn = func(p string) (io.WriteCloser, error) {
+		t.Errorf("unexpected patch file created: %s", p)
+		return &testBufferCloser{}, nil
+	}
+
+	tuner := newTunerWithDefaultFlags(setupDefaultTestIO(""), cfs)
+	d, outside := cfs.diff()
+	if len(outside) != 1 || outside[0] != incPath {
+		t.Errorf("incorrect files outside the conf directory: got %v want %s", outside, incPath)
+	}
+	if !strings.Contains(d, fmt.Sprintf(diffHeaderFmt, incPath, incPath)) {
+		t.Errorf("diff missing absolute name of %s:\n%s", incPath, d)
+	}
+
+	// the diff can still be shown, but not saved as a patch
+	stdout := &testWriter{}
+	if err := tuner.writeDiff("", stdout); err != nil {
+		t.Errorf("unexpected error without patch file: %v", err)
+	}
+	stdout = &testWriter{}
+	err = tuner.writeDiff("tune.patch", stdout)
+	wantErr := fmt.Sprintf(errDiffFileOutside, incPath, confDir)
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("incorrect error: got %v want %s", err, wantErr)
+	}
+	if len(stdout.lines) != 0 {
+		t.Errorf("unexpected output: %v", stdout.lines)
+	}
+}
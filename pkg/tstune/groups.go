@@ -0,0 +1,231 @@
+package tstune
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+const (
+	// groupsDefault stands for all of tunableLabels in --groups
+	groupsDefault = "default"
+
+	errUnknownGroupFmt = "unknown settings group %q: valid groups are %s"
+	errNoGroupsLeft    = "no settings groups left to tune after --skip-groups"
+	errUnknownKeyFmt   = "unknown setting %q in %s: not in any settings group"
+	errKeyNotTunedFmt  = "setting %q in --keys is in the %s settings group, which is not being tuned"
+	errNoKeysLeft      = "no settings left to tune after --keys and --skip-keys"
+)
+
+// optionalLabels are the labels of the settings groups that are only tuned
+// when asked for with --groups
+var optionalLabels = []string{
+	pgtune.LoggingLabel,
+}
+
+// ValidGroups are the names that --groups accepts.
+var ValidGroups = append(append([]string{groupsDefault}, tunableLabels...), optionalLabels...)
+
+// parseGroups returns the labels of the settings groups listed in s, which is
+// a comma-separated list of labels, in the order they are processed. Labels
+// are matched regardless of case, and "default" stands for every group that is
+// tuned when s is blank.
+func parseGroups(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return tunableLabels, nil
+	}
+	want := map[string]bool{}
+	for _, g := range strings.Split(s, ",") {
+		g = strings.TrimSpace(g)
+		if strings.EqualFold(g, groupsDefault) {
+			for _, label := range tunableLabels {
+				want[label] = true
+			}
+			continue
+		}
+		found := false
+		for _, label := range ValidGroups[1:] {
+			if strings.EqualFold(g, label) {
+				want[label] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf(errUnknownGroupFmt, g, strings.Join(ValidGroups, ", "))
+		}
+	}
+	labels := []string{}
+	for _, label := range ValidGroups[1:] {
+		if want[label] {
+			labels = append(labels, label)
+		}
+	}
+	return labels, nil
+}
+
+// selectGroups returns the labels of the settings groups listed in groups, as
+// parsed by parseGroups, less those listed in skip. It is an error for none to
+// be left.
+func selectGroups(groups, skip string) ([]string, error) {
+	labels, err := parseGroups(groups)
+	if err != nil || strings.TrimSpace(skip) == "" {
+		return labels, err
+	}
+	skipped, err := parseGroups(skip)
+	if err != nil {
+		return nil, err
+	}
+	left := []string{}
+	for _, label := range labels {
+		if !isIn(label, skipped) {
+			left = append(left, label)
+		}
+	}
+	if len(left) == 0 {
+		return nil, fmt.Errorf(errNoGroupsLeft)
+	}
+	return left, nil
+}
+
+// splitKeys returns the keys in s, a comma-separated list of settings.
+func splitKeys(s string) []string {
+	keys := []string{}
+	if strings.TrimSpace(s) == "" {
+		return keys
+	}
+	for _, k := range strings.Split(s, ",") {
+		keys = append(keys, strings.TrimSpace(k))
+	}
+	return keys
+}
+
+// selectKeys narrows the settings groups being tuned down to the settings
+// listed in --keys, if any, less those listed in --skip-keys. Keys are checked
+// against those of the settings groups for config, so this must be done once
+// config is complete. Groups left with no settings to tune are not tuned.
+func (t *Tuner) selectKeys(config *pgtune.SystemConfig) error {
+	keys := splitKeys(t.flags.Keys)
+	skip := splitKeys(t.flags.SkipKeys)
+	if len(keys) == 0 && len(skip) == 0 {
+		return nil
+	}
+
+	groupOf := make(map[string]string)
+	for _, label := range ValidGroups[1:] {
+		sg, err := pgtune.GetSettingsGroup(label, config)
+		if err != nil {
+			return err
+		}
+		for _, k := range sg.Keys() {
+			groupOf[k] = label
+		}
+	}
+	for _, k := range keys {
+		label, ok := groupOf[k]
+		if !ok {
+			return fmt.Errorf(errUnknownKeyFmt, k, "--keys")
+		}
+		if !isIn(label, t.tunedLabels()) {
+			return fmt.Errorf(errKeyNotTunedFmt, k, label)
+		}
+	}
+	for _, k := range skip {
+		if _, ok := groupOf[k]; !ok {
+			return fmt.Errorf(errUnknownKeyFmt, k, "--skip-keys")
+		}
+	}
+
+	labels := []string{}
+	t.keys = make(map[string][]string)
+	for _, label := range t.tunedLabels() {
+		sg, err := pgtune.GetSettingsGroup(label, config)
+		if err != nil {
+			return err
+		}
+		left := []string{}
+		for _, k := range sg.Keys() {
+			if (len(keys) == 0 || isIn(k, keys)) && !isIn(k, skip) {
+				left = append(left, k)
+			}
+		}
+		if len(left) > 0 {
+			labels = append(labels, label)
+			t.keys[label] = left
+		}
+	}
+	if len(labels) == 0 {
+		return fmt.Errorf(errNoKeysLeft)
+	}
+	t.groups = labels
+	return nil
+}
+
+// keysSettingsGroup is a SettingsGroup whose keys are only those selected by
+// --keys and --skip-keys.
+type keysSettingsGroup struct {
+	pgtune.SettingsGroup
+	keys []string
+}
+
+func (sg *keysSettingsGroup) Keys() []string { return sg.keys }
+
+// tunedLabels returns the labels of the settings groups being tuned.
+func (t *Tuner) tunedLabels() []string {
+	if t.groups == nil {
+		return tunableLabels
+	}
+	return t.groups
+}
+
+// tunesKey returns whether key, of the settings group with label, is being
+// tuned: the group is, key was not left out of it by --keys or --skip-keys, it
+// is not pinned, and it was not left alone at the prompts.
+func (t *Tuner) tunesKey(label, key string) bool {
+	if t.tuneDeclined || !isIn(label, t.tunedLabels()) {
+		return false
+	}
+	if t.keys != nil && !isIn(key, t.keys[label]) {
+		return false
+	}
+	_, pinned := t.pins[key]
+	return !pinned && !t.declined[key]
+}
+
+// decline records that key was left alone at the prompts.
+func (t *Tuner) decline(key string) {
+	if t.declined == nil {
+		t.declined = make(map[string]bool)
+	}
+	t.declined[key] = true
+}
+
+// sharedLibEdit is a change made to the shared_preload_libraries line, kept so
+// that it can be redone once the prompts have settled which settings, and so
+// which libraries, are needed.
+type sharedLibEdit struct {
+	file string // file the line is in
+	idx  int    // index of the line in file
+	orig string // line as it was before, blank if it was added
+}
+
+// extraSharedLibs returns the libraries other than timescaledb that the
+// settings being tuned need in shared_preload_libraries.
+func (t *Tuner) extraSharedLibs() []string {
+	if t.tunesKey(pgtune.LoggingLabel, pgtune.PGStatStatementsMaxKey) {
+		return []string{pgtune.PGStatStatementsLib}
+	}
+	return nil
+}
+
+// missingSharedLibLine returns the shared_preload_libraries line to add when
+// there is none.
+func (t *Tuner) missingSharedLibLine() string {
+	return fmt.Sprintf("%s = '%s'", sharedLibsKey, t.sharedLibs())
+}
+
+// sharedLibs returns the value of shared_preload_libraries when there is none.
+func (t *Tuner) sharedLibs() string {
+	return strings.Join(append([]string{extName}, t.extraSharedLibs()...), ",")
+}
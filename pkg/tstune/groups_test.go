@@ -0,0 +1,343 @@
+package tstune
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+func TestParseGroups(t *testing.T) {
+	withLogging := append(append([]string{}, tunableLabels...), pgtune.LoggingLabel)
+	cases := []struct {
+		desc   string
+		input  string
+		want   []string
+		errMsg string
+	}{
+		{desc: "blank", input: "", want: tunableLabels},
+		{desc: "default", input: "default", want: tunableLabels},
+		{desc: "default and logging", input: "logging, DEFAULT", want: withLogging},
+		{desc: "only some", input: "wal,Memory", want: []string{pgtune.MemoryLabel, pgtune.WALLabel}},
+		{desc: "label with space", input: "background writer", want: []string{pgtune.BgwriterLabel}},
+		{desc: "repeated", input: "logging,logging", want: []string{pgtune.LoggingLabel}},
+		{
+			desc:   "unknown",
+			input:  "memory,foo",
+			errMsg: fmt.Sprintf(errUnknownGroupFmt, "foo", strings.Join(ValidGroups, ", ")),
+		},
+	}
+	for _, c := range cases {
+		got, err := parseGroups(c.input)
+		if c.errMsg != "" {
+			if err == nil || err.Error() != c.errMsg {
+				t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("%s: incorrect groups: got %v want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestTunerExtraSharedLibs(t *testing.T) {
+	tuner := newTunerWithDefaultFlags(setupDefaultTestIO(""), nil)
+	if got := tuner.extraSharedLibs(); len(got) != 0 {
+		t.Errorf("unexpected extra libs by default: %v", got)
+	}
+	if got := tuner.missingSharedLibLine(); got != plainSharedLibLine {
+		t.Errorf("incorrect line by default: got %s want %s", got, plainSharedLibLine)
+	}
+
+	tuner.groups = []string{pgtune.MemoryLabel, pgtune.LoggingLabel}
+	if got := tuner.extraSharedLibs(); strings.Join(got, ",") != pgtune.PGStatStatementsLib {
+		t.Errorf("incorrect extra libs with logging: %v", got)
+	}
+	want := "shared_preload_libraries = 'timescaledb,pg_stat_statements'"
+	if got := tuner.missingSharedLibLine(); got != want {
+		t.Errorf("incorrect line with logging: got %s want %s", got, want)
+	}
+
+	// only when pg_stat_statements.max is going to be tuned
+	notTuned := map[string]func(*Tuner){
+		"left out by keys": func(tuner *Tuner) {
+			tuner.keys = map[string][]string{pgtune.LoggingLabel: {pgtune.LogLockWaitsKey}}
+		},
+		"pinned": func(tuner *Tuner) {
+			tuner.pins = map[string]string{pgtune.PGStatStatementsMaxKey: pinReasonKeep}
+		},
+		"left alone at prompt": func(tuner *Tuner) { tuner.decline(pgtune.PGStatStatementsMaxKey) },
+		"tuning declined":      func(tuner *Tuner) { tuner.tuneDeclined = true },
+	}
+	for desc, fn := range notTuned {
+		tuner := newTunerWithDefaultFlags(setupDefaultTestIO(""), nil)
+		tuner.groups = []string{pgtune.LoggingLabel}
+		fn(tuner)
+		if got := tuner.extraSharedLibs(); len(got) != 0 {
+			t.Errorf("%s: unexpected extra libs: %v", desc, got)
+		}
+	}
+}
+
+func TestTunerRedoSharedLibLine(t *testing.T) {
+	logging := []string{
+		"log_line_prefix = '%m [%p] '",
+		"pg_stat_statements.max = 100",
+	}
+	cases := []struct {
+		desc        string
+		sharedLib   string
+		input       string
+		want        string
+		wantChanged bool
+	}{
+		{
+			desc:        "logging tuned",
+			sharedLib:   "shared_preload_libraries = 'timescaledb'",
+			input:       "y\ny\ny\n",
+			want:        "shared_preload_libraries = 'timescaledb,pg_stat_statements'",
+			wantChanged: true,
+		},
+		{
+			desc:      "logging skipped",
+			sharedLib: "shared_preload_libraries = 'timescaledb'",
+			input:     "y\ny\ns\n",
+			want:      "shared_preload_libraries = 'timescaledb'",
+		},
+		{
+			desc:        "logging skipped, timescaledb still added",
+			sharedLib:   "shared_preload_libraries = 'pg_prewarm'",
+			input:       "y\ny\ns\n",
+			want:        "shared_preload_libraries = 'pg_prewarm,timescaledb'",
+			wantChanged: true,
+		},
+		{
+			desc:        "logging skipped, line was missing",
+			input:       "y\ny\ns\n",
+			want:        plainSharedLibLine,
+			wantChanged: true,
+		},
+	}
+
+	for _, c := range cases {
+		lines := logging
+		if c.sharedLib != "" {
+			lines = append([]string{c.sharedLib}, logging...)
+		}
+		tuner := newTunerWithDefaultFlagsForInputs(t, c.input, lines)
+		tuner.groups = []string{pgtune.LoggingLabel}
+		if err := tuner.processSharedLibLine(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.desc, err)
+		}
+		if err := tuner.promptUntilValidInput(promptTune+promptYesNo, newYesNoChecker("")); err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.desc, err)
+		}
+		if err := tuner.processTunables(getDefaultSystemConfig(t), pgtune.DefaultProfile); err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.desc, err)
+		}
+		tuner.redoSharedLibLine()
+
+		idx := 0
+		if c.sharedLib == "" {
+			idx = len(tuner.cfs.lines) - 1
+		}
+		if got := tuner.cfs.lines[idx].content; got != c.want {
+			t.Errorf("%s: incorrect line: got %s want %s", c.desc, got, c.want)
+		}
+		changed := false
+		for _, ch := range tuner.changes {
+			if ch.key == sharedLibsKey {
+				changed = true
+				if want := parseLineForSharedLibResult(c.want).libs; ch.value != want {
+					t.Errorf("%s: incorrect change: got %s want %s", c.desc, ch.value, want)
+				}
+			}
+		}
+		if changed != c.wantChanged {
+			t.Errorf("%s: incorrect changed: got %v want %v", c.desc, changed, c.wantChanged)
+		}
+	}
+}
+
+func TestTunerProcessQuietLogging(t *testing.T) {
+	lines := []string{
+		"shared_preload_libraries = 'timescaledb'",
+		"log_line_prefix = '%m [%p] '",
+		"log_checkpoints = on",
+		"log_min_duration_statement = 1000",
+	}
+	tuner := newTunerWithDefaultFlagsForInputs(t, "y\n", lines)
+	tuner.flags.Quiet = true
+	tuner.groups = []string{pgtune.LoggingLabel}
+
+	if err := tuner.processQuiet(getDefaultSystemConfig(t), pgtune.DefaultProfile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// log_checkpoints and log_min_duration_statement are already as recommended
+	want := []string{
+		"shared_preload_libraries = 'timescaledb,pg_stat_statements'",
+		"log_autovacuum_min_duration = 10s",
+		"log_lock_waits = on",
+		"log_temp_files = 0",
+		"log_line_prefix = '%m [%p] %q%u@%d/%a '",
+		"track_io_timing = on",
+		"pg_stat_statements.max = 10000",
+		"track_activity_query_size = 4096",
+	}
+	out := tuner.handler.out.(*testWriter)
+	if len(out.lines) < len(want) {
+		t.Fatalf("too few lines printed: got %v", out.lines)
+	}
+	for i, w := range want {
+		if got := out.lines[i]; got != w+"\n" {
+			t.Errorf("incorrect line at %d: got %q want %q", i, got, w+"\n")
+		}
+	}
+
+	if got := tuner.cfs.lines[0].content; got != want[0] {
+		t.Errorf("shared_preload_libraries not updated: got %s", got)
+	}
+	if got := tuner.cfs.lines[1].content; got != want[4] {
+		t.Errorf("log_line_prefix not updated in place: got %s", got)
+	}
+}
+
+func TestSelectGroups(t *testing.T) {
+	cases := []struct {
+		desc   string
+		groups string
+		skip   string
+		want   []string
+		errMsg string
+	}{
+		{desc: "nothing skipped", groups: "wal,memory", want: []string{pgtune.MemoryLabel, pgtune.WALLabel}},
+		{desc: "skip from default", skip: "Memory, autovacuum", want: []string{pgtune.ParallelLabel, pgtune.WALLabel, pgtune.BgwriterLabel, pgtune.MiscLabel, pgtune.TimescaleDBLabel, pgtune.ReplicationLabel}},
+		{desc: "skip default", groups: "default,logging", skip: "default", want: []string{pgtune.LoggingLabel}},
+		{desc: "skip not tuned", groups: "wal", skip: "logging", want: []string{pgtune.WALLabel}},
+		{desc: "none left", groups: "wal", skip: "wal", errMsg: errNoGroupsLeft},
+		{
+			desc:   "unknown",
+			skip:   "foo",
+			errMsg: fmt.Sprintf(errUnknownGroupFmt, "foo", strings.Join(ValidGroups, ", ")),
+		},
+	}
+	for _, c := range cases {
+		got, err := selectGroups(c.groups, c.skip)
+		if c.errMsg != "" {
+			if err == nil || err.Error() != c.errMsg {
+				t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("%s: incorrect groups: got %v want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestTunerSelectKeys(t *testing.T) {
+	walLeft := []string{pgtune.WALBuffersKey, pgtune.MinWALKey, pgtune.CheckpointTimeoutKey, pgtune.WALCompressionKey}
+	cases := []struct {
+		desc       string
+		groups     []string
+		keys       string
+		skip       string
+		wantGroups []string
+		wantKeys   map[string][]string
+		errMsg     string
+	}{
+		{desc: "neither"},
+		{
+			desc:       "keys",
+			keys:       "wal_buffers, shared_buffers",
+			wantGroups: []string{pgtune.MemoryLabel, pgtune.WALLabel},
+			wantKeys: map[string][]string{
+				pgtune.MemoryLabel: {pgtune.SharedBuffersKey},
+				pgtune.WALLabel:    {pgtune.WALBuffersKey},
+			},
+		},
+		{
+			desc:       "skip keys",
+			groups:     []string{pgtune.WALLabel},
+			skip:       "max_wal_size,work_mem",
+			wantGroups: []string{pgtune.WALLabel},
+			wantKeys:   map[string][]string{pgtune.WALLabel: walLeft},
+		},
+		{
+			desc:       "keys and skip keys",
+			keys:       "wal_buffers,shared_buffers",
+			skip:       "shared_buffers",
+			wantGroups: []string{pgtune.WALLabel},
+			wantKeys:   map[string][]string{pgtune.WALLabel: {pgtune.WALBuffersKey}},
+		},
+		{desc: "unknown key", keys: "wal_buffers,wal_bufers", errMsg: fmt.Sprintf(errUnknownKeyFmt, "wal_bufers", "--keys")},
+		{desc: "unknown skip key", skip: "foo", errMsg: fmt.Sprintf(errUnknownKeyFmt, "foo", "--skip-keys")},
+		{
+			desc:   "key not tuned",
+			groups: []string{pgtune.WALLabel},
+			keys:   pgtune.LogCheckpointsKey,
+			errMsg: fmt.Sprintf(errKeyNotTunedFmt, pgtune.LogCheckpointsKey, pgtune.LoggingLabel),
+		},
+		{desc: "none left", keys: "wal_buffers", skip: "wal_buffers", errMsg: errNoKeysLeft},
+	}
+	for _, c := range cases {
+		tuner := newTunerWithDefaultFlags(setupDefaultTestIO(""), nil)
+		tuner.groups = c.groups
+		tuner.flags.Keys = c.keys
+		tuner.flags.SkipKeys = c.skip
+		err := tuner.selectKeys(getDefaultSystemConfig(t))
+		if c.errMsg != "" {
+			if err == nil || err.Error() != c.errMsg {
+				t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+		if strings.Join(tuner.groups, ",") != strings.Join(c.wantGroups, ",") {
+			t.Errorf("%s: incorrect groups: got %v want %v", c.desc, tuner.groups, c.wantGroups)
+		}
+		if len(tuner.keys) != len(c.wantKeys) {
+			t.Errorf("%s: incorrect keys: got %v want %v", c.desc, tuner.keys, c.wantKeys)
+		}
+		for label, want := range c.wantKeys {
+			if got := tuner.keys[label]; strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("%s: incorrect keys for %s: got %v want %v", c.desc, label, got, want)
+			}
+		}
+	}
+}
+
+func TestTunerProcessQuietKeys(t *testing.T) {
+	lines := []string{"shared_preload_libraries = 'timescaledb'"}
+	tuner := newTunerWithDefaultFlagsForInputs(t, "y\n", lines)
+	tuner.flags.Quiet = true
+	tuner.flags.Keys = "wal_buffers,shared_buffers"
+	config := getDefaultSystemConfig(t)
+	if err := tuner.selectKeys(config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := tuner.processQuiet(config, pgtune.DefaultProfile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := append(lines, "shared_buffers = 2GB", "wal_buffers = 16MB")
+	if got := len(tuner.cfs.lines); got != len(want) {
+		t.Fatalf("incorrect number of lines: got %d want %d", got, len(want))
+	}
+	for i, w := range want {
+		if got := tuner.cfs.lines[i].content; got != w {
+			t.Errorf("incorrect line at %d: got %s want %s", i, got, w)
+		}
+	}
+}
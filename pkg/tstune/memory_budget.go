@@ -0,0 +1,172 @@
+package tstune
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+const (
+	statementMemoryBudget   = "Memory budget:"
+	fmtMemoryBudgetRow      = "%-28s %12s %12s\n"
+	memoryBudgetExpected    = "expected"
+	memoryBudgetWorstCase   = "worst case"
+	memoryBudgetTotal       = "total"
+	memoryLimitTotal        = "total memory"
+	memoryLimitCgroup       = "cgroup memory limit"
+	fmtMemoryBudgetOver     = "expected memory use of %s is more than the %s of %s, mostly from %s: lower %s"
+	warningMemoryBudgetFmt  = "worst case memory use of %s is more than the %s of %s, mostly from %s: lower %s if every connection may run queries that use work_mem several times at once"
+	warningMemoryBudgetSkip = "could not work out the memory budget: %v"
+)
+
+// memoryBudgetReport is the memory budget of the settings as they will be.
+type memoryBudgetReport struct {
+	Uses      []*memoryUseReport `json:"uses" yaml:"uses"`
+	Expected  uint64             `json:"expected_bytes" yaml:"expected_bytes"`
+	WorstCase uint64             `json:"worst_case_bytes" yaml:"worst_case_bytes"`
+	Limit     uint64             `json:"limit_bytes" yaml:"limit_bytes"`
+}
+
+type memoryUseReport struct {
+	Name      string `json:"name" yaml:"name"`
+	Expected  uint64 `json:"expected_bytes" yaml:"expected_bytes"`
+	WorstCase uint64 `json:"worst_case_bytes" yaml:"worst_case_bytes"`
+}
+
+// memoryLimit is an amount of memory that PostgreSQL has to fit in.
+type memoryLimit struct {
+	name  string
+	bytes uint64
+}
+
+// finalValue returns the value key will have once the accepted changes are
+// made, i.e., the new value or else the one set in the conf files. Blank if it
+// is not set.
+func (t *Tuner) finalValue(key string) string {
+	for _, c := range t.changes {
+		if c.key == key {
+			return c.value
+		}
+	}
+	if r, ok := t.cfs.tuneParseResults[key]; ok && !r.commented {
+		return r.value
+	}
+	return ""
+}
+
+// memoryLimits returns the amounts of memory that PostgreSQL has to fit in,
+// from the strictest.
+func (t *Tuner) memoryLimits(config *pgtune.SystemConfig) []memoryLimit {
+	limits := []memoryLimit{{memoryLimitTotal, config.Memory}}
+	if t.cgroupMemory > 0 {
+		cgroup := memoryLimit{memoryLimitCgroup, t.cgroupMemory}
+		if t.cgroupMemory < config.Memory {
+			limits = []memoryLimit{cgroup, limits[0]}
+		} else {
+			limits = append(limits, cgroup)
+		}
+	}
+	return limits
+}
+
+// recommendedValue returns the value key would have if every recommendation
+// made were accepted, i.e., what the tool recommends or else the value it will
+// have anyway.
+func (t *Tuner) recommendedValue(key string) string {
+	if v, ok := t.recommended[key]; ok {
+		return v
+	}
+	return t.finalValue(key)
+}
+
+// recordRecommendations remembers what recommender recommends for the keys
+// that go into the memory budget, to tell the tool's own values apart from
+// those chosen by hand or kept.
+func (t *Tuner) recordRecommendations(keys []string, recommender pgtune.Recommender) {
+	if t.recommended == nil {
+		t.recommended = make(map[string]string)
+	}
+	for _, k := range keys {
+		if !isIn(k, pgtune.MemoryBudgetKeys) {
+			continue
+		}
+		if rec := toolRecommendation(recommender, k); rec != pgtune.NoRecommendation {
+			t.recommended[k] = rec
+		}
+	}
+}
+
+// overBudget returns the message for use going over limit, naming the part of
+// b that uses the most.
+func overBudget(format string, use uint64, l memoryLimit, largest *pgtune.MemoryUse) string {
+	return fmt.Sprintf(format, parse.BytesToDecimalFormat(use), l.name, parse.BytesToDecimalFormat(l.bytes), largest.Name, joinOr(largest.Keys))
+}
+
+// joinOr joins keys into a list such as "a or b" or "a, b, or c".
+func joinOr(keys []string) string {
+	if len(keys) <= 2 {
+		return strings.Join(keys, " or ")
+	}
+	return strings.Join(keys[:len(keys)-1], ", ") + ", or " + keys[len(keys)-1]
+}
+
+// processMemoryBudget works out how much memory PostgreSQL uses with the
+// settings as they will be, and shows the breakdown. It is a warning if the
+// expected or worst case use does not fit in memory. With --strict-memory, the
+// expected use not fitting is an error instead, unless the tool's own
+// recommendations would not fit either.
+func (t *Tuner) processMemoryBudget(config *pgtune.SystemConfig) error {
+	b, err := pgtune.NewMemoryBudget(t.finalValue)
+	if err != nil {
+		// the conf file is not ours to fix, so carry on without the budget
+		t.handler.p.Error("warning", warningMemoryBudgetSkip, err)
+		return nil
+	}
+	limits := t.memoryLimits(config)
+
+	if !t.flags.Quiet {
+		fmt.Fprintf(t.handler.out, "\n")
+		t.handler.p.Statement(statementMemoryBudget)
+		fmt.Fprintf(t.handler.out, fmtMemoryBudgetRow, "", memoryBudgetExpected, memoryBudgetWorstCase)
+		for _, u := range b.Uses {
+			fmt.Fprintf(t.handler.out, fmtMemoryBudgetRow, u.Name, parse.BytesToDecimalFormat(u.Expected), parse.BytesToDecimalFormat(u.WorstCase))
+		}
+		fmt.Fprintf(t.handler.out, fmtMemoryBudgetRow, memoryBudgetTotal, parse.BytesToDecimalFormat(b.Expected()), parse.BytesToDecimalFormat(b.WorstCase()))
+		for _, l := range limits {
+			fmt.Fprintf(t.handler.out, fmtMemoryBudgetRow, l.name, parse.BytesToDecimalFormat(l.bytes), "")
+		}
+	}
+
+	if t.report != nil {
+		r := &memoryBudgetReport{Uses: []*memoryUseReport{}, Expected: b.Expected(), WorstCase: b.WorstCase(), Limit: limits[0].bytes}
+		for _, u := range b.Uses {
+			r.Uses = append(r.Uses, &memoryUseReport{u.Name, u.Expected, u.WorstCase})
+		}
+		t.report.MemoryBudget = r
+	}
+
+	for _, l := range limits {
+		if b.Expected() <= l.bytes {
+			continue
+		}
+		msg := overBudget(fmtMemoryBudgetOver, b.Expected(), l, b.Largest(false))
+		if t.flags.StrictMemory {
+			rb, err := pgtune.NewMemoryBudget(t.recommendedValue)
+			if err == nil && rb.Expected() <= l.bytes {
+				return errors.New(msg)
+			}
+		}
+		t.handler.p.Error("warning", msg)
+		return nil
+	}
+	for _, l := range limits {
+		if b.WorstCase() > l.bytes {
+			t.handler.p.Error("warning", overBudget(warningMemoryBudgetFmt, b.WorstCase(), l, b.Largest(true)))
+			break
+		}
+	}
+	return nil
+}
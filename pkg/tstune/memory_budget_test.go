@@ -0,0 +1,205 @@
+package tstune
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+// memoryBudgetLines use 3.08 GB as expected and 7.39 GB in the worst case
+var memoryBudgetLines = []string{
+	"shared_buffers = 2GB",
+	"wal_buffers = 16MB",
+	"max_connections = 25",
+	"work_mem = 64MB",
+	"maintenance_work_mem = 1GB",
+	"autovacuum_max_workers = 4",
+	"autovacuum_work_mem = 256MB",
+	"#max_worker_processes = 64",
+	"max_worker_processes = 23",
+}
+
+func TestTunerFinalValue(t *testing.T) {
+	tuner := newTunerWithDefaultFlagsForInputs(t, "", []string{"work_mem = 64MB", "#shared_buffers = 1GB"})
+	tuner.recordChange(pgtune.MaxConnectionsKey, "50")
+	cases := map[string]string{
+		pgtune.WorkMemKey:        "64MB",
+		pgtune.SharedBuffersKey:  "",
+		pgtune.MaxConnectionsKey: "50",
+		pgtune.WALBuffersKey:     "",
+	}
+	for key, want := range cases {
+		if got := tuner.finalValue(key); got != want {
+			t.Errorf("%s: incorrect value: got %q want %q", key, got, want)
+		}
+	}
+
+	tuner.recordChange(pgtune.WorkMemKey, "32MB")
+	if got := tuner.finalValue(pgtune.WorkMemKey); got != "32MB" {
+		t.Errorf("change not used: got %s", got)
+	}
+}
+
+func TestJoinOr(t *testing.T) {
+	cases := map[string][]string{
+		"a":          {"a"},
+		"a or b":     {"a", "b"},
+		"a, b, or c": {"a", "b", "c"},
+	}
+	for want, keys := range cases {
+		if got := joinOr(keys); got != want {
+			t.Errorf("incorrect list: got %q want %q", got, want)
+		}
+	}
+}
+
+func TestTunerProcessMemoryBudget(t *testing.T) {
+	gb := uint64(parse.Gigabyte)
+	cases := []struct {
+		desc         string
+		lines        []string
+		changes      map[string]string
+		memory       uint64
+		cgroupMemory uint64
+		quiet        bool
+		strict       bool
+		recommended  map[string]string
+		wantSkipped  bool
+		wantPrints   int
+		wantErrors   []string
+		errMsg       string
+	}{
+		{
+			desc:       "fits",
+			lines:      memoryBudgetLines,
+			memory:     8 * gb,
+			wantPrints: 9,
+		},
+		{
+			desc:       "worst case does not fit",
+			lines:      memoryBudgetLines,
+			memory:     6 * gb,
+			wantPrints: 9,
+			wantErrors: []string{"warning: " + fmt.Sprintf(warningMemoryBudgetFmt, "7.39 GB", memoryLimitTotal, "6.00 GB", pgtune.MemoryUseQueries, "work_mem or max_connections")},
+		},
+		{
+			desc:         "worst case does not fit the cgroup",
+			lines:        memoryBudgetLines,
+			memory:       8 * gb,
+			cgroupMemory: 7 * gb,
+			quiet:        true,
+			wantErrors:   []string{"warning: " + fmt.Sprintf(warningMemoryBudgetFmt, "7.39 GB", memoryLimitCgroup, "7.00 GB", pgtune.MemoryUseQueries, "work_mem or max_connections")},
+		},
+		{
+			desc:         "expected does not fit the cgroup",
+			lines:        memoryBudgetLines,
+			memory:       8 * gb,
+			cgroupMemory: 3 * gb,
+			wantPrints:   10,
+			wantErrors:   []string{"warning: " + fmt.Sprintf(fmtMemoryBudgetOver, "3.08 GB", memoryLimitCgroup, "3.00 GB", pgtune.MemoryUseSharedBuffers, "shared_buffers")},
+		},
+		{
+			desc:        "strict, recommendations would fit",
+			lines:       memoryBudgetLines,
+			recommended: map[string]string{pgtune.SharedBuffersKey: "1GB"},
+			memory:      3 * gb,
+			quiet:       true,
+			strict:      true,
+			errMsg:      fmt.Sprintf(fmtMemoryBudgetOver, "3.08 GB", memoryLimitTotal, "3.00 GB", pgtune.MemoryUseSharedBuffers, "shared_buffers"),
+		},
+		{
+			desc:        "strict, recommendations would not fit",
+			lines:       memoryBudgetLines,
+			recommended: map[string]string{pgtune.SharedBuffersKey: "2GB"},
+			memory:      3 * gb,
+			quiet:       true,
+			strict:      true,
+			wantErrors:  []string{"warning: " + fmt.Sprintf(fmtMemoryBudgetOver, "3.08 GB", memoryLimitTotal, "3.00 GB", pgtune.MemoryUseSharedBuffers, "shared_buffers")},
+		},
+		{
+			desc:       "accepted changes are used",
+			lines:      memoryBudgetLines,
+			changes:    map[string]string{pgtune.SharedBuffersKey: "8GB"},
+			memory:     8 * gb,
+			quiet:      true,
+			wantErrors: []string{"warning: " + fmt.Sprintf(fmtMemoryBudgetOver, "9.08 GB", memoryLimitTotal, "8.00 GB", pgtune.MemoryUseSharedBuffers, "shared_buffers")},
+		},
+		{
+			desc:        "unparseable",
+			lines:       []string{"work_mem = lots"},
+			memory:      8 * gb,
+			wantSkipped: true,
+			wantErrors:  []string{"warning: " + fmt.Sprintf(warningMemoryBudgetSkip, "could not parse work_mem for the memory budget: incorrect PostgreSQL bytes format: 'lots'")},
+		},
+	}
+
+	for _, c := range cases {
+		tuner := newTunerWithDefaultFlagsForInputs(t, "", c.lines)
+		tuner.flags.Quiet = c.quiet
+		tuner.flags.Format = formatJSON
+		tuner.report = &report{}
+		tuner.cgroupMemory = c.cgroupMemory
+		tuner.flags.StrictMemory = c.strict
+		tuner.recommended = c.recommended
+		for k, v := range c.changes {
+			tuner.recordChange(k, v)
+		}
+		config := getDefaultSystemConfig(t)
+		config.Memory = c.memory
+
+		err := tuner.processMemoryBudget(config)
+		if c.errMsg != "" {
+			if err == nil || err.Error() != c.errMsg {
+				t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.errMsg)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		}
+
+		tp := tuner.handler.p.(*testPrinter)
+		if got := len(tp.errors); got != len(c.wantErrors) {
+			t.Errorf("%s: incorrect number of errors: got %d want %d (%v)", c.desc, got, len(c.wantErrors), tp.errors)
+		} else {
+			for i, want := range c.wantErrors {
+				if got := tp.errors[i]; got != want {
+					t.Errorf("%s: incorrect error at %d: got\n%s\nwant\n%s", c.desc, i, got, want)
+				}
+			}
+		}
+		if c.wantSkipped {
+			if tuner.report.MemoryBudget != nil {
+				t.Errorf("%s: unexpected memory budget in report", c.desc)
+			}
+			continue
+		}
+
+		out := tuner.handler.out.(*testWriter)
+		if got := len(out.lines); got != c.wantPrints {
+			t.Errorf("%s: incorrect number of prints: got %d want %d", c.desc, got, c.wantPrints)
+		}
+		if c.wantPrints > 0 {
+			want := fmt.Sprintf(fmtMemoryBudgetRow, pgtune.MemoryUseQueries, "448.00 MB", "3.12 GB")
+			if got := out.lines[4]; got != want {
+				t.Errorf("%s: incorrect row: got %q want %q", c.desc, got, want)
+			}
+		}
+
+		r := tuner.report.MemoryBudget
+		if r == nil {
+			t.Errorf("%s: memory budget missing from report", c.desc)
+			continue
+		}
+		if got := len(r.Uses); got != 5 {
+			t.Errorf("%s: incorrect number of uses in report: got %d", c.desc, got)
+		}
+		wantLimit := c.memory
+		if c.cgroupMemory > 0 && c.cgroupMemory < wantLimit {
+			wantLimit = c.cgroupMemory
+		}
+		if r.Limit != wantLimit {
+			t.Errorf("%s: incorrect limit in report: got %d want %d", c.desc, r.Limit, wantLimit)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package tstune
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+const (
+	promptSettingFmt     = "Use %s = %s? "
+	promptSettingOptions = "[(a)ccept/(k)eep current/(q)uit, or a value of your own]: "
+
+	errPerSettingConflictFmt = "--per-setting cannot be used with %s"
+	errSettingInvalidFmt     = "invalid value for %s: %v"
+	fmtSettingBudget         = "with %s = %s, %s"
+	invalidLabel             = "invalid"
+
+	statementChangeSummary = "Summary of changes:"
+	fmtChangeByTool        = "%s = %s\t# recommended\n"
+	fmtChangeByHand        = "%s = %s\t# set by hand, recommended %s\n"
+)
+
+// validatePerSettingFlags returns an error if --per-setting is combined with
+// flags that do not prompt for each group of settings.
+func validatePerSettingFlags(flags *TunerFlags) error {
+	if !flags.PerSetting {
+		return nil
+	}
+	switch {
+	case flags.Quiet:
+		return fmt.Errorf(errPerSettingConflictFmt, "--quiet")
+	case flags.YesAlways:
+		return fmt.Errorf(errPerSettingConflictFmt, "--yes")
+	case flags.Check:
+		return fmt.Errorf(errPerSettingConflictFmt, "--check")
+	}
+	return nil
+}
+
+// chooseSettingValues asks, for each of keys, whether to use the
+// recommendation, keep the current value, or use a value of the user's own.
+// It returns the values to write by key, leaving out those kept, and which of
+// them were chosen by hand.
+func (t *Tuner) chooseSettingValues(label string, keys []string, recommender pgtune.Recommender) (map[string]string, map[string]bool, error) {
+	values := map[string]string{}
+	byHand := map[string]bool{}
+	onInvalid := func(err error) {
+		t.handler.p.Error(invalidLabel, "%v", err)
+	}
+	for _, k := range keys {
+		key := k
+		rec := recommender.Recommend(key)
+		if rec == pgtune.NoRecommendation {
+			continue
+		}
+		validate := func(s string) (string, error) {
+			return t.validateSettingValue(key, s, recommender, values)
+		}
+		checker := newSettingChecker(validate, onInvalid, errSettingsNeedTuningFmt, label)
+		q := question{name: questionSettings, label: label, key: key}
+		err := t.promptUntilValidInput(fmt.Sprintf(promptSettingFmt, key, rec)+promptSettingOptions, ask(q, checker))
+		if err != nil {
+			return nil, nil, err
+		}
+		switch checker.response {
+		case settingAccept:
+			values[key] = rec
+			if _, ok := t.answers.setting(key); ok {
+				byHand[key] = true
+			}
+		case settingCustom:
+			values[key] = checker.value
+			byHand[key] = true
+		}
+	}
+	return values, byHand, nil
+}
+
+// validateSettingValue checks that s is a valid value for key, returning it in
+// the form to write to the conf file. Values that affect memory use are also
+// checked to fit in memory along with pending, the values already chosen for
+// the group being tuned, and the rest of the settings as they will be, which
+// is only an error with --strict-memory.
+func (t *Tuner) validateSettingValue(key, s string, recommender pgtune.Recommender, pending map[string]string) (string, error) {
+	if isIn(key, stringKeys) {
+		return quoteStringSetting(s), nil
+	}
+	if err := pgtune.ValidateValue(recommender, key, s); err != nil {
+		return "", fmt.Errorf(errSettingInvalidFmt, key, err)
+	}
+	if !isIn(key, pgtune.MemoryBudgetKeys) || t.config == nil {
+		return s, nil
+	}
+
+	b, err := pgtune.NewMemoryBudget(func(k string) string {
+		if k == key {
+			return s
+		}
+		if v, ok := pending[k]; ok {
+			return v
+		}
+		return t.finalValue(k)
+	})
+	if err != nil {
+		return "", fmt.Errorf(errSettingInvalidFmt, key, err)
+	}
+	for _, l := range t.memoryLimits(t.config) {
+		if b.Expected() > l.bytes {
+			msg := fmt.Sprintf(fmtSettingBudget, key, s, overBudget(fmtMemoryBudgetOver, b.Expected(), l, b.Largest(false)))
+			if t.flags.StrictMemory {
+				return "", errors.New(msg)
+			}
+			t.handler.p.Error("warning", msg)
+			return s, nil
+		}
+	}
+	for _, l := range t.memoryLimits(t.config) {
+		if b.WorstCase() > l.bytes {
+			t.handler.p.Error("warning", overBudget(warningMemoryBudgetFmt, b.WorstCase(), l, b.Largest(true)))
+			break
+		}
+	}
+	return s, nil
+}
+
+// quoteStringSetting returns s, a value for one of stringKeys, quoted the way
+// it is written to the conf file, unless it already is.
+func quoteStringSetting(s string) string {
+	if strings.HasPrefix(s, "'") {
+		return s
+	}
+	return sqlQuoteLiteral(s)
+}
+
+// printChangeSummary shows every accepted change, and whether its value was
+// chosen by hand or recommended.
+func (t *Tuner) printChangeSummary() {
+	if len(t.changes) == 0 {
+		return
+	}
+	fmt.Fprintf(t.handler.out, "\n")
+	t.handler.p.Statement(statementChangeSummary)
+	for _, c := range t.changes {
+		if rec, ok := t.byHand[c.key]; ok {
+			fmt.Fprintf(t.handler.out, fmtChangeByHand, c.key, c.value, rec)
+		} else {
+			fmt.Fprintf(t.handler.out, fmtChangeByTool, c.key, c.value)
+		}
+	}
+}
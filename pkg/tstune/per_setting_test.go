@@ -0,0 +1,236 @@
+package tstune
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+func TestValidatePerSettingFlags(t *testing.T) {
+	cases := []struct {
+		desc   string
+		flags  *TunerFlags
+		errMsg string
+	}{
+		{desc: "not per setting", flags: &TunerFlags{Quiet: true}},
+		{desc: "per setting", flags: &TunerFlags{PerSetting: true}},
+		{desc: "quiet", flags: &TunerFlags{PerSetting: true, Quiet: true}, errMsg: fmt.Sprintf(errPerSettingConflictFmt, "--quiet")},
+		{desc: "yes", flags: &TunerFlags{PerSetting: true, YesAlways: true}, errMsg: fmt.Sprintf(errPerSettingConflictFmt, "--yes")},
+		{desc: "check", flags: &TunerFlags{PerSetting: true, Check: true}, errMsg: fmt.Sprintf(errPerSettingConflictFmt, "--check")},
+	}
+	for _, c := range cases {
+		err := validatePerSettingFlags(c.flags)
+		if c.errMsg == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if c.errMsg != "" && (err == nil || err.Error() != c.errMsg) {
+			t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.errMsg)
+		}
+	}
+}
+
+func TestTunerProcessSettingsGroupPerSetting(t *testing.T) {
+	// shared_buffers is accepted, effective_cache_size is kept, and the others
+	// are set by hand after an invalid value and one that does not fit
+	input := "a\nk\nlots\n256MB\n10GB\n16MB\n"
+	tuner := newTunerWithDefaultFlagsForInputs(t, input, []string{})
+	tuner.flags.PerSetting = true
+	tuner.flags.StrictMemory = true
+	tuner.report = &report{}
+	config := getDefaultSystemConfig(t)
+	tuner.config = config
+
+	err := tuner.processSettingsGroup(mustGetSettingsGroup(t, pgtune.MemoryLabel, config), pgtune.DefaultProfile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tp := tuner.handler.p.(*testPrinter)
+	if got := tp.promptCalls; got != 6 {
+		t.Errorf("incorrect number of prompts: got %d want %d", got, 6)
+	}
+	wantPrompt := fmt.Sprintf(promptSettingFmt, pgtune.SharedBuffersKey, "2GB") + promptSettingOptions
+	if got := tp.prompts[0]; got != wantPrompt {
+		t.Errorf("incorrect prompt: got\n%s\nwant\n%s", got, wantPrompt)
+	}
+	// the first errors are the missing settings
+	errors := tp.errors[4:]
+	if got := len(errors); got != 2 {
+		t.Fatalf("incorrect number of errors: got %d want 2 (%v)", got, errors)
+	}
+	if got := errors[0]; !strings.HasPrefix(got, invalidLabel+": invalid value for maintenance_work_mem") {
+		t.Errorf("incorrect error for invalid value: got %s", got)
+	}
+	if got := errors[1]; !strings.HasPrefix(got, invalidLabel+": with work_mem = 10GB, expected memory use") {
+		t.Errorf("incorrect error for value that does not fit: got %s", got)
+	}
+
+	wantLines := []string{"shared_buffers = 2GB", "maintenance_work_mem = 256MB", "work_mem = 16MB"}
+	if got := len(tuner.cfs.lines); got != len(wantLines) {
+		t.Fatalf("incorrect number of lines: got %d want %d", got, len(wantLines))
+	}
+	for i, want := range wantLines {
+		if got := tuner.cfs.lines[i].content; got != want {
+			t.Errorf("incorrect line at %d: got %s want %s", i, got, want)
+		}
+	}
+
+	wantByHand := map[string]string{pgtune.MaintenanceWorkMemKey: "1GB", pgtune.WorkMemKey: "64MB"}
+	if len(tuner.byHand) != len(wantByHand) {
+		t.Errorf("incorrect keys set by hand: got %v want %v", tuner.byHand, wantByHand)
+	}
+	for k, want := range wantByHand {
+		if got := tuner.byHand[k]; got != want {
+			t.Errorf("incorrect recommendation for %s set by hand: got %s want %s", k, got, want)
+		}
+	}
+
+	settings := map[string]*settingReport{}
+	for _, s := range tuner.report.Groups[0].Settings {
+		settings[s.Key] = s
+	}
+	if got := settings[pgtune.EffectiveCacheKey].Action; got != actionSkip {
+		t.Errorf("incorrect action for kept setting: got %s", got)
+	}
+	if s := settings[pgtune.WorkMemKey]; !s.ByHand || s.Value != "16MB" || s.Action != actionAdd {
+		t.Errorf("incorrect report for setting set by hand: got %v %s %s", s.ByHand, s.Value, s.Action)
+	}
+	if s := settings[pgtune.SharedBuffersKey]; s.ByHand || s.Value != "" {
+		t.Errorf("incorrect report for accepted setting: got %v %s", s.ByHand, s.Value)
+	}
+
+	tuner.handler.out.(*testWriter).lines = nil
+	tuner.printChangeSummary()
+	wantSummary := []string{
+		"\n",
+		fmt.Sprintf(fmtChangeByTool, pgtune.SharedBuffersKey, "2GB"),
+		fmt.Sprintf(fmtChangeByHand, pgtune.MaintenanceWorkMemKey, "256MB", "1GB"),
+		fmt.Sprintf(fmtChangeByHand, pgtune.WorkMemKey, "16MB", "64MB"),
+	}
+	out := tuner.handler.out.(*testWriter)
+	if got := strings.Join(out.lines, ""); got != strings.Join(wantSummary, "") {
+		t.Errorf("incorrect summary: got\n%s\nwant\n%s", got, strings.Join(wantSummary, ""))
+	}
+}
+
+func TestTunerProcessSettingsGroupPerSettingOverBudget(t *testing.T) {
+	// without --strict-memory, a value that does not fit is only warned about
+	tuner := newTunerWithDefaultFlagsForInputs(t, "a\na\na\n10GB\n", []string{})
+	tuner.flags.PerSetting = true
+	config := getDefaultSystemConfig(t)
+	tuner.config = config
+
+	err := tuner.processSettingsGroup(mustGetSettingsGroup(t, pgtune.MemoryLabel, config), pgtune.DefaultProfile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tp := tuner.handler.p.(*testPrinter)
+	if got := tp.promptCalls; got != 4 {
+		t.Errorf("incorrect number of prompts: got %d want %d", got, 4)
+	}
+	errors := tp.errors[4:]
+	if got := len(errors); got != 1 {
+		t.Fatalf("incorrect number of errors: got %d want 1 (%v)", got, errors)
+	}
+	if got := errors[0]; !strings.HasPrefix(got, "warning: with work_mem = 10GB, expected memory use") {
+		t.Errorf("incorrect warning for value that does not fit: got %s", got)
+	}
+	if got := tuner.cfs.lines[3].content; got != "work_mem = 10GB" {
+		t.Errorf("incorrect line for value that does not fit: got %s", got)
+	}
+}
+
+func TestTunerProcessSettingsGroupPerSettingEnumAndBool(t *testing.T) {
+	tuner := newTunerWithDefaultFlagsForInputs(t, "a\na\na\na\na\nzstd\npglz\non\na\n", []string{})
+	tuner.flags.PerSetting = true
+	config, err := pgtune.NewSystemConfig(testMem, testCPUs, pgutils.MajorVersion14, testWALDisk, testMaxConns, testWorkers)
+	if err != nil {
+		t.Fatalf("unexpected error in config creation: got %v", err)
+	}
+	sg := &keysSettingsGroup{mustGetSettingsGroup(t, pgtune.MiscLabel, config), []string{
+		pgtune.StatsTargetKey,
+		pgtune.RandomPageCostKey,
+		pgtune.CheckpointKey,
+		pgtune.MaxConnectionsKey,
+		pgtune.MaxLocksPerTxKey,
+		pgtune.DefaultToastCompression,
+		pgtune.Jit,
+	}}
+
+	err = tuner.processSettingsGroup(sg, pgtune.DefaultProfile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tp := tuner.handler.p.(*testPrinter)
+	if got := tp.promptCalls; got != 8 {
+		t.Errorf("incorrect number of prompts: got %d want %d", got, 8)
+	}
+	if got := tp.errors[len(tp.errors)-1]; !strings.HasPrefix(got, "invalid: invalid value for default_toast_compression: unrecognized value: zstd") {
+		t.Errorf("incorrect error for invalid value: got %s", got)
+	}
+	lines := []string{}
+	for _, l := range tuner.cfs.lines {
+		lines = append(lines, l.content)
+	}
+	for _, want := range []string{"default_toast_compression = pglz", "jit = on"} {
+		if !isIn(want, lines) {
+			t.Errorf("missing line %q: got %v", want, lines)
+		}
+	}
+}
+
+func TestTunerProcessSettingsGroupPerSettingNothingToTune(t *testing.T) {
+	tuner := newTunerWithDefaultFlagsForInputs(t, "", []string{})
+	tuner.flags.PerSetting = true
+	config := getDefaultSystemConfig(t)
+	// neither has a recommendation for PostgreSQL 10
+	sg := &keysSettingsGroup{mustGetSettingsGroup(t, pgtune.MiscLabel, config), []string{pgtune.DefaultToastCompression, pgtune.Jit}}
+
+	err := tuner.processSettingsGroup(sg, pgtune.DefaultProfile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tp := tuner.handler.p.(*testPrinter)
+	if got := tp.promptCalls; got != 0 {
+		t.Errorf("incorrect number of prompts: got %d want %d", got, 0)
+	}
+	if got := len(tp.errors); got != 0 {
+		t.Errorf("unexpected errors: got %v", tp.errors)
+	}
+	want := pgtune.MiscLabel + " settings have nothing to tune"
+	if got := tp.successes; len(got) != 1 || got[0] != want {
+		t.Errorf("incorrect successes: got %v want %s", got, want)
+	}
+}
+
+func TestTunerProcessSettingsGroupPerSettingAllKept(t *testing.T) {
+	tuner := newTunerWithDefaultFlagsForInputs(t, "k\nk\nk\nk\n", []string{})
+	tuner.flags.PerSetting = true
+	config := getDefaultSystemConfig(t)
+
+	err := tuner.processSettingsGroup(mustGetSettingsGroup(t, pgtune.MemoryLabel, config), pgtune.DefaultProfile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := len(tuner.cfs.lines); got != 0 {
+		t.Errorf("unexpected lines added: got %d", got)
+	}
+	tp := tuner.handler.p.(*testPrinter)
+	if got := tp.errors[4:]; len(got) != 1 || got[0] != "warning: memory settings left alone, but still need tuning" {
+		t.Errorf("incorrect errors: got %v", got)
+	}
+
+	// strings are quoted, since they are written as they are
+	tuner = newTunerWithDefaultFlagsForInputs(t, "", []string{})
+	got, err := tuner.validateSettingValue(pgtune.LogLinePrefixKey, "%m it's ", pgtune.NewLoggingRecommender(config.PGMajorVersion), nil)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if want := "'%m it''s '"; got != want {
+		t.Errorf("incorrect string value: got %s want %s", got, want)
+	}
+}
@@ -0,0 +1,462 @@
+package tstune
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+const (
+	errConnectFmt      = "could not connect to PostgreSQL: %v"
+	errReadSettingsFmt = "could not read pg_settings: %v"
+
+	statementConnectedFmt  = "Connected to PostgreSQL, read %d settings from pg_settings"
+	statementPendingFmt    = "Changes waiting for a restart to take effect: %s"
+	warningLiveSourceFmt   = "%s = %s is set by %s, which takes precedence over the conf file"
+	warningLiveFileFmt     = "%s = %s is set in %s, which is not a conf file being tuned"
+	warningLiveMinFmt      = "%s: %s is below the server's minimum, recommending %s instead"
+	warningLiveMaxFmt      = "%s: %s is above the server's maximum, recommending %s instead"
+	warningLiveEnumFmt     = "%s: %s is not one of the values the server accepts (%s)"
+	fmtLiveRunning         = "\t# running with %s (%s)"
+	fmtLivePendingRestart  = "\t# pending restart"
+	fmtLiveRequiresRestart = "\t# requires restart"
+
+	// sources in pg_settings whose values come from the conf files, or from
+	// nowhere at all, rather than overriding them
+	sourceDefault  = "default"
+	sourceConfFile = "configuration file"
+
+	contextPostmaster = "postmaster"
+
+	vartypeInteger = "integer"
+	vartypeReal    = "real"
+	vartypeEnum    = "enum"
+
+	pgSettingsQuery = `SELECT name, setting, coalesce(unit, ''), vartype, context,
+	coalesce(min_val, ''), coalesce(max_val, ''), coalesce(enumvals, '{}'),
+	source, coalesce(sourcefile, ''), pending_restart
+FROM pg_settings WHERE name = ANY($1)`
+)
+
+// pgSetting is a row of pg_settings, describing the value a setting has in the
+// running server and where it came from.
+type pgSetting struct {
+	name           string
+	setting        string // value in the units given by unit
+	unit           string // e.g., 8kB, MB, ms, or blank
+	varType        string // bool, enum, integer, real, or string
+	context        string // when it can be changed, e.g., postmaster for only at start
+	minVal         string // blank if not numeric
+	maxVal         string // blank if not numeric
+	enumVals       []string
+	source         string // e.g., default, configuration file, or command line
+	sourceFile     string // only visible to superusers and pg_read_all_settings
+	pendingRestart bool   // whether the conf files have a value that needs a restart
+}
+
+// pgConn is a connection to a running PostgreSQL server.
+type pgConn interface {
+	// Settings returns the rows of pg_settings for names, keyed by name.
+	// Names the server does not know are left out.
+	Settings(names []string) (map[string]*pgSetting, error)
+	// Exec runs a statement outside of a transaction, ignoring any rows.
+	Exec(query string) error
+	// QueryString returns the first column of the first row of a query, or
+	// a blank string if there are no rows.
+	QueryString(query string) (string, error)
+	Close() error
+}
+
+// allows us to substitute a mock version in tests
+var connectFn = connectPostgres
+
+// sqlConn is a pgConn backed by database/sql.
+type sqlConn struct {
+	db *sql.DB
+}
+
+// connectPostgres connects to the server described by dsn, which is either a
+// URL or a string of key=value pairs as accepted by libpq.
+func connectPostgres(dsn string) (pgConn, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqlConn{db}, nil
+}
+
+func (c *sqlConn) Settings(names []string) (map[string]*pgSetting, error) {
+	rows, err := c.db.Query(pgSettingsQuery, pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]*pgSetting)
+	for rows.Next() {
+		s := &pgSetting{}
+		err = rows.Scan(&s.name, &s.setting, &s.unit, &s.varType, &s.context,
+			&s.minVal, &s.maxVal, pq.Array(&s.enumVals), &s.source, &s.sourceFile, &s.pendingRestart)
+		if err != nil {
+			return nil, err
+		}
+		settings[s.name] = s
+	}
+	return settings, rows.Err()
+}
+
+func (c *sqlConn) Exec(query string) error {
+	_, err := c.db.Exec(query)
+	return err
+}
+
+func (c *sqlConn) QueryString(query string) (string, error) {
+	var s string
+	err := c.db.QueryRow(query).Scan(&s)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return s, err
+}
+
+func (c *sqlConn) Close() error {
+	return c.db.Close()
+}
+
+// unitBytes returns the number of bytes in one unit of s, if it is a memory
+// setting.
+func (s *pgSetting) unitBytes() (uint64, bool) {
+	switch s.unit {
+	case "":
+		return 0, false
+	case "B":
+		return 1, true
+	}
+	unit := s.unit
+	if unit[0] < '0' || unit[0] > '9' {
+		unit = "1" + unit
+	}
+	bytes, err := parse.PGFormatToBytes(unit)
+	return bytes, err == nil
+}
+
+// timeUnit returns the unit of s, if it is a time setting.
+func (s *pgSetting) timeUnit() (parse.TimeUnit, bool) {
+	if s.unit == "" {
+		return 0, false
+	}
+	tu, err := parse.ParseTimeUnit(s.unit)
+	return tu, err == nil
+}
+
+// toNative converts val, in the format used in the conf file, to a number in
+// the units of s. Numbers without units are already in those units, the same
+// as PostgreSQL treats them.
+func (s *pgSetting) toNative(val string) (float64, error) {
+	val = unquoteValue(val)
+	if v, err := strconv.ParseFloat(val, 64); err == nil {
+		return v, nil
+	}
+	if ub, ok := s.unitBytes(); ok {
+		bytes, err := parse.PGFormatToBytes(val)
+		if err != nil {
+			return 0, err
+		}
+		return float64(bytes) / float64(ub), nil
+	}
+	if tu, ok := s.timeUnit(); ok {
+		vt := parse.VarTypeInteger
+		if s.varType == vartypeReal {
+			vt = parse.VarTypeReal
+		}
+		v, units, err := parse.PGFormatToTime(val, tu, vt)
+		if err != nil {
+			return 0, err
+		}
+		conv, err := parse.TimeConversion(units, tu)
+		if err != nil {
+			return 0, err
+		}
+		return v * conv, nil
+	}
+	return strconv.ParseFloat(val, 64)
+}
+
+// fromNative converts v, a number in the units of s, to the format used in the
+// conf file.
+func (s *pgSetting) fromNative(v float64) string {
+	num := strconv.FormatFloat(v, 'f', -1, 64)
+	if v < 0 { // sentinels such as -1 have no units
+		return num
+	}
+	if ub, ok := s.unitBytes(); ok {
+		bytes := uint64(v) * ub
+		if bytes < parse.Kilobyte {
+			return num
+		}
+		return parse.BytesToPGFormat(bytes)
+	}
+	if _, ok := s.timeUnit(); ok {
+		return num + s.unit
+	}
+	return num
+}
+
+// value returns the running value of s in the format used in the conf file.
+func (s *pgSetting) value() string {
+	v, err := strconv.ParseFloat(s.setting, 64)
+	if err != nil || s.unit == "" {
+		return s.setting
+	}
+	return s.fromNative(v)
+}
+
+// requiresRestart returns whether a change to s only takes effect once the
+// server is restarted.
+func (s *pgSetting) requiresRestart() bool {
+	return s.context == contextPostmaster
+}
+
+// differsFrom returns whether the running value of s is not val, which is in
+// the format used in the conf file.
+func (s *pgSetting) differsFrom(val string) bool {
+	curr, err := s.toNative(val)
+	if err != nil {
+		return !strings.EqualFold(unquoteValue(val), s.setting)
+	}
+	running, err := strconv.ParseFloat(s.setting, 64)
+	if err != nil {
+		return true
+	}
+	return curr != running
+}
+
+// validate checks rec against the limits the server puts on s. A number outside
+// of the minimum and maximum is replaced by the nearest one within them, while
+// an unknown enum value is kept, since the server may be an older version than
+// the one recommendations are for. If anything is wrong, a warning is returned
+// as well.
+func (s *pgSetting) validate(rec string) (string, string) {
+	switch s.varType {
+	case vartypeInteger, vartypeReal:
+		v, err := s.toNative(rec)
+		if err != nil {
+			return rec, ""
+		}
+		if min, err := strconv.ParseFloat(s.minVal, 64); err == nil && v < min {
+			bound := s.fromNative(min)
+			return bound, fmt.Sprintf(warningLiveMinFmt, s.name, rec, bound)
+		}
+		if max, err := strconv.ParseFloat(s.maxVal, 64); err == nil && v > max {
+			bound := s.fromNative(max)
+			return bound, fmt.Sprintf(warningLiveMaxFmt, s.name, rec, bound)
+		}
+	case vartypeEnum:
+		if len(s.enumVals) == 0 {
+			return rec, ""
+		}
+		for _, e := range s.enumVals {
+			if strings.EqualFold(e, unquoteValue(rec)) {
+				return rec, ""
+			}
+		}
+		return rec, fmt.Sprintf(warningLiveEnumFmt, s.name, rec, strings.Join(s.enumVals, ", "))
+	}
+	return rec, ""
+}
+
+// hasFile returns whether filePath is the path of cfs or of any file it
+// includes, including postgresql.auto.conf.
+func (cfs *configFileState) hasFile(filePath string) bool {
+	same := func(other string) bool {
+		if other == "" {
+			return false
+		}
+		a, errA := filepath.Abs(filePath)
+		b, errB := filepath.Abs(other)
+		return errA == nil && errB == nil && a == b
+	}
+	if same(cfs.path) || (cfs.autoConf != nil && same(cfs.autoConf.path)) {
+		return true
+	}
+	for _, inc := range cfs.includes {
+		if same(inc.path) {
+			return true
+		}
+	}
+	return false
+}
+
+// liveSourceWarning returns a warning if the running value of s does not come
+// from the conf files we are tuning, so changing them would have no effect.
+func (t *Tuner) liveSourceWarning(s *pgSetting) string {
+	switch s.source {
+	case sourceDefault:
+		return ""
+	case sourceConfFile:
+		// the file is only known to privileged users
+		if s.sourceFile == "" || t.cfs.hasFile(s.sourceFile) {
+			return ""
+		}
+		return fmt.Sprintf(warningLiveFileFmt, s.name, s.value(), s.sourceFile)
+	default:
+		return fmt.Sprintf(warningLiveSourceFmt, s.name, s.value(), s.source)
+	}
+}
+
+// connect returns a connection to the server given with --connect, or nil if
+// there is none.
+func (t *Tuner) connect() (pgConn, error) {
+	if t.flags.Connect == "" {
+		return nil, nil
+	}
+	conn, err := connectFn(t.flags.Connect)
+	if err != nil {
+		return nil, fmt.Errorf(errConnectFmt, err)
+	}
+	return conn, nil
+}
+
+// processLiveSettings reads the settings of the server we are connected to, if
+// any, so that recommendations can be checked against what the server accepts,
+// and warns about settings whose effective values do not come from the conf
+// files.
+func (t *Tuner) processLiveSettings(config *pgtune.SystemConfig, conn pgConn) error {
+	if conn == nil {
+		return nil
+	}
+	names := []string{sharedLibsKey}
+	for _, label := range t.tunedLabels() {
+		sg, err := t.getSettingsGroup(label, config)
+		if err != nil {
+			return err
+		}
+		names = append(names, sg.Keys()...)
+	}
+	settings, err := conn.Settings(names)
+	if err != nil {
+		return fmt.Errorf(errReadSettingsFmt, err)
+	}
+	t.live = settings
+	t.liveWarned = make(map[string]bool)
+	t.handler.p.Statement(statementConnectedFmt, len(settings))
+
+	pending := []string{}
+	for _, name := range names {
+		s, ok := settings[name]
+		if !ok {
+			continue
+		}
+		if msg := t.liveSourceWarning(s); msg != "" {
+			t.handler.p.Error("warning", msg)
+		}
+		if s.pendingRestart {
+			pending = append(pending, name)
+		}
+	}
+	if len(pending) > 0 {
+		sort.Strings(pending)
+		t.handler.p.Statement(statementPendingFmt, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// warnLive prints a warning about key, once per run.
+func (t *Tuner) warnLive(key, msg string) {
+	if t.liveWarned[key] {
+		return
+	}
+	t.liveWarned[key] = true
+	t.handler.p.Error("warning", msg)
+}
+
+// liveCurrentNote returns a conf comment for the current value of r when the
+// server is running with a different value, or is waiting for a restart to
+// use it.
+func (t *Tuner) liveCurrentNote(r *tunableParseResult) string {
+	s, ok := t.live[r.key]
+	if !ok {
+		return ""
+	}
+	if s.pendingRestart {
+		return fmtLivePendingRestart
+	}
+	if r.commented || s.differsFrom(r.value) {
+		return fmt.Sprintf(fmtLiveRunning, s.value(), s.source)
+	}
+	return ""
+}
+
+// liveRestartNote returns a conf comment for a recommendation for key that
+// only takes effect after a restart of the server we are connected to.
+func (t *Tuner) liveRestartNote(key string) string {
+	if s, ok := t.live[key]; ok && s.requiresRestart() {
+		return fmtLiveRequiresRestart
+	}
+	return ""
+}
+
+// addLiveSettings adds the running values of the settings in g to it.
+func addLiveSettings(g *groupReport, live map[string]*pgSetting) {
+	for _, sr := range g.Settings {
+		s, ok := live[sr.Key]
+		if !ok {
+			continue
+		}
+		sr.Running = s.value()
+		sr.Source = s.source
+		sr.PendingRestart = s.pendingRestart
+		sr.RequiresRestart = s.requiresRestart()
+	}
+}
+
+// liveSettingsGroup is a SettingsGroup whose recommendations are validated
+// against the settings of the running server.
+type liveSettingsGroup struct {
+	pgtune.SettingsGroup
+	t *Tuner
+}
+
+func (sg *liveSettingsGroup) GetRecommender(profile pgtune.Profile) pgtune.Recommender {
+	return &liveRecommender{sg.SettingsGroup.GetRecommender(profile), sg.t}
+}
+
+// liveRecommender gives the recommendations of another Recommender, adjusted
+// to be within the limits of the running server.
+type liveRecommender struct {
+	base pgtune.Recommender
+	t    *Tuner
+}
+
+func (r *liveRecommender) IsAvailable() bool {
+	return r.base.IsAvailable()
+}
+
+// Unwrap returns the Recommender whose recommendations are validated.
+func (r *liveRecommender) Unwrap() pgtune.Recommender {
+	return r.base
+}
+
+func (r *liveRecommender) Recommend(key string) string {
+	rec := r.base.Recommend(key)
+	s, ok := r.t.live[key]
+	if rec == pgtune.NoRecommendation || !ok {
+		return rec
+	}
+	rec, msg := s.validate(rec)
+	if msg != "" {
+		r.t.warnLive(key, msg)
+	}
+	return rec
+}
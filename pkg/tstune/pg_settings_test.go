@@ -0,0 +1,318 @@
+package tstune
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+type testPGConn struct {
+	settings  map[string]*pgSetting
+	shouldErr bool
+	names     []string
+	execs     []string
+	queries   map[string]string        // results of QueryString, which errors on other queries
+	onExec    func(query string) error // changes settings the way the server would
+	closed    bool
+}
+
+func (c *testPGConn) Settings(names []string) (map[string]*pgSetting, error) {
+	if c.shouldErr {
+		return nil, fmt.Errorf("erroring")
+	}
+	c.names = names
+	ret := make(map[string]*pgSetting)
+	for _, n := range names {
+		if s, ok := c.settings[n]; ok {
+			ret[n] = s
+		}
+	}
+	return ret, nil
+}
+
+func (c *testPGConn) Exec(query string) error {
+	c.execs = append(c.execs, query)
+	if c.onExec != nil {
+		return c.onExec(query)
+	}
+	return nil
+}
+
+func (c *testPGConn) QueryString(query string) (string, error) {
+	res, ok := c.queries[query]
+	if !ok {
+		return "", fmt.Errorf("relation does not exist")
+	}
+	return res, nil
+}
+
+func (c *testPGConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+var (
+	testSharedBuffers = &pgSetting{
+		name: pgtune.SharedBuffersKey, setting: "16384", unit: "8kB", varType: vartypeInteger,
+		context: contextPostmaster, minVal: "16", maxVal: "1073741823", source: sourceConfFile,
+	}
+	testWorkMem = &pgSetting{
+		name: pgtune.WorkMemKey, setting: "4096", unit: "kB", varType: vartypeInteger,
+		context: "user", minVal: "64", maxVal: "2147483647", source: sourceDefault,
+	}
+	testCheckpointTimeout = &pgSetting{
+		name: "checkpoint_timeout", setting: "300", unit: "s", varType: vartypeInteger,
+		context: "sighup", minVal: "30", maxVal: "86400", source: sourceDefault,
+	}
+	testRandomPageCost = &pgSetting{
+		name: pgtune.RandomPageCostKey, setting: "4", varType: vartypeReal,
+		context: "user", minVal: "0", maxVal: "1.79769e+308", source: sourceDefault,
+	}
+	testWALLevel = &pgSetting{
+		name: "wal_level", setting: "replica", varType: vartypeEnum, context: contextPostmaster,
+		enumVals: []string{"minimal", "replica", "logical"}, source: sourceDefault,
+	}
+)
+
+func TestPGSettingValue(t *testing.T) {
+	cases := []struct {
+		s    *pgSetting
+		want string
+	}{
+		{testSharedBuffers, "128MB"},
+		{testWorkMem, "4MB"},
+		{testCheckpointTimeout, "300s"},
+		{testRandomPageCost, "4"},
+		{testWALLevel, "replica"},
+		{&pgSetting{setting: "-1", unit: "kB"}, "-1"},
+		{&pgSetting{setting: "8", unit: "B"}, "8"},
+	}
+	for _, c := range cases {
+		if got := c.s.value(); got != c.want {
+			t.Errorf("%s: incorrect value: got %s want %s", c.s.name, got, c.want)
+		}
+	}
+}
+
+func TestPGSettingToNative(t *testing.T) {
+	cases := []struct {
+		desc   string
+		s      *pgSetting
+		val    string
+		want   float64
+		errMsg string
+	}{
+		{desc: "8kB pages", s: testSharedBuffers, val: "1GB", want: 131072},
+		{desc: "no units", s: testSharedBuffers, val: "1024", want: 1024},
+		{desc: "quoted", s: testWorkMem, val: "'64MB'", want: 65536},
+		{desc: "minutes to seconds", s: testCheckpointTimeout, val: "15min", want: 900},
+		{desc: "real", s: testRandomPageCost, val: "1.1", want: 1.1},
+		{desc: "bad bytes", s: testWorkMem, val: "64XB", errMsg: "incorrect PostgreSQL bytes format: '64XB'"},
+		{desc: "enum", s: testWALLevel, val: "replica", errMsg: `strconv.ParseFloat: parsing "replica": invalid syntax`},
+	}
+	for _, c := range cases {
+		got, err := c.s.toNative(c.val)
+		if c.errMsg != "" {
+			if err == nil || err.Error() != c.errMsg {
+				t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if got != c.want {
+			t.Errorf("%s: incorrect value: got %v want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestPGSettingValidate(t *testing.T) {
+	cases := []struct {
+		desc    string
+		s       *pgSetting
+		rec     string
+		want    string
+		warning string
+	}{
+		{desc: "within limits", s: testWorkMem, rec: "64MB", want: "64MB"},
+		{
+			desc:    "below min",
+			s:       testWorkMem,
+			rec:     "32kB",
+			want:    "64kB",
+			warning: fmt.Sprintf(warningLiveMinFmt, pgtune.WorkMemKey, "32kB", "64kB"),
+		},
+		{
+			desc:    "above max",
+			s:       testCheckpointTimeout,
+			rec:     "2d",
+			want:    "86400s",
+			warning: fmt.Sprintf(warningLiveMaxFmt, "checkpoint_timeout", "2d", "86400s"),
+		},
+		{desc: "enum", s: testWALLevel, rec: "logical", want: "logical"},
+		{
+			desc:    "unknown enum",
+			s:       testWALLevel,
+			rec:     "archive",
+			want:    "archive",
+			warning: fmt.Sprintf(warningLiveEnumFmt, "wal_level", "archive", "minimal, replica, logical"),
+		},
+		{desc: "unparseable", s: testWorkMem, rec: "lots", want: "lots"},
+	}
+	for _, c := range cases {
+		got, warning := c.s.validate(c.rec)
+		if got != c.want {
+			t.Errorf("%s: incorrect recommendation: got %s want %s", c.desc, got, c.want)
+		}
+		if warning != c.warning {
+			t.Errorf("%s: incorrect warning: got %q want %q", c.desc, warning, c.warning)
+		}
+	}
+}
+
+func TestTunerConnect(t *testing.T) {
+	oldConnectFn := connectFn
+	defer func() { connectFn = oldConnectFn }()
+
+	// not connecting
+	tuner := newTunerWithDefaultFlags(setupDefaultTestIO(""), nil)
+	connectFn = func(string) (pgConn, error) {
+		t.Fatalf("connected without --connect")
+		return nil, nil
+	}
+	if conn, err := tuner.connect(); err != nil || conn != nil {
+		t.Errorf("unexpected result without --connect: %v %v", conn, err)
+	}
+
+	// could not connect
+	tuner.flags.Connect = "postgres://localhost"
+	connectFn = func(string) (pgConn, error) { return nil, fmt.Errorf("refused") }
+	_, err := tuner.connect()
+	if want := fmt.Sprintf(errConnectFmt, "refused"); err == nil || err.Error() != want {
+		t.Errorf("incorrect error: got %v want %s", err, want)
+	}
+
+	want := &testPGConn{}
+	connectFn = func(dsn string) (pgConn, error) {
+		if dsn != tuner.flags.Connect {
+			t.Errorf("incorrect dsn: got %s want %s", dsn, tuner.flags.Connect)
+		}
+		return want, nil
+	}
+	if conn, err := tuner.connect(); err != nil || conn != want {
+		t.Errorf("unexpected result: got %v %v", conn, err)
+	}
+}
+
+func TestTunerProcessLiveSettings(t *testing.T) {
+	cfs, err := getConfigFileStateWithIncludes(stringSliceToBytesReader([]string{"shared_buffers = 128MB"}), "/etc/postgresql.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	workMem := *testWorkMem
+	workMem.source = "command line"
+	sharedBuffers := *testSharedBuffers
+	sharedBuffers.sourceFile = "/var/lib/postgresql/postgresql.conf"
+	sharedBuffers.pendingRestart = true
+	conn := &testPGConn{settings: map[string]*pgSetting{
+		pgtune.WorkMemKey:       &workMem,
+		pgtune.SharedBuffersKey: &sharedBuffers,
+	}}
+
+	// not connected
+	tuner := newTunerWithDefaultFlags(setupDefaultTestIO(""), cfs)
+	if err := tuner.processLiveSettings(getDefaultSystemConfig(t), nil); err != nil || tuner.live != nil {
+		t.Errorf("unexpected result without connection: %v %v", err, tuner.live)
+	}
+
+	// could not query
+	err = tuner.processLiveSettings(getDefaultSystemConfig(t), &testPGConn{shouldErr: true})
+	if want := fmt.Sprintf(errReadSettingsFmt, "erroring"); err == nil || err.Error() != want {
+		t.Errorf("incorrect error: got %v want %s", err, want)
+	}
+
+	if err := tuner.processLiveSettings(getDefaultSystemConfig(t), conn); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conn.names[0] != sharedLibsKey || !strings.Contains(strings.Join(conn.names, ","), pgtune.MaxWorkerProcessesKey) {
+		t.Errorf("incorrect settings requested: %v", conn.names)
+	}
+	if len(tuner.live) != 2 {
+		t.Errorf("incorrect number of live settings: got %d want 2", len(tuner.live))
+	}
+
+	p := tuner.handler.p.(*testPrinter)
+	wantErrors := []string{
+		"warning: " + fmt.Sprintf(warningLiveFileFmt, pgtune.SharedBuffersKey, "128MB", sharedBuffers.sourceFile),
+		"warning: " + fmt.Sprintf(warningLiveSourceFmt, pgtune.WorkMemKey, "4MB", "command line"),
+	}
+	if got := strings.Join(p.errors, "\n"); got != strings.Join(wantErrors, "\n") {
+		t.Errorf("incorrect warnings: got\n%s\nwant\n%s", got, strings.Join(wantErrors, "\n"))
+	}
+	wantStatements := []string{
+		fmt.Sprintf(statementConnectedFmt, 2),
+		fmt.Sprintf(statementPendingFmt, pgtune.SharedBuffersKey),
+	}
+	if got := strings.Join(p.statements, "\n"); got != strings.Join(wantStatements, "\n") {
+		t.Errorf("incorrect statements: got\n%s\nwant\n%s", got, strings.Join(wantStatements, "\n"))
+	}
+}
+
+func TestTunerProcessSettingsGroupLive(t *testing.T) {
+	lines := []string{
+		"shared_buffers = 128MB",
+		"#effective_cache_size = 4GB",
+		"maintenance_work_mem = 64MB",
+		"work_mem = 4MB",
+	}
+	tuner := newTunerWithDefaultFlagsForInputs(t, "y\n", lines)
+	workMem := *testWorkMem
+	workMem.setting = "8192"
+	workMem.source = "command line"
+	// pretend the server has a much lower limit than usual
+	workMem.maxVal = "1024"
+	tuner.live = map[string]*pgSetting{
+		pgtune.SharedBuffersKey: testSharedBuffers,
+		pgtune.WorkMemKey:       &workMem,
+	}
+	tuner.liveWarned = make(map[string]bool)
+
+	config := getDefaultSystemConfig(t)
+	sg, err := tuner.getSettingsGroup(pgtune.MemoryLabel, config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := pgtune.GetFloatParser(sg.GetRecommender(pgtune.DefaultProfile)).ParseFloat(pgtune.WorkMemKey, "1MB"); err != nil {
+		t.Errorf("incorrect float parser for live recommender: %v", err)
+	}
+	if err := tuner.processSettingsGroup(sg, pgtune.DefaultProfile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := strings.Join(tuner.handler.out.(*testWriter).lines, "")
+	for _, want := range []string{
+		"shared_buffers = 128MB\n",
+		"work_mem = 4MB" + fmt.Sprintf(fmtLiveRunning, "8MB", "command line") + "\n",
+		"shared_buffers = 2GB" + fmtLiveRequiresRestart + "\n",
+		"work_mem = 1MB\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q: got\n%s", want, out)
+		}
+	}
+	p := tuner.handler.p.(*testPrinter)
+	warnings := 0
+	for _, e := range p.errors {
+		if strings.Contains(e, "above the server's maximum") {
+			warnings++
+		}
+	}
+	if warnings != 1 {
+		t.Errorf("incorrect number of limit warnings: got %d want 1\n%v", warnings, p.errors)
+	}
+	if got := tuner.cfs.lines[3].content; got != "work_mem = 1MB" {
+		t.Errorf("clamped recommendation not written: got %s", got)
+	}
+}
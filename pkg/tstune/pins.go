@@ -0,0 +1,116 @@
+package tstune
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+const (
+	// pinMarker in the trailing comment of a line keeps its setting as it is
+	pinMarker = "tstune:pin"
+
+	pinnedLabel         = "pinned"
+	fmtPinned           = "%s = %s, by %s"
+	fmtPinnedMissing    = "%s is not set, by %s"
+	pinReasonCommentFmt = pinMarker + " at %s"
+	pinReasonKeep       = "--keep"
+	pinReasonProfileFmt = "profile file %s"
+	pinReasonAnswersFmt = "answers file %s"
+
+	errKeepUnknownFmt = "unknown setting to keep: %s"
+	errAnswerKeepFmt  = "%s cannot be both kept and given a value"
+)
+
+// parseKeep returns the keys listed in s, a comma-separated list of settings
+// to keep as they are, checking that each is a setting that is tuned.
+func parseKeep(s string) ([]string, error) {
+	keys := []string{}
+	if strings.TrimSpace(s) == "" {
+		return keys, nil
+	}
+	for _, k := range strings.Split(s, ",") {
+		k = strings.TrimSpace(k)
+		if _, ok := regexes[k]; !ok {
+			return nil, fmt.Errorf(errKeepUnknownFmt, k)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// loadPins works out which settings are pinned, i.e., never tuned, and why:
+// those whose line in the conf files has pinMarker in its trailing comment, and
+// those listed by --keep, the profile file, and the answers file.
+func (t *Tuner) loadPins() error {
+	keep, err := parseKeep(t.flags.Keep)
+	if err != nil {
+		return err
+	}
+	t.pins = make(map[string]string)
+	add := func(key, reason string) {
+		if prev, ok := t.pins[key]; ok {
+			reason = prev + ", " + reason
+		}
+		t.pins[key] = reason
+	}
+
+	keys := make([]string, 0, len(t.cfs.tuneParseResults))
+	for k := range t.cfs.tuneParseResults {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if r := t.cfs.tuneParseResults[k]; r.pinned {
+			add(k, fmt.Sprintf(pinReasonCommentFmt, r.location()))
+		}
+	}
+	for _, k := range keep {
+		add(k, pinReasonKeep)
+	}
+	if t.customProfile != nil {
+		for _, k := range t.customProfile.Keep {
+			add(k, fmt.Sprintf(pinReasonProfileFmt, t.flags.ProfileFile))
+		}
+	}
+	if t.answers != nil {
+		for _, k := range t.answers.Keep {
+			add(k, fmt.Sprintf(pinReasonAnswersFmt, t.flags.Answers))
+		}
+	}
+	return nil
+}
+
+// printPinned tells the user about each of keys that is pinned, along with
+// its current value and why it is pinned, for those keys recommender has a
+// recommendation for.
+func (t *Tuner) printPinned(keys []string, recommender pgtune.Recommender) {
+	for _, k := range keys {
+		reason, ok := t.pins[k]
+		if !ok || recommender.Recommend(k) == pgtune.NoRecommendation {
+			continue
+		}
+		r, ok := t.cfs.tuneParseResults[k]
+		if !ok || r.commented {
+			t.handler.p.Error(pinnedLabel, fmtPinnedMissing, k, reason)
+			continue
+		}
+		t.handler.p.Error(pinnedLabel, fmtPinned, k, r.value, reason)
+	}
+}
+
+// pin marks the settings in pins as pinned, with the reason, and not to be
+// changed.
+func (g *groupReport) pin(pins map[string]string) {
+	for _, s := range g.Settings {
+		if reason, ok := pins[s.Key]; ok {
+			// not compared against the recommendation, so not within it either
+			s.Pinned = true
+			s.PinReason = reason
+			s.WithinFudge = false
+			s.Action = actionNone
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package tstune
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+func TestParseKeep(t *testing.T) {
+	cases := []struct {
+		desc   string
+		s      string
+		want   []string
+		errMsg string
+	}{
+		{desc: "blank", s: " ", want: []string{}},
+		{desc: "one", s: "work_mem", want: []string{pgtune.WorkMemKey}},
+		{desc: "several", s: "work_mem, max_connections", want: []string{pgtune.WorkMemKey, pgtune.MaxConnectionsKey}},
+		{desc: "unknown", s: "work_mem,work_memory", errMsg: fmt.Sprintf(errKeepUnknownFmt, "work_memory")},
+	}
+	for _, c := range cases {
+		got, err := parseKeep(c.s)
+		if c.errMsg != "" {
+			if err == nil || err.Error() != c.errMsg {
+				t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("%s: incorrect keys: got %v want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestParseWithRegexPinned(t *testing.T) {
+	regex := keyToRegex(pgtune.WorkMemKey)
+	cases := map[string]bool{
+		"work_mem = 256MB":                           false,
+		"work_mem = 256MB # for reporting":           false,
+		"work_mem = 256MB # tstune:pin":              true,
+		"work_mem = 256MB    # tstune:pin reporting": true,
+		"#work_mem = 4MB # tstune:pin":               true,
+	}
+	for line, want := range cases {
+		r := parseWithRegex(line, regex)
+		if r == nil {
+			t.Errorf("%s: not parsed", line)
+		} else if r.pinned != want {
+			t.Errorf("%s: incorrect pinned: got %v want %v", line, r.pinned, want)
+		}
+	}
+}
+
+func TestTunerLoadPins(t *testing.T) {
+	lines := []string{"work_mem = 256MB # tstune:pin", "shared_buffers = 1GB # tuned by hand"}
+	tuner := newTunerWithDefaultFlagsForInputs(t, "", lines)
+	tuner.flags.Keep = "max_connections,work_mem"
+	tuner.flags.ProfileFile = "sensors.yaml"
+	tuner.customProfile = &pgtune.CustomProfile{Keep: []string{pgtune.Jit}}
+	tuner.flags.Answers = "answers.yaml"
+	tuner.answers = &answersFile{Keep: []string{pgtune.MaxConnectionsKey}}
+
+	if err := tuner.loadPins(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	comment := fmt.Sprintf(pinReasonCommentFmt, tuner.cfs.tuneParseResults[pgtune.WorkMemKey].location())
+	want := map[string]string{
+		pgtune.WorkMemKey:        comment + ", " + pinReasonKeep,
+		pgtune.MaxConnectionsKey: pinReasonKeep + ", " + fmt.Sprintf(pinReasonAnswersFmt, "answers.yaml"),
+		pgtune.Jit:               fmt.Sprintf(pinReasonProfileFmt, "sensors.yaml"),
+	}
+	if len(tuner.pins) != len(want) {
+		t.Errorf("incorrect pins: got %v want %v", tuner.pins, want)
+	}
+	for k, reason := range want {
+		if got := tuner.pins[k]; got != reason {
+			t.Errorf("incorrect reason for %s: got %q want %q", k, got, reason)
+		}
+	}
+
+	tuner.flags.Keep = "nope"
+	if err := tuner.loadPins(); err == nil || err.Error() != fmt.Sprintf(errKeepUnknownFmt, "nope") {
+		t.Errorf("incorrect error: got %v", err)
+	}
+}
+
+func TestCheckIfShouldShowSettingPinned(t *testing.T) {
+	config := getDefaultSystemConfig(t)
+	recommender := mustGetSettingsGroup(t, pgtune.MemoryLabel, config).GetRecommender(pgtune.DefaultProfile)
+	parseResults := map[string]*tunableParseResult{
+		pgtune.WorkMemKey: {key: pgtune.WorkMemKey, value: "256MB"},
+	}
+	pins := map[string]string{pgtune.WorkMemKey: pinReasonKeep, pgtune.SharedBuffersKey: pinReasonKeep}
+
+	show, err := checkIfShouldShowSetting(pgtune.MemoryKeys, parseResults, recommender, pins)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]bool{pgtune.EffectiveCacheKey: true, pgtune.MaintenanceWorkMemKey: true}
+	if len(show) != len(want) {
+		t.Errorf("incorrect show: got %v want %v", show, want)
+	}
+	for k := range want {
+		if !show[k] {
+			t.Errorf("%s not shown", k)
+		}
+	}
+}
+
+func TestTunerProcessSettingsGroupPinned(t *testing.T) {
+	lines := []string{"work_mem = 256MB # tstune:pin", "shared_buffers = 2GB"}
+	for _, quiet := range []bool{false, true} {
+		tuner := newTunerWithDefaultFlagsForInputs(t, "y\n", lines)
+		tuner.flags.Quiet = quiet
+		tuner.report = &report{}
+		tuner.flags.Keep = pgtune.MaintenanceWorkMemKey
+		if err := tuner.loadPins(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		config := getDefaultSystemConfig(t)
+
+		err := tuner.processSettingsGroup(mustGetSettingsGroup(t, pgtune.MemoryLabel, config), pgtune.DefaultProfile)
+		if err != nil {
+			t.Fatalf("quiet %v: unexpected error: %v", quiet, err)
+		}
+
+		// only effective_cache_size needs tuning
+		wantLines := append(lines, "effective_cache_size = 6GB")
+		if got := len(tuner.cfs.lines); got != len(wantLines) {
+			t.Fatalf("quiet %v: incorrect number of lines: got %d want %d", quiet, got, len(wantLines))
+		}
+		for i, want := range wantLines {
+			if got := tuner.cfs.lines[i].content; got != want {
+				t.Errorf("quiet %v: incorrect line at %d: got %s want %s", quiet, i, got, want)
+			}
+		}
+
+		tp := tuner.handler.p.(*testPrinter)
+		comment := fmt.Sprintf(pinReasonCommentFmt, tuner.cfs.tuneParseResults[pgtune.WorkMemKey].location())
+		wantErrors := []string{
+			pinnedLabel + ": " + fmt.Sprintf(fmtPinnedMissing, pgtune.MaintenanceWorkMemKey, pinReasonKeep),
+			pinnedLabel + ": " + fmt.Sprintf(fmtPinned, pgtune.WorkMemKey, "256MB", comment),
+			"missing: " + pgtune.EffectiveCacheKey,
+		}
+		if quiet {
+			wantErrors = nil
+		}
+		if got := len(tp.errors); got != len(wantErrors) {
+			t.Errorf("quiet %v: incorrect number of errors: got %d want %d (%v)", quiet, got, len(wantErrors), tp.errors)
+		} else {
+			for i, want := range wantErrors {
+				if got := tp.errors[i]; got != want {
+					t.Errorf("quiet %v: incorrect error at %d: got\n%s\nwant\n%s", quiet, i, got, want)
+				}
+			}
+		}
+
+		for _, s := range tuner.report.Groups[0].Settings {
+			reason, pinned := tuner.pins[s.Key]
+			if s.Pinned != pinned || s.PinReason != reason {
+				t.Errorf("quiet %v: incorrect pin for %s: got %v %q", quiet, s.Key, s.Pinned, s.PinReason)
+			}
+			if pinned && (s.Action != actionNone || s.WithinFudge) {
+				t.Errorf("quiet %v: incorrect report for pinned %s: got %s %v", quiet, s.Key, s.Action, s.WithinFudge)
+			}
+		}
+	}
+}
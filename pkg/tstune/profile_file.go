@@ -0,0 +1,130 @@
+package tstune
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	errProfileFileFmt        = "could not load profile file %s: %v"
+	errProfileFileExtFmt     = "unknown file extension '%s' (valid extensions: .yaml, .yml, .json, .toml)"
+	errProfileFileUnknownFmt = "unknown fields: %s"
+	errProfileConflictFmt    = "profile %s conflicts with base profile '%s' of profile file %s"
+)
+
+// loadProfileFile reads and validates a custom profile from path, which is a
+// YAML, JSON, or TOML document depending on its extension.
+func loadProfileFile(path string) (*pgtune.CustomProfile, error) {
+	p := &pgtune.CustomProfile{}
+	err := decodeFile(path, p)
+	if err == nil {
+		err = p.Validate()
+	}
+	if err != nil {
+		return nil, fmt.Errorf(errProfileFileFmt, path, err)
+	}
+	return p, nil
+}
+
+// decodeFile reads path into v, decoding it as YAML, JSON, or TOML depending
+// on its extension. Unknown fields are an error, so that typos do not silently
+// go unused.
+func decodeFile(path string, v interface{}) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		return dec.Decode(v)
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		return dec.Decode(v)
+	case ".toml":
+		md, err := toml.Decode(string(b), v)
+		if err == nil && len(md.Undecoded()) > 0 {
+			fields := []string{}
+			for _, k := range md.Undecoded() {
+				fields = append(fields, k.String())
+			}
+			sort.Strings(fields)
+			err = fmt.Errorf(errProfileFileUnknownFmt, strings.Join(fields, ", "))
+		}
+		return err
+	default:
+		return fmt.Errorf(errProfileFileExtFmt, ext)
+	}
+}
+
+// processProfile determines which profile recommendations are based on, from
+// the --profile flag and the profile file (if any), and tells the user about it
+// if it is not the default.
+func (t *Tuner) processProfile() (pgtune.Profile, error) {
+	profile, err := pgtune.ParseProfile(t.flags.Profile)
+	if err != nil {
+		return profile, err
+	}
+	t.profileName = profile.String()
+
+	if t.flags.ProfileFile != "" {
+		t.customProfile, err = loadProfileFile(t.flags.ProfileFile)
+		if err != nil {
+			return profile, err
+		}
+		base := t.customProfile.BaseProfile()
+		if t.flags.Profile != "" && profile != base {
+			baseName := base.String()
+			if baseName == "" {
+				baseName = defaultProfileName
+			}
+			return profile, fmt.Errorf(errProfileConflictFmt, t.flags.Profile, baseName, t.flags.ProfileFile)
+		}
+		profile = base
+		t.profileName = t.customProfile.Name
+	}
+
+	if t.profileName != "" {
+		t.handler.p.Statement("Tuning with profile: %s", t.profileName)
+	}
+	return profile, nil
+}
+
+// getSettingsGroup returns the SettingsGroup for label, with the overrides of
+// the custom profile applied if there is one, validated against the running
+// server if connected to one, with the values pinned in the answers file used
+// if there are any, and with only the keys selected by --keys and --skip-keys.
+func (t *Tuner) getSettingsGroup(label string, config *pgtune.SystemConfig) (pgtune.SettingsGroup, error) {
+	sg, err := pgtune.GetSettingsGroup(label, config)
+	if err != nil {
+		return nil, err
+	}
+	if t.customProfile != nil {
+		sg, err = t.customProfile.WrapSettingsGroup(sg, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.live != nil {
+		sg = &liveSettingsGroup{sg, t}
+	}
+	if t.answers != nil && len(t.answers.Settings) > 0 {
+		sg = &answersSettingsGroup{sg, t.answers}
+	}
+	if keys, ok := t.keys[label]; ok {
+		sg = &keysSettingsGroup{sg, keys}
+	}
+	return sg, nil
+}
@@ -0,0 +1,353 @@
+package tstune
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+const (
+	testProfileYAML = `name: ingest
+base: promscale
+settings:
+  work_mem:
+    formula: memory / connections / 4
+    min: 4MB
+  max_connections:
+    value: 200
+`
+	testProfileJSON = `{
+  "name": "ingest",
+  "base": "promscale",
+  "settings": {
+    "work_mem": {"formula": "memory / connections / 4", "min": "4MB"},
+    "max_connections": {"value": "200"}
+  }
+}`
+	testProfileTOML = `name = "ingest"
+base = "promscale"
+
+[settings.work_mem]
+formula = "memory / connections / 4"
+min = "4MB"
+
+[settings.max_connections]
+value = "200"
+`
+)
+
+func TestLoadProfileFile(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		desc     string
+		file     string
+		contents string
+		errMsg   string
+	}{
+		{
+			desc:     "yaml",
+			file:     "profile.yaml",
+			contents: testProfileYAML,
+		},
+		{
+			desc:     "yml",
+			file:     "profile.yml",
+			contents: testProfileYAML,
+		},
+		{
+			desc:     "json",
+			file:     "profile.JSON",
+			contents: testProfileJSON,
+		},
+		{
+			desc:     "toml",
+			file:     "profile.toml",
+			contents: testProfileTOML,
+		},
+		{
+			desc:   "missing file",
+			file:   "missing.yaml",
+			errMsg: "no such file or directory",
+		},
+		{
+			desc:     "unknown extension",
+			file:     "profile.ini",
+			contents: testProfileYAML,
+			errMsg:   fmt.Sprintf(errProfileFileExtFmt, ".ini"),
+		},
+		{
+			desc:     "unknown yaml field",
+			file:     "unknown.yaml",
+			contents: testProfileYAML + "extra: true\n",
+			errMsg:   "field extra not found",
+		},
+		{
+			desc:     "unknown json field",
+			file:     "unknown.json",
+			contents: `{"name": "ingest", "settings": {"work_mem": {"valeu": "4MB"}}}`,
+			errMsg:   `unknown field "valeu"`,
+		},
+		{
+			desc:     "unknown toml field",
+			file:     "unknown.toml",
+			contents: testProfileTOML + "valeu = \"1\"\n",
+			errMsg:   fmt.Sprintf(errProfileFileUnknownFmt, "settings.max_connections.valeu"),
+		},
+		{
+			desc:     "invalid profile",
+			file:     "invalid.yaml",
+			contents: "name: ingest\nsettings:\n  not_a_setting:\n    value: 1\n",
+			errMsg:   "unknown setting in profile: not_a_setting",
+		},
+		{
+			desc:     "invalid value",
+			file:     "value.yaml",
+			contents: "name: ingest\nsettings:\n  work_mem:\n    value: lots\n",
+			errMsg:   "invalid value for work_mem: incorrect PostgreSQL bytes format: 'lots'",
+		},
+	}
+
+	for _, c := range cases {
+		path := filepath.Join(dir, c.file)
+		if c.contents != "" {
+			if err := os.WriteFile(path, []byte(c.contents), 0644); err != nil {
+				t.Fatalf("could not write file: %v", err)
+			}
+		}
+
+		p, err := loadProfileFile(path)
+		if c.errMsg != "" {
+			if err == nil {
+				t.Errorf("%s: unexpected lack of error", c.desc)
+			} else if got := err.Error(); !strings.HasPrefix(got, fmt.Sprintf(errProfileFileFmt, path, "")) || !strings.Contains(got, c.errMsg) {
+				t.Errorf("%s: incorrect error: got\n%s\nwant it to contain\n%s", c.desc, got, c.errMsg)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+
+		if got := p.Name; got != "ingest" {
+			t.Errorf("%s: incorrect name: got %s want ingest", c.desc, got)
+		}
+		if got := p.BaseProfile(); got != pgtune.PromscaleProfile {
+			t.Errorf("%s: incorrect base: got %s want %s", c.desc, got, pgtune.PromscaleProfile)
+		}
+		if got := p.Settings[pgtune.WorkMemKey].Formula; got != "memory / connections / 4" {
+			t.Errorf("%s: incorrect work_mem formula: got %s", c.desc, got)
+		}
+		if got := p.Settings[pgtune.MaxConnectionsKey].Value; got != "200" {
+			t.Errorf("%s: incorrect max_connections value: got %s want 200", c.desc, got)
+		}
+	}
+}
+
+func TestTunerProcessProfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "profile.yaml")
+	if err := os.WriteFile(path, []byte(testProfileYAML), 0644); err != nil {
+		t.Fatalf("could not write file: %v", err)
+	}
+	defaultBasePath := filepath.Join(dir, "default.yaml")
+	if err := os.WriteFile(defaultBasePath, []byte("name: mine\n"), 0644); err != nil {
+		t.Fatalf("could not write file: %v", err)
+	}
+	// names that would break the quoted timescaledb.last_tuned_profile line
+	quotePath := filepath.Join(dir, "quote.yaml")
+	if err := os.WriteFile(quotePath, []byte("name: O'Brien\n"), 0644); err != nil {
+		t.Fatalf("could not write file: %v", err)
+	}
+	newlinePath := filepath.Join(dir, "newline.json")
+	if err := os.WriteFile(newlinePath, []byte(`{"name": "two\nlines"}`), 0644); err != nil {
+		t.Fatalf("could not write file: %v", err)
+	}
+
+	cases := []struct {
+		desc          string
+		flagProfile   string
+		profileFile   string
+		want          pgtune.Profile
+		wantName      string
+		wantStatement bool
+		errMsg        string
+	}{
+		{
+			desc: "default",
+			want: pgtune.DefaultProfile,
+		},
+		{
+			desc:          "built-in",
+			flagProfile:   "promscale",
+			want:          pgtune.PromscaleProfile,
+			wantName:      "promscale",
+			wantStatement: true,
+		},
+		{
+			desc:        "unknown built-in",
+			flagProfile: "nope",
+			errMsg:      "unrecognized profile: nope",
+		},
+		{
+			desc:          "profile file",
+			profileFile:   path,
+			want:          pgtune.PromscaleProfile,
+			wantName:      "ingest",
+			wantStatement: true,
+		},
+		{
+			desc:          "profile file with matching flag",
+			flagProfile:   "promscale",
+			profileFile:   path,
+			want:          pgtune.PromscaleProfile,
+			wantName:      "ingest",
+			wantStatement: true,
+		},
+		{
+			desc:        "profile file with conflicting flag",
+			flagProfile: "promscale",
+			profileFile: defaultBasePath,
+			errMsg:      fmt.Sprintf(errProfileConflictFmt, "promscale", defaultProfileName, defaultBasePath),
+		},
+		{
+			desc:        "profile file with quote in name",
+			profileFile: quotePath,
+			errMsg:      fmt.Sprintf(errProfileFileFmt, quotePath, "invalid profile name \"O'Brien\""),
+		},
+		{
+			desc:        "profile file with newline in name",
+			profileFile: newlinePath,
+			errMsg:      fmt.Sprintf(errProfileFileFmt, newlinePath, `invalid profile name "two\nlines"`),
+		},
+		{
+			desc:        "missing profile file",
+			profileFile: path + ".missing",
+			errMsg:      "could not load profile file",
+		},
+	}
+
+	for _, c := range cases {
+		tuner := newTunerWithDefaultFlags(setupDefaultTestIO(""), nil)
+		tuner.flags.Profile = c.flagProfile
+		tuner.flags.ProfileFile = c.profileFile
+
+		got, err := tuner.processProfile()
+		if c.errMsg != "" {
+			if err == nil {
+				t.Errorf("%s: unexpected lack of error", c.desc)
+			} else if !strings.Contains(err.Error(), c.errMsg) {
+				t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.errMsg)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: incorrect profile: got %s want %s", c.desc, got, c.want)
+		}
+		if got := tuner.profileName; got != c.wantName {
+			t.Errorf("%s: incorrect profile name: got %s want %s", c.desc, got, c.wantName)
+		}
+		tp := tuner.handler.p.(*testPrinter)
+		if c.wantStatement {
+			want := "Tuning with profile: " + c.wantName
+			if tp.statementCalls != 1 || tp.statements[0] != want {
+				t.Errorf("%s: incorrect statements: got %v want %s", c.desc, tp.statements, want)
+			}
+		} else if tp.statementCalls != 0 {
+			t.Errorf("%s: unexpected statements: %v", c.desc, tp.statements)
+		}
+	}
+}
+
+func TestTunerGetSettingsGroup(t *testing.T) {
+	config := getDefaultSystemConfig(t)
+	tuner := newTunerWithDefaultFlags(setupDefaultTestIO(""), nil)
+
+	sg, err := tuner.getSettingsGroup(pgtune.MiscLabel, config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := sg.GetRecommender(pgtune.DefaultProfile).Recommend(pgtune.MaxConnectionsKey); got != "25" {
+		t.Errorf("incorrect built-in max_connections: got %s want 25", got)
+	}
+
+	tuner.customProfile = &pgtune.CustomProfile{Name: "mine", Settings: map[string]*pgtune.SettingOverride{
+		pgtune.MaxConnectionsKey: {Formula: "cpus * 50"},
+	}}
+	if err := tuner.customProfile.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sg, err = tuner.getSettingsGroup(pgtune.MiscLabel, config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := sg.GetRecommender(pgtune.DefaultProfile).Recommend(pgtune.MaxConnectionsKey); got != "200" {
+		t.Errorf("incorrect overridden max_connections: got %s want 200", got)
+	}
+
+	tuner.customProfile.Settings[pgtune.MaxConnectionsKey] = &pgtune.SettingOverride{Formula: "cpus / wal_disk_size"}
+	if err := tuner.customProfile.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = tuner.getSettingsGroup(pgtune.MiscLabel, config); err == nil {
+		t.Errorf("unexpected lack of error")
+	}
+}
+
+func TestTunerProfileNameInConfFile(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		desc     string
+		name     string
+		wantLine string
+	}{
+		{
+			desc:     "plain",
+			name:     "sensors v2",
+			wantLine: fmt.Sprintf(fmtOurParam, lastTunedProfileParam, "sensors v2"),
+		},
+		{
+			desc: "quote",
+			name: "O'Brien",
+		},
+		{
+			desc: "newline",
+			name: "two\nlines",
+		},
+	}
+
+	for _, c := range cases {
+		path := filepath.Join(dir, c.desc+".json")
+		contents := fmt.Sprintf(`{"name": %q}`, c.name)
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("could not write file: %v", err)
+		}
+		tuner := newTunerWithDefaultFlagsForInputs(t, "", []string{})
+		tuner.flags.ProfileFile = path
+		if _, err := tuner.processProfile(); err != nil {
+			if c.wantLine != "" {
+				t.Errorf("%s: unexpected error: %v", c.desc, err)
+			}
+			continue
+		} else if c.wantLine == "" {
+			t.Errorf("%s: unexpected lack of error", c.desc)
+			continue
+		}
+		tuner.processOurParams()
+
+		var buf bytes.Buffer
+		if _, err := tuner.cfs.WriteTo(&buf); err != nil {
+			t.Fatalf("%s: unexpected error writing: %v", c.desc, err)
+		}
+		if got := buf.String(); !strings.Contains(got, c.wantLine+"\n") {
+			t.Errorf("%s: conf file missing %q:\n%s", c.desc, c.wantLine, got)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package tstune
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+const (
+	maxPreparedTxKey = "max_prepared_transactions"
+
+	errReplicasWithoutRoleFmt = "--replicas needs --role to be %s or %s"
+
+	warningStandbyLowerFmt  = "%s would go down from %s to %s on this standby, but PostgreSQL does not start a standby with a lower value than its primary: make sure the primary's is no higher than %s"
+	warningPrimaryHigherFmt = "%s would go up from %s to %s on this primary, but PostgreSQL does not start a standby with a lower value than its primary: raise it on the standbys first"
+)
+
+// replicaLimitKeys are the settings that a standby must have at least as high
+// as its primary.
+var replicaLimitKeys = []string{
+	pgtune.MaxConnectionsKey,
+	pgtune.MaxWorkerProcessesKey,
+	pgtune.MaxLocksPerTxKey,
+	pgtune.MaxWALSendersKey, // PG12+
+	maxPreparedTxKey,
+}
+
+// replicaLimitOldVersions are the PostgreSQL versions for which a key in
+// replicaLimitKeys is not yet a limit.
+var replicaLimitOldVersions = map[string][]string{
+	pgtune.MaxWALSendersKey: {pgutils.MajorVersion96, pgutils.MajorVersion10, pgutils.MajorVersion11},
+}
+
+// isReplicaLimit returns whether key is one of replicaLimitKeys for the given
+// PostgreSQL version.
+func isReplicaLimit(key, pgMajorVersion string) bool {
+	return isIn(key, replicaLimitKeys) && !isIn(pgMajorVersion, replicaLimitOldVersions[key])
+}
+
+// parseRole returns the Role given by the --role and --replicas flags.
+func parseRole(role string, replicas uint) (pgtune.Role, error) {
+	r, err := pgtune.ParseRole(role)
+	if err != nil {
+		return r, err
+	}
+	if replicas > 0 && r != pgtune.RolePrimary && r != pgtune.RoleStandby {
+		return r, fmt.Errorf(errReplicasWithoutRoleFmt, pgtune.RolePrimary, pgtune.RoleStandby)
+	}
+	return r, nil
+}
+
+// processReplicaLimits warns when a recommendation for one of replicaLimitKeys
+// would stop standbys from starting, i.e., when it is lower than the current
+// value on a standby or higher on a primary. The current value is the one the
+// server is running with, if we are connected to it.
+func (t *Tuner) processReplicaLimits(config *pgtune.SystemConfig, profile pgtune.Profile) error {
+	if config.Role != pgtune.RolePrimary && config.Role != pgtune.RoleStandby {
+		return nil
+	}
+	for _, label := range t.tunedLabels() {
+		sg, err := t.getSettingsGroup(label, config)
+		if err != nil {
+			return err
+		}
+		r := sg.GetRecommender(profile)
+		if !r.IsAvailable() {
+			continue
+		}
+		for _, k := range sg.Keys() {
+			if _, ok := t.pins[k]; ok || !isReplicaLimit(k, config.PGMajorVersion) {
+				continue
+			}
+			rec := r.Recommend(k)
+			curr := t.currentValue(k)
+			if rec == pgtune.NoRecommendation || curr == "" {
+				continue
+			}
+			recVal, err := strconv.ParseFloat(rec, 64)
+			if err != nil {
+				continue
+			}
+			currVal, err := strconv.ParseFloat(curr, 64)
+			if err != nil {
+				continue
+			}
+			if config.Role == pgtune.RoleStandby && recVal < currVal {
+				t.handler.p.Error("warning", warningStandbyLowerFmt, k, curr, rec, rec)
+			} else if config.Role == pgtune.RolePrimary && recVal > currVal {
+				t.handler.p.Error("warning", warningPrimaryHigherFmt, k, curr, rec)
+			}
+		}
+	}
+	return nil
+}
+
+// currentValue returns the value the server is running with for key, or else
+// the value set in the conf files. Blank if neither is known.
+func (t *Tuner) currentValue(key string) string {
+	if s, ok := t.live[key]; ok {
+		return s.value()
+	}
+	if r, ok := t.cfs.tuneParseResults[key]; ok && !r.commented {
+		return unquoteValue(r.value)
+	}
+	return ""
+}
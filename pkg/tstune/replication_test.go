@@ -0,0 +1,227 @@
+package tstune
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+func TestParseRole(t *testing.T) {
+	cases := []struct {
+		desc     string
+		role     string
+		replicas uint
+		want     pgtune.Role
+		errMsg   string
+	}{
+		{desc: "blank", want: pgtune.RoleUnknown},
+		{desc: "primary with replicas", role: "primary", replicas: 2, want: pgtune.RolePrimary},
+		{desc: "standby with replicas", role: "standby", replicas: 2, want: pgtune.RoleStandby},
+		{desc: "standalone", role: "standalone", want: pgtune.RoleStandalone},
+		{
+			desc:   "unknown",
+			role:   "leader",
+			errMsg: "unrecognized role: leader",
+		},
+		{
+			desc:     "replicas without role",
+			replicas: 1,
+			errMsg:   fmt.Sprintf(errReplicasWithoutRoleFmt, pgtune.RolePrimary, pgtune.RoleStandby),
+		},
+		{
+			desc:     "standalone with replicas",
+			role:     "standalone",
+			replicas: 1,
+			errMsg:   fmt.Sprintf(errReplicasWithoutRoleFmt, pgtune.RolePrimary, pgtune.RoleStandby),
+		},
+	}
+	for _, c := range cases {
+		got, err := parseRole(c.role, c.replicas)
+		if c.errMsg != "" {
+			if err == nil || err.Error() != c.errMsg {
+				t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if got != c.want {
+			t.Errorf("%s: incorrect role: got %v want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestTunerProcessReplicaLimits(t *testing.T) {
+	// recommendations for the default system config are testMaxConns
+	// connections and 23 worker processes
+	lines := []string{
+		"max_connections = 100",
+		"max_worker_processes = 8",
+		"#max_locks_per_transaction = 1024",
+	}
+	cases := []struct {
+		desc       string
+		role       pgtune.Role
+		live       map[string]*pgSetting
+		wantErrors []string
+	}{
+		{
+			desc: "standby",
+			role: pgtune.RoleStandby,
+			wantErrors: []string{
+				"warning: " + fmt.Sprintf(warningStandbyLowerFmt, pgtune.MaxConnectionsKey, "100", "25", "25"),
+			},
+		},
+		{
+			desc: "primary",
+			role: pgtune.RolePrimary,
+			wantErrors: []string{
+				"warning: " + fmt.Sprintf(warningPrimaryHigherFmt, pgtune.MaxWorkerProcessesKey, "8", "23"),
+			},
+		},
+		{
+			desc: "standby uses running values",
+			role: pgtune.RoleStandby,
+			live: map[string]*pgSetting{
+				pgtune.MaxConnectionsKey:     {name: pgtune.MaxConnectionsKey, setting: "20", varType: "integer"},
+				pgtune.MaxWorkerProcessesKey: {name: pgtune.MaxWorkerProcessesKey, setting: "32", varType: "integer"},
+			},
+			wantErrors: []string{
+				"warning: " + fmt.Sprintf(warningStandbyLowerFmt, pgtune.MaxWorkerProcessesKey, "32", "23", "23"),
+			},
+		},
+		{
+			desc: "standalone",
+			role: pgtune.RoleStandalone,
+		},
+		{
+			desc: "unknown role",
+			role: pgtune.RoleUnknown,
+		},
+	}
+	for _, c := range cases {
+		tuner := newTunerWithDefaultFlagsForInputs(t, "", lines)
+		if c.live != nil {
+			tuner.live = c.live
+			tuner.liveWarned = make(map[string]bool)
+		}
+		config := getDefaultSystemConfig(t)
+		config.Role = c.role
+		if err := tuner.processReplicaLimits(config, pgtune.DefaultProfile); err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+		tp := tuner.handler.p.(*testPrinter)
+		if got := len(tp.errors); got != len(c.wantErrors) {
+			t.Errorf("%s: incorrect number of errors: got %d want %d (%v)", c.desc, got, len(c.wantErrors), tp.errors)
+			continue
+		}
+		for i, want := range c.wantErrors {
+			if got := tp.errors[i]; got != want {
+				t.Errorf("%s: incorrect error at %d: got\n%s\nwant\n%s", c.desc, i, got, want)
+			}
+		}
+	}
+}
+
+func TestTunerProcessReplicaLimitsWALSenders(t *testing.T) {
+	lines := []string{
+		"max_wal_senders = 20",
+	}
+	cases := []struct {
+		pgVersion  string
+		wantErrors []string
+	}{
+		{
+			pgVersion: pgutils.MajorVersion11,
+		},
+		{
+			pgVersion: pgutils.MajorVersion12,
+			wantErrors: []string{
+				"warning: " + fmt.Sprintf(warningStandbyLowerFmt, pgtune.MaxWALSendersKey, "20", "10", "10"),
+			},
+		},
+	}
+	for _, c := range cases {
+		tuner := newTunerWithDefaultFlagsForInputs(t, "", lines)
+		tuner.groups = []string{pgtune.ReplicationLabel}
+		config := getDefaultSystemConfig(t)
+		config.PGMajorVersion = c.pgVersion
+		config.Role = pgtune.RoleStandby
+		if err := tuner.processReplicaLimits(config, pgtune.DefaultProfile); err != nil {
+			t.Errorf("%s: unexpected error: %v", c.pgVersion, err)
+			continue
+		}
+		tp := tuner.handler.p.(*testPrinter)
+		if got := len(tp.errors); got != len(c.wantErrors) {
+			t.Errorf("%s: incorrect number of errors: got %d want %d (%v)", c.pgVersion, got, len(c.wantErrors), tp.errors)
+			continue
+		}
+		for i, want := range c.wantErrors {
+			if got := tp.errors[i]; got != want {
+				t.Errorf("%s: incorrect error at %d: got\n%s\nwant\n%s", c.pgVersion, i, got, want)
+			}
+		}
+	}
+}
+
+func TestIsReplicaLimit(t *testing.T) {
+	cases := []struct {
+		key       string
+		pgVersion string
+		want      bool
+	}{
+		{pgtune.MaxConnectionsKey, pgutils.MajorVersion96, true},
+		{maxPreparedTxKey, pgutils.MajorVersion10, true},
+		{pgtune.MaxWALSendersKey, pgutils.MajorVersion11, false},
+		{pgtune.MaxWALSendersKey, pgutils.MajorVersion12, true},
+		{pgtune.MaxWALSendersKey, pgutils.MajorVersion16, true},
+		{pgtune.MaxReplicationSlotsKey, pgutils.MajorVersion16, false},
+	}
+	for _, c := range cases {
+		if got := isReplicaLimit(c.key, c.pgVersion); got != c.want {
+			t.Errorf("%s on %s: incorrect result: got %v want %v", c.key, c.pgVersion, got, c.want)
+		}
+	}
+}
+
+func TestTunerProcessQuietReplication(t *testing.T) {
+	lines := []string{
+		"shared_preload_libraries = 'timescaledb'",
+		"wal_level = logical",
+		"max_wal_senders = 4",
+	}
+	tuner := newTunerWithDefaultFlagsForInputs(t, "y\n", lines)
+	tuner.flags.Quiet = true
+	tuner.groups = []string{pgtune.ReplicationLabel}
+	config := getDefaultSystemConfig(t)
+	config.Role = pgtune.RolePrimary
+	config.Replicas = 3
+
+	if err := tuner.processQuiet(config, pgtune.DefaultProfile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// logical already includes what replica needs, so wal_level is left alone
+	want := []string{
+		"max_wal_senders = 10",
+		"max_replication_slots = 10",
+		"wal_keep_segments = 64",
+		"hot_standby_feedback = on",
+		"wal_log_hints = on",
+	}
+	out := tuner.handler.out.(*testWriter)
+	if len(out.lines) < len(want) {
+		t.Fatalf("too few lines printed: got %v", out.lines)
+	}
+	for i, w := range want {
+		if got := out.lines[i]; got != w+"\n" {
+			t.Errorf("incorrect line at %d: got %q want %q", i, got, w+"\n")
+		}
+	}
+	if got := tuner.cfs.lines[1].content; got != lines[1] {
+		t.Errorf("wal_level unexpectedly changed: got %s", got)
+	}
+}
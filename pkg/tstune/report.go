@@ -0,0 +1,243 @@
+package tstune
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatYAML = "yaml"
+
+	errUnknownFormatFmt = "unknown output format: %s (valid values: %s)"
+	errFormatStdout     = "cannot write both the report and the SQL script to stdout"
+
+	// actions that are taken (or would be taken, in --dry-run) for a setting
+	actionNone      = "none"
+	actionAdd       = "add"
+	actionUncomment = "uncomment"
+	actionUpdate    = "update"
+	actionSkip      = "skip"
+)
+
+// ValidFormats are the output formats that can be passed to --format
+var ValidFormats = []string{formatText, formatJSON, formatYAML}
+
+// validateFormat returns an error if format is not one of ValidFormats. A
+// blank format is treated as formatText.
+func validateFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+	for _, f := range ValidFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf(errUnknownFormatFmt, format, strings.Join(ValidFormats, ", "))
+}
+
+// report is a machine-readable document describing the system that the
+// recommendations are based on, and what was found and changed for each
+// setting.
+type report struct {
+	System     *systemReport    `json:"system" yaml:"system"`
+	SharedLibs *sharedLibReport `json:"shared_preload_libraries" yaml:"shared_preload_libraries"`
+	Groups     []*groupReport   `json:"groups" yaml:"groups"`
+	BackupPath string           `json:"backup_path,omitempty" yaml:"backup_path,omitempty"`
+	Apply      *applyOutcome    `json:"apply,omitempty" yaml:"apply,omitempty"`
+
+	MemoryBudget *memoryBudgetReport `json:"memory_budget,omitempty" yaml:"memory_budget,omitempty"`
+	Answers      []*answerReport     `json:"answers,omitempty" yaml:"answers,omitempty"`
+}
+
+type systemReport struct {
+	Memory        string `json:"memory" yaml:"memory"`
+	MemoryBytes   uint64 `json:"memory_bytes" yaml:"memory_bytes"`
+	MemorySource  string `json:"memory_source" yaml:"memory_source"`
+	CPUs          int    `json:"cpus" yaml:"cpus"`
+	CPUSource     string `json:"cpu_source" yaml:"cpu_source"`
+	PGVersion     string `json:"pg_version" yaml:"pg_version"`
+	WALDiskSize   uint64 `json:"wal_disk_size" yaml:"wal_disk_size"`
+	WALDiskShared bool   `json:"wal_disk_shared" yaml:"wal_disk_shared"`
+	Storage       string `json:"storage" yaml:"storage"`
+	Profile       string `json:"profile" yaml:"profile"`
+	Role          string `json:"role,omitempty" yaml:"role,omitempty"`
+	Replicas      int    `json:"replicas,omitempty" yaml:"replicas,omitempty"`
+
+	TimescaleDBVersion string `json:"timescaledb_version,omitempty" yaml:"timescaledb_version,omitempty"`
+	TimescaleDBJobs    int    `json:"timescaledb_jobs,omitempty" yaml:"timescaledb_jobs,omitempty"`
+	MaxBGWorkers       int    `json:"max_background_workers" yaml:"max_background_workers"`
+}
+
+// answerReport is an answer from the answers file that was used for a prompt.
+type answerReport struct {
+	Question string `json:"question" yaml:"question"`
+	Answer   string `json:"answer" yaml:"answer"`
+}
+
+type sharedLibReport struct {
+	Current     string `json:"current" yaml:"current"`
+	Commented   bool   `json:"commented" yaml:"commented"`
+	Missing     bool   `json:"missing" yaml:"missing"`
+	Recommended string `json:"recommended" yaml:"recommended"`
+	Action      string `json:"action" yaml:"action"`
+}
+
+type groupReport struct {
+	Label    string           `json:"label" yaml:"label"`
+	Settings []*settingReport `json:"settings" yaml:"settings"`
+}
+
+type settingReport struct {
+	Key         string `json:"key" yaml:"key"`
+	Current     string `json:"current" yaml:"current"`
+	Commented   bool   `json:"commented" yaml:"commented"`
+	Missing     bool   `json:"missing" yaml:"missing"`
+	Recommended string `json:"recommended" yaml:"recommended"`
+	WithinFudge bool   `json:"within_fudge_factor" yaml:"within_fudge_factor"`
+	Action      string `json:"action" yaml:"action"`
+	// only when the value was chosen by hand instead of the recommendation
+	ByHand bool   `json:"by_hand,omitempty" yaml:"by_hand,omitempty"`
+	Value  string `json:"value,omitempty" yaml:"value,omitempty"`
+	// only when the setting is pinned, and so never changed
+	Pinned    bool   `json:"pinned,omitempty" yaml:"pinned,omitempty"`
+	PinReason string `json:"pin_reason,omitempty" yaml:"pin_reason,omitempty"`
+
+	// only when connected to a running server
+	Running         string `json:"running,omitempty" yaml:"running,omitempty"`
+	Source          string `json:"source,omitempty" yaml:"source,omitempty"`
+	PendingRestart  bool   `json:"pending_restart,omitempty" yaml:"pending_restart,omitempty"`
+	RequiresRestart bool   `json:"requires_restart,omitempty" yaml:"requires_restart,omitempty"`
+}
+
+func newReport(config *pgtune.SystemConfig, profileName string) *report {
+	if profileName == "" {
+		profileName = defaultProfileName
+	}
+	r := &report{
+		System: &systemReport{
+			Memory:      parse.BytesToDecimalFormat(config.Memory),
+			MemoryBytes: config.Memory,
+			CPUs:        config.CPUs,
+			PGVersion:   config.PGMajorVersion,
+			WALDiskSize: config.WALDiskSize,
+			Storage:     config.Storage.String(),
+			Profile:     profileName,
+			Replicas:    config.Replicas,
+		},
+		Groups: []*groupReport{},
+	}
+	if config.Role != pgtune.RoleUnknown {
+		r.System.Role = config.Role.String()
+	}
+	return r
+}
+
+// newSharedLibReport describes the shared_preload_libraries setting found in
+// the conf file and what would be changed about it.
+func newSharedLibReport(res *sharedLibResult, lines []*configLine, extra ...string) *sharedLibReport {
+	if res == nil {
+		libs := strings.Join(append([]string{extName}, extra...), ",")
+		return &sharedLibReport{Missing: true, Recommended: libs, Action: actionAdd}
+	}
+	r := &sharedLibReport{
+		Current:     res.libs,
+		Commented:   res.commented,
+		Recommended: res.libs,
+		Action:      actionNone,
+	}
+	newLine := updateSharedLibLine(lines[res.idx].content, res, extra...)
+	if newLine != lines[res.idx].content {
+		r.Recommended = parseLineForSharedLibResult(newLine).libs
+		r.Action = actionUpdate
+		if res.commented {
+			r.Action = actionUncomment
+		}
+	}
+	return r
+}
+
+// newGroupReport describes each of the keys of a SettingsGroup, where show is
+// the result of checkIfShouldShowSetting for those keys.
+func newGroupReport(label string, keys []string, parseResults map[string]*tunableParseResult, recommender pgtune.Recommender, show map[string]bool) *groupReport {
+	g := &groupReport{Label: label, Settings: []*settingReport{}}
+	for _, k := range keys {
+		s := &settingReport{Key: k, Recommended: unquoteValue(recommender.Recommend(k)), Action: actionNone}
+		r, ok := parseResults[k]
+		if !ok {
+			s.Missing = true
+		} else {
+			s.Current = unquoteValue(r.value)
+			s.Commented = r.commented
+		}
+		// only a recommendation that was compared against can be close enough
+		s.WithinFudge = s.Recommended != pgtune.NoRecommendation && !s.Missing && !s.Commented && !show[k]
+
+		switch {
+		case s.Recommended == pgtune.NoRecommendation || !show[k]:
+			// leave as none
+		case s.Missing:
+			s.Action = actionAdd
+		case s.Commented:
+			s.Action = actionUncomment
+		default:
+			s.Action = actionUpdate
+		}
+		g.Settings = append(g.Settings, s)
+	}
+	return g
+}
+
+// skip marks every setting that would have been changed as skipped.
+func (g *groupReport) skip() {
+	for _, s := range g.Settings {
+		if s.Action != actionNone {
+			s.Action = actionSkip
+		}
+	}
+}
+
+// choose marks the settings that would have been changed as skipped, unless
+// they are in values, where those in byHand are marked as set by hand.
+func (g *groupReport) choose(values map[string]string, byHand map[string]bool) {
+	for _, s := range g.Settings {
+		if s.Action == actionNone {
+			continue
+		}
+		v, ok := values[s.Key]
+		if !ok {
+			s.Action = actionSkip
+		} else if byHand[s.Key] {
+			s.ByHand = true
+			s.Value = unquoteValue(v)
+		}
+	}
+}
+
+// writeReport outputs rep, which is a report or another document such as a
+// list of backups, to w in the given format.
+func writeReport(w io.Writer, rep interface{}, format string) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	case formatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(rep); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf(errUnknownFormatFmt, format, strings.Join([]string{formatJSON, formatYAML}, ", "))
+	}
+}
@@ -0,0 +1,261 @@
+package tstune
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+	"gopkg.in/yaml.v3"
+)
+
+func TestValidateFormat(t *testing.T) {
+	for _, f := range append(ValidFormats, "") {
+		if err := validateFormat(f); err != nil {
+			t.Errorf("%s: unexpected error: %v", f, err)
+		}
+	}
+	err := validateFormat("xml")
+	want := fmt.Sprintf(errUnknownFormatFmt, "xml", strings.Join(ValidFormats, ", "))
+	if err == nil || err.Error() != want {
+		t.Errorf("incorrect error: got %v want %s", err, want)
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	config := getDefaultSystemConfig(t)
+	rep := newReport(config, pgtune.DefaultProfile.String())
+	if got := rep.System.Profile; got != "default" {
+		t.Errorf("incorrect profile: got %s want default", got)
+	}
+	if got := rep.System.MemoryBytes; got != config.Memory {
+		t.Errorf("incorrect memory: got %d want %d", got, config.Memory)
+	}
+	if got := rep.System.CPUs; got != config.CPUs {
+		t.Errorf("incorrect CPUs: got %d want %d", got, config.CPUs)
+	}
+	rep = newReport(config, pgtune.PromscaleProfile.String())
+	if got := rep.System.Profile; got != "promscale" {
+		t.Errorf("incorrect profile: got %s want promscale", got)
+	}
+	rep = newReport(config, "ingest")
+	if got := rep.System.Profile; got != "ingest" {
+		t.Errorf("incorrect profile: got %s want ingest", got)
+	}
+}
+
+func TestNewSharedLibReport(t *testing.T) {
+	cases := []struct {
+		desc string
+		line string
+		want sharedLibReport
+	}{
+		{
+			desc: "missing",
+			want: sharedLibReport{Missing: true, Recommended: extName, Action: actionAdd},
+		},
+		{
+			desc: "already set",
+			line: "shared_preload_libraries = 'timescaledb'",
+			want: sharedLibReport{Current: extName, Recommended: extName, Action: actionNone},
+		},
+		{
+			desc: "commented",
+			line: "#shared_preload_libraries = 'timescaledb'",
+			want: sharedLibReport{Current: extName, Commented: true, Recommended: extName, Action: actionUncomment},
+		},
+		{
+			desc: "needs update",
+			line: "shared_preload_libraries = 'pg_stat_statements'",
+			want: sharedLibReport{Current: "pg_stat_statements", Recommended: "pg_stat_statements,timescaledb", Action: actionUpdate},
+		},
+	}
+
+	for _, c := range cases {
+		var res *sharedLibResult
+		lines := []*configLine{{content: c.line}}
+		if c.line != "" {
+			res = parseLineForSharedLibResult(c.line)
+		}
+		if got := newSharedLibReport(res, lines); *got != c.want {
+			t.Errorf("%s: incorrect report: got %+v want %+v", c.desc, *got, c.want)
+		}
+	}
+}
+
+func TestNewGroupReport(t *testing.T) {
+	config := getDefaultSystemConfig(t)
+	sg := mustGetSettingsGroup(t, pgtune.MemoryLabel, config)
+	recommender := sg.GetRecommender(pgtune.DefaultProfile)
+	lines := []string{
+		"#shared_buffers = 2GB",
+		"work_mem = 0kB",
+		"maintenance_work_mem = 1GB",
+	}
+	cfs, err := getConfigFileState(stringSliceToBytesReader(lines))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	show, err := checkIfShouldShowSetting(sg.Keys(), cfs.tuneParseResults, recommender, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	g := newGroupReport(sg.Label(), sg.Keys(), cfs.tuneParseResults, recommender, show)
+	if got := g.Label; got != pgtune.MemoryLabel {
+		t.Errorf("incorrect label: got %s want %s", got, pgtune.MemoryLabel)
+	}
+	want := map[string]settingReport{
+		pgtune.SharedBuffersKey:      {Current: "2GB", Commented: true, Action: actionUncomment},
+		pgtune.EffectiveCacheKey:     {Missing: true, Action: actionAdd},
+		pgtune.MaintenanceWorkMemKey: {Current: "1GB", WithinFudge: true, Action: actionNone},
+		pgtune.WorkMemKey:            {Current: "0kB", Action: actionUpdate},
+	}
+	if got := len(g.Settings); got != len(want) {
+		t.Fatalf("incorrect number of settings: got %d want %d", got, len(want))
+	}
+	for _, s := range g.Settings {
+		w, ok := want[s.Key]
+		if !ok {
+			t.Errorf("unexpected key: %s", s.Key)
+			continue
+		}
+		w.Key = s.Key
+		w.Recommended = recommender.Recommend(s.Key)
+		if *s != w {
+			t.Errorf("incorrect report for %s: got %+v want %+v", s.Key, *s, w)
+		}
+	}
+
+	g.skip()
+	for _, s := range g.Settings {
+		wantAction := actionSkip
+		if s.Key == pgtune.MaintenanceWorkMemKey {
+			wantAction = actionNone
+		}
+		if s.Action != wantAction {
+			t.Errorf("incorrect action after skip for %s: got %s want %s", s.Key, s.Action, wantAction)
+		}
+	}
+}
+
+func TestNewGroupReportNoRecommendation(t *testing.T) {
+	// no recommendation for jit before PostgreSQL 11
+	config := getDefaultSystemConfig(t)
+	sg := mustGetSettingsGroup(t, pgtune.MiscLabel, config)
+	recommender := sg.GetRecommender(pgtune.DefaultProfile)
+	keys := []string{pgtune.Jit}
+	lines := []string{"jit = on"}
+	cfs, err := getConfigFileState(stringSliceToBytesReader(lines))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	show, err := checkIfShouldShowSetting(keys, cfs.tuneParseResults, recommender, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	g := newGroupReport(sg.Label(), keys, cfs.tuneParseResults, recommender, show)
+	want := settingReport{Key: pgtune.Jit, Current: "on", Recommended: pgtune.NoRecommendation, Action: actionNone}
+	if got := len(g.Settings); got != 1 {
+		t.Fatalf("incorrect number of settings: got %d want %d", got, 1)
+	}
+	if got := *g.Settings[0]; got != want {
+		t.Errorf("incorrect report: got %+v want %+v", got, want)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	rep := newReport(getDefaultSystemConfig(t), pgtune.DefaultProfile.String())
+	rep.SharedLibs = &sharedLibReport{Missing: true, Recommended: extName, Action: actionAdd}
+	rep.Groups = append(rep.Groups, &groupReport{
+		Label:    pgtune.MemoryLabel,
+		Settings: []*settingReport{{Key: pgtune.WorkMemKey, Current: "0kB", Recommended: "64MB", Action: actionUpdate}},
+	})
+	rep.BackupPath = "/tmp/backup"
+
+	var buf bytes.Buffer
+	if err := writeReport(&buf, rep, formatJSON); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := &report{}
+	if err := json.Unmarshal(buf.Bytes(), got); err != nil {
+		t.Fatalf("could not unmarshal json: %v", err)
+	}
+	checkReportsEqual(t, formatJSON, got, rep)
+
+	buf.Reset()
+	if err := writeReport(&buf, rep, formatYAML); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got = &report{}
+	if err := yaml.Unmarshal(buf.Bytes(), got); err != nil {
+		t.Fatalf("could not unmarshal yaml: %v", err)
+	}
+	checkReportsEqual(t, formatYAML, got, rep)
+
+	if err := writeReport(&buf, rep, formatText); err == nil {
+		t.Errorf("unexpected lack of error for text format")
+	}
+}
+
+func checkReportsEqual(t *testing.T, desc string, got, want *report) {
+	if *got.System != *want.System {
+		t.Errorf("%s: incorrect system: got %+v want %+v", desc, *got.System, *want.System)
+	}
+	if *got.SharedLibs != *want.SharedLibs {
+		t.Errorf("%s: incorrect shared libs: got %+v want %+v", desc, *got.SharedLibs, *want.SharedLibs)
+	}
+	if got.BackupPath != want.BackupPath {
+		t.Errorf("%s: incorrect backup path: got %s want %s", desc, got.BackupPath, want.BackupPath)
+	}
+	if len(got.Groups) != len(want.Groups) {
+		t.Fatalf("%s: incorrect number of groups: got %d want %d", desc, len(got.Groups), len(want.Groups))
+	}
+	for i, g := range want.Groups {
+		if got.Groups[i].Label != g.Label || len(got.Groups[i].Settings) != len(g.Settings) {
+			t.Errorf("%s: incorrect group at %d: got %+v want %+v", desc, i, got.Groups[i], g)
+			continue
+		}
+		for j, s := range g.Settings {
+			if *got.Groups[i].Settings[j] != *s {
+				t.Errorf("%s: incorrect setting at %d/%d: got %+v want %+v", desc, i, j, *got.Groups[i].Settings[j], *s)
+			}
+		}
+	}
+}
+
+func TestTunerProcessSettingsGroupReport(t *testing.T) {
+	config := getDefaultSystemConfig(t)
+	cases := []struct {
+		desc       string
+		input      string
+		wantAction string
+	}{
+		{desc: "accepted", input: "y\n", wantAction: actionUpdate},
+		{desc: "skipped", input: "s\n", wantAction: actionSkip},
+	}
+
+	for _, c := range cases {
+		tuner := newTunerWithDefaultFlagsForInputs(t, c.input, memSettingsWrongVal)
+		tuner.report = newReport(config, pgtune.DefaultProfile.String())
+		err := tuner.processSettingsGroup(mustGetSettingsGroup(t, pgtune.MemoryLabel, config), pgtune.DefaultProfile)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.desc, err)
+		}
+		if got := len(tuner.report.Groups); got != 1 {
+			t.Fatalf("%s: incorrect number of groups: got %d want 1", c.desc, got)
+		}
+		for _, s := range tuner.report.Groups[0].Settings {
+			want := actionNone
+			if s.Key == pgtune.WorkMemKey {
+				want = c.wantAction
+			}
+			if s.Action != want {
+				t.Errorf("%s: incorrect action for %s: got %s want %s", c.desc, s.Key, s.Action, want)
+			}
+		}
+	}
+}
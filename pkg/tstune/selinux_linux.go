@@ -0,0 +1,27 @@
+package tstune
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const selinuxXattr = "security.selinux"
+
+// copySELinuxLabel gives f the same SELinux security context as the file at
+// path, so that a confined postgres can still read it after it is replaced.
+func copySELinuxLabel(path string, f *os.File) error {
+	buf := make([]byte, 256)
+	for {
+		n, err := unix.Lgetxattr(path, selinuxXattr, buf)
+		if err == unix.ERANGE {
+			buf = make([]byte, len(buf)*2)
+			continue
+		}
+		if err != nil {
+			// ENODATA or ENOTSUP means there is no label to copy
+			return err
+		}
+		return unix.Fsetxattr(int(f.Fd()), selinuxXattr, buf[:n], 0)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package tstune
+
+import "os"
+
+// copySELinuxLabel does nothing since SELinux only exists on Linux.
+func copySELinuxLabel(path string, f *os.File) error {
+	return nil
+}
@@ -13,6 +13,7 @@ var sharedRegex = regexp.MustCompile("(#+?\\s*)?shared_preload_libraries = '(.*?
 // line of a postgresql.conf file.
 type sharedLibResult struct {
 	idx          int    // the line index where this result was parsed
+	file         string // path of the file the line was parsed from
 	commented    bool   // whether the line is currently commented out (i.e., prepended by #)
 	hasTimescale bool   // whether 'timescaledb' appears in the list of libraries
 	commentGroup string // the combination of # + spaces that appear before the key / value
@@ -37,23 +38,43 @@ func parseLineForSharedLibResult(line string) *sharedLibResult {
 }
 
 // updateSharedLibLine takes a given line that matched the shared_preload_libraries
-// regex and updates it to validly include the 'timescaledb' extension.
-func updateSharedLibLine(line string, parseResult *sharedLibResult) string {
+// regex and updates it to validly include the 'timescaledb' extension, as well
+// as any extra libraries that are needed.
+func updateSharedLibLine(line string, parseResult *sharedLibResult, extra ...string) string {
 	res := line
 	if parseResult.commented {
 		res = strings.Replace(res, parseResult.commentGroup, "", 1)
 	}
 
-	if parseResult.hasTimescale {
+	missing := []string{}
+	if !parseResult.hasTimescale {
+		missing = append(missing, extName)
+	}
+	for _, lib := range extra {
+		if !parseResult.hasLib(lib) {
+			missing = append(missing, lib)
+		}
+	}
+	if len(missing) == 0 {
 		return res
 	}
 	newLibsVal := "= '"
 	if len(parseResult.libs) > 0 {
 		newLibsVal += parseResult.libs + ","
 	}
-	newLibsVal += extName + "'"
+	newLibsVal += strings.Join(missing, ",") + "'"
 	replaceVal := "= '" + parseResult.libs + "'"
 	res = strings.Replace(res, replaceVal, newLibsVal, 1)
 
 	return res
 }
+
+// hasLib returns whether lib appears in the list of libraries.
+func (r *sharedLibResult) hasLib(lib string) bool {
+	for _, l := range strings.Split(r.libs, ",") {
+		if strings.Trim(strings.TrimSpace(l), `"`) == lib {
+			return true
+		}
+	}
+	return false
+}
@@ -226,3 +226,45 @@ func TestUpdateSharedLibLine(t *testing.T) {
 		}
 	}
 }
+
+func TestUpdateSharedLibLineExtra(t *testing.T) {
+	confKey := "shared_preload_libraries = "
+	extra := "pg_stat_statements"
+	cases := []struct {
+		desc     string
+		original string
+		want     string
+	}{
+		{
+			desc:     "both need to be added",
+			original: confKey + "''",
+			want:     confKey + "'" + extName + "," + extra + "'",
+		},
+		{
+			desc:     "only extra needs to be added",
+			original: confKey + "'" + extName + "' # (change requires restart)",
+			want:     confKey + "'" + extName + "," + extra + "' # (change requires restart)",
+		},
+		{
+			desc:     "already there with spaces",
+			original: "#" + confKey + "'pg_stat_statements, timescaledb'",
+			want:     confKey + "'pg_stat_statements, timescaledb'",
+		},
+		{
+			desc:     "similar name is not enough",
+			original: confKey + "'timescaledb,pg_stat_statements_ext'",
+			want:     confKey + "'timescaledb,pg_stat_statements_ext," + extra + "'",
+		},
+	}
+
+	for _, c := range cases {
+		res := parseLineForSharedLibResult(c.original)
+		if res == nil {
+			t.Fatalf("%s: parsing gave unexpected nil", c.desc)
+		}
+		got := updateSharedLibLine(c.original, res, extra)
+		if got != c.want {
+			t.Errorf("%s: incorrect result: got\n%s\nwant\n%s", c.desc, got, c.want)
+		}
+	}
+}
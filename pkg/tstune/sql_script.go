@@ -0,0 +1,136 @@
+package tstune
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+const (
+	sharedLibsKey = "shared_preload_libraries"
+
+	sqlHeaderFmt        = "-- Generated by timescaledb-tune %s on %s\n"
+	sqlAutocommitNote   = "-- ALTER SYSTEM cannot run inside a transaction block; run with autocommit on.\n"
+	sqlAlterSystemFmt   = "ALTER SYSTEM SET %s = %s;"
+	sqlRestartComment   = " -- requires restart"
+	sqlRestartFooter    = "-- Settings marked 'requires restart' only take effect after PostgreSQL is restarted.\n"
+	sqlReloadConf       = "SELECT pg_reload_conf();\n"
+	statementSQLWriting = "Writing ALTER SYSTEM script to: "
+)
+
+// settingChange is a setting whose new value was accepted by the user.
+type settingChange struct {
+	key   string
+	value string
+}
+
+// recordChange keeps track of the new value for key that was accepted by the
+// user, so that it can be output in forms other than the conf file. If a key is
+// changed more than once, only the latest value is kept.
+func (t *Tuner) recordChange(key, value string) {
+	delete(t.byHand, key)
+	for _, c := range t.changes {
+		if c.key == key {
+			c.value = value
+			return
+		}
+	}
+	t.changes = append(t.changes, &settingChange{key, value})
+}
+
+// dropChange forgets the change to key, for when it was undone.
+func (t *Tuner) dropChange(key string) {
+	delete(t.byHand, key)
+	for i, c := range t.changes {
+		if c.key == key {
+			t.changes = append(t.changes[:i], t.changes[i+1:]...)
+			return
+		}
+	}
+}
+
+// recordChangeByHand is recordChange for a value that the user chose instead
+// of the recommendation rec.
+func (t *Tuner) recordChangeByHand(key, value, rec string) {
+	t.recordChange(key, value)
+	if t.byHand == nil {
+		t.byHand = make(map[string]string)
+	}
+	t.byHand[key] = rec
+}
+
+// sqlQuoteLiteral quotes s as a SQL string literal.
+func sqlQuoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// alterSystemStatement returns the ALTER SYSTEM statement that sets key to
+// value. shared_preload_libraries is a list, so each of its elements needs to
+// be given as its own literal; otherwise PostgreSQL would treat the whole
+// string as the name of a single library.
+func alterSystemStatement(key, value string) string {
+	value = unquoteValue(value)
+	if key != sharedLibsKey {
+		return fmt.Sprintf(sqlAlterSystemFmt, key, sqlQuoteLiteral(value))
+	}
+	libs := []string{}
+	for _, lib := range strings.Split(value, ",") {
+		lib = strings.Trim(strings.TrimSpace(lib), `"`)
+		if lib != "" {
+			libs = append(libs, sqlQuoteLiteral(lib))
+		}
+	}
+	return fmt.Sprintf(sqlAlterSystemFmt, key, strings.Join(libs, ", "))
+}
+
+// writeSQLScript writes changes as a script of ALTER SYSTEM statements that
+// ends by reloading the configuration. Running it more than once has the same
+// effect as running it once.
+func writeSQLScript(w io.Writer, changes []*settingChange, now time.Time) error {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, sqlHeaderFmt, Version, now.Format(time.RFC3339))
+	sb.WriteString(sqlAutocommitNote)
+	sb.WriteString("\n")
+
+	needsRestart := false
+	for _, c := range changes {
+		sb.WriteString(alterSystemStatement(c.key, c.value))
+		if pgtune.RequiresRestart(c.key) {
+			needsRestart = true
+			sb.WriteString(sqlRestartComment)
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(sqlReloadConf)
+	if needsRestart {
+		sb.WriteString(sqlRestartFooter)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeSQLFile writes the accepted changes as an ALTER SYSTEM script to
+// outPath, or to stdout if outPath is "-".
+func (t *Tuner) writeSQLFile(outPath string, stdout io.Writer) error {
+	if outPath == "-" {
+		return writeSQLScript(stdout, t.changes, time.Now())
+	}
+
+	t.handler.p.Statement(statementSQLWriting + outPath)
+	f, err := osCreateFn(outPath)
+	if err != nil {
+		return fmt.Errorf(errCouldNotWriteFmt, outPath, err)
+	}
+	defer f.Close()
+
+	err = writeSQLScript(f, t.changes, time.Now())
+	if err != nil {
+		return fmt.Errorf(errCouldNotWriteFmt, outPath, err)
+	}
+	return nil
+}
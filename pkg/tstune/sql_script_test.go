@@ -0,0 +1,197 @@
+package tstune
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+func TestAlterSystemStatement(t *testing.T) {
+	cases := []struct {
+		desc  string
+		key   string
+		value string
+		want  string
+	}{
+		{
+			desc:  "plain value",
+			key:   pgtune.SharedBuffersKey,
+			value: "2GB",
+			want:  "ALTER SYSTEM SET shared_buffers = '2GB';",
+		},
+		{
+			desc:  "quoted value",
+			key:   "log_line_prefix",
+			value: "'%m [%p] '",
+			want:  "ALTER SYSTEM SET log_line_prefix = '%m [%p] ';",
+		},
+		{
+			desc:  "value with quote",
+			key:   "log_line_prefix",
+			value: "it's",
+			want:  "ALTER SYSTEM SET log_line_prefix = 'it''s';",
+		},
+		{
+			desc:  "single shared lib",
+			key:   sharedLibsKey,
+			value: "timescaledb",
+			want:  "ALTER SYSTEM SET shared_preload_libraries = 'timescaledb';",
+		},
+		{
+			desc:  "multiple shared libs",
+			key:   sharedLibsKey,
+			value: "timescaledb, pg_stat_statements,\"other\"",
+			want:  "ALTER SYSTEM SET shared_preload_libraries = 'timescaledb', 'pg_stat_statements', 'other';",
+		},
+	}
+
+	for _, c := range cases {
+		if got := alterSystemStatement(c.key, c.value); got != c.want {
+			t.Errorf("%s: incorrect statement: got\n%s\nwant\n%s", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestWriteSQLScript(t *testing.T) {
+	now := time.Date(2019, 1, 22, 20, 56, 0, 0, time.UTC)
+	header := fmt.Sprintf(sqlHeaderFmt, Version, now.Format(time.RFC3339)) + sqlAutocommitNote + "\n"
+	cases := []struct {
+		desc    string
+		changes []*settingChange
+		want    string
+	}{
+		{
+			desc:    "no changes",
+			changes: []*settingChange{},
+			want:    header + "\n" + sqlReloadConf,
+		},
+		{
+			desc:    "no restart needed",
+			changes: []*settingChange{{pgtune.WorkMemKey, "64MB"}},
+			want:    header + "ALTER SYSTEM SET work_mem = '64MB';\n\n" + sqlReloadConf,
+		},
+		{
+			desc: "restart needed",
+			changes: []*settingChange{
+				{sharedLibsKey, "timescaledb"},
+				{pgtune.WorkMemKey, "64MB"},
+			},
+			want: header +
+				"ALTER SYSTEM SET shared_preload_libraries = 'timescaledb';" + sqlRestartComment + "\n" +
+				"ALTER SYSTEM SET work_mem = '64MB';\n\n" +
+				sqlReloadConf + sqlRestartFooter,
+		},
+	}
+
+	for _, c := range cases {
+		var buf strings.Builder
+		if err := writeSQLScript(&buf, c.changes, now); err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.desc, err)
+		}
+		if got := buf.String(); got != c.want {
+			t.Errorf("%s: incorrect script: got\n%s\nwant\n%s", c.desc, got, c.want)
+		}
+	}
+
+	w := &testWriter{shouldErr: true}
+	if err := writeSQLScript(w, nil, now); err == nil {
+		t.Errorf("unexpected lack of error on write")
+	}
+}
+
+func TestTunerRecordChange(t *testing.T) {
+	tuner := &Tuner{}
+	tuner.recordChange(pgtune.WorkMemKey, "64MB")
+	tuner.recordChange(sharedLibsKey, "timescaledb")
+	tuner.recordChange(pgtune.WorkMemKey, "128MB")
+
+	want := []settingChange{{pgtune.WorkMemKey, "128MB"}, {sharedLibsKey, "timescaledb"}}
+	if got := len(tuner.changes); got != len(want) {
+		t.Fatalf("incorrect number of changes: got %d want %d", got, len(want))
+	}
+	for i, c := range want {
+		if got := *tuner.changes[i]; got != c {
+			t.Errorf("incorrect change at %d: got %v want %v", i, got, c)
+		}
+	}
+}
+
+func TestTunerChangesRecorded(t *testing.T) {
+	lines := []string{"#shared_preload_libraries = 'timescaledb'"}
+	tuner := newTunerWithDefaultFlagsForInputs(t, "y\ny\n", lines)
+
+	if err := tuner.processSharedLibLine(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := tuner.processSettingsGroup(mustGetSettingsGroup(t, pgtune.MemoryLabel, getDefaultSystemConfig(t)), pgtune.DefaultProfile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// shared lib, then every key in the memory group
+	wantKeys := append([]string{sharedLibsKey}, pgtune.MemoryKeys...)
+	if got := len(tuner.changes); got != len(wantKeys) {
+		t.Fatalf("incorrect number of changes: got %d want %d", got, len(wantKeys))
+	}
+	for i, key := range wantKeys {
+		if got := tuner.changes[i].key; got != key {
+			t.Errorf("incorrect key at %d: got %s want %s", i, got, key)
+		}
+	}
+	if got := tuner.changes[0].value; got != extName {
+		t.Errorf("incorrect shared lib value: got %s want %s", got, extName)
+	}
+}
+
+func TestTunerWriteSQLFile(t *testing.T) {
+	wantPath := "tune.sql"
+	errCreate := "could not create"
+	oldOSCreateFn := osCreateFn
+	defer func() { osCreateFn = oldOSCreateFn }()
+
+	tuner := newTunerWithDefaultFlagsForInputs(t, "", []string{})
+	tuner.recordChange(pgtune.WorkMemKey, "64MB")
+
+	// stdout
+	stdout := &testWriter{}
+	if err := tuner.writeSQLFile("-", stdout); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(stdout.lines, ""); !strings.Contains(got, "ALTER SYSTEM SET work_mem = '64MB';\n") {
+		t.Errorf("missing statement in stdout output:\n%s", got)
+	}
+
+	// file
+	var buf testBufferCloser
+	osCreateFn = func(p string) (io.WriteCloser, error) {
+		if p != wantPath {
+			return nil, fmt.Errorf(errCreate)
+		}
+		return &buf, nil
+	}
+	if err := tuner.writeSQLFile(wantPath, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := buf.b.String(); !strings.HasSuffix(got, sqlReloadConf) {
+		t.Errorf("script does not end with reload:\n%s", got)
+	}
+
+	// create error
+	err := tuner.writeSQLFile("other.sql", nil)
+	want := fmt.Sprintf(errCouldNotWriteFmt, "other.sql", errCreate)
+	if err == nil || err.Error() != want {
+		t.Errorf("incorrect error: got %v want %s", err, want)
+	}
+
+	// write error
+	buf.shouldErr = true
+	err = tuner.writeSQLFile(wantPath, nil)
+	want = fmt.Sprintf(errCouldNotWriteFmt, wantPath, errTestWriter)
+	if err == nil || err.Error() != want {
+		t.Errorf("incorrect error: got %v want %s", err, want)
+	}
+}
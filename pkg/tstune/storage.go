@@ -0,0 +1,245 @@
+package tstune
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+const (
+	defaultMountInfoPath = "/proc/self/mountinfo"
+	defaultSysRoot       = "/sys"
+
+	statementStorageFmt = "Data directory is on %s storage"
+	errStorageDetectFmt = "could not detect storage type: %v"
+	errMountInfoLineFmt = "malformed mountinfo line: %s"
+	errNoMountFmt       = "no mount found for %s"
+)
+
+// networkFSTypes are filesystem types whose data lives across the network
+var networkFSTypes = map[string]bool{
+	"nfs":            true,
+	"nfs4":           true,
+	"cifs":           true,
+	"smb3":           true,
+	"smbfs":          true,
+	"ceph":           true,
+	"glusterfs":      true,
+	"fuse.glusterfs": true,
+	"fuse.sshfs":     true,
+	"lustre":         true,
+	"gpfs":           true,
+	"9p":             true,
+}
+
+// networkBlockModels are substrings of the model of block devices that look
+// local but are really network storage, e.g., EBS volumes attached as NVMe
+var networkBlockModels = []string{
+	"Amazon Elastic Block Store",
+	"PersistentDisk", // Google Cloud
+}
+
+// virtualBlockPrefixes are prefixes of the names of paravirtualized block
+// devices (virtio and Xen), and virtualBlockModels substrings of the models of
+// emulated disks. These say they are rotational whatever is behind them, so
+// nothing can be told from them.
+var (
+	virtualBlockPrefixes = []string{"vd", "xvd"}
+	virtualBlockModels   = []string{
+		"QEMU",
+		"VBOX",
+		"Virtual disk", // VMware and Hyper-V
+	}
+)
+
+// mountInfo is the part of a /proc/self/mountinfo line that we care about
+type mountInfo struct {
+	device     string // major:minor of the device
+	mountPoint string
+	fsType     string
+}
+
+// parseMountInfoLine parses a line of /proc/self/mountinfo, which looks like:
+//
+//	36 35 98:0 /mnt1 /mnt/parent rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+//
+// where the number of optional fields before the "-" separator varies.
+func parseMountInfoLine(line string) (*mountInfo, error) {
+	fields := strings.Fields(line)
+	sep := -1
+	for i := 6; i < len(fields); i++ {
+		if fields[i] == "-" {
+			sep = i
+			break
+		}
+	}
+	if len(fields) < 5 || sep == -1 || sep+1 >= len(fields) {
+		return nil, fmt.Errorf(errMountInfoLineFmt, line)
+	}
+	return &mountInfo{
+		device:     fields[2],
+		mountPoint: unescapeMountPath(fields[4]),
+		fsType:     fields[sep+1],
+	}, nil
+}
+
+// unescapeMountPath undoes the octal escaping of spaces, tabs, newlines and
+// backslashes in mountinfo paths.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// findMount returns the mount from mountinfoPath that path is on, i.e., the
+// one with the longest mount point that contains path.
+func findMount(path, mountinfoPath string) (*mountInfo, error) {
+	f, err := os.Open(mountinfoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var best *mountInfo
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		m, err := parseMountInfoLine(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		if !pathHasPrefix(path, m.mountPoint) {
+			continue
+		}
+		// later mounts on the same point hide earlier ones, so >= is needed
+		if best == nil || len(m.mountPoint) >= len(best.mountPoint) {
+			best = m
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if best == nil {
+		return nil, fmt.Errorf(errNoMountFmt, path)
+	}
+	return best, nil
+}
+
+// pathHasPrefix returns whether path is dir or is inside of dir.
+func pathHasPrefix(path, dir string) bool {
+	if dir == "/" || path == dir {
+		return true
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// blockDeviceName returns the name of the whole disk (e.g. "sda" for /dev/sda1)
+// with the given major:minor, as found under sysRoot.
+func blockDeviceName(device, sysRoot string) (string, error) {
+	devPath, err := filepath.EvalSymlinks(filepath.Join(sysRoot, "dev", "block", device))
+	if err != nil {
+		return "", err
+	}
+	// partitions are a subdirectory of their disk
+	if fileExists(filepath.Join(devPath, "partition")) {
+		devPath = filepath.Dir(devPath)
+	}
+	return filepath.Base(devPath), nil
+}
+
+// detectStorageClass probes what kind of storage dataDir is on, by finding its
+// mount in mountinfoPath and then looking at the block device in sysRoot.
+// Returns pgtune.StorageUnknown if the mount is not backed by a block device
+// we can find, e.g., an overlay filesystem, or by one that does not say what
+// it really is, i.e., a virtual disk or one without a model.
+func detectStorageClass(dataDir, mountinfoPath, sysRoot string) (pgtune.StorageClass, error) {
+	path, err := filepath.EvalSymlinks(dataDir)
+	if err != nil {
+		return pgtune.StorageUnknown, err
+	}
+	m, err := findMount(path, mountinfoPath)
+	if err != nil {
+		return pgtune.StorageUnknown, err
+	}
+	if networkFSTypes[m.fsType] {
+		return pgtune.StorageNetwork, nil
+	}
+
+	name, err := blockDeviceName(m.device, sysRoot)
+	if err != nil {
+		return pgtune.StorageUnknown, nil
+	}
+	blockDir := filepath.Join(sysRoot, "block", name)
+	model, ok, _ := readSysFile(filepath.Join(blockDir, "device", "model"))
+	for _, nm := range networkBlockModels {
+		if strings.Contains(model, nm) {
+			return pgtune.StorageNetwork, nil
+		}
+	}
+	if !ok || model == "" || isVirtualBlockDevice(name, model) {
+		return pgtune.StorageUnknown, nil
+	}
+	rotational, ok, err := readSysFile(filepath.Join(blockDir, "queue", "rotational"))
+	if err != nil {
+		return pgtune.StorageUnknown, err
+	} else if !ok {
+		return pgtune.StorageUnknown, nil
+	}
+	if rotational == "1" {
+		return pgtune.StorageHDD, nil
+	}
+	return pgtune.StorageSSD, nil
+}
+
+// isVirtualBlockDevice returns whether the block device with the given name
+// and model is a virtual disk.
+func isVirtualBlockDevice(name, model string) bool {
+	for _, p := range virtualBlockPrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	for _, vm := range virtualBlockModels {
+		if strings.Contains(model, vm) {
+			return true
+		}
+	}
+	return false
+}
+
+// processStorage fills in the storage class of config by probing the data
+// directory, unless it was given by a flag.
+func (t *Tuner) processStorage(config *pgtune.SystemConfig, confPath string) {
+	if t.flags.Storage != "" {
+		return
+	}
+	dataDir := getDataDirectory(t.cfs, confPath)
+	if dataDir == "" || !fileExists(defaultMountInfoPath) {
+		return
+	}
+	storage, err := detectStorageClass(dataDir, defaultMountInfoPath, defaultSysRoot)
+	if err != nil {
+		t.handler.p.Error("warning", errStorageDetectFmt, err)
+		return
+	}
+	config.Storage = storage
+	if storage != pgtune.StorageUnknown {
+		t.handler.p.Statement(statementStorageFmt, storage)
+	}
+}
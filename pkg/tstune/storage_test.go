@@ -0,0 +1,245 @@
+package tstune
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+)
+
+func TestParseMountInfoLine(t *testing.T) {
+	cases := []struct {
+		desc   string
+		line   string
+		want   mountInfo
+		errMsg string
+	}{
+		{
+			desc: "optional fields",
+			line: "36 35 98:0 /mnt1 /mnt/parent rw,noatime master:1 - ext3 /dev/root rw,errors=continue",
+			want: mountInfo{device: "98:0", mountPoint: "/mnt/parent", fsType: "ext3"},
+		},
+		{
+			desc: "no optional fields",
+			line: "25 1 8:1 / / rw,relatime - ext4 /dev/sda1 rw",
+			want: mountInfo{device: "8:1", mountPoint: "/", fsType: "ext4"},
+		},
+		{
+			desc: "escaped space",
+			line: `40 25 0:45 / /mnt/my\040data rw shared:5 - nfs4 server:/export rw`,
+			want: mountInfo{device: "0:45", mountPoint: "/mnt/my data", fsType: "nfs4"},
+		},
+		{
+			desc:   "no separator",
+			line:   "25 1 8:1 / / rw,relatime ext4 /dev/sda1 rw",
+			errMsg: fmt.Sprintf(errMountInfoLineFmt, "25 1 8:1 / / rw,relatime ext4 /dev/sda1 rw"),
+		},
+		{
+			desc:   "too short",
+			line:   "25 1 8:1",
+			errMsg: fmt.Sprintf(errMountInfoLineFmt, "25 1 8:1"),
+		},
+	}
+
+	for _, c := range cases {
+		got, err := parseMountInfoLine(c.line)
+		if c.errMsg != "" {
+			if err == nil || err.Error() != c.errMsg {
+				t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, c.errMsg)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if *got != c.want {
+			t.Errorf("%s: incorrect result: got %+v want %+v", c.desc, *got, c.want)
+		}
+	}
+}
+
+func TestPathHasPrefix(t *testing.T) {
+	cases := []struct {
+		path string
+		dir  string
+		want bool
+	}{
+		{"/var/lib/postgresql", "/", true},
+		{"/var/lib/postgresql", "/var/lib", true},
+		{"/var/lib/postgresql", "/var/lib/postgresql", true},
+		{"/var/lib/postgresql", "/var/lib/postgres", false},
+		{"/var/lib/postgresql", "/srv", false},
+	}
+	for _, c := range cases {
+		if got := pathHasPrefix(c.path, c.dir); got != c.want {
+			t.Errorf("%s in %s: got %v want %v", c.path, c.dir, got, c.want)
+		}
+	}
+}
+
+// setupStorageFixture creates a fake sysfs with a rotational disk (sda, with
+// partition sda1 as 8:1), a solid state disk (nvme0n1 as 259:0), an EBS
+// volume (nvme1n1 as 259:1), and virtual disks that say they are rotational:
+// virtio (vda as 252:0), Xen (xvda as 202:0), an emulated disk (sdb as 8:16),
+// and one without a model (sdc as 8:32), plus a data directory at data/ and a
+// mountinfo file with mountLine, formatted with the fixture's root directory.
+func setupStorageFixture(t *testing.T, mountLine string) (string, string, string) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("could not resolve temp dir: %v", err)
+	}
+	sysRoot := filepath.Join(root, "sys")
+	devices := filepath.Join(sysRoot, "devices")
+	mkdir := func(p string) {
+		if err := os.MkdirAll(p, 0755); err != nil {
+			t.Fatalf("could not create dir: %v", err)
+		}
+	}
+	write := func(p, content string) {
+		mkdir(filepath.Dir(p))
+		if err := os.WriteFile(p, []byte(content+"\n"), 0644); err != nil {
+			t.Fatalf("could not write file: %v", err)
+		}
+	}
+	link := func(target, name string) {
+		mkdir(filepath.Dir(name))
+		if err := os.Symlink(target, name); err != nil {
+			t.Fatalf("could not create symlink: %v", err)
+		}
+	}
+
+	disks := map[string]struct {
+		dev        string
+		part       string
+		rotational string
+		model      string
+	}{
+		"sda":     {dev: "8:0", part: "8:1", rotational: "1", model: "ST4000DM004"},
+		"nvme0n1": {dev: "259:0", rotational: "0", model: "Samsung SSD 970"},
+		"nvme1n1": {dev: "259:1", rotational: "0", model: "Amazon Elastic Block Store"},
+		"vda":     {dev: "252:0", rotational: "1"},
+		"xvda":    {dev: "202:0", rotational: "1"},
+		"sdb":     {dev: "8:16", rotational: "1", model: "QEMU HARDDISK"},
+		"sdc":     {dev: "8:32", rotational: "1"},
+	}
+	for name, d := range disks {
+		diskDir := filepath.Join(devices, "pci0000:00", "block", name)
+		write(filepath.Join(diskDir, "queue", "rotational"), d.rotational)
+		if d.model != "" {
+			write(filepath.Join(diskDir, "device", "model"), d.model)
+		}
+		link(diskDir, filepath.Join(sysRoot, "block", name))
+		link(diskDir, filepath.Join(sysRoot, "dev", "block", d.dev))
+		if d.part != "" {
+			partDir := filepath.Join(diskDir, name+"1")
+			write(filepath.Join(partDir, "partition"), "1")
+			link(partDir, filepath.Join(sysRoot, "dev", "block", d.part))
+		}
+	}
+
+	dataDir := filepath.Join(root, "data")
+	mkdir(dataDir)
+	mountinfo := filepath.Join(root, "mountinfo")
+	write(mountinfo, "25 1 8:1 / / rw,relatime - ext4 /dev/sda1 rw\n"+fmt.Sprintf(mountLine, root))
+	return dataDir, mountinfo, sysRoot
+}
+
+func TestDetectStorageClass(t *testing.T) {
+	cases := []struct {
+		desc      string
+		mountLine string
+		want      pgtune.StorageClass
+	}{
+		{
+			desc:      "hdd partition",
+			mountLine: "30 25 8:1 / %s/data rw - ext4 /dev/sda1 rw",
+			want:      pgtune.StorageHDD,
+		},
+		{
+			desc:      "ssd",
+			mountLine: "30 25 259:0 / %s/data rw shared:1 - xfs /dev/nvme0n1 rw",
+			want:      pgtune.StorageSSD,
+		},
+		{
+			desc:      "ebs",
+			mountLine: "30 25 259:1 / %s/data rw - xfs /dev/nvme1n1 rw",
+			want:      pgtune.StorageNetwork,
+		},
+		{
+			desc:      "nfs",
+			mountLine: "30 25 0:50 / %s/data rw - nfs4 server:/export rw",
+			want:      pgtune.StorageNetwork,
+		},
+		{
+			desc:      "overlay",
+			mountLine: "30 25 0:51 / %s/data rw - overlay overlay rw",
+			want:      pgtune.StorageUnknown,
+		},
+		{
+			desc:      "virtio",
+			mountLine: "30 25 252:0 / %s/data rw - ext4 /dev/vda rw",
+			want:      pgtune.StorageUnknown,
+		},
+		{
+			desc:      "xen",
+			mountLine: "30 25 202:0 / %s/data rw - ext4 /dev/xvda rw",
+			want:      pgtune.StorageUnknown,
+		},
+		{
+			desc:      "emulated",
+			mountLine: "30 25 8:16 / %s/data rw - ext4 /dev/sdb rw",
+			want:      pgtune.StorageUnknown,
+		},
+		{
+			desc:      "no model",
+			mountLine: "30 25 8:32 / %s/data rw - ext4 /dev/sdc rw",
+			want:      pgtune.StorageUnknown,
+		},
+		{
+			desc:      "parent mount",
+			mountLine: "30 25 259:0 / %s rw - xfs /dev/nvme0n1 rw",
+			want:      pgtune.StorageSSD,
+		},
+	}
+
+	for _, c := range cases {
+		dataDir, mountinfo, sysRoot := setupStorageFixture(t, c.mountLine)
+		got, err := detectStorageClass(dataDir, mountinfo, sysRoot)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if got != c.want {
+			t.Errorf("%s: incorrect storage: got %v want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestDetectStorageClassErr(t *testing.T) {
+	dataDir, mountinfo, sysRoot := setupStorageFixture(t, "30 25 8:1 / %s/data rw - ext4 /dev/sda1 rw")
+	if _, err := detectStorageClass(filepath.Join(dataDir, "missing"), mountinfo, sysRoot); err == nil {
+		t.Errorf("unexpected lack of error for missing data dir")
+	}
+	if _, err := detectStorageClass(dataDir, filepath.Join(dataDir, "missing"), sysRoot); err == nil {
+		t.Errorf("unexpected lack of error for missing mountinfo")
+	}
+	if err := os.WriteFile(mountinfo, []byte("garbage\n"), 0644); err != nil {
+		t.Fatalf("could not write mountinfo: %v", err)
+	}
+	if _, err := detectStorageClass(dataDir, mountinfo, sysRoot); err == nil {
+		t.Errorf("unexpected lack of error for bad mountinfo")
+	}
+}
+
+func TestTunerInitializeSystemConfigStorage(t *testing.T) {
+	tuner := &Tuner{flags: &TunerFlags{PGVersion: "12", Storage: "hdd"}}
+	config, err := tuner.initializeSystemConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := config.Storage; got != pgtune.StorageHDD {
+		t.Errorf("incorrect storage: got %v want %v", got, pgtune.StorageHDD)
+	}
+
+	tuner.flags.Storage = "tape"
+	if _, err = tuner.initializeSystemConfig(); err == nil {
+		t.Errorf("unexpected lack of error for bad storage")
+	}
+}
@@ -0,0 +1,137 @@
+package tstune
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+const (
+	controlFileName = extName + ".control"
+
+	sqlExtVersion       = "SELECT extversion FROM pg_extension WHERE extname = '" + extName + "'"
+	sqlJobsCount        = "SELECT count(*) FROM timescaledb_information.jobs"
+	sourcePGExt         = "pg_extension"
+	errNoVersionInFmt   = "no default_version in %s"
+	errSharedirFmt      = "could not execute `%s --sharedir`: %v"
+	errPGConfigMajorFmt = "%s is for PostgreSQL %s, not %s"
+
+	statementTimescaleDBFmt      = "Tuning for TimescaleDB %s (from %s)"
+	statementJobsFmt             = "Found %d scheduled TimescaleDB jobs, using %d background workers"
+	warningTimescaleDBUnknownFmt = "could not detect the TimescaleDB version (%v); only tuning settings every version has"
+	warningTimescaleDBParseFmt   = "unrecognized TimescaleDB version %s; only tuning settings every version has"
+	warningJobsQueryFmt          = "could not count TimescaleDB jobs: %v"
+	warningBGWorkersForJobsFmt   = "%d background workers are fewer than the %d needed to run all %d jobs at once"
+)
+
+// allows us to substitute mock versions in tests
+var getPGConfigSharedirFn = pgutils.GetPGConfigSharedirAtPath
+
+var controlVersionRegex = regexp.MustCompile(`^\s*default_version\s*=\s*'([^']*)'`)
+
+// readControlFileVersion returns the default_version of the extension control
+// file at path, which is the version CREATE EXTENSION installs.
+func readControlFileVersion(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if res := controlVersionRegex.FindStringSubmatch(scanner.Text()); res != nil {
+			return res[1], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf(errNoVersionInFmt, path)
+}
+
+// processTimescaleDB finds out which version of TimescaleDB recommendations
+// should be for, and how many jobs it has scheduled, and updates config. The
+// version installed in the database we are connected to is preferred over the
+// one in the extension control file, which may be newer if the extension has
+// not been updated yet. If neither can be found, recommendations are limited to
+// settings every version has.
+func (t *Tuner) processTimescaleDB(config *pgtune.SystemConfig, conn pgConn) {
+	version, source := "", ""
+	if conn != nil {
+		v, err := conn.QueryString(sqlExtVersion)
+		if err == nil && v != "" {
+			version, source = v, sourcePGExt
+		}
+	}
+	if version == "" {
+		var err error
+		version, source, err = t.controlFileVersion(config.PGMajorVersion)
+		if err != nil {
+			t.handler.p.Error("warning", warningTimescaleDBUnknownFmt, err)
+			return
+		}
+	}
+	if _, _, ok := pgtune.ParseTimescaleDBVersion(version); !ok {
+		t.handler.p.Error("warning", warningTimescaleDBParseFmt, version)
+	}
+	config.TimescaleDBVersion = version
+	t.handler.p.Statement(statementTimescaleDBFmt, version, source)
+
+	// jobs can only be counted in the database they are scheduled in
+	if source == sourcePGExt {
+		t.processJobs(config, conn)
+	}
+}
+
+// controlFileVersion returns the default_version of the extension control file
+// of the PostgreSQL installation pg_config is from, along with its path. That
+// installation must be of pgMajorVersion, the version being tuned for, or its
+// control file says nothing about the one being tuned.
+func (t *Tuner) controlFileVersion(pgMajorVersion string) (string, string, error) {
+	major, err := getPGMajorVersion(t.flags.PGConfig)
+	if err != nil {
+		return "", "", err
+	}
+	if major != pgMajorVersion {
+		return "", "", fmt.Errorf(errPGConfigMajorFmt, t.flags.PGConfig, major, pgMajorVersion)
+	}
+	sharedir, err := getPGConfigSharedirFn(t.flags.PGConfig)
+	if err != nil {
+		return "", "", fmt.Errorf(errSharedirFmt, t.flags.PGConfig, err)
+	}
+	path := filepath.Join(sharedir, "extension", controlFileName)
+	version, err := readControlFileVersion(path)
+	return version, path, err
+}
+
+// processJobs sizes the TimescaleDB background workers so that every scheduled
+// job can run at once, unless the number of workers was given by flag.
+func (t *Tuner) processJobs(config *pgtune.SystemConfig, conn pgConn) {
+	count, err := conn.QueryString(sqlJobsCount)
+	if err != nil {
+		t.handler.p.Error("warning", warningJobsQueryFmt, err)
+		return
+	}
+	jobs, err := strconv.Atoi(count)
+	if err != nil {
+		t.handler.p.Error("warning", warningJobsQueryFmt, err)
+		return
+	}
+	t.jobs = jobs
+	workers := pgtune.BackgroundWorkersForJobs(jobs)
+	if t.flags.MaxBGWorkers != 0 {
+		if config.MaxBGWorkers < workers {
+			t.handler.p.Error("warning", warningBGWorkersForJobsFmt, config.MaxBGWorkers, workers, jobs)
+		}
+		return
+	}
+	config.MaxBGWorkers = workers
+	t.handler.p.Statement(statementJobsFmt, jobs, workers)
+}
@@ -0,0 +1,216 @@
+package tstune
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+func writeControlFile(t *testing.T, sharedir, content string) string {
+	dir := filepath.Join(sharedir, "extension")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("could not create extension dir: %v", err)
+	}
+	path := filepath.Join(dir, controlFileName)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("could not write control file: %v", err)
+	}
+	return path
+}
+
+func TestReadControlFileVersion(t *testing.T) {
+	cases := []struct {
+		desc    string
+		content string
+		want    string
+		errMsg  string
+	}{
+		{
+			desc:    "found",
+			content: "# timescaledb extension\ncomment = 'Enables scalable inserts'\ndefault_version = '2.14.2'\nmodule_pathname = '$libdir/timescaledb-2.14.2'\n",
+			want:    "2.14.2",
+		},
+		{
+			desc:    "spaces",
+			content: "  default_version='2.15.0-dev'\n",
+			want:    "2.15.0-dev",
+		},
+		{
+			desc:    "commented",
+			content: "#default_version = '2.14.2'\n",
+			errMsg:  errNoVersionInFmt,
+		},
+		{
+			desc:    "missing",
+			content: "comment = 'Enables scalable inserts'\n",
+			errMsg:  errNoVersionInFmt,
+		},
+	}
+
+	for _, c := range cases {
+		path := writeControlFile(t, t.TempDir(), c.content)
+		got, err := readControlFileVersion(path)
+		if c.errMsg == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if c.errMsg != "" && (err == nil || err.Error() != fmt.Sprintf(c.errMsg, path)) {
+			t.Errorf("%s: incorrect error: got %v want %s", c.desc, err, fmt.Sprintf(c.errMsg, path))
+		} else if got != c.want {
+			t.Errorf("%s: incorrect version: got %s want %s", c.desc, got, c.want)
+		}
+	}
+
+	if _, err := readControlFileVersion(filepath.Join(t.TempDir(), controlFileName)); err == nil {
+		t.Errorf("unexpected lack of error for a missing file")
+	}
+}
+
+func TestTunerProcessTimescaleDB(t *testing.T) {
+	oldSharedirFn := getPGConfigSharedirFn
+	oldVersionFn := getPGConfigVersionFn
+	defer func() {
+		getPGConfigSharedirFn = oldSharedirFn
+		getPGConfigVersionFn = oldVersionFn
+	}()
+
+	sharedir := t.TempDir()
+	controlPath := writeControlFile(t, sharedir, "default_version = '2.15.0'\n")
+	getPGConfigSharedirFn = func(string) (string, error) { return sharedir, nil }
+
+	cases := []struct {
+		desc          string
+		conn          *testPGConn
+		sharedirErr   bool
+		pgConfigMajor string
+		flagWorkers   int
+		wantVersion   string
+		wantWorkers   int
+		wantJobs      int
+		wantStatement string
+		wantErrors    []string
+	}{
+		{
+			desc:          "control file",
+			wantVersion:   "2.15.0",
+			wantWorkers:   pgtune.MaxBackgroundWorkersDefault,
+			wantStatement: fmt.Sprintf(statementTimescaleDBFmt, "2.15.0", controlPath),
+		},
+		{
+			desc:        "no pg_config",
+			sharedirErr: true,
+			wantWorkers: pgtune.MaxBackgroundWorkersDefault,
+			wantErrors: []string{"warning: " + fmt.Sprintf(warningTimescaleDBUnknownFmt,
+				fmt.Errorf(errSharedirFmt, "pg_config", "not found"))},
+		},
+		{
+			desc:          "pg_config of another version",
+			pgConfigMajor: pgutils.MajorVersion16,
+			wantWorkers:   pgtune.MaxBackgroundWorkersDefault,
+			wantErrors: []string{"warning: " + fmt.Sprintf(warningTimescaleDBUnknownFmt,
+				fmt.Errorf(errPGConfigMajorFmt, "pg_config", pgutils.MajorVersion16, pgutils.MajorVersion10))},
+		},
+		{
+			desc:          "not installed in database",
+			conn:          &testPGConn{queries: map[string]string{sqlExtVersion: ""}},
+			wantVersion:   "2.15.0",
+			wantWorkers:   pgtune.MaxBackgroundWorkersDefault,
+			wantStatement: fmt.Sprintf(statementTimescaleDBFmt, "2.15.0", controlPath),
+		},
+		{
+			desc:          "installed with few jobs",
+			conn:          &testPGConn{queries: map[string]string{sqlExtVersion: "2.14.2", sqlJobsCount: "5"}},
+			wantVersion:   "2.14.2",
+			wantWorkers:   pgtune.MaxBackgroundWorkersDefault,
+			wantJobs:      5,
+			wantStatement: fmt.Sprintf(statementJobsFmt, 5, pgtune.MaxBackgroundWorkersDefault),
+		},
+		{
+			desc:          "installed with many jobs",
+			conn:          &testPGConn{queries: map[string]string{sqlExtVersion: "2.14.2", sqlJobsCount: "40"}},
+			wantVersion:   "2.14.2",
+			wantWorkers:   43,
+			wantJobs:      40,
+			wantStatement: fmt.Sprintf(statementJobsFmt, 40, 43),
+		},
+		{
+			desc:          "too few workers by flag",
+			conn:          &testPGConn{queries: map[string]string{sqlExtVersion: "2.14.2", sqlJobsCount: "40"}},
+			flagWorkers:   20,
+			wantVersion:   "2.14.2",
+			wantWorkers:   20,
+			wantJobs:      40,
+			wantStatement: fmt.Sprintf(statementTimescaleDBFmt, "2.14.2", sourcePGExt),
+			wantErrors:    []string{"warning: " + fmt.Sprintf(warningBGWorkersForJobsFmt, 20, 43, 40)},
+		},
+		{
+			desc:          "no jobs view",
+			conn:          &testPGConn{queries: map[string]string{sqlExtVersion: "1.7.5"}},
+			wantVersion:   "1.7.5",
+			wantWorkers:   pgtune.MaxBackgroundWorkersDefault,
+			wantStatement: fmt.Sprintf(statementTimescaleDBFmt, "1.7.5", sourcePGExt),
+			wantErrors:    []string{"warning: " + fmt.Sprintf(warningJobsQueryFmt, "relation does not exist")},
+		},
+		{
+			desc:          "unparseable version",
+			conn:          &testPGConn{queries: map[string]string{sqlExtVersion: "main", sqlJobsCount: "0"}},
+			wantVersion:   "main",
+			wantWorkers:   pgtune.MaxBackgroundWorkersDefault,
+			wantStatement: fmt.Sprintf(statementJobsFmt, 0, pgtune.MaxBackgroundWorkersDefault),
+			wantErrors:    []string{"warning: " + fmt.Sprintf(warningTimescaleDBParseFmt, "main")},
+		},
+	}
+
+	for _, c := range cases {
+		if c.sharedirErr {
+			getPGConfigSharedirFn = func(string) (string, error) { return "", fmt.Errorf("not found") }
+		} else {
+			getPGConfigSharedirFn = func(string) (string, error) { return sharedir, nil }
+		}
+		config := getDefaultSystemConfig(t)
+		major := config.PGMajorVersion
+		if c.pgConfigMajor != "" {
+			major = c.pgConfigMajor
+		}
+		getPGConfigVersionFn = func(string) (string, error) { return "PostgreSQL " + major + ".1", nil }
+		tuner := newTunerWithDefaultFlags(setupDefaultTestIO(""), nil)
+		tuner.flags.PGConfig = "pg_config"
+		if c.flagWorkers != 0 {
+			tuner.flags.MaxBGWorkers = c.flagWorkers
+			config.MaxBGWorkers = c.flagWorkers
+		}
+
+		var conn pgConn
+		if c.conn != nil {
+			conn = c.conn
+		}
+		tuner.processTimescaleDB(config, conn)
+
+		if got := config.TimescaleDBVersion; got != c.wantVersion {
+			t.Errorf("%s: incorrect version: got %s want %s", c.desc, got, c.wantVersion)
+		}
+		if got := config.MaxBGWorkers; got != c.wantWorkers {
+			t.Errorf("%s: incorrect background workers: got %d want %d", c.desc, got, c.wantWorkers)
+		}
+		if got := tuner.jobs; got != c.wantJobs {
+			t.Errorf("%s: incorrect jobs: got %d want %d", c.desc, got, c.wantJobs)
+		}
+
+		tp := tuner.handler.p.(*testPrinter)
+		if c.wantStatement == "" {
+			if tp.statementCalls != 0 {
+				t.Errorf("%s: unexpected statements: %v", c.desc, tp.statements)
+			}
+		} else if tp.statementCalls == 0 {
+			t.Errorf("%s: missing statement: want %s", c.desc, c.wantStatement)
+		} else if got := tp.statements[len(tp.statements)-1]; got != c.wantStatement {
+			t.Errorf("%s: incorrect statement: got\n%s\nwant\n%s", c.desc, got, c.wantStatement)
+		}
+		if got := strings.Join(tp.errors, "\n"); got != strings.Join(c.wantErrors, "\n") {
+			t.Errorf("%s: incorrect errors: got\n%s\nwant\n%s", c.desc, got, strings.Join(c.wantErrors, "\n"))
+		}
+	}
+}
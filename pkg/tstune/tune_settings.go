@@ -3,6 +3,7 @@ package tstune
 import (
 	"fmt"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/timescale/timescaledb-tune/pkg/pgtune"
@@ -13,20 +14,30 @@ const (
 	fmtOurParam           = "%s = '%s'"
 	lastTunedParam        = "timescaledb.last_tuned"
 	lastTunedVersionParam = "timescaledb.last_tuned_version"
+	lastTunedProfileParam = "timescaledb.last_tuned_profile"
+
+	// defaultProfileName is how the default profile is referred to in output
+	defaultProfileName = "default"
 )
 
 // ourParams is a list of parameters that the tuning program adds to the conf file
-var ourParams = []string{lastTunedParam, lastTunedVersionParam}
+var ourParams = []string{lastTunedParam, lastTunedVersionParam, lastTunedProfileParam}
 
 // ourParamToValue returns the configuration file line for a given
-// timescaledb-tune parameter, e.g., timescaledb.last_tuned.
-func ourParamString(param string) string {
+// timescaledb-tune parameter, e.g., timescaledb.last_tuned. profileName is the
+// name of the profile used for tuning, blank for the default profile.
+func ourParamString(param, profileName string) string {
 	var val string
 	switch param {
 	case lastTunedParam:
 		val = time.Now().Format(time.RFC3339)
 	case lastTunedVersionParam:
 		val = Version
+	case lastTunedProfileParam:
+		val = profileName
+		if val == "" {
+			val = defaultProfileName
+		}
 	default:
 		panic("unknown param: " + param)
 	}
@@ -42,14 +53,26 @@ const (
 	// tuneRegexQuotedFmt is similar to the format above but for string parameters
 	// that need single quotes around them
 	tuneRegexQuotedFmt = `^(\s*#+?\s*)?(%s)\s*=\s*'(.+?)'(\s*(?:#.*|))$`
+	// tuneRegexStringFmt is similar to the formats above but for string
+	// parameters whose values may contain spaces, so are usually quoted. The
+	// quotes are kept as part of the value.
+	tuneRegexStringFmt = `^(\s*#+?\s*)?(%s)\s*=\s*('(?:[^']|'')*'|\S+?)(\s*(?:#.*|))$`
 )
 
+// stringKeys are the tunable keys whose values are strings that may contain
+// spaces
+var stringKeys = []string{pgtune.LogLinePrefixKey}
+
 var regexes = make(map[string]*regexp.Regexp)
 
 func init() {
 	setup := func(arr []string) {
 		for _, k := range arr {
-			regexes[k] = keyToRegex(k)
+			if isIn(k, stringKeys) {
+				regexes[k] = keyToRegexString(k)
+			} else {
+				regexes[k] = keyToRegex(k)
+			}
 		}
 	}
 
@@ -58,6 +81,10 @@ func init() {
 	setup(pgtune.WALKeys)
 	setup(pgtune.MiscKeys)
 	setup(pgtune.BgwriterKeys)
+	setup(pgtune.AutovacuumKeys)
+	setup(pgtune.LoggingKeys)
+	setup(pgtune.TimescaleDBKeys)
+	setup(pgtune.ReplicationKeys)
 }
 
 // keyToRegex takes a conf file key/param name and creates the correct regular
@@ -72,6 +99,12 @@ func keyToRegexQuoted(key string) *regexp.Regexp {
 	return regexp.MustCompile(fmt.Sprintf(tuneRegexQuotedFmt, regexp.QuoteMeta(key)))
 }
 
+// keyToRegexString takes a conf file key/param name and creates the correct
+// regular expression for a string value, which may be quoted.
+func keyToRegexString(key string) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(tuneRegexStringFmt, regexp.QuoteMeta(key)))
+}
+
 // parseWithRegex takes a line and attempts to parse it using a given regular
 // expression regex. The regex is expected to produce 5 capture groups:
 // 1) the full result, 2) whether the line is preceded by # or not, 3) the
@@ -91,6 +124,7 @@ func parseWithRegex(line string, regex *regexp.Regexp) *tunableParseResult {
 			key:       res[2],
 			value:     res[3],
 			extra:     res[4],
+			pinned:    strings.Contains(res[4], pinMarker),
 		}
 	}
 	return nil
@@ -20,23 +20,35 @@ func removeSecsFromLastTuned(time string) string {
 func TestOurParamToValue(t *testing.T) {
 	now := time.Now().Format(time.RFC3339)
 	want := removeSecsFromLastTuned(fmt.Sprintf(fmtOurParam, lastTunedParam, now))
-	got := removeSecsFromLastTuned(ourParamString(lastTunedParam))
+	got := removeSecsFromLastTuned(ourParamString(lastTunedParam, ""))
 	if got != want {
 		t.Errorf("incorrect value for %s: got %s want %s", lastTunedParam, got, want)
 	}
 
 	want = fmt.Sprintf(fmtOurParam, lastTunedVersionParam, Version)
-	got = ourParamString(lastTunedVersionParam)
+	got = ourParamString(lastTunedVersionParam, "")
 	if got != want {
 		t.Errorf("incorrect value for %s: got %s want %s", lastTunedVersionParam, got, want)
 	}
 
+	want = fmt.Sprintf(fmtOurParam, lastTunedProfileParam, defaultProfileName)
+	got = ourParamString(lastTunedProfileParam, "")
+	if got != want {
+		t.Errorf("incorrect value for %s (default): got %s want %s", lastTunedProfileParam, got, want)
+	}
+
+	want = fmt.Sprintf(fmtOurParam, lastTunedProfileParam, "ingest")
+	got = ourParamString(lastTunedProfileParam, "ingest")
+	if got != want {
+		t.Errorf("incorrect value for %s: got %s want %s", lastTunedProfileParam, got, want)
+	}
+
 	defer func() {
 		if re := recover(); re == nil {
 			t.Errorf("did not panic when should")
 		}
 	}()
-	_ = ourParamString("not_a_real_param")
+	_ = ourParamString("not_a_real_param", "")
 }
 
 const (
@@ -73,6 +85,31 @@ func TestKeyToRegexQuoted(t *testing.T) {
 	}
 }
 
+func TestKeyToRegexString(t *testing.T) {
+	regex := keyToRegexString(testKey)
+	want := fmt.Sprintf(tuneRegexStringFmt, testKey)
+	if got := regex.String(); got != want {
+		t.Errorf("incorrect regex: got %s want %s", got, want)
+	}
+
+	cases := map[string]string{
+		"log_line_prefix = '%m [%p] '":              "'%m [%p] '",
+		"#log_line_prefix = '%m [%p] ' # comment":   "'%m [%p] '",
+		"log_line_prefix = ''":                      "''",
+		"log_line_prefix = 'it''s # not a comment'": "'it''s # not a comment'",
+		"log_line_prefix = unquoted":                "unquoted",
+	}
+	regex = keyToRegexString("log_line_prefix")
+	for line, want := range cases {
+		res := parseWithRegex(line, regex)
+		if res == nil {
+			t.Errorf("%s: unexpected nil", line)
+		} else if res.value != want {
+			t.Errorf("%s: incorrect value: got %s want %s", line, res.value, want)
+		}
+	}
+}
+
 var testRegex = keyToRegex(testKey)
 
 func TestParseWithRegex(t *testing.T) {
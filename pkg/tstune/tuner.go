@@ -4,6 +4,7 @@ package tstune
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
@@ -11,7 +12,6 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
-	"sort"
 	"strings"
 	"time"
 
@@ -35,33 +35,40 @@ const (
 	promptYesNo   = "[(y)es/(n)o]: "
 	promptSkip    = "[(y)es/(s)kip/(q)uit]: "
 
+	errSettingsNeedTuningFmt = "%s settings still need to be tuned, please re-run or do so manually"
+
 	statementConfFileCheck = "Using postgresql.conf at this path:"
 	errConfFileCheckNo     = "please pass in the correct path to postgresql.conf using the --conf-path flag"
 	errConfFileMismatchFmt = "ambiguous conf file path: got both %s and %s"
 
-	errCouldNotGetBackupsFmt = "could not get list of backup files: %v"
-	errNoBackupsFound        = "no backup files found"
-	errNoBackupRestored      = "no backup restored"
-	errCouldNotRestoreFmt    = "could not restore %s: %v"
-	backupListFmt            = "%d) %s (%v ago)\n"
-	promptBackupNumber       = "Use which backup? Number or (q)uit: "
-	successRestore           = "restored successfully"
+	errCouldNotGetBackupsFmt   = "could not get list of backup files: %v"
+	errNoBackupsFound          = "no backup files found"
+	errNoBackupRestored        = "no backup restored"
+	errCouldNotRestoreFmt      = "could not restore %s: %v"
+	backupListFmt              = "%d) %s (%v ago)\n"
+	promptBackupNumber         = "Use which backup? Number or (q)uit: "
+	successRestore             = "restored successfully"
+	statementRestoreIncludeFmt = "Restoring included file '%s' to %s..."
 
 	errSharedLibNeeded             = "`timescaledb` needs to be added to shared_preload_libraries in order for it to work"
 	successSharedLibCorrect        = "shared_preload_libraries is set correctly"
 	successSharedLibUpdated        = "shared_preload_libraries will be updated"
 	statementSharedLibNotFound     = "Unable to find shared_preload_libraries in configuration file"
+	statementSharedLibRedoneFmt    = "%s was left alone, so shared_preload_libraries will instead be:"
 	plainSharedLibLine             = "shared_preload_libraries = 'timescaledb'"
-	plainSharedLibLineWithComments = plainSharedLibLine + "	# (change requires restart)"
+	sharedLibRestartComment        = "	# (change requires restart)"
+	plainSharedLibLineWithComments = plainSharedLibLine + sharedLibRestartComment
 
-	statementTunableIntro = "Recommendations based on %s of available memory and %d CPUs for PostgreSQL %s"
+	statementTunableIntro = "Recommendations based on %s of available memory (from %s) and %d CPUs (from %s) for PostgreSQL %s"
 	promptTune            = "Tune memory/parallelism/WAL and other settings? "
 
 	successQuiet = "all settings tuned, no changes needed"
 
-	errCouldNotWriteFmt = "could not open %s for writing: %v"
+	errCouldNotWriteFmt  = "could not open %s for writing: %v"
+	errOutPathIncludeFmt = "cannot write to --out-path %s: settings set in %s would be changed in place; tune without --out-path or move them into the main conf file"
 
 	fmtTunableParam = "%s = %s%s"
+	fmtSetInFile    = "\t# set in %s"
 
 	fudgeFactor = 0.05
 )
@@ -69,23 +76,61 @@ const (
 // allows us to substitute mock versions in tests
 var filepathAbsFn = filepath.Abs
 
+// tunableLabels are the labels of the settings groups that are tuned, in the
+// order they are processed
+var tunableLabels = []string{
+	pgtune.MemoryLabel,
+	pgtune.ParallelLabel,
+	pgtune.WALLabel,
+	pgtune.BgwriterLabel,
+	pgtune.MiscLabel,
+	pgtune.AutovacuumLabel,
+	pgtune.TimescaleDBLabel,
+	pgtune.ReplicationLabel,
+}
+
 // TunerFlags are the flags that control how a Tuner object behaves when it is run.
 type TunerFlags struct {
-	Memory       string // amount of memory to base recommendations on
-	NumCPUs      uint   // number of CPUs to base recommendations on
-	WALDiskSize  string // disk size of WAL to base recommendations on
-	PGVersion    string // major version of PostgreSQL to base recommendations on
-	PGConfig     string // path to pg_config binary
-	MaxConns     uint64 // max number of database connections
-	MaxBGWorkers int    // max number of background workers
-	ConfPath     string // path to the postgresql.conf file
-	DestPath     string // path to output file
-	YesAlways    bool   // always respond yes to prompts
-	Quiet        bool   // show only the bare necessities
-	UseColor     bool   // use color in output
-	DryRun       bool   // whether to actually persist changes to disk
-	Restore      bool   // whether to restore a backup
-	Profile      string // a specific "mode" to provide recommendations tailored to a special workload type, e.g. "promscale"
+	Memory         string // amount of memory to base recommendations on
+	NumCPUs        uint   // number of CPUs to base recommendations on
+	WALDiskSize    string // disk size of WAL to base recommendations on
+	PGVersion      string // major version of PostgreSQL to base recommendations on
+	PGConfig       string // path to pg_config binary
+	MaxConns       uint64 // max number of database connections
+	MaxBGWorkers   int    // max number of background workers
+	ConfPath       string // path to the postgresql.conf file
+	DestPath       string // path to output file
+	YesAlways      bool   // always respond yes to prompts
+	Quiet          bool   // show only the bare necessities
+	UseColor       bool   // use color in output
+	DryRun         bool   // whether to actually persist changes to disk
+	Restore        bool   // whether to restore a backup
+	Profile        string // a specific "mode" to provide recommendations tailored to a special workload type, e.g. "promscale"
+	SQLPath        string // path to write an ALTER SYSTEM script to instead of modifying the conf file
+	Format         string // format of the output, either text or a structured document (json/yaml)
+	CgroupRoot     string // path where the cgroup filesystem is mounted, blank to not detect container limits
+	CPURounding    string // how to round a fractional cgroup CPU limit: up, down, or nearest
+	Storage        string // kind of storage the data is on: ssd, hdd, or network; blank to detect
+	ProfileFile    string // path to a YAML, JSON, or TOML file defining a custom profile
+	Check          bool   // only check whether the conf file is tuned, exiting with a status code
+	Diff           bool   // show the changes to the conf file as a unified diff instead of writing them
+	DiffPath       string // path to also write the diff to as a patch file; implies Diff
+	BackupDir      string // directory to keep backups in, blank to use one in the data directory
+	BackupKeep     uint   // number of backups of the conf file to keep, 0 to keep all
+	BackupMaxAge   string // age after which backups are removed, blank to keep them regardless of age
+	Connect        string // connection string of a running server to read pg_settings from, blank to not connect
+	Apply          string // how to push changes to the server given by Connect: file or alter-system; blank to not
+	Groups         string // comma-separated labels of the settings groups to tune, blank for the default ones
+	SkipGroups     string // comma-separated labels of the settings groups not to tune
+	Keys           string // comma-separated keys of the settings to tune, blank for all of them
+	SkipKeys       string // comma-separated keys of the settings not to tune
+	Role           string // part the server plays in streaming replication: primary, standby, or standalone; blank to not tune replication
+	Replicas       uint   // number of standbys streaming from the primary
+	PerSetting     bool   // ask about each setting instead of each group of settings
+	Answers        string // path to a YAML, JSON, or TOML file answering the prompts, blank to ask
+	NonInteractive bool   // never read responses, failing on prompts that are not answered otherwise
+	Keep           string // comma-separated keys of settings to never tune
+	StrictMemory   bool   // fail if the final settings are expected not to fit in memory while the recommended ones would
 }
 
 // Tuner represents the tuning program for TimescaleDB.
@@ -93,6 +138,32 @@ type Tuner struct {
 	handler *ioHandler
 	cfs     *configFileState
 	flags   *TunerFlags
+	changes []*settingChange    // accepted changes, in the order they were made
+	groups  []string            // labels of the settings groups to tune, nil for tunableLabels
+	keys    map[string][]string // labels of the settings groups to the keys to tune in them, nil for all keys
+	report  *report             // structured report of the run, nil unless a structured format is used
+
+	profileName   string                // name of the profile used for tuning, blank for the default
+	customProfile *pgtune.CustomProfile // profile loaded from --profile-file, if any
+	answers       *answersFile          // answers loaded from --answers, if any
+	pins          map[string]string     // keys of the settings never tuned, to why
+
+	memorySource valueSource // where the amount of memory in the system config came from
+	cpuSource    valueSource // where the number of CPUs in the system config came from
+	cgroupMemory uint64      // memory limit of the cgroup we are in, 0 if none
+
+	config *pgtune.SystemConfig // system config that recommendations are based on
+	byHand map[string]string    // keys whose changes were chosen by hand, to what was recommended
+
+	recommended map[string]string // recommendations for the keys in the memory budget
+
+	live       map[string]*pgSetting // settings of the running server, nil unless --connect is used
+	jobs       int                   // number of scheduled TimescaleDB jobs, 0 if unknown
+	liveWarned map[string]bool       // keys already warned about when validating against live
+
+	declined      map[string]bool // keys left alone at the prompts
+	tuneDeclined  bool            // whether tuning was declined altogether at the prompt
+	sharedLibEdit *sharedLibEdit  // change made to the shared_preload_libraries line, if any
 }
 
 // initializeIOHandler sets up the printer to be used throughout the running of
@@ -113,28 +184,48 @@ func (t *Tuner) initializeIOHandler(in io.Reader, out io.Writer, outErr io.Write
 	}
 }
 
+// pgMajorVersion returns the major version of PostgreSQL given by flag, or
+// otherwise the one found via pg_config.
+func (t *Tuner) pgMajorVersion() (string, error) {
+	if t.flags.PGVersion != "" {
+		if err := validatePGMajorVersion(t.flags.PGVersion); err != nil {
+			return "", err
+		}
+		return t.flags.PGVersion, nil
+	}
+	return getPGMajorVersion(t.flags.PGConfig)
+}
+
 // initializeSystemConfig creates the pgtune.SystemConfig to be used for recommendations
 // based on the Tuner's TunerFlags (i.e., whether memory and/or number of CPU cores has
 // been overridden).
 func (t *Tuner) initializeSystemConfig() (*pgtune.SystemConfig, error) {
-	var err error
-
 	// Some settings are not applicable in some versions,
 	// e.g. max_parallel_workers is not available in 9.6
-	var pgVersion string
-	if t.flags.PGVersion != "" {
-		if err = validatePGMajorVersion(t.flags.PGVersion); err != nil {
-			return nil, err
-		}
-		pgVersion = t.flags.PGVersion
-	} else {
-		pgVersion, err = getPGMajorVersion(t.flags.PGConfig)
+	pgVersion, err := t.pgMajorVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	// Inside a container, the host's resources are not all available to us
+	if err = validateCPURounding(t.flags.CPURounding); err != nil {
+		return nil, err
+	}
+	limits := &cgroupLimits{}
+	if t.flags.CgroupRoot != "" {
+		limits, err = detectCgroupLimits(t.flags.CgroupRoot)
 		if err != nil {
 			return nil, err
 		}
 	}
+	// a limit no lower than the host's memory is no limit at all, e.g., the
+	// very large value of an unlimited v1 cgroup
+	if limits.memory > 0 && limits.memory < memory.TotalMemory() {
+		t.cgroupMemory = limits.memory
+	}
 
 	// Memory flag needs to be in PostgreSQL format, default is all memory
+	// the cgroup allows, or all memory if there is no limit
 	var totalMemory uint64
 	if t.flags.Memory != "" {
 		temp, err := parse.PGFormatToBytes(t.flags.Memory)
@@ -142,8 +233,14 @@ func (t *Tuner) initializeSystemConfig() (*pgtune.SystemConfig, error) {
 			return nil, err
 		}
 		totalMemory = temp
+		t.memorySource = sourceFlag
 	} else {
 		totalMemory = memory.TotalMemory()
+		t.memorySource = sourceHost
+		if limits.memory > 0 && limits.memory < totalMemory {
+			totalMemory = limits.memory
+			t.memorySource = sourceCgroup
+		}
 	}
 
 	// WAL Disk size needs to be in PostgreSQL format, default is 0
@@ -156,10 +253,22 @@ func (t *Tuner) initializeSystemConfig() (*pgtune.SystemConfig, error) {
 		walDisk = temp
 	}
 
-	// Default to the number of cores
+	// Default to the number of cores, or what the cgroup allows if less
 	cpus := int(t.flags.NumCPUs)
+	t.cpuSource = sourceFlag
 	if t.flags.NumCPUs == 0 {
 		cpus = runtime.NumCPU()
+		t.cpuSource = sourceHost
+		if limits.cpus > 0 {
+			limited, err := roundCPUs(limits.cpus, t.flags.CPURounding)
+			if err != nil {
+				return nil, err
+			}
+			if limited < cpus {
+				cpus = limited
+				t.cpuSource = sourceCgroup
+			}
+		}
 	}
 
 	// Use default BG Workers if not provided
@@ -168,11 +277,29 @@ func (t *Tuner) initializeSystemConfig() (*pgtune.SystemConfig, error) {
 		maxBGWorkers = pgtune.MaxBackgroundWorkersDefault
 	}
 
-	return pgtune.NewSystemConfig(totalMemory, cpus, pgVersion, walDisk, t.flags.MaxConns, maxBGWorkers)
+	// Storage is detected later, once we know the data directory, if not given
+	storage, err := pgtune.ParseStorageClass(t.flags.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := parseRole(t.flags.Role, t.flags.Replicas)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := pgtune.NewSystemConfig(totalMemory, cpus, pgVersion, walDisk, t.flags.MaxConns, maxBGWorkers)
+	if err != nil {
+		return nil, err
+	}
+	config.Storage = storage
+	config.Role = role
+	config.Replicas = int(t.flags.Replicas)
+	return config, nil
 }
 
-func (t *Tuner) restore(r restorer, filePath string) error {
-	files, err := getBackups()
+func (t *Tuner) restore(r restorer, dir, filePath string) error {
+	files, err := getBackups(dir, filePath)
 	if err != nil {
 		return fmt.Errorf(errCouldNotGetBackupsFmt, err)
 	}
@@ -181,8 +308,7 @@ func (t *Tuner) restore(r restorer, filePath string) error {
 		return fmt.Errorf(errNoBackupsFound)
 	}
 
-	// Reverse sort the list so most recent backups are first
-	sort.Strings(files)
+	// Reverse the list so most recent backups are first
 	for i := len(files)/2 - 1; i >= 0; i-- {
 		opp := len(files) - 1 - i
 		files[i], files[opp] = files[opp], files[i]
@@ -191,9 +317,8 @@ func (t *Tuner) restore(r restorer, filePath string) error {
 	for i, file := range files {
 		now := time.Now()
 		name := path.Base(file)
-		datePart := strings.Replace(name, backupFilePrefix, "", -1)
-		// no need to check the error, as getBackups does that for us
-		when, _ := time.ParseInLocation(backupDateFmt, datePart, now.Location())
+		// no need to check the result, as getBackups does that for us
+		_, when, _ := parseBackupName(name, now.Location())
 		ago := now.Sub(when)
 		fmt.Fprintf(t.handler.out, backupListFmt, i+1, name, parse.PrettyDuration(ago))
 	}
@@ -205,14 +330,56 @@ func (t *Tuner) restore(r restorer, filePath string) error {
 		return err
 	}
 
-	backupPath := files[checker.response-1]
-	shortBackupName := path.Base(backupPath)
+	return t.restoreBackup(r, dir, files[checker.response-1], filePath)
+}
 
+// restoreBackup restores the backup at backupPath to filePath, along with the
+// included files backed up with it. The files being replaced are backed up
+// into dir first, so that the restore can be undone by restoring that backup.
+func (t *Tuner) restoreBackup(r restorer, dir, backupPath, filePath string) error {
+	meta, err := readBackupMeta(backupPath)
+	if err != nil {
+		return fmt.Errorf(errCouldNotRestoreFmt, path.Base(backupPath), err)
+	}
+	includes := []*backupInclude{}
+	if meta != nil {
+		includes = meta.Includes
+	}
+	undo := []includedFile{}
+	for _, inc := range includes {
+		contents, err := os.ReadFile(inc.SourcePath)
+		if err == nil {
+			undo = append(undo, includedFile{inc.SourcePath, bytes.NewReader(contents)})
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	contents, err := os.ReadFile(filePath)
+	if err == nil {
+		undoPath, err := backup(bytes.NewReader(contents), dir, filePath, "", undo...)
+		t.handler.p.Statement("Writing backup to:")
+		fmt.Fprintf(t.handler.outErr, undoPath+"\n\n")
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	shortBackupName := path.Base(backupPath)
 	t.handler.p.Statement("Restoring '%s'...", shortBackupName)
-	err = r.Restore(backupPath, filePath)
+	err = t.checkWriteErr(filePath, r.Restore(backupPath, filePath))
 	if err != nil {
 		return fmt.Errorf(errCouldNotRestoreFmt, shortBackupName, err)
 	}
+	for _, inc := range includes {
+		t.handler.p.Statement(statementRestoreIncludeFmt, inc.Name, inc.SourcePath)
+		err = t.checkWriteErr(inc.SourcePath, r.Restore(filepath.Join(filepath.Dir(backupPath), filepath.Base(inc.Name)), inc.SourcePath))
+		if err != nil {
+			return fmt.Errorf(errCouldNotRestoreFmt, inc.Name, err)
+		}
+	}
 	t.handler.p.Success(successRestore)
 
 	return nil
@@ -232,6 +399,15 @@ func verifyTunerFlags(flags *TunerFlags) (*TunerFlags, error) {
 	flags.ConfPath = dirPathToFile(flags.ConfPath, "postgresql.conf")
 	flags.DestPath = dirPathToFile(flags.DestPath, "postgresql.conf")
 
+	// A diff is only useful if the conf file is left alone so that it can be
+	// reviewed and applied later
+	if flags.DiffPath != "" {
+		flags.Diff = true
+	}
+	if flags.Diff {
+		flags.DryRun = true
+	}
+
 	return flags, nil
 }
 
@@ -241,22 +417,54 @@ func verifyTunerFlags(flags *TunerFlags) (*TunerFlags, error) {
 func (t *Tuner) Run(flags *TunerFlags, in io.Reader, out io.Writer, outErr io.Writer) {
 	t.flags, _ = verifyTunerFlags(flags)
 	t.initializeIOHandler(in, out, outErr)
+	structured := t.flags.Format != "" && t.flags.Format != formatText
+	if t.flags.SQLPath == "-" || structured || t.flags.Diff {
+		// keep stdout clean for the script, report, or diff; everything else goes to stderr
+		t.handler.out = outErr
+	}
 
+	// --check has its own exit codes, so errors need to be told apart from drift
+	errorExit := t.handler.errorExit
+	if t.flags.Check {
+		errorExit = func(err error) {
+			t.handler.exit(exitCheckError, err.Error())
+		}
+	}
 	ifErrHandle := func(err error) {
 		if err != nil {
-			t.handler.errorExit(err)
+			errorExit(err)
 		}
 	}
 
-	profile, err := pgtune.ParseProfile(t.flags.Profile)
+	ifErrHandle(validateFormat(t.flags.Format))
+	ifErrHandle(validateCheckFlags(t.flags))
+	ifErrHandle(validateDiffFlags(t.flags))
+	ifErrHandle(validateApplyFlags(t.flags))
+	ifErrHandle(validatePerSettingFlags(t.flags))
+	backupMaxAge, err := parseBackupMaxAge(t.flags.BackupMaxAge)
 	ifErrHandle(err)
-	if profile != pgtune.DefaultProfile {
-		t.handler.p.Statement("Tuning with profile: %s", profile)
+	t.groups, err = selectGroups(t.flags.Groups, t.flags.SkipGroups)
+	ifErrHandle(err)
+	if structured && t.flags.SQLPath == "-" {
+		ifErrHandle(fmt.Errorf(errFormatStdout))
+	}
+
+	profile, err := t.processProfile()
+	ifErrHandle(err)
+	if t.flags.Answers != "" {
+		t.answers, err = loadAnswersFile(t.flags.Answers)
+		ifErrHandle(err)
 	}
 
 	// Before proceeding, make sure we have a valid system config
 	config, err := t.initializeSystemConfig()
 	ifErrHandle(err)
+	t.config = config
+	if structured {
+		t.report = newReport(config, t.profileName)
+		t.report.System.MemorySource = t.memorySource.String()
+		t.report.System.CPUSource = t.cpuSource.String()
+	}
 
 	// Attempt to find the config file and open it for reading
 	filePath := t.flags.ConfPath
@@ -267,7 +475,7 @@ func (t *Tuner) Run(flags *TunerFlags, in io.Reader, out io.Writer, outErr io.Wr
 
 	file, err := os.Open(filePath)
 	if err != nil {
-		t.handler.errorExit(fmt.Errorf("could not open config file for reading: %v", err))
+		errorExit(fmt.Errorf("could not open config file for reading: %v", err))
 	}
 	defer file.Close()
 
@@ -277,22 +485,97 @@ func (t *Tuner) Run(flags *TunerFlags, in io.Reader, out io.Writer, outErr io.Wr
 
 	// If restore flag, restore and that's it
 	if t.flags.Restore {
+		// the conf file may not parse, which could be why it is being restored,
+		// in which case the backup directory is found without it
+		cfs, _ := getConfigFileStateWithIncludes(file, filePath)
 		r := &fsRestorer{}
-		err = t.restore(r, filePath)
+		err = t.restore(r, getBackupDir(t.flags.BackupDir, cfs, filePath), filePath)
 		ifErrHandle(err)
 		return // do nothing else!
 	}
 
-	// Generate current conf file state
-	t.cfs, err = getConfigFileState(file)
+	// Generate current conf file state, following any include directives
+	t.cfs, err = getConfigFileStateWithIncludes(file, filePath)
+	ifErrHandle(err)
+
+	// Settings made with ALTER SYSTEM take precedence over everything else
+	err = t.loadAutoConf(filePath)
+	ifErrHandle(err)
+
+	// Settings can be pinned in the conf files as well as by flags and files
+	err = t.loadPins()
+	ifErrHandle(err)
+
+	// The WAL disk and storage can only be found once we know where the data
+	// directory is
+	t.processWALDisk(config, filePath)
+	t.processStorage(config, filePath)
+	// A custom profile's max_connections is what everything sized by
+	// connections needs to fit, and its formulas may use the WAL disk size
+	if t.customProfile != nil {
+		err = t.customProfile.ApplyConnections(config)
+		ifErrHandle(err)
+	}
+
+	// The running server knows the effective value of every setting, however
+	// it was set, and which version of TimescaleDB is in use
+	conn, err := t.connect()
+	ifErrHandle(err)
+	if conn != nil {
+		defer conn.Close()
+	}
+	t.processTimescaleDB(config, conn)
+	// Which settings there are depends on the versions found above
+	err = t.selectKeys(config)
+	ifErrHandle(err)
+	err = t.processLiveSettings(config, conn)
+	ifErrHandle(err)
+	err = t.processReplicaLimits(config, profile)
 	ifErrHandle(err)
+	if t.report != nil {
+		t.report.System.TimescaleDBVersion = config.TimescaleDBVersion
+		t.report.System.TimescaleDBJobs = t.jobs
+		t.report.System.MaxBGWorkers = config.MaxBGWorkers
+		t.report.System.WALDiskSize = config.WALDiskSize
+		t.report.System.WALDiskShared = config.WALDiskShared
+		t.report.System.Storage = config.Storage.String()
+		res := t.cfs.sharedLibResult
+		var lines []*configLine
+		if res != nil {
+			lines = t.cfs.fileFor(res.file).lines
+		}
+		t.report.SharedLibs = newSharedLibReport(res, lines, t.extraSharedLibs()...)
+	}
+
+	// In --check mode, just report on how the conf file compares
+	if t.flags.Check {
+		code, err := t.processCheck(config, profile)
+		ifErrHandle(err)
+		if t.report != nil {
+			err = writeReport(out, t.report, t.flags.Format)
+			ifErrHandle(err)
+		}
+		if code != exitCheckTuned {
+			exitFn(code)
+		}
+		return
+	}
 
-	// Write backup
-	if !t.flags.DryRun {
-		backupPath, err := backup(t.cfs)
+	// Write backup, then make room for it
+	if !t.flags.DryRun && t.flags.SQLPath == "" && t.flags.Apply != applyAlterSystem {
+		backupDir := getBackupDir(t.flags.BackupDir, t.cfs, filePath)
+		backupPath, err := backup(t.cfs, backupDir, filePath, t.profileName, backupIncludes(t.cfs)...)
 		t.handler.p.Statement("Writing backup to:")
 		fmt.Fprintf(t.handler.outErr, backupPath+"\n\n")
 		ifErrHandle(err)
+		if t.report != nil {
+			t.report.BackupPath = backupPath
+		}
+		removed, err := pruneBackups(backupDir, filePath, t.flags.BackupKeep, backupMaxAge, time.Now())
+		if len(removed) > 0 {
+			t.handler.p.Statement(statementBackupsPrunedFmt, len(removed), backupDir)
+		}
+		ifErrHandle(err)
 	}
 
 	// Process the tuning of settings
@@ -304,50 +587,91 @@ func (t *Tuner) Run(flags *TunerFlags, in io.Reader, out io.Writer, outErr io.Wr
 		ifErrHandle(err)
 
 		fmt.Fprintf(t.handler.outErr, "\n")
-		err = t.promptUntilValidInput(promptTune+promptYesNo, newYesNoChecker(""))
+		err = t.promptUntilValidInput(promptTune+promptYesNo, ask(question{name: questionTune}, newYesNoChecker("")))
 		if err == nil {
 			err = t.processTunables(config, profile)
 			ifErrHandle(err)
 		} else if err.Error() != "" { // error msg of "" is response when user selects no to tuning
-			t.handler.errorExit(err)
+			errorExit(err)
+		} else {
+			t.tuneDeclined = true
 		}
+		t.redoSharedLibLine()
 	}
 
+	// Make sure the settings, as they will be, fit in memory
+	err = t.processMemoryBudget(config)
+	ifErrHandle(err)
+
 	// Add our params to the conf file, and cleanup because old versions of Tuner
 	// were noisy and left these params each time.
 	t.processOurParams()
 	t.cfs.ProcessLines(getRemoveDuplicatesProcessors(ourParams)...)
 
 	// Wrap up: Either write it out, or show success in --dry-run
-	if !t.flags.DryRun {
+	if t.flags.SQLPath != "" {
+		err = t.writeSQLFile(t.flags.SQLPath, out)
+		ifErrHandle(err)
+	} else if t.flags.Diff {
+		err = t.writeDiff(t.flags.DiffPath, out)
+		ifErrHandle(err)
+	} else if t.flags.Apply == applyAlterSystem {
+		// the server writes the changes to postgresql.auto.conf itself
+	} else if !t.flags.DryRun {
 		err = t.writeConfFile(filePath)
 		ifErrHandle(err)
 	} else {
 		t.handler.p.Statement("Success, but not writing due to --dry-run flag")
 	}
+
+	// Find out which changes the server picked up, and which need a restart
+	if t.flags.Apply != "" {
+		err = t.applyChanges()
+		ifErrHandle(err)
+	}
+
+	if t.report != nil {
+		err = writeReport(out, t.report, t.flags.Format)
+		ifErrHandle(err)
+	}
 }
 
 // promptUntilValidInput continually prompts the user via handler's output to
 // answer a question provided in prompt until an acceptable answer is given, or
-// returns immediately if the Yes flag is passed in.
+// returns immediately if the Yes flag is passed in and the answers file does
+// not answer the question.
 func (t *Tuner) promptUntilValidInput(prompt string, checker promptChecker) error {
 	if t.flags.YesAlways {
-		return nil
+		q, _ := unwrapQuestion(checker)
+		if _, _, ok := t.answers.answer(q); !ok {
+			return nil
+		}
 	}
 	return t.forcePromptUntilValidInput(prompt, checker)
 }
 
 // forcePromptUntilValidInput continually prompts the user to answer a question
 // provided in prompt until an acceptable answer is given. It is not affected by
-// the presence of the Yes flag.
+// the presence of the Yes flag. If the question is answered in the answers
+// file, that answer is used instead, and if it is not and responses cannot be
+// read, it is an error.
 func (t *Tuner) forcePromptUntilValidInput(prompt string, checker promptChecker) error {
+	q, checker := unwrapQuestion(checker)
+	if answer, from, ok := t.answers.answer(q); ok {
+		return t.useAnswer(prompt, checker, answer, from)
+	} else if t.flags.NonInteractive {
+		return fmt.Errorf(errUnansweredFmt, strings.TrimSpace(prompt))
+	}
 	for {
 		t.handler.p.Prompt(prompt)
 		resp, err := t.handler.br.ReadString('\n')
 		if err != nil {
 			return fmt.Errorf("could not parse response: %v", err)
 		}
-		r := strings.ToLower(strings.TrimSpace(resp))
+		r := strings.TrimSpace(resp)
+		if _, ok := checker.(caseSensitiveChecker); !ok {
+			r = strings.ToLower(r)
+		}
 		ok, err := checker.Check(r)
 		if ok || err != nil {
 			return err
@@ -358,13 +682,17 @@ func (t *Tuner) forcePromptUntilValidInput(prompt string, checker promptChecker)
 // processConfFileCheck handles the interactions for checking whether Tuner is
 // using the correct conf file. If provided by a flag, it should skip prompting
 // error if somehow the provided filePath differs from the flag value. Otherwise,
-// it prompts the user for input on whether the provided path is correct.
+// it prompts the user for input on whether the provided path is correct, unless
+// only checking the conf file.
 func (t *Tuner) processConfFileCheck(filePath string) error {
 	t.handler.p.Statement(statementConfFileCheck)
 	fmt.Fprintf(t.handler.outErr, filePath+"\n\n")
 	if len(t.flags.ConfPath) == 0 {
+		if t.flags.Check {
+			return nil
+		}
 		checker := newYesNoChecker(errConfFileCheckNo)
-		err := t.promptUntilValidInput(promptCorrect+promptYesNo, checker)
+		err := t.promptUntilValidInput(promptCorrect+promptYesNo, ask(question{name: questionConfFile}, checker))
 		if err != nil {
 			return err
 		}
@@ -379,13 +707,16 @@ func (t *Tuner) processConfFileCheck(filePath string) error {
 func (t *Tuner) processNoSharedLibLine() error {
 	t.handler.p.Statement(statementSharedLibNotFound)
 	checker := newYesNoChecker(errSharedLibNeeded)
-	err := t.promptUntilValidInput("Append to end? "+promptYesNo, checker)
+	err := t.promptUntilValidInput("Append to end? "+promptYesNo, ask(question{name: questionSharedLibs}, checker))
 	if err != nil {
 		return err
 	}
 
-	t.cfs.lines = append(t.cfs.lines, &configLine{content: plainSharedLibLine})
-	t.handler.p.Success("appending shared_preload_libraries = 'timescaledb' to end of configuration file")
+	line := t.missingSharedLibLine()
+	t.cfs.lines = append(t.cfs.lines, &configLine{content: line})
+	t.sharedLibEdit = &sharedLibEdit{file: t.cfs.path, idx: len(t.cfs.lines) - 1}
+	t.recordChange(sharedLibsKey, t.sharedLibs())
+	t.handler.p.Success("appending " + line + " to end of configuration file")
 
 	return nil
 }
@@ -399,8 +730,9 @@ func (t *Tuner) processSharedLibLine() error {
 
 	res := t.cfs.sharedLibResult
 	idx := res.idx
-	newLine := updateSharedLibLine(t.cfs.lines[idx].content, res)
-	if newLine == t.cfs.lines[idx].content { // already valid, nothing to do
+	lines := t.cfs.fileFor(res.file).lines
+	newLine := updateSharedLibLine(lines[idx].content, res, t.extraSharedLibs()...)
+	if newLine == lines[idx].content { // already valid, nothing to do
 		t.handler.p.Success(successSharedLibCorrect)
 	} else {
 		t.handler.p.Statement("shared_preload_libraries needs to be updated")
@@ -411,29 +743,62 @@ func (t *Tuner) processSharedLibLine() error {
 
 		t.handler.p.Statement(recommendLabel)
 		// want to print without trailing comments to reduce clutter
-		recWithoutComments := updateSharedLibLine(currWithoutComments, res)
+		recWithoutComments := updateSharedLibLine(currWithoutComments, res, t.extraSharedLibs()...)
 		fmt.Fprintf(t.handler.out, recWithoutComments+"\n")
 
 		checker := newYesNoChecker(errSharedLibNeeded)
-		err := t.promptUntilValidInput(promptOkay+promptYesNo, checker)
+		err := t.promptUntilValidInput(promptOkay+promptYesNo, ask(question{name: questionSharedLibs}, checker))
 		if err != nil {
 			return err
 		}
-		t.cfs.lines[idx] = &configLine{content: newLine} // keep trailing comments when writing
+		t.sharedLibEdit = &sharedLibEdit{file: res.file, idx: idx, orig: lines[idx].content}
+		t.cfs.setLine(res.file, idx, newLine) // keep trailing comments when writing
+		t.recordChange(sharedLibsKey, parseLineForSharedLibResult(newLine).libs)
 		t.handler.p.Success(successSharedLibUpdated)
 	}
 	return nil
 }
 
+// redoSharedLibLine changes the shared_preload_libraries line again once the
+// prompts are done, so that libraries only needed by settings that were left
+// alone there are not added after all.
+func (t *Tuner) redoSharedLibLine() {
+	e := t.sharedLibEdit
+	if e == nil || len(t.extraSharedLibs()) > 0 {
+		return
+	}
+	line := t.missingSharedLibLine()
+	if e.orig != "" {
+		line = updateSharedLibLine(e.orig, t.cfs.sharedLibResult)
+	}
+	lines := t.cfs.fileFor(e.file).lines
+	if line == lines[e.idx].content {
+		return
+	}
+	t.handler.p.Statement(statementSharedLibRedoneFmt, pgtune.PGStatStatementsMaxKey)
+	fmt.Fprintf(t.handler.out, line+"\n")
+	t.cfs.setLine(e.file, e.idx, line)
+	if line == e.orig {
+		t.dropChange(sharedLibsKey)
+	} else {
+		t.recordChange(sharedLibsKey, parseLineForSharedLibResult(line).libs)
+	}
+}
+
 // checkIfShouldShowSetting iterates through a group of settings defined by keys
 // and checks whether the setting should be shown to the user for modification.
 // The criteria for being shown is either:
 // (a) the setting is missing altogether,
 // (b) the setting is currently commented out,
 // (c) OR the setting's recommended value is far enough away from its current value.
-func checkIfShouldShowSetting(keys []string, parseResults map[string]*tunableParseResult, recommender pgtune.Recommender) (map[string]bool, error) {
+// Settings in pins are never shown.
+func checkIfShouldShowSetting(keys []string, parseResults map[string]*tunableParseResult, recommender pgtune.Recommender, pins map[string]string) (map[string]bool, error) {
 	show := make(map[string]bool)
 	for _, k := range keys {
+		// pinned settings are never changed, whatever they are set to
+		if _, ok := pins[k]; ok {
+			continue
+		}
 		r := parseResults[k]
 
 		// if the setting was not found on pass through, should show our rec
@@ -447,20 +812,22 @@ func checkIfShouldShowSetting(keys []string, parseResults map[string]*tunablePar
 		// get and parse our recommendation; fail if for we can't
 		rec := recommender.Recommend(k)
 
+		// values may be quoted, e.g., ALTER SYSTEM always quotes them
+		value := unquoteValue(r.value)
+
 		switch {
 		case rec == pgtune.NoRecommendation:
 			// don't bother adding it to the map. no recommendation
 			continue
 		case r.commented:
 			show[k] = true
-		case r.value == rec:
+		case value == unquoteValue(rec):
 			// don't bother adding it to the map. no recommendation
 			continue
-
 		}
 
 		// parse the value already there; if unparseable, should show our rec
-		curr, err := rv.ParseFloat(k, r.value)
+		curr, err := rv.ParseFloat(k, value)
 		if err != nil {
 			show[k] = true
 			continue
@@ -488,12 +855,23 @@ func (t *Tuner) processSettingsGroup(sg pgtune.SettingsGroup, profile pgtune.Pro
 	}
 	keys := sg.Keys()
 	recommender := sg.GetRecommender(profile)
+	t.recordRecommendations(keys, recommender)
 
 	// Get a map of only the settings that are missing, commented out, or not "close enough" to our recommendation.
-	show, err := checkIfShouldShowSetting(keys, t.cfs.tuneParseResults, recommender)
+	show, err := checkIfShouldShowSetting(keys, t.cfs.tuneParseResults, recommender, t.pins)
 	if err != nil {
 		return err
 	}
+	var groupRep *groupReport
+	if t.report != nil {
+		groupRep = newGroupReport(label, keys, t.cfs.tuneParseResults, recommender, show)
+		addLiveSettings(groupRep, t.live)
+		groupRep.pin(t.pins)
+		t.report.Groups = append(t.report.Groups, groupRep)
+	}
+	if !quiet {
+		t.printPinned(keys, recommender)
+	}
 
 	// Settings that need to be changed exist...
 	if len(show) > 0 {
@@ -530,7 +908,14 @@ func (t *Tuner) processSettingsGroup(sg pgtune.SettingsGroup, profile pgtune.Pro
 				if r.commented {
 					format = "#" + format
 				}
-				fmt.Fprintf(t.handler.out, format, r.key, r.value, "") // don't print comment, too cluttered
+				// don't print comment, too cluttered, but do say where it is
+				// set if that is not the main conf file
+				extra := ""
+				if r.file != t.cfs.path {
+					extra = fmt.Sprintf(fmtSetInFile, r.location())
+				}
+				extra += t.liveCurrentNote(r)
+				fmt.Fprintf(t.handler.out, format, r.key, r.value, extra)
 			})
 
 			// Now display recommendations, but only those with new recommendations
@@ -543,14 +928,59 @@ func (t *Tuner) processSettingsGroup(sg pgtune.SettingsGroup, profile pgtune.Pro
 			if rec == pgtune.NoRecommendation {
 				return
 			}
-			fmt.Fprintf(t.handler.out, fmtTunableParam+"\n", r.key, rec, "") // don't print comment, too cluttered
+			// don't print comment, too cluttered, except whether a restart is needed
+			fmt.Fprintf(t.handler.out, fmtTunableParam+"\n", r.key, rec, t.liveRestartNote(r.key))
+		})
+
+		// The values to write are the recommendations, unless chosen one by one
+		values := map[string]string{}
+		byHand := map[string]bool{}
+		doWithVisibile(func(r *tunableParseResult) {
+			if rec := recommender.Recommend(r.key); rec != pgtune.NoRecommendation {
+				values[r.key] = rec
+			}
 		})
+		if err := t.useAnswerSettings(values, byHand, recommender); err != nil {
+			return err
+		}
 
 		// Prompt the user for input (only in non-quiet mode)
-		if !quiet {
-			checker := newSkipChecker(label + " settings still need to be tuned, please re-run or do so manually")
-			err := t.promptUntilValidInput(promptOkay+promptSkip, checker)
+		if !quiet && t.flags.PerSetting {
+			keys := []string{}
+			doWithVisibile(func(r *tunableParseResult) {
+				if recommender.Recommend(r.key) != pgtune.NoRecommendation {
+					keys = append(keys, r.key)
+				}
+			})
+			if len(keys) == 0 {
+				t.handler.p.Success(label + " settings have nothing to tune")
+				return nil
+			}
+			values, byHand, err = t.chooseSettingValues(label, keys, recommender)
+			if err != nil {
+				return err
+			}
+			for _, k := range keys {
+				if _, ok := values[k]; !ok {
+					t.decline(k)
+				}
+			}
+			if len(values) == 0 {
+				if groupRep != nil {
+					groupRep.skip()
+				}
+				t.handler.p.Error("warning", label+" settings left alone, but still need tuning")
+				return nil
+			}
+			t.handler.p.Success(label + " settings will be updated")
+		} else if !quiet {
+			checker := newSkipChecker(errSettingsNeedTuningFmt, label)
+			err := t.promptUntilValidInput(promptOkay+promptSkip, ask(question{name: questionGroups, label: label}, checker))
 			if err == errSkip {
+				doWithVisibile(func(r *tunableParseResult) { t.decline(r.key) })
+				if groupRep != nil {
+					groupRep.skip()
+				}
 				t.handler.p.Error("warning", label+" settings left alone, but still need tuning")
 				return nil
 			} else if err != nil {
@@ -558,18 +988,48 @@ func (t *Tuner) processSettingsGroup(sg pgtune.SettingsGroup, profile pgtune.Pro
 			}
 			t.handler.p.Success(label + " settings will be updated")
 		}
+		if groupRep != nil {
+			groupRep.choose(values, byHand)
+		}
+
+		// Settings made with ALTER SYSTEM override whatever we would write, so
+		// find out what the user wants to do with those
+		shadowed := []*tunableParseResult{}
+		doWithVisibile(func(r *tunableParseResult) {
+			if _, ok := values[r.key]; ok && t.cfs.isAutoConf(r.file) {
+				shadowed = append(shadowed, r)
+			}
+		})
+		autoAction := autoConfWrite
+		if len(shadowed) > 0 {
+			autoAction, err = t.processAutoConfShadowing(label, shadowed)
+			if err != nil {
+				return err
+			}
+		}
 
 		// If we reach here, it means the user accepted our recommendations, so update the lines
 		doWithVisibile(func(r *tunableParseResult) {
-			rec := recommender.Recommend(r.key)
-			if rec == pgtune.NoRecommendation {
+			rec, ok := values[r.key]
+			if !ok {
 				return
 			}
-			newLine := &configLine{content: fmt.Sprintf(fmtTunableParam, r.key, rec, r.extra)} // do write comment into file
+			if byHand[r.key] {
+				t.recordChangeByHand(r.key, rec, toolRecommendation(recommender, r.key))
+			} else {
+				t.recordChange(r.key, rec)
+			}
+			if t.cfs.isAutoConf(r.file) {
+				t.applyAutoConfAction(autoAction, r, rec)
+				return
+			}
+			newLine := fmt.Sprintf(fmtTunableParam, r.key, rec, r.extra) // do write comment into file
 			if r.idx == -1 {
-				t.cfs.lines = append(t.cfs.lines, newLine)
+				t.cfs.lines = append(t.cfs.lines, &configLine{content: newLine})
 			} else {
-				t.cfs.lines[r.idx] = newLine
+				// edit the file the setting was found in, since that is the one
+				// controlling its effective value
+				t.cfs.setLine(r.file, r.idx, newLine)
 			}
 		})
 	} else if !quiet { // nothing to tune
@@ -579,32 +1039,36 @@ func (t *Tuner) processSettingsGroup(sg pgtune.SettingsGroup, profile pgtune.Pro
 	return nil
 }
 
+// printTunableIntro tells the user what resources recommendations are based on,
+// and where those values came from.
+func (t *Tuner) printTunableIntro(config *pgtune.SystemConfig) {
+	t.handler.p.Statement(statementTunableIntro, parse.BytesToDecimalFormat(config.Memory), t.memorySource, config.CPUs, t.cpuSource, config.PGMajorVersion)
+}
+
 // processTunables handles user interactions for updating the conf file when it comes
 // to parameters than be tuned, e.g. memory.
 func (t *Tuner) processTunables(config *pgtune.SystemConfig, profile pgtune.Profile) error {
 	quiet := t.flags.Quiet
 	if !quiet {
-		t.handler.p.Statement(statementTunableIntro, parse.BytesToDecimalFormat(config.Memory), config.CPUs, config.PGMajorVersion)
+		t.printTunableIntro(config)
 	}
-	tunables := []string{
-		pgtune.MemoryLabel,
-		pgtune.ParallelLabel,
-		pgtune.WALLabel,
-		pgtune.BgwriterLabel,
-		pgtune.MiscLabel,
-	}
-
-	for _, label := range tunables {
-		sg := pgtune.GetSettingsGroup(label, config)
+	for _, label := range t.tunedLabels() {
+		sg, err := t.getSettingsGroup(label, config)
+		if err != nil {
+			return err
+		}
 		r := sg.GetRecommender(profile)
 		if !r.IsAvailable() {
 			continue
 		}
-		err := t.processSettingsGroup(sg, profile)
+		err = t.processSettingsGroup(sg, profile)
 		if err != nil {
 			return err
 		}
 	}
+	if t.flags.PerSetting && !quiet {
+		t.printChangeSummary()
+	}
 	return nil
 }
 
@@ -638,14 +1102,14 @@ func (t *Tuner) processOurParams() {
 
 	// For each one we found, replace in place.
 	for param, idx := range foundLines {
-		t.cfs.lines[idx] = &configLine{content: ourParamString(param)}
+		t.cfs.lines[idx] = &configLine{content: ourParamString(param, t.profileName)}
 	}
 
 	// For each one we did NOT find, append to the end. Use our params so they
 	// are always added in the same order (easier to test)
 	for _, param := range ourParams {
 		if _, ok := findRegexes[param]; ok {
-			line := &configLine{content: ourParamString(param)}
+			line := &configLine{content: ourParamString(param, t.profileName)}
 			t.cfs.lines = append(t.cfs.lines, line)
 		}
 	}
@@ -665,7 +1129,7 @@ func (w *counterWriter) Write(p []byte) (int, error) {
 
 // processQuiet handles the iteractions when the user wants "quiet" output.
 func (t *Tuner) processQuiet(config *pgtune.SystemConfig, profile pgtune.Profile) error {
-	t.handler.p.Statement(statementTunableIntro, parse.BytesToDecimalFormat(config.Memory), config.CPUs, config.PGMajorVersion)
+	t.printTunableIntro(config)
 
 	// Replace the print function with a version that counts how many times it
 	// is invoked so we can know whether to prompt the user or not. It doesn't
@@ -677,16 +1141,20 @@ func (t *Tuner) processQuiet(config *pgtune.SystemConfig, profile pgtune.Profile
 	}()
 
 	if t.cfs.sharedLibResult == nil { // shared lib line is missing completely
-		fmt.Fprintf(t.handler.out, plainSharedLibLine+"\n")
-		t.cfs.lines = append(t.cfs.lines, &configLine{content: plainSharedLibLine})
-		t.cfs.sharedLibResult = parseLineForSharedLibResult(plainSharedLibLineWithComments)
+		line := t.missingSharedLibLine()
+		fmt.Fprintf(t.handler.out, line+"\n")
+		t.cfs.lines = append(t.cfs.lines, &configLine{content: line})
+		t.recordChange(sharedLibsKey, t.sharedLibs())
+		t.cfs.sharedLibResult = parseLineForSharedLibResult(line + sharedLibRestartComment)
 		t.cfs.sharedLibResult.idx = len(t.cfs.lines) - 1
 	} else { // exists, but may need to be updated
-		sharedIdx := t.cfs.sharedLibResult.idx
-		newLine := updateSharedLibLine(t.cfs.lines[sharedIdx].content, t.cfs.sharedLibResult)
-		if newLine != t.cfs.lines[sharedIdx].content {
+		res := t.cfs.sharedLibResult
+		lines := t.cfs.fileFor(res.file).lines
+		newLine := updateSharedLibLine(lines[res.idx].content, res, t.extraSharedLibs()...)
+		if newLine != lines[res.idx].content {
 			fmt.Fprintf(t.handler.out, newLine+"\n")
-			t.cfs.lines[sharedIdx] = &configLine{content: newLine}
+			t.cfs.setLine(res.file, res.idx, newLine)
+			t.recordChange(sharedLibsKey, parseLineForSharedLibResult(newLine).libs)
 		}
 	}
 
@@ -697,7 +1165,7 @@ func (t *Tuner) processQuiet(config *pgtune.SystemConfig, profile pgtune.Profile
 	}
 	if newWriter.count > 0 {
 		for _, param := range ourParams {
-			fmt.Fprintf(t.handler.out, ourParamString(param)+"\n")
+			fmt.Fprintf(t.handler.out, ourParamString(param, t.profileName)+"\n")
 		}
 		checker := newYesNoChecker("not using these settings could lead to suboptimal performance")
 		err = t.promptUntilValidInput("Use these recommendations? "+promptYesNo, checker)
@@ -721,17 +1189,45 @@ func (t *Tuner) writeConfFile(confPath string) error {
 		}
 	}
 
+	// included files and postgresql.auto.conf are changed in place, which
+	// --out-path is meant to avoid
+	if absConf, err := filepathAbsFn(confPath); err != nil || absConf != outPath {
+		if incs := t.cfs.modifiedIncludes(); len(incs) > 0 {
+			return fmt.Errorf(errOutPathIncludeFmt, outPath, incs[0].path)
+		}
+	}
+
 	t.handler.p.Statement("Saving changes to: " + outPath)
-	t.handler.p.Statement("Restart PostgreSQL to apply the modified configuration")
-	f, err := osCreateFn(outPath)
+	// when applying, exactly what needs a restart is reported afterwards
+	if t.flags.Apply == "" {
+		t.handler.p.Statement("Restart PostgreSQL to apply the modified configuration")
+	}
+	// only refuse to write over changes made by others to the file we read
+	var snap *fileSnapshot
+	if absPath, err := filepathAbsFn(t.cfs.path); err == nil && absPath == outPath {
+		snap = t.cfs.snapshot
+	}
+	err = t.checkWriteErr(outPath, writeFileAtomicFn(outPath, snap, t.cfs))
 	if err != nil {
 		return fmt.Errorf(errCouldNotWriteFmt, outPath, err)
 	}
-	defer f.Close()
 
-	_, err = t.cfs.WriteTo(f)
+	// Settings found in included files are changed in place there
+	for _, inc := range t.cfs.modifiedIncludes() {
+		err = t.writeIncludedFile(inc)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeIncludedFile writes out an included conf file that had settings changed.
+func (t *Tuner) writeIncludedFile(inc *configFileState) error {
+	t.handler.p.Statement("Saving changes to included file: " + inc.path)
+	err := t.checkWriteErr(inc.path, writeFileAtomicFn(inc.path, inc.snapshot, inc))
 	if err != nil {
-		return fmt.Errorf(errCouldNotWriteFmt, outPath, err)
+		return fmt.Errorf(errCouldNotWriteFmt, inc.path, err)
 	}
 	return nil
 }
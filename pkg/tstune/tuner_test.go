@@ -21,7 +21,7 @@ import (
 )
 
 func newTunerWithDefaultFlags(handler *ioHandler, cfs *configFileState) *Tuner {
-	return &Tuner{handler, cfs, &TunerFlags{}}
+	return &Tuner{handler: handler, cfs: cfs, flags: &TunerFlags{}}
 }
 
 func TestVerifyTunerFlags(t *testing.T) {
@@ -58,7 +58,7 @@ func TestVerifyTunerFlags(t *testing.T) {
 }
 
 func TestTunerInitializeIOHandler(t *testing.T) {
-	tuner := &Tuner{nil, nil, &TunerFlags{}}
+	tuner := &Tuner{flags: &TunerFlags{}}
 	tuner.flags.UseColor = true
 	tuner.initializeIOHandler(os.Stdin, os.Stdout, os.Stderr)
 
@@ -196,7 +196,7 @@ func TestTunerInitializeSystemConfig(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.desc, func(t *testing.T) {
-			tuner := &Tuner{nil, nil, &TunerFlags{
+			tuner := &Tuner{flags: &TunerFlags{
 				PGConfig:     c.flagPGConfig,
 				PGVersion:    c.flagPGVersion,
 				Memory:       c.flagMemory,
@@ -265,18 +265,16 @@ func setupDefaultTestIO(input string) *ioHandler {
 func TestRestore(t *testing.T) {
 	errGlob := "glob error"
 	now := time.Now()
-	baseFile := path.Join(os.TempDir(), backupFilePrefix)
-	time1 := now.Add(-5 * time.Minute).Format(backupDateFmt)
-	time2 := now.Add(-3 * time.Hour).Format(backupDateFmt)
-	correctFile1 := baseFile + time1
-	correctFile2 := baseFile + time2
-	shortFile1 := backupFilePrefix + time1
-	wantPrint1 := fmt.Sprintf(backupListFmt, 1, backupFilePrefix+time1, parse.PrettyDuration(now.Sub(now.Add(-5*time.Minute))))
-	wantPrint2 := fmt.Sprintf(backupListFmt, 2, backupFilePrefix+time2, parse.PrettyDuration(now.Sub(now.Add(-3*time.Hour))))
+	confPath := "/etc/postgresql/16/main/postgresql.conf"
+	shortFile1 := backupName(confPathHash(confPath), now.Add(-5*time.Minute))
+	shortFile2 := backupName(confPathHash(confPath), now.Add(-3*time.Hour))
+	correctFile1 := path.Join(os.TempDir(), shortFile1)
+	correctFile2 := path.Join(os.TempDir(), shortFile2)
+	wantPrint1 := fmt.Sprintf(backupListFmt, 1, shortFile1, parse.PrettyDuration(now.Sub(now.Add(-5*time.Minute))))
+	wantPrint2 := fmt.Sprintf(backupListFmt, 2, shortFile2, parse.PrettyDuration(now.Sub(now.Add(-3*time.Hour))))
 
 	cases := []struct {
 		desc          string
-		filePath      string
 		onDiskFiles   []string
 		input         string
 		statements    uint64
@@ -318,7 +316,7 @@ func TestRestore(t *testing.T) {
 		},
 		{
 			desc:        "two backups wrong order",
-			onDiskFiles: []string{correctFile1, correctFile2},
+			onDiskFiles: []string{correctFile2, correctFile1},
 			input:       "1\n",
 			statements:  2,
 			prompts:     1,
@@ -367,7 +365,7 @@ func TestRestore(t *testing.T) {
 		handler := setupDefaultTestIO(c.input)
 		tuner := newTunerWithDefaultFlags(handler, nil)
 
-		err := tuner.restore(&testRestorer{c.restoreErrMsg}, c.filePath)
+		err := tuner.restore(&testRestorer{c.restoreErrMsg}, os.TempDir(), confPath)
 		if c.errMsg == "" && err != nil {
 			t.Errorf("%s: unexpected error: got %v", c.desc, err)
 		} else if c.errMsg != "" {
@@ -511,6 +509,7 @@ func TestProcessConfFileCheck(t *testing.T) {
 		promptCalls uint64
 		filePath    string
 		flagPath    string
+		check       bool
 		errMsg      string
 	}{
 		{
@@ -539,6 +538,13 @@ func TestProcessConfFileCheck(t *testing.T) {
 			promptCalls: 2,
 			filePath:    "/path/to/postgresql.conf",
 		},
+		{
+			desc:        "success - no prompt when checking",
+			input:       "",
+			promptCalls: 0,
+			filePath:    "/path/to/postgresql.conf",
+			check:       true,
+		},
 		{
 			desc:        "error - said no",
 			input:       "maybe\nno\n",
@@ -558,6 +564,7 @@ func TestProcessConfFileCheck(t *testing.T) {
 	for _, c := range cases {
 		tuner := newTunerWithDefaultFlagsForInputs(t, c.input, []string{})
 		tuner.flags.ConfPath = dirPathToFile(c.flagPath, "postgresql.conf")
+		tuner.flags.Check = c.check
 
 		err := tuner.processConfFileCheck(c.filePath)
 		tp := tuner.handler.p.(*testPrinter)
@@ -974,7 +981,7 @@ func TestCheckIfShouldShowSetting(t *testing.T) {
 			}
 			mr := pgtune.NewMemoryRecommender(8*parse.Gigabyte, 1, 20)
 
-			show, err := checkIfShouldShowSetting(pgtune.MemoryKeys, c.parseResults, mr)
+			show, err := checkIfShouldShowSetting(pgtune.MemoryKeys, c.parseResults, mr, nil)
 			if len(c.errMsg) > 0 {
 
 			} else if err != nil {
@@ -1012,6 +1019,7 @@ func TestCheckIfShouldShowSettingNonNumeric(t *testing.T) {
 			},
 		},
 		mr,
+		nil,
 	)
 
 	if err != nil {
@@ -1033,7 +1041,7 @@ func TestCheckIfShouldShowSettingErr(t *testing.T) {
 	parseResults := map[string]*tunableParseResult{
 		"foo": {value: "5.0"},
 	}
-	show, err := checkIfShouldShowSetting(keys, parseResults, &badRecommender{})
+	show, err := checkIfShouldShowSetting(keys, parseResults, &badRecommender{}, nil)
 	if show != nil {
 		t.Errorf("show map is not nil: %v", show)
 	}
@@ -1105,6 +1113,17 @@ func (sg *testSettingsGroup) GetRecommender(profile pgtune.Profile) pgtune.Recom
 	return &badRecommender{}
 }
 
+// mustGetSettingsGroup returns the SettingsGroup for label, failing the test
+// if the label is unknown.
+func mustGetSettingsGroup(t *testing.T, label string, config *pgtune.SystemConfig) pgtune.SettingsGroup {
+	t.Helper()
+	sg, err := pgtune.GetSettingsGroup(label, config)
+	if err != nil {
+		t.Fatalf("unexpected error getting settings group %s: %v", label, err)
+	}
+	return sg
+}
+
 func getDefaultSystemConfig(t *testing.T) *pgtune.SystemConfig {
 	config, err := pgtune.NewSystemConfig(testMem, testCPUs, pgutils.MajorVersion10, testWALDisk, testMaxConns, testWorkers)
 	if err != nil {
@@ -1150,7 +1169,7 @@ func TestTunerProcessSettingsGroup(t *testing.T) {
 		},
 		{
 			desc:           "memory - commented",
-			ts:             pgtune.GetSettingsGroup(pgtune.MemoryLabel, config),
+			ts:             mustGetSettingsGroup(t, pgtune.MemoryLabel, config),
 			profile:        pgtune.DefaultProfile,
 			lines:          memSettingsCommented,
 			input:          "y\n",
@@ -1162,7 +1181,7 @@ func TestTunerProcessSettingsGroup(t *testing.T) {
 		},
 		{
 			desc:           "memory - wrong",
-			ts:             pgtune.GetSettingsGroup(pgtune.MemoryLabel, config),
+			ts:             mustGetSettingsGroup(t, pgtune.MemoryLabel, config),
 			profile:        pgtune.DefaultProfile,
 			lines:          memSettingsWrongVal,
 			input:          "y\n",
@@ -1174,7 +1193,7 @@ func TestTunerProcessSettingsGroup(t *testing.T) {
 		},
 		{
 			desc:           "memory - missing",
-			ts:             pgtune.GetSettingsGroup(pgtune.MemoryLabel, config),
+			ts:             mustGetSettingsGroup(t, pgtune.MemoryLabel, config),
 			profile:        pgtune.DefaultProfile,
 			lines:          memSettingsMissing,
 			input:          "y\n",
@@ -1187,7 +1206,7 @@ func TestTunerProcessSettingsGroup(t *testing.T) {
 		},
 		{
 			desc:           "memory - comment+wrong",
-			ts:             pgtune.GetSettingsGroup(pgtune.MemoryLabel, config),
+			ts:             mustGetSettingsGroup(t, pgtune.MemoryLabel, config),
 			profile:        pgtune.DefaultProfile,
 			lines:          memSettingsCommentWrong,
 			input:          " \ny\n",
@@ -1199,7 +1218,7 @@ func TestTunerProcessSettingsGroup(t *testing.T) {
 		},
 		{
 			desc:           "memory - comment+wrong promscale",
-			ts:             pgtune.GetSettingsGroup(pgtune.MemoryLabel, config),
+			ts:             mustGetSettingsGroup(t, pgtune.MemoryLabel, config),
 			profile:        pgtune.PromscaleProfile,
 			lines:          memSettingsCommentWrong,
 			input:          " \ny\n",
@@ -1211,7 +1230,7 @@ func TestTunerProcessSettingsGroup(t *testing.T) {
 		},
 		{
 			desc:           "memory - comment+wrong+missing",
-			ts:             pgtune.GetSettingsGroup(pgtune.MemoryLabel, config),
+			ts:             mustGetSettingsGroup(t, pgtune.MemoryLabel, config),
 			profile:        pgtune.DefaultProfile,
 			lines:          memSettingsCommentWrongMissing,
 			input:          " \n \ny\n",
@@ -1224,7 +1243,7 @@ func TestTunerProcessSettingsGroup(t *testing.T) {
 		},
 		{
 			desc:           "memory - all wrong, but skip",
-			ts:             pgtune.GetSettingsGroup(pgtune.MemoryLabel, config),
+			ts:             mustGetSettingsGroup(t, pgtune.MemoryLabel, config),
 			profile:        pgtune.DefaultProfile,
 			lines:          memSettingsAllWrong,
 			input:          "s\n",
@@ -1237,7 +1256,7 @@ func TestTunerProcessSettingsGroup(t *testing.T) {
 		},
 		{
 			desc:           "memory - all wrong, but quit",
-			ts:             pgtune.GetSettingsGroup(pgtune.MemoryLabel, config),
+			ts:             mustGetSettingsGroup(t, pgtune.MemoryLabel, config),
 			profile:        pgtune.DefaultProfile,
 			lines:          memSettingsAllWrong,
 			input:          " \nqUIt\n",
@@ -1249,7 +1268,7 @@ func TestTunerProcessSettingsGroup(t *testing.T) {
 		},
 		{
 			desc:           "memory - all wrong",
-			ts:             pgtune.GetSettingsGroup(pgtune.MemoryLabel, config),
+			ts:             mustGetSettingsGroup(t, pgtune.MemoryLabel, config),
 			profile:        pgtune.DefaultProfile,
 			lines:          memSettingsAllWrong,
 			input:          "y\n",
@@ -1261,7 +1280,7 @@ func TestTunerProcessSettingsGroup(t *testing.T) {
 		},
 		{
 			desc:           "label capitalized",
-			ts:             pgtune.GetSettingsGroup(pgtune.WALLabel, config),
+			ts:             mustGetSettingsGroup(t, pgtune.WALLabel, config),
 			profile:        pgtune.DefaultProfile,
 			input:          "y\n",
 			wantStatements: 3, // intro remark + current label + recommend label
@@ -1273,7 +1292,7 @@ func TestTunerProcessSettingsGroup(t *testing.T) {
 		},
 		{
 			desc:           "wal - checkpoint_timeout promscale",
-			ts:             pgtune.GetSettingsGroup(pgtune.WALLabel, config),
+			ts:             mustGetSettingsGroup(t, pgtune.WALLabel, config),
 			profile:        pgtune.PromscaleProfile,
 			lines:          []string{"checkpoint_timeout = 5m"},
 			input:          "y\n",
@@ -1286,7 +1305,7 @@ func TestTunerProcessSettingsGroup(t *testing.T) {
 		},
 		{
 			desc:           "wal - wal_compression promscale",
-			ts:             pgtune.GetSettingsGroup(pgtune.WALLabel, config),
+			ts:             mustGetSettingsGroup(t, pgtune.WALLabel, config),
 			profile:        pgtune.PromscaleProfile,
 			lines:          []string{"wal_compression = off"},
 			input:          "y\n",
@@ -1299,7 +1318,7 @@ func TestTunerProcessSettingsGroup(t *testing.T) {
 		},
 		{
 			desc:           "bgwriter wrong promscale",
-			ts:             pgtune.GetSettingsGroup(pgtune.BgwriterLabel, config),
+			ts:             mustGetSettingsGroup(t, pgtune.BgwriterLabel, config),
 			profile:        pgtune.PromscaleProfile,
 			lines:          []string{"bgwriter_flush_after = 100"},
 			input:          "y\n",
@@ -1312,7 +1331,7 @@ func TestTunerProcessSettingsGroup(t *testing.T) {
 		},
 		{
 			desc:           "bgwriter correct",
-			ts:             pgtune.GetSettingsGroup(pgtune.BgwriterLabel, config),
+			ts:             mustGetSettingsGroup(t, pgtune.BgwriterLabel, config),
 			profile:        pgtune.PromscaleProfile,
 			lines:          []string{"bgwriter_flush_after = 9"}, // will change to 0
 			input:          "y\n",
@@ -1383,7 +1402,7 @@ func TestTunerProcessTunables(t *testing.T) {
 			t.Errorf("incorrect number of statements: got %d, want %d", got, wantStatements)
 		}
 
-		wantStatement := fmt.Sprintf(statementTunableIntro, parse.BytesToDecimalFormat(config.Memory), config.CPUs, config.PGMajorVersion)
+		wantStatement := fmt.Sprintf(statementTunableIntro, parse.BytesToDecimalFormat(config.Memory), sourceHost, config.CPUs, sourceHost, config.PGMajorVersion)
 		if got := tp.statements[0]; got != wantStatement {
 			t.Errorf("incorrect first statement: got\n%s\nwant\n%s\n", got, wantStatement)
 		}
@@ -1405,21 +1424,23 @@ func TestTunerProcessTunables(t *testing.T) {
 			idx += 3
 		}
 		checkStmt("Memory settings recommendations")
-		if wantGroups > 4 {
+		if wantGroups > 6 {
 			checkStmt("Parallelism settings recommendations")
 		}
 		checkStmt("WAL settings recommendations")
 		checkStmt("Background writer settings recommendations")
 		checkStmt("Miscellaneous settings recommendations")
+		checkStmt("Autovacuum settings recommendations")
+		checkStmt("TimescaleDB settings recommendations")
 	}
-	input := "y\ny\ny\ny\n"
+	input := "y\ny\ny\ny\ny\ny\ny\n"
 
 	config := getDefaultSystemConfig(t)
 	handler := setupDefaultTestIO(input)
 	cfs := &configFileState{tuneParseResults: make(map[string]*tunableParseResult)}
 	tuner := newTunerWithDefaultFlags(handler, cfs)
 	tuner.processTunables(config, pgtune.DefaultProfile)
-	check(tuner.handler, config, 5)
+	check(tuner.handler, config, 7)
 
 	// changes to parallelism settings should not be recommended if only 1 CPU
 	config.CPUs = 1
@@ -1427,14 +1448,14 @@ func TestTunerProcessTunables(t *testing.T) {
 	cfs = &configFileState{tuneParseResults: make(map[string]*tunableParseResult)}
 	tuner = newTunerWithDefaultFlags(handler, cfs)
 	tuner.processTunables(config, pgtune.DefaultProfile)
-	check(tuner.handler, config, 4)
+	check(tuner.handler, config, 6)
 
 	config = getDefaultSystemConfig(t)
 	handler = setupDefaultTestIO(input)
 	cfs = &configFileState{tuneParseResults: make(map[string]*tunableParseResult)}
 	tuner = newTunerWithDefaultFlags(handler, cfs)
 	tuner.processTunables(config, pgtune.PromscaleProfile)
-	check(tuner.handler, config, 5)
+	check(tuner.handler, config, 7)
 
 	// changes to parallelism settings should not be recommended if only 1 CPU
 	config.CPUs = 1
@@ -1442,7 +1463,7 @@ func TestTunerProcessTunables(t *testing.T) {
 	cfs = &configFileState{tuneParseResults: make(map[string]*tunableParseResult)}
 	tuner = newTunerWithDefaultFlags(handler, cfs)
 	tuner.processTunables(config, pgtune.PromscaleProfile)
-	check(tuner.handler, config, 4)
+	check(tuner.handler, config, 6)
 }
 
 var (
@@ -1466,18 +1487,26 @@ var (
 		"random_page_cost = 1.1",
 		"checkpoint_completion_target = 0.9",
 		fmt.Sprintf("max_connections = %d", testMaxConns),
-		"autovacuum_max_workers = 10",
+		"autovacuum_max_workers = 4",
 		"autovacuum_naptime = 10",
 		"max_locks_per_transaction = 128",
 		"effective_io_concurrency = 200",
 		"max_locks_per_transaction = 256",
+		"autovacuum_vacuum_cost_limit = 800",
+		"autovacuum_vacuum_cost_delay = 2ms",
+		"autovacuum_work_mem = 256MB",
+		"autovacuum_vacuum_scale_factor = 0.05",
+		"autovacuum_analyze_scale_factor = 0.02",
+		"timescaledb.max_cached_chunks_per_hypertable = 1024",
+		"timescaledb.max_open_chunks_per_insert = 1024",
 	}
 )
 
 func TestTunerProcessOurParams(t *testing.T) {
 	defaultWantLines := []string{
-		ourParamString(lastTunedParam),
-		ourParamString(lastTunedVersionParam),
+		ourParamString(lastTunedParam, ""),
+		ourParamString(lastTunedVersionParam, ""),
+		ourParamString(lastTunedProfileParam, ""),
 	}
 	cases := []struct {
 		desc      string
@@ -1492,15 +1521,16 @@ func TestTunerProcessOurParams(t *testing.T) {
 		{
 			desc: "one param found",
 			lines: []string{
-				ourParamString(lastTunedParam),
+				ourParamString(lastTunedParam, ""),
 			},
 			wantLines: defaultWantLines,
 		},
 		{
 			desc: "all param found",
 			lines: []string{
-				ourParamString(lastTunedParam),
-				ourParamString(lastTunedVersionParam),
+				ourParamString(lastTunedParam, ""),
+				ourParamString(lastTunedVersionParam, ""),
+				ourParamString(lastTunedProfileParam, ""),
 			},
 			wantLines: defaultWantLines,
 		},
@@ -1508,15 +1538,28 @@ func TestTunerProcessOurParams(t *testing.T) {
 			desc: "all param found, early stop",
 			lines: []string{
 				"not a useful line",
-				ourParamString(lastTunedParam),
-				ourParamString(lastTunedParam), // repeat
-				ourParamString(lastTunedVersionParam),
+				ourParamString(lastTunedParam, ""),
+				ourParamString(lastTunedParam, ""), // repeat
+				ourParamString(lastTunedVersionParam, ""),
+				ourParamString(lastTunedProfileParam, ""),
 			},
 			wantLines: []string{
 				"not a useful line",
-				ourParamString(lastTunedParam),
-				ourParamString(lastTunedParam), // repeat
-				ourParamString(lastTunedVersionParam),
+				ourParamString(lastTunedParam, ""),
+				ourParamString(lastTunedParam, ""), // repeat
+				ourParamString(lastTunedVersionParam, ""),
+				ourParamString(lastTunedProfileParam, ""),
+			},
+		},
+		{
+			desc: "profile changed",
+			lines: []string{
+				ourParamString(lastTunedProfileParam, "promscale"),
+			},
+			wantLines: []string{
+				ourParamString(lastTunedProfileParam, ""),
+				ourParamString(lastTunedParam, ""),
+				ourParamString(lastTunedVersionParam, ""),
 			},
 		},
 	}
@@ -1538,8 +1581,9 @@ func TestTunerProcessOurParams(t *testing.T) {
 }
 
 func TestTunerProcessQuiet(t *testing.T) {
-	lastTuned := removeSecsFromLastTuned(ourParamString(lastTunedParam)) + "\n"
-	lastTunedVersion := ourParamString(lastTunedVersionParam) + "\n"
+	lastTuned := removeSecsFromLastTuned(ourParamString(lastTunedParam, "")) + "\n"
+	lastTunedVersion := ourParamString(lastTunedVersionParam, "") + "\n"
+	lastTunedProfile := ourParamString(lastTunedProfileParam, "") + "\n"
 	cases := []struct {
 		desc          string
 		lines         []string
@@ -1607,10 +1651,10 @@ func TestTunerProcessQuiet(t *testing.T) {
 		// If there are no prints, then our "extra" prints for last_tuned GUCs
 		// are not printed either, so the default is 0. However, if any other
 		// setting is printed, then we add our GUCs too, therefore upping the
-		// wanted prints len by 2.
+		// wanted prints len by 3.
 		wantPrintsLen := 0
 		if len(c.wantedPrints) > 0 {
-			wantPrintsLen = len(c.wantedPrints) + 2
+			wantPrintsLen = len(c.wantedPrints) + 3
 		}
 
 		out := tuner.handler.out.(*testWriter)
@@ -1624,19 +1668,23 @@ func TestTunerProcessQuiet(t *testing.T) {
 			}
 			lastTuneIdx := len(c.wantedPrints)
 			lastTuneVersionIdx := len(c.wantedPrints) + 1
+			lastTuneProfileIdx := len(c.wantedPrints) + 2
 			if got := removeSecsFromLastTuned(out.lines[lastTuneIdx]); got != lastTuned {
 				t.Errorf("%s: lastTuned print is missing/incorrect: got\n%s\nwant\n%s", c.desc, got, lastTuned)
 			}
 			if got := out.lines[lastTuneVersionIdx]; got != lastTunedVersion {
 				t.Errorf("%s: lastTunedVersion print is missing/incorrect: got\n%s\nwant\n%s", c.desc, got, lastTunedVersion)
 			}
+			if got := out.lines[lastTuneProfileIdx]; got != lastTunedProfile {
+				t.Errorf("%s: lastTunedProfile print is missing/incorrect: got\n%s\nwant\n%s", c.desc, got, lastTunedProfile)
+			}
 		}
 
 		tp := tuner.handler.p.(*testPrinter)
 		if got := tp.statementCalls; got != 1 {
 			t.Errorf("%s: incorrect number of statements: got %d want %d", c.desc, got, 1)
 		} else {
-			want := fmt.Sprintf(statementTunableIntro, parse.BytesToDecimalFormat(config.Memory), config.CPUs, config.PGMajorVersion)
+			want := fmt.Sprintf(statementTunableIntro, parse.BytesToDecimalFormat(config.Memory), sourceHost, config.CPUs, sourceHost, config.PGMajorVersion)
 			if got := tp.statements[0]; got != want {
 				t.Errorf("%s: incorrect statement: got\n%s\nwant\n%s", c.desc, got, want)
 			}
@@ -1703,7 +1751,7 @@ func TestTunerWriteConfFile(t *testing.T) {
 		},
 	}
 
-	oldOSCreateFn := osCreateFn
+	oldWriteFileAtomicFn := writeFileAtomicFn
 	oldFilepathAbsFn := filepathAbsFn
 	filepathAbsFn = func(p string) (string, error) {
 		if p == wantPath {
@@ -1715,11 +1763,12 @@ func TestTunerWriteConfFile(t *testing.T) {
 	for _, c := range cases {
 		var buf testBufferCloser
 		buf.shouldErr = c.shouldErrOnWrite
-		osCreateFn = func(p string) (io.WriteCloser, error) {
+		writeFileAtomicFn = func(p string, _ *fileSnapshot, wt io.WriterTo) error {
 			if !fileExists(p) && p != wantPath {
-				return nil, fmt.Errorf(errCreateFmt, p)
+				return fmt.Errorf(errCreateFmt, p)
 			}
-			return &buf, nil
+			_, err := wt.WriteTo(&buf)
+			return err
 		}
 
 		tuner := newTunerWithDefaultFlagsForInputs(t, "", confFileLines)
@@ -1756,5 +1805,107 @@ func TestTunerWriteConfFile(t *testing.T) {
 	}
 
 	filepathAbsFn = oldFilepathAbsFn
-	osCreateFn = oldOSCreateFn
+	writeFileAtomicFn = oldWriteFileAtomicFn
+}
+
+func TestTunerWriteConfFileOutPathIncludes(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := path.Join(dir, "postgresql.conf")
+	incPath := path.Join(dir, "memory.conf")
+	outPath := path.Join(dir, "out.conf")
+	writeTestConfFile(t, incPath, "work_mem = 0kB")
+	cfs, err := getConfigFileStateWithIncludes(stringSliceToBytesReader([]string{"include 'memory.conf'"}), mainPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tuner := newTunerWithDefaultFlags(setupDefaultTestIO(""), cfs)
+	tuner.flags.DestPath = outPath
+	r := cfs.tuneParseResults[pgtune.WorkMemKey]
+	cfs.setLine(r.file, r.idx, "work_mem = 16MB")
+
+	err = tuner.writeConfFile(mainPath)
+	want := fmt.Sprintf(errOutPathIncludeFmt, outPath, incPath)
+	if err == nil || err.Error() != want {
+		t.Errorf("incorrect error: got %v want %s", err, want)
+	}
+	if fileExists(outPath) {
+		t.Errorf("out path unexpectedly written")
+	}
+	checkFileContents(t, "included file", incPath, "work_mem = 0kB\n")
+}
+
+func TestTunerRestoreBackupIncludes(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := path.Join(dir, BackupDirName)
+	confPath := path.Join(dir, "postgresql.conf")
+	incPath := path.Join(dir, "memory.conf")
+	writeTestConfFile(t, confPath, "include 'memory.conf'")
+	writeTestConfFile(t, incPath, "work_mem = 16MB")
+	f, err := os.Open(confPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfs, err := getConfigFileStateWithIncludes(f, confPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	backupPath, err := backup(cfs, backupDir, confPath, "", backupIncludes(cfs)...)
+	if err != nil {
+		t.Fatalf("unexpected error for backup: %v", err)
+	}
+	writeTestConfFile(t, incPath, "work_mem = 1GB")
+
+	tuner := newTunerWithDefaultFlags(setupDefaultTestIO(""), nil)
+	if err := tuner.restoreBackup(&fsRestorer{}, backupDir, backupPath, confPath); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkFileContents(t, "restored included file", incPath, "work_mem = 16MB\n")
+
+	// the undo backup has the included file as it was before the restore
+	files, err := getBackups(backupDir, confPath)
+	if err != nil || len(files) != 2 {
+		t.Fatalf("incorrect backups: got %v (%v)", files, err)
+	}
+	meta, err := readBackupMeta(files[1])
+	if err != nil || meta == nil || len(meta.Includes) != 1 {
+		t.Fatalf("incorrect undo backup metadata: got %v (%v)", meta, err)
+	}
+	checkFileContents(t, "undo included backup", path.Join(backupDir, meta.Includes[0].Name), "work_mem = 1GB\n")
+}
+
+func TestTunerProcessSettingsGroupIncludedFile(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := path.Join(dir, "postgresql.conf")
+	incPath := path.Join(dir, "memory.conf")
+	writeTestConfFile(t, incPath, "work_mem = 0kB")
+	lines := append([]string{"include 'memory.conf'"}, memSettingsCorrect[0], memSettingsCorrect[2], memSettingsCorrect[3])
+
+	cfs, err := getConfigFileStateWithIncludes(stringSliceToBytesReader(lines), mainPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tuner := newTunerWithDefaultFlags(setupDefaultTestIO("y\n"), cfs)
+	tuner.cfs.path = mainPath
+
+	err = tuner.processSettingsGroup(mustGetSettingsGroup(t, pgtune.MemoryLabel, getDefaultSystemConfig(t)), pgtune.DefaultProfile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := tuner.handler.out.(*testWriter)
+	wantCurrent := "work_mem = 0kB" + fmt.Sprintf(fmtSetInFile, incPath+":1") + "\n"
+	if got := out.lines[1]; got != wantCurrent {
+		t.Errorf("incorrect current print: got %q want %q", got, wantCurrent)
+	}
+	if got := len(tuner.cfs.lines); got != len(lines) {
+		t.Errorf("main file lines changed: got %d want %d", got, len(lines))
+	}
+	inc := tuner.cfs.modifiedIncludes()
+	if len(inc) != 1 {
+		t.Fatalf("incorrect number of modified includes: got %d want 1", len(inc))
+	}
+	if got := inc[0].lines[0].content; !strings.HasPrefix(got, pgtune.WorkMemKey+" = ") || got == "work_mem = 0kB" {
+		t.Errorf("included file line not updated: got %s", got)
+	}
 }
@@ -5,6 +5,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/timescale/timescaledb-tune/pkg/pgutils"
 )
@@ -66,6 +67,15 @@ func isCloseEnough(actual, target, fudge float64) bool {
 	return math.Abs((target-actual)/target) <= fudge
 }
 
+// unquoteValue strips a single pair of surrounding single quotes from a
+// conf file value, e.g., 'lz4' -> lz4.
+func unquoteValue(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, "'") && strings.HasSuffix(s, "'") {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
+
 // isIn checks whether a given string s is inside the []string arr.
 func isIn(s string, arr []string) bool {
 	for _, x := range arr {
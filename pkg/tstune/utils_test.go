@@ -87,6 +87,25 @@ func TestDirPathToFile(t *testing.T) {
 	}
 }
 
+func TestUnquoteValue(t *testing.T) {
+	cases := map[string]string{
+		"":         "",
+		"'":        "'",
+		"2GB":      "2GB",
+		"'2GB'":    "2GB",
+		"''":       "",
+		"'it''s'":  "it's",
+		"'partial": "'partial",
+		"partial'": "partial'",
+		"'a b c'":  "a b c",
+	}
+	for in, want := range cases {
+		if got := unquoteValue(in); got != want {
+			t.Errorf("incorrect result for %q: got %q want %q", in, got, want)
+		}
+	}
+}
+
 func TestIsIn(t *testing.T) {
 	limit := 1000
 	arr := []string{}
@@ -0,0 +1,101 @@
+package tstune
+
+import (
+	"path/filepath"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+const (
+	walDirName       = "pg_wal"
+	walDirNameLegacy = "pg_xlog" // name of the WAL directory before PostgreSQL 10
+
+	statementWALDiskFmt       = "WAL directory %s is on a %s filesystem, which max_wal_size is based on"
+	statementWALDiskSharedFmt = "WAL directory %s is on a %s filesystem shared with the data directory, so max_wal_size is based on its %s of free space"
+	errWALDiskDetectFmt       = "could not detect WAL disk size: %v"
+	errWALDiskUnsupportedOS   = "not supported on this OS"
+)
+
+// diskInfo is what we need to know about the filesystem a path is on
+type diskInfo struct {
+	size uint64 // total size of the filesystem in bytes
+	free uint64 // bytes free on the filesystem for unprivileged users
+	dev  uint64 // id of the device holding the filesystem
+}
+
+// allows us to substitute mock versions in tests
+var getDiskInfoFn = getDiskInfo
+
+// walDisk describes where the WAL lives
+type walDisk struct {
+	path   string // resolved path of the WAL directory
+	size   uint64 // total size of the filesystem the WAL is on
+	free   uint64 // bytes free on the filesystem the WAL is on
+	shared bool   // whether the data directory is on the same filesystem
+}
+
+// getWALDir returns the path of the WAL directory inside dataDir for the
+// given major version of PostgreSQL.
+func getWALDir(dataDir, pgMajorVersion string) string {
+	if pgMajorVersion == pgutils.MajorVersion96 {
+		return filepath.Join(dataDir, walDirNameLegacy)
+	}
+	return filepath.Join(dataDir, walDirName)
+}
+
+// detectWALDisk finds the filesystem that the WAL directory of dataDir is on.
+// The WAL directory is often a symlink to a dedicated disk, so it is followed
+// before looking at the filesystem.
+func detectWALDisk(dataDir, pgMajorVersion string) (*walDisk, error) {
+	walPath, err := filepath.EvalSymlinks(getWALDir(dataDir, pgMajorVersion))
+	if err != nil {
+		return nil, err
+	}
+	walInfo, err := getDiskInfoFn(walPath)
+	if err != nil {
+		return nil, err
+	}
+	dataInfo, err := getDiskInfoFn(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	return &walDisk{
+		path:   walPath,
+		size:   walInfo.size,
+		free:   walInfo.free,
+		shared: walInfo.dev == dataInfo.dev,
+	}, nil
+}
+
+// processWALDisk fills in the WAL disk size of config by looking at the
+// filesystem the WAL is on, unless it was given by a flag. The data directory
+// is needed for that, so this can only be done once the conf file is read.
+// When the data directory is on the same filesystem, the data and whatever
+// else is there already take up part of it, so only the free space counts,
+// and the recommendations take the same share of it as of a dedicated disk.
+func (t *Tuner) processWALDisk(config *pgtune.SystemConfig, confPath string) {
+	if t.flags.WALDiskSize != "" {
+		return
+	}
+	dataDir := getDataDirectory(t.cfs, confPath)
+	if dataDir == "" {
+		return
+	}
+	disk, err := detectWALDisk(dataDir, config.PGMajorVersion)
+	if err != nil {
+		t.handler.p.Error("warning", errWALDiskDetectFmt, err)
+		return
+	}
+
+	config.WALDiskShared = disk.shared
+	config.WALDiskDetected = true
+	if disk.shared {
+		config.WALDiskSize = disk.free
+		t.handler.p.Statement(statementWALDiskSharedFmt, disk.path, parse.BytesToDecimalFormat(disk.size), parse.BytesToDecimalFormat(disk.free))
+	} else {
+		config.WALDiskSize = disk.size
+		t.handler.p.Statement(statementWALDiskFmt, disk.path, parse.BytesToDecimalFormat(disk.size))
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd)
+
+package tstune
+
+import "fmt"
+
+// getDiskInfo is not supported on this OS, so WAL disk size needs to be given
+// with a flag.
+func getDiskInfo(path string) (*diskInfo, error) {
+	return nil, fmt.Errorf(errWALDiskUnsupportedOS)
+}
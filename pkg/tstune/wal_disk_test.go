@@ -0,0 +1,190 @@
+package tstune
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/timescale/timescaledb-tune/internal/parse"
+	"github.com/timescale/timescaledb-tune/pkg/pgtune"
+	"github.com/timescale/timescaledb-tune/pkg/pgutils"
+)
+
+func TestGetWALDir(t *testing.T) {
+	if got, want := getWALDir("/data", pgutils.MajorVersion96), "/data/pg_xlog"; got != want {
+		t.Errorf("incorrect 9.6 dir: got %s want %s", got, want)
+	}
+	if got, want := getWALDir("/data", pgutils.MajorVersion12), "/data/pg_wal"; got != want {
+		t.Errorf("incorrect 12 dir: got %s want %s", got, want)
+	}
+}
+
+func TestGetDiskInfo(t *testing.T) {
+	info, err := getDiskInfo(t.TempDir())
+	if err != nil {
+		t.Skipf("disk info not available: %v", err)
+	}
+	if info.size == 0 {
+		t.Errorf("unexpected zero size")
+	}
+	if info.free > info.size {
+		t.Errorf("more free than total: got %d free of %d", info.free, info.size)
+	}
+	if _, err = getDiskInfo(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("unexpected lack of error for missing path")
+	}
+}
+
+// setupWALDiskTest creates a data directory whose WAL directory is a symlink
+// to another directory, and mocks out getDiskInfoFn to report each of them
+// as being on the given devices.
+func setupWALDiskTest(t *testing.T, dataDev, walDev uint64) (string, string) {
+	dataDir := t.TempDir()
+	walDir := t.TempDir()
+	if err := os.Symlink(walDir, filepath.Join(dataDir, walDirName)); err != nil {
+		t.Fatalf("could not create symlink: %v", err)
+	}
+	walDir, err := filepath.EvalSymlinks(walDir)
+	if err != nil {
+		t.Fatalf("could not resolve wal dir: %v", err)
+	}
+
+	oldGetDiskInfoFn := getDiskInfoFn
+	t.Cleanup(func() { getDiskInfoFn = oldGetDiskInfoFn })
+	getDiskInfoFn = func(path string) (*diskInfo, error) {
+		switch path {
+		case walDir:
+			return &diskInfo{size: 100 * parse.Gigabyte, free: 40 * parse.Gigabyte, dev: walDev}, nil
+		case dataDir:
+			return &diskInfo{size: 500 * parse.Gigabyte, free: 300 * parse.Gigabyte, dev: dataDev}, nil
+		}
+		return nil, fmt.Errorf("unknown path: %s", path)
+	}
+	return dataDir, walDir
+}
+
+func TestDetectWALDisk(t *testing.T) {
+	dataDir, walDir := setupWALDiskTest(t, 1, 2)
+	disk, err := detectWALDisk(dataDir, pgutils.MajorVersion12)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := walDisk{path: walDir, size: 100 * parse.Gigabyte, free: 40 * parse.Gigabyte, shared: false}
+	if *disk != want {
+		t.Errorf("incorrect disk: got %+v want %+v", *disk, want)
+	}
+
+	dataDir, _ = setupWALDiskTest(t, 1, 1)
+	disk, err = detectWALDisk(dataDir, pgutils.MajorVersion12)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !disk.shared {
+		t.Errorf("disk unexpectedly not shared")
+	}
+
+	// 9.6 uses pg_xlog, which does not exist here
+	if _, err = detectWALDisk(dataDir, pgutils.MajorVersion96); err == nil {
+		t.Errorf("unexpected lack of error for missing WAL dir")
+	}
+}
+
+func TestTunerProcessWALDisk(t *testing.T) {
+	dataDir, walDir := setupWALDiskTest(t, 1, 1)
+	confPath := filepath.Join(dataDir, "postgresql.conf")
+	writeTestConfFile(t, filepath.Join(dataDir, pgVersionFileName), pgutils.MajorVersion12)
+
+	cases := []struct {
+		desc           string
+		flagWALDisk    string
+		confPath       string
+		pgVersion      string
+		wantSize       uint64
+		wantShared     bool
+		wantStatements uint64
+		wantErrors     uint64
+	}{
+		{
+			desc:        "flag overrides",
+			flagWALDisk: "10GB",
+			confPath:    confPath,
+			pgVersion:   pgutils.MajorVersion12,
+		},
+		{
+			desc:      "no data directory",
+			confPath:  filepath.Join(t.TempDir(), "postgresql.conf"),
+			pgVersion: pgutils.MajorVersion12,
+		},
+		{
+			desc:       "detect error",
+			confPath:   confPath,
+			pgVersion:  pgutils.MajorVersion96,
+			wantErrors: 1,
+		},
+		{
+			desc:           "detected, only free space when shared",
+			confPath:       confPath,
+			pgVersion:      pgutils.MajorVersion12,
+			wantSize:       40 * parse.Gigabyte,
+			wantShared:     true,
+			wantStatements: 1,
+		},
+	}
+
+	oldPGData := os.Getenv("PGDATA")
+	os.Unsetenv("PGDATA")
+	defer os.Setenv("PGDATA", oldPGData)
+
+	for _, c := range cases {
+		cfs, err := getConfigFileState(stringSliceToBytesReader([]string{}))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.desc, err)
+		}
+		tuner := newTunerWithDefaultFlags(setupDefaultTestIO(""), cfs)
+		tuner.flags.WALDiskSize = c.flagWALDisk
+		config := &pgtune.SystemConfig{PGMajorVersion: c.pgVersion}
+
+		tuner.processWALDisk(config, c.confPath)
+		if got := config.WALDiskSize; got != c.wantSize {
+			t.Errorf("%s: incorrect size: got %d want %d", c.desc, got, c.wantSize)
+		}
+		if got := config.WALDiskShared; got != c.wantShared {
+			t.Errorf("%s: incorrect shared: got %v want %v", c.desc, got, c.wantShared)
+		}
+		if got, want := config.WALDiskDetected, c.wantSize != 0; got != want {
+			t.Errorf("%s: incorrect detected: got %v want %v", c.desc, got, want)
+		}
+		tp := tuner.handler.p.(*testPrinter)
+		if got := tp.statementCalls; got != c.wantStatements {
+			t.Errorf("%s: incorrect number of statements: got %d want %d", c.desc, got, c.wantStatements)
+		} else if c.wantStatements > 0 {
+			want := fmt.Sprintf(statementWALDiskSharedFmt, walDir, parse.BytesToDecimalFormat(100*parse.Gigabyte), parse.BytesToDecimalFormat(c.wantSize))
+			if got := tp.statements[0]; got != want {
+				t.Errorf("%s: incorrect statement: got %s want %s", c.desc, got, want)
+			}
+		}
+		if got := tp.errorCalls; got != c.wantErrors {
+			t.Errorf("%s: incorrect number of errors: got %d want %d", c.desc, got, c.wantErrors)
+		}
+	}
+
+	// a dedicated WAL disk counts in full
+	dataDir, walDir = setupWALDiskTest(t, 1, 2)
+	cfs, err := getConfigFileState(stringSliceToBytesReader([]string{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tuner := newTunerWithDefaultFlags(setupDefaultTestIO(""), cfs)
+	config := &pgtune.SystemConfig{PGMajorVersion: pgutils.MajorVersion12}
+	writeTestConfFile(t, filepath.Join(dataDir, pgVersionFileName), pgutils.MajorVersion12)
+	tuner.processWALDisk(config, filepath.Join(dataDir, "postgresql.conf"))
+	if got, want := config.WALDiskSize, uint64(100*parse.Gigabyte); got != want || config.WALDiskShared {
+		t.Errorf("dedicated: incorrect size or shared: got %d %v want %d false", got, config.WALDiskShared, want)
+	}
+	tp := tuner.handler.p.(*testPrinter)
+	want := fmt.Sprintf(statementWALDiskFmt, walDir, parse.BytesToDecimalFormat(100*parse.Gigabyte))
+	if tp.statementCalls != 1 || tp.statements[0] != want {
+		t.Errorf("dedicated: incorrect statements: got %v want %s", tp.statements, want)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd
+
+package tstune
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// getDiskInfo returns the size and device of the filesystem that path is on.
+func getDiskInfo(path string) (*diskInfo, error) {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(path, &fs); err != nil {
+		return nil, err
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return nil, err
+	}
+	return &diskInfo{
+		size: uint64(fs.Blocks) * uint64(fs.Bsize),
+		free: uint64(fs.Bavail) * uint64(fs.Bsize),
+		dev:  uint64(st.Dev),
+	}, nil
+}